@@ -15,17 +15,32 @@ import (
 
 var logger = log.Logger("api")
 
+// default amount of requests that can be in flight at the same time
+const DefaultMaxConcurrentRequests = 50
+
+// time we wait for a free request slot
+var requestSlotWait = time.Second
+
+var ErrAPIBusy = errors.New("too many requests in flight")
+
 type UpStream interface {
 	Send(data string)
 }
 
 // Create new api with given client
 func New(client UpStream) *API {
+	return NewWithMaxConcurrentRequests(client, DefaultMaxConcurrentRequests)
+}
+
+// Create new api that allows at most maxRequests
+// requests to be in flight at the same time
+func NewWithMaxConcurrentRequests(client UpStream, maxRequests uint) *API {
 
 	a := &API{
-		lock:     sync.Mutex{},
-		requests: map[string]chan *Response{},
-		client:   client,
+		lock:      sync.Mutex{},
+		requests:  map[string]chan *Response{},
+		client:    client,
+		semaphore: make(chan struct{}, maxRequests),
 	}
 
 	a.dAppApi = DAppApi{
@@ -41,6 +56,8 @@ type API struct {
 	lock     sync.Mutex
 	requests map[string]chan *Response
 	client   UpStream
+	// bounds the amount of in flight requests
+	semaphore chan struct{}
 }
 
 // This represent an api response
@@ -114,6 +131,16 @@ func (a *API) cutRequest(id string) (chan *Response, error) {
 // send a request to the client
 func (a *API) request(req *pb.Request, timeOut time.Duration) (*Response, error) {
 
+	// acquire request slot
+	select {
+	case a.semaphore <- struct{}{}:
+		defer func() {
+			<-a.semaphore
+		}()
+	case <-time.After(requestSlotWait):
+		return nil, ErrAPIBusy
+	}
+
 	// create request ID
 	requestId, err := uuid.NewV4()
 	if err != nil {
@@ -84,3 +84,34 @@ func TestRequestResponse(t *testing.T) {
 	require.Nil(t, err)
 
 }
+
+func TestRequestBusy(t *testing.T) {
+
+	requestSlotWait = time.Millisecond * 10
+	defer func() {
+		requestSlotWait = time.Second
+	}()
+
+	sent := make(chan struct{}, 2)
+
+	// api with only one request slot
+	api := NewWithMaxConcurrentRequests(&testUpStream{
+		sendFn: func(data string) {
+			sent <- struct{}{}
+		},
+	}, 1)
+
+	// first request occupies the slot until it times out
+	go api.request(&pb.Request{}, time.Millisecond*200)
+	<-sent
+
+	_, err := api.request(&pb.Request{}, time.Second)
+	require.Equal(t, ErrAPIBusy, err)
+
+	// slot is released after the timeout
+	time.Sleep(time.Millisecond * 250)
+	_, err = api.request(&pb.Request{}, time.Millisecond*10)
+	require.Error(t, err)
+	require.NotEqual(t, ErrAPIBusy, err)
+
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	pb "github.com/Bit-Nation/panthalassa/api/pb"
+	proto "github.com/golang/protobuf/proto"
+	uuid "github.com/satori/go.uuid"
+)
+
+// send a set of requests with one call to the client.
+// The requests are sent as a json array of base64 encoded
+// requests. The returned channel receives the responses in the order
+// of the requests once all of them responded or timed out.
+// Every response must be closed by the caller.
+func (a *API) SendBatch(reqs []*pb.Request, timeOut time.Duration) (<-chan []*Response, error) {
+
+	if len(reqs) == 0 {
+		return nil, errors.New("a batch must contain at least one request")
+	}
+
+	// a batch is one call to the client so it takes one request slot
+	select {
+	case a.semaphore <- struct{}{}:
+	case <-time.After(requestSlotWait):
+		return nil, ErrAPIBusy
+	}
+	release := func() {
+		<-a.semaphore
+	}
+
+	reqChans := make([]<-chan *Response, len(reqs))
+	rawReqs := make([]string, len(reqs))
+	for i, req := range reqs {
+
+		requestId, err := uuid.NewV4()
+		if err != nil {
+			a.cutBatch(reqs[:i])
+			release()
+			return nil, err
+		}
+		req.RequestID = requestId.String()
+
+		rawReq, err := proto.Marshal(req)
+		if err != nil {
+			a.cutBatch(reqs[:i])
+			release()
+			return nil, err
+		}
+
+		reqChans[i] = a.addRequest(req)
+		rawReqs[i] = base64.StdEncoding.EncodeToString(rawReq)
+
+	}
+
+	rawBatch, err := json.Marshal(rawReqs)
+	if err != nil {
+		a.cutBatch(reqs)
+		release()
+		return nil, err
+	}
+	go a.client.Send(string(rawBatch))
+
+	batchResp := make(chan []*Response, 1)
+	go func() {
+		defer release()
+		responses := make([]*Response, len(reqs))
+		timeout := time.After(timeOut)
+		timedOut := false
+		for i, reqChan := range reqChans {
+			if !timedOut {
+				select {
+				case res := <-reqChan:
+					responses[i] = res
+					continue
+				case <-timeout:
+					timedOut = true
+				}
+			}
+			// the request is being answered if we can't cut it anymore
+			if _, err := a.cutRequest(reqs[i].RequestID); err != nil {
+				responses[i] = <-reqChan
+				continue
+			}
+			responses[i] = &Response{
+				Error:  fmt.Errorf("request timeout for ID: %s", reqs[i].RequestID),
+				Closer: make(chan error, 1),
+			}
+		}
+		batchResp <- responses
+	}()
+
+	return batchResp, nil
+
+}
+
+// remove the requests of a batch from the stack
+func (a *API) cutBatch(reqs []*pb.Request) {
+	for _, req := range reqs {
+		if _, err := a.cutRequest(req.RequestID); err != nil {
+			logger.Error(err)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	pb "github.com/Bit-Nation/panthalassa/api/pb"
+	proto "github.com/golang/protobuf/proto"
+	require "github.com/stretchr/testify/require"
+)
+
+type batchUpStream struct {
+	sendFn func(data string)
+}
+
+func (u *batchUpStream) Send(data string) {
+	u.sendFn(data)
+}
+
+func TestAPI_SendBatch(t *testing.T) {
+
+	dataChan := make(chan string, 1)
+	api := New(&batchUpStream{
+		sendFn: func(data string) {
+			dataChan <- data
+		},
+	})
+
+	respChan, err := api.SendBatch([]*pb.Request{
+		&pb.Request{},
+		&pb.Request{},
+		&pb.Request{},
+	}, time.Second)
+	require.Nil(t, err)
+
+	// all requests are sent with one call
+	var rawReqs []string
+	require.Nil(t, json.Unmarshal([]byte(<-dataChan), &rawReqs))
+	require.Equal(t, 3, len(rawReqs))
+
+	var ids []string
+	for _, rawReq := range rawReqs {
+		protoReq, err := base64.StdEncoding.DecodeString(rawReq)
+		require.Nil(t, err)
+		req := &pb.Request{}
+		require.Nil(t, proto.Unmarshal(protoReq, req))
+		ids = append(ids, req.RequestID)
+	}
+
+	// respond in reverse order, the last request doesn't respond
+	go func() {
+		for i := 1; i >= 0; i-- {
+			resp := &pb.Response{
+				SendEthereumTransaction: &pb.Response_SendEthereumTransaction{GasPrice: ids[i]},
+			}
+			if err := api.Respond(ids[i], resp, nil, time.Second); err != nil {
+				panic(err)
+			}
+		}
+	}()
+	go func() {
+		for _, res := range <-respChan {
+			res.Closer <- nil
+			dataChan <- res.Msg.GetSendEthereumTransaction().GetGasPrice()
+		}
+	}()
+
+	// responses are in the order of the requests
+	require.Equal(t, ids[0], <-dataChan)
+	require.Equal(t, ids[1], <-dataChan)
+	require.Equal(t, "", <-dataChan)
+
+	// timed out requests are removed from the stack
+	require.Equal(t, 0, len(api.requests))
+
+}
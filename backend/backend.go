@@ -5,11 +5,13 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	prekey "github.com/Bit-Nation/panthalassa/chat/prekey"
 	db "github.com/Bit-Nation/panthalassa/db"
 	km "github.com/Bit-Nation/panthalassa/keyManager"
+	uiapi "github.com/Bit-Nation/panthalassa/uiapi"
 	bpb "github.com/Bit-Nation/protobuffers"
 	x3dh "github.com/Bit-Nation/x3dh"
 	log "github.com/ipfs/go-log"
@@ -17,6 +19,8 @@ import (
 
 var logger = log.Logger("backend")
 
+var ErrAuthFailed = errors.New("failed to authenticate with the backend")
+
 // IMPORTANT - the returned error will be send to the backend.
 // Make sure it only return an error message that doesn't
 // have private information
@@ -25,18 +29,64 @@ type RequestHandler func(req *bpb.BackendMessage_Request) (*bpb.BackendMessage_R
 type ServerConfig struct {
 	WebSocketUrl string
 	BearerToken  string
+	// headers added to the websocket handshake
+	// e.g. "X-Device-ID" (the identity public key) and
+	// "X-App-Version" to identify the device and app
+	ExtraHeaders map[string]string
+	// bounds of the exponential backoff between reconnect
+	// attempts - default to one second and one minute
+	ReconnectMinInterval time.Duration
+	ReconnectMaxInterval time.Duration
+	// optional, called for a new bearer token once the
+	// backend rejected the current one while connecting
+	RefreshBearerToken func() (string, error)
+}
+
+type BackendStats struct {
+	PendingRequests int       `json:"pending_requests"`
+	QueueDepth      int       `json:"queue_depth"`
+	Authenticated   bool      `json:"authenticated"`
+	TotalSent       uint64    `json:"total_sent"`
+	TotalReceived   uint64    `json:"total_received"`
+	LastConnectedAt time.Time `json:"last_connected_at"`
 }
 
 type Backend struct {
+	// the 64 bit counters are accessed atomically and must
+	// stay at the top of the struct to be aligned on 32 bit platforms
+	totalSent     uint64
+	totalReceived uint64
+	// unix nano of the last time we saw the connection alive
+	lastConnectedAt int64
+	// sequence number of the last request handed to the transport
+	seqNum    uint64
 	transport Transport
 	// all outgoing requests
-	outReqQueue         chan *request
+	outReqQueue chan *request
+	// requests ordered by their sequence number
+	sendQueue           chan *request
 	stack               requestStack
 	km                  *km.KeyManager
 	closer              chan struct{}
 	addReqHandler       chan RequestHandler
 	reqHandlers         chan chan []RequestHandler
 	signedPreKeyStorage db.SignedPreKeyStorage
+	// optional cache of fetched pre key bundles
+	profileCache    db.ProfileCache
+	profileCacheTTL time.Duration
+	uiApi           *uiapi.Api
+	// overrides the timeout of each request if != 0
+	requestTimeout time.Duration
+	authTimeout    time.Duration
+	// handlers the state starts with
+	initialReqHandlers []RequestHandler
+	// only used for reporting
+	endpoint  string
+	lastError atomic.Value
+	// 1 if we are authenticated with the backend
+	authenticated int32
+	// outgoing requests are only send while authenticated
+	authChanged chan bool
 }
 
 // Add request handler that will be executed
@@ -44,8 +94,103 @@ func (b *Backend) AddRequestHandler(handler RequestHandler) {
 	b.addReqHandler <- handler
 }
 
+// report if the backend transport is connected
+func (b *Backend) Connected() bool {
+	return b.transport.Connected()
+}
+
+// report if we are authenticated with the backend
+func (b *Backend) Authenticated() bool {
+	return atomic.LoadInt32(&b.authenticated) == 1
+}
+
+// count a message that was sent to the backend
+func (b *Backend) sent() {
+	atomic.AddUint64(&b.totalSent, 1)
+	atomic.StoreInt64(&b.lastConnectedAt, time.Now().UnixNano())
+}
+
+// count a message that was received from the backend
+func (b *Backend) received() {
+	atomic.AddUint64(&b.totalReceived, 1)
+	atomic.StoreInt64(&b.lastConnectedAt, time.Now().UnixNano())
+}
+
+// amount of requests waiting for a response
+func (b *Backend) PendingRequests() int {
+	return b.stack.Len()
+}
+
+// snapshot of the backend metrics
+func (b *Backend) Stats() BackendStats {
+	stats := BackendStats{
+		PendingRequests: b.PendingRequests(),
+		QueueDepth:      len(b.outReqQueue),
+		Authenticated:   b.Authenticated(),
+		TotalSent:       atomic.LoadUint64(&b.totalSent),
+		TotalReceived:   atomic.LoadUint64(&b.totalReceived),
+	}
+	if lastConnectedAt := atomic.LoadInt64(&b.lastConnectedAt); lastConnectedAt != 0 {
+		stats.LastConnectedAt = time.Unix(0, lastConnectedAt)
+	}
+	return stats
+}
+
+func (b *Backend) setAuthenticated(authenticated bool) {
+	var state int32
+	if authenticated {
+		state = 1
+	}
+	atomic.StoreInt32(&b.authenticated, state)
+	// the sender reads the latest state - so we don't
+	// need to wait if a change is already pending
+	select {
+	case b.authChanged <- authenticated:
+	default:
+	}
+	if b.uiApi != nil {
+		err := b.uiApi.Dispatch(uiapi.BackendStatusEvent{
+			Connected:     b.transport.Connected(),
+			Authenticated: authenticated,
+		})
+		if err != nil {
+			logger.Error(err)
+		}
+	}
+}
+
+// update the bearer token used to authenticate with the backend
+// outgoing requests are halted when the re authentication fails
+func (b *Backend) UpdateAuthToken(newToken string) error {
+
+	// wait till the transport connected with the new token
+	// the old connection doesn't tell us anything about it
+	result := make(chan error, 1)
+	go func() {
+		result <- b.transport.UpdateBearerToken(newToken)
+	}()
+
+	select {
+	case err := <-result:
+		if err == nil {
+			b.setAuthenticated(true)
+			return nil
+		}
+		logger.Error(err)
+	case <-time.After(b.authTimeout):
+	}
+
+	b.setAuthenticated(false)
+	if b.uiApi != nil {
+		b.uiApi.Send("BACKEND:AUTH_FAILED", map[string]interface{}{})
+	}
+	return ErrAuthFailed
+
+}
+
 func (b *Backend) Close() error {
-	b.closer <- struct{}{}
+	// all goroutines of the backend listen on the closer
+	close(b.closer)
 	err := b.transport.Close()
 	if err != nil {
 		return err
@@ -55,26 +200,47 @@ func (b *Backend) Close() error {
 	return nil
 }
 
-func NewBackend(trans Transport, km *km.KeyManager, signedPreKeyStorage db.SignedPreKeyStorage) (*Backend, error) {
+// create a backend for the private chat server used by the mobile app
+func NewServerBackend(trans Transport, km *km.KeyManager, signedPreKeyStorage db.SignedPreKeyStorage, uiApi *uiapi.Api, opts ...BackendOption) (*Backend, error) {
+	return NewBackend(trans, km, signedPreKeyStorage, append([]BackendOption{WithUiApi(uiApi)}, opts...)...)
+}
+
+func NewBackend(trans Transport, km *km.KeyManager, signedPreKeyStorage db.SignedPreKeyStorage, opts ...BackendOption) (*Backend, error) {
 
 	b := &Backend{
 		transport:   trans,
-		outReqQueue: make(chan *request, 150),
+		outReqQueue: make(chan *request, defaultMaxQueueSize),
 		stack: requestStack{
-			stack: map[string]chan *response{},
-			lock:  sync.Mutex{},
+			stack:   map[string]chan *response{},
+			lock:    sync.Mutex{},
+			maxSize: defaultMaxStackSize,
 		},
 		km:                  km,
-		closer:              make(chan struct{}, 1),
+		closer:              make(chan struct{}),
 		addReqHandler:       make(chan RequestHandler),
 		reqHandlers:         make(chan chan []RequestHandler),
 		signedPreKeyStorage: signedPreKeyStorage,
+		authTimeout:         defaultAuthTimeout,
+		authenticated:       1,
+		authChanged:         make(chan bool, 1),
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	b.sendQueue = make(chan *request, cap(b.outReqQueue))
+
+	// queued requests wait till we are connected
+	// and authenticated again
+	if notifier, ok := trans.(ConnectionNotifier); ok {
+		notifier.OnConnectionChange(b.setAuthenticated)
 	}
 
 	// backend state
 	go func() {
 
-		reqHandlers := []RequestHandler{}
+		reqHandlers := append([]RequestHandler{}, b.initialReqHandlers...)
 
 		for {
 			select {
@@ -110,21 +276,7 @@ func NewBackend(trans Transport, km *km.KeyManager, signedPreKeyStorage db.Signe
 			logger.Error(err)
 			return
 		}
-		if err := signedPreKey.Sign(*b.km); err != nil {
-			logger.Error(err)
-			return
-		}
-		protoSignedPreKey, err := signedPreKey.ToProtobuf()
-		if err != nil {
-			logger.Error(err)
-			return
-		}
-
-		_, err = b.request(bpb.BackendMessage_Request{
-			NewSignedPreKey: &protoSignedPreKey,
-		}, time.Second*10)
-
-		if err != nil {
+		if err := b.UploadSignedPreKey(signedPreKey); err != nil {
 			logger.Error(err)
 			return
 		}
@@ -143,8 +295,10 @@ func NewBackend(trans Transport, km *km.KeyManager, signedPreKeyStorage db.Signe
 			msg, err := trans.NextMessage()
 			if err != nil {
 				logger.Error(err)
+				b.setLastError(err)
 				continue
 			}
+			b.received()
 
 			// make sure we don't get a response & a request at the same time
 			// we don't accept it. It's invalid!
@@ -184,8 +338,10 @@ func NewBackend(trans Transport, km *km.KeyManager, signedPreKeyStorage db.Signe
 					requestHandled = true
 					if err != nil {
 						logger.Error(err)
+						b.setLastError(err)
 						continue
 					}
+					b.sent()
 
 				}
 
@@ -230,26 +386,67 @@ func NewBackend(trans Transport, km *km.KeyManager, signedPreKeyStorage db.Signe
 
 	// send outgoing requests to transport
 	go func() {
+		authenticated := true
 		for {
+			// a nil channel blocks, so we stop draining
+			// while we are not authenticated
+			outReqQueue := b.outReqQueue
+			if !authenticated {
+				outReqQueue = nil
+			}
 			select {
 			case <-b.closer:
 				return
-			case req := <-b.outReqQueue:
+			case <-b.authChanged:
+				authenticated = b.Authenticated()
+			case req := <-outReqQueue:
 				// add response channel
-				b.stack.Add(req.ReqID, req.RespChan)
-				// send request
-				go func() {
-					err := b.transport.Send(&bpb.BackendMessage{
-						RequestID: req.ReqID,
-						Request:   req.Req,
-					})
-					// close response channel on error
-					if err != nil {
+				// back off while too many requests wait for a response
+				for b.stack.Add(req.ReqID, req.RespChan) == ErrRequestStackFull {
+					logger.Warning("request stack is full - retrying in one second")
+					select {
+					case <-b.closer:
+						return
+					case <-time.After(time.Second):
+					}
+				}
+				// hand the request over to the sender
+				req.SeqNum = atomic.AddUint64(&b.seqNum, 1)
+				select {
+				case <-b.closer:
+					return
+				case b.sendQueue <- req:
+				}
+			}
+		}
+	}()
+
+	// hand requests to the transport one after each other in
+	// sequence number order. The sequence number is not sent to
+	// the server and there is no reorder buffer on the receiving side.
+	go func() {
+		for {
+			select {
+			case <-b.closer:
+				return
+			case req := <-b.sendQueue:
+				logger.Debugf("sending request %s with sequence number %d", req.ReqID, req.SeqNum)
+				err := b.transport.Send(&bpb.BackendMessage{
+					RequestID: req.ReqID,
+					Request:   req.Req,
+				})
+				// close response channel on error - the requester
+				// might be gone already so we must not block the sender
+				if err != nil {
+					b.setLastError(err)
+					go func(req *request) {
 						req.RespChan <- &response{
 							err: err,
 						}
-					}
-				}()
+					}(req)
+					continue
+				}
+				b.sent()
 			}
 		}
 	}()
@@ -0,0 +1,364 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	bpb "github.com/Bit-Nation/protobuffers"
+	x3dh "github.com/Bit-Nation/x3dh"
+	require "github.com/stretchr/testify/require"
+)
+
+func TestBackend_UpdateAuthToken(t *testing.T) {
+
+	transport := testTransport{
+		nextMessage: func() (*bpb.BackendMessage, error) {
+			select {}
+		},
+		// the old connection is still up while we re authenticate
+		connected: func() bool {
+			return true
+		},
+		updateBearerToken: func(token string) error {
+			switch token {
+			case "expired":
+				return ErrAuthFailed
+			case "slow":
+				time.Sleep(time.Second)
+			}
+			return nil
+		},
+	}
+
+	b, err := NewBackend(&transport, nil, &testSignedPreKeyStore{
+		all: func() []*x3dh.KeyPair {
+			return []*x3dh.KeyPair{&x3dh.KeyPair{}}
+		},
+	}, WithAuthTimeout(time.Millisecond*200))
+	require.Nil(t, err)
+	require.True(t, b.Authenticated())
+
+	// backend rejects the new token
+	require.Equal(t, ErrAuthFailed, b.UpdateAuthToken("expired"))
+	require.False(t, b.Authenticated())
+
+	// transport connects with the new token
+	require.Nil(t, b.UpdateAuthToken("token"))
+	require.True(t, b.Authenticated())
+
+	// new connection isn't established within the timeout
+	require.Equal(t, ErrAuthFailed, b.UpdateAuthToken("slow"))
+	require.False(t, b.Authenticated())
+
+}
+
+func TestBackend_Stats(t *testing.T) {
+
+	// the transport answers every request
+	responses := make(chan *bpb.BackendMessage, 1)
+	transport := testTransport{
+		send: func(msg *bpb.BackendMessage) error {
+			responses <- &bpb.BackendMessage{
+				RequestID: msg.RequestID,
+				Response:  &bpb.BackendMessage_Response{},
+			}
+			return nil
+		},
+		nextMessage: func() (*bpb.BackendMessage, error) {
+			return <-responses, nil
+		},
+	}
+
+	b, err := NewBackend(&transport, nil, &testSignedPreKeyStore{
+		all: func() []*x3dh.KeyPair {
+			return []*x3dh.KeyPair{&x3dh.KeyPair{}}
+		},
+	})
+	require.Nil(t, err)
+
+	stats := b.Stats()
+	require.Equal(t, 0, stats.PendingRequests)
+	require.Equal(t, 0, stats.QueueDepth)
+	require.True(t, stats.Authenticated)
+	require.Equal(t, uint64(0), stats.TotalSent)
+	require.Equal(t, uint64(0), stats.TotalReceived)
+	require.True(t, stats.LastConnectedAt.IsZero())
+
+	_, err = b.request(bpb.BackendMessage_Request{}, time.Second)
+	require.Nil(t, err)
+
+	// the sent counter is updated after the transport returned
+	for i := 0; i < 100 && b.Stats().TotalSent == 0; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	stats = b.Stats()
+	require.Equal(t, 0, stats.PendingRequests)
+	require.Equal(t, uint64(1), stats.TotalSent)
+	require.Equal(t, uint64(1), stats.TotalReceived)
+	require.False(t, stats.LastConnectedAt.IsZero())
+
+}
+
+func TestRequestStack_MaxSize(t *testing.T) {
+
+	s := requestStack{
+		stack:   map[string]chan *response{},
+		maxSize: 1,
+	}
+
+	require.Nil(t, s.Add("first", make(chan *response)))
+	require.Equal(t, ErrRequestStackFull, s.Add("second", make(chan *response)))
+	require.Equal(t, 1, s.Len())
+
+	// there is space again once a request got a response
+	require.NotNil(t, s.Cut("first"))
+	require.Nil(t, s.Add("second", make(chan *response)))
+
+}
+
+func TestMessageOrdering(t *testing.T) {
+
+	requests := map[string]*request{}
+	for i := 0; i < 100; i++ {
+		id := fmt.Sprintf("request-%d", i)
+		requests[id] = &request{
+			Req:      &bpb.BackendMessage_Request{},
+			ReqID:    id,
+			RespChan: make(chan *response, 1),
+		}
+	}
+
+	sent := make(chan uint64, len(requests))
+	b, err := NewBackend(&testTransport{
+		send: func(msg *bpb.BackendMessage) error {
+			sent <- requests[msg.RequestID].SeqNum
+			return nil
+		},
+		nextMessage: func() (*bpb.BackendMessage, error) {
+			select {}
+		},
+	}, nil, &testSignedPreKeyStore{
+		all: func() []*x3dh.KeyPair {
+			return []*x3dh.KeyPair{&x3dh.KeyPair{}}
+		},
+	})
+	require.Nil(t, err)
+
+	// send all requests concurrently
+	for _, req := range requests {
+		go func(req *request) {
+			b.outReqQueue <- req
+		}(req)
+	}
+
+	for expected := uint64(1); expected <= uint64(len(requests)); expected++ {
+		select {
+		case seqNum := <-sent:
+			require.Equal(t, expected, seqNum)
+		case <-time.After(time.Second * 5):
+			require.FailNow(t, "timed out waiting for request")
+		}
+	}
+
+}
+
+func TestBackend_CloseStopsSending(t *testing.T) {
+
+	sent := make(chan string, 1)
+	b, err := NewBackend(&testTransport{
+		send: func(msg *bpb.BackendMessage) error {
+			sent <- msg.RequestID
+			return nil
+		},
+		nextMessage: func() (*bpb.BackendMessage, error) {
+			select {}
+		},
+	}, nil, &testSignedPreKeyStore{
+		all: func() []*x3dh.KeyPair {
+			return []*x3dh.KeyPair{&x3dh.KeyPair{}}
+		},
+	})
+	require.Nil(t, err)
+
+	require.Nil(t, b.Close())
+
+	// none of the goroutines must still be running
+	b.outReqQueue <- &request{
+		Req:      &bpb.BackendMessage_Request{},
+		ReqID:    "after-close",
+		RespChan: make(chan *response, 1),
+	}
+	select {
+	case id := <-sent:
+		require.FailNow(t, "request was sent after close", id)
+	case <-time.After(time.Millisecond * 100):
+	}
+
+}
+
+func TestNewBackend_Options(t *testing.T) {
+
+	handler := func(req *bpb.BackendMessage_Request) (*bpb.BackendMessage_Response, error) {
+		return nil, nil
+	}
+
+	b, err := NewBackend(&testTransport{
+		send: func(msg *bpb.BackendMessage) error {
+			return nil
+		},
+		nextMessage: func() (*bpb.BackendMessage, error) {
+			select {}
+		},
+	}, nil, &testSignedPreKeyStore{
+		all: func() []*x3dh.KeyPair {
+			return []*x3dh.KeyPair{&x3dh.KeyPair{}}
+		},
+	},
+		WithRequestTimeout(time.Millisecond*10),
+		WithMaxQueueSize(3),
+		WithAuthTimeout(time.Second),
+		WithRequestHandler(handler),
+	)
+	require.Nil(t, err)
+
+	require.Equal(t, 3, cap(b.outReqQueue))
+	require.Equal(t, time.Second, b.authTimeout)
+
+	// the request handler is registered right away
+	reqHandlers := make(chan []RequestHandler)
+	b.reqHandlers <- reqHandlers
+	require.Equal(t, 1, len(<-reqHandlers))
+
+	// the request timeout overrides the timeout of the request
+	_, err = b.request(bpb.BackendMessage_Request{}, time.Hour)
+	require.EqualError(t, err, "request timed out after 10000000")
+
+}
+
+func TestBackend_HealthCheck(t *testing.T) {
+
+	connected := true
+	transport := testTransport{
+		nextMessage: func() (*bpb.BackendMessage, error) {
+			select {}
+		},
+		connected: func() bool {
+			return connected
+		},
+	}
+
+	b, err := NewBackend(&transport, nil, &testSignedPreKeyStore{
+		all: func() []*x3dh.KeyPair {
+			return []*x3dh.KeyPair{&x3dh.KeyPair{}}
+		},
+	}, WithEndpoint("wss://backend"))
+	require.Nil(t, err)
+
+	require.Nil(t, b.HealthCheck(context.Background()))
+
+	// transport is not connected
+	connected = false
+	b.setLastError(errors.New("connection refused"))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*200)
+	defer cancel()
+	err = b.HealthCheck(ctx)
+	healthErr, ok := err.(HealthError)
+	require.True(t, ok)
+	require.Equal(t, "wss://backend", healthErr.Endpoint)
+	require.EqualError(t, healthErr.LastError, "connection refused")
+	require.Equal(t, time.Duration(0), healthErr.TimeSinceLastSuccess)
+
+}
+
+func TestBackend_Reconnect(t *testing.T) {
+
+	var connected int32 = 1
+	var connListener func(connected bool)
+	incoming := make(chan *bpb.BackendMessage, 10)
+	sent := make(chan string, 10)
+
+	b, err := NewBackend(&testTransport{
+		send: func(msg *bpb.BackendMessage) error {
+			if atomic.LoadInt32(&connected) == 0 {
+				return errors.New("sent while disconnected")
+			}
+			sent <- msg.RequestID
+			// the backend responds to every request
+			incoming <- &bpb.BackendMessage{
+				RequestID: msg.RequestID,
+				Response:  &bpb.BackendMessage_Response{},
+			}
+			return nil
+		},
+		nextMessage: func() (*bpb.BackendMessage, error) {
+			return <-incoming, nil
+		},
+		onConnectionChange: func(fn func(connected bool)) {
+			connListener = fn
+		},
+	}, nil, &testSignedPreKeyStore{
+		all: func() []*x3dh.KeyPair {
+			return []*x3dh.KeyPair{&x3dh.KeyPair{}}
+		},
+	})
+	require.Nil(t, err)
+	require.NotNil(t, connListener)
+
+	// two consecutive disconnects
+	requests := []*request{}
+	for i := 0; i < 2; i++ {
+
+		// connection drops
+		atomic.StoreInt32(&connected, 0)
+		connListener(false)
+		require.False(t, b.Authenticated())
+		// wait till the sender paused
+		for len(b.authChanged) > 0 {
+			time.Sleep(time.Millisecond * 10)
+		}
+
+		req := &request{
+			Req:      &bpb.BackendMessage_Request{},
+			ReqID:    fmt.Sprintf("request-%d", i),
+			RespChan: make(chan *response, 1),
+		}
+		requests = append(requests, req)
+		b.outReqQueue <- req
+
+		// requests must not be sent while we are disconnected
+		select {
+		case <-sent:
+			require.FailNow(t, "sent request while disconnected")
+		case <-time.After(time.Millisecond * 100):
+		}
+
+		// reconnected and authenticated
+		atomic.StoreInt32(&connected, 1)
+		connListener(true)
+		require.True(t, b.Authenticated())
+
+		select {
+		case id := <-sent:
+			require.Equal(t, req.ReqID, id)
+		case <-time.After(time.Second * 5):
+			require.FailNow(t, "timed out waiting for request")
+		}
+
+	}
+
+	// all pending requests got resolved
+	for _, req := range requests {
+		select {
+		case resp := <-req.RespChan:
+			require.Nil(t, resp.err)
+		case <-time.After(time.Second * 5):
+			require.FailNow(t, "timed out waiting for response")
+		}
+	}
+
+}
@@ -0,0 +1,63 @@
+package backend
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	defaultReconnectMinInterval = time.Second
+	defaultReconnectMaxInterval = time.Minute
+)
+
+// exponential backoff with jitter used to reconnect
+// so that clients don't reconnect all at the same time
+type backoff struct {
+	lock    sync.Mutex
+	min     time.Duration
+	max     time.Duration
+	attempt uint
+	// returns a number in [0.0,1.0)
+	random func() float64
+}
+
+func newBackoff(min, max time.Duration) *backoff {
+	if min <= 0 {
+		min = defaultReconnectMinInterval
+	}
+	if max < min {
+		max = min
+	}
+	return &backoff{
+		min:    min,
+		max:    max,
+		random: rand.Float64,
+	}
+}
+
+// time to wait before the next attempt
+// somewhere between the half and the full interval
+func (b *backoff) next() time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	interval := b.min
+	for i := uint(0); i < b.attempt && interval < b.max; i++ {
+		interval *= 2
+	}
+	if interval > b.max {
+		interval = b.max
+	}
+	b.attempt++
+
+	half := interval / 2
+	return half + time.Duration(b.random()*float64(interval-half))
+}
+
+// start over after a successful attempt
+func (b *backoff) reset() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.attempt = 0
+}
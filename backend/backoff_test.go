@@ -0,0 +1,33 @@
+package backend
+
+import (
+	"testing"
+	"time"
+
+	require "github.com/stretchr/testify/require"
+)
+
+func TestBackoff(t *testing.T) {
+
+	b := newBackoff(time.Second, time.Second*5)
+
+	// without jitter we wait the full interval
+	b.random = func() float64 {
+		return 0.9999999
+	}
+	require.InDelta(t, float64(time.Second), float64(b.next()), float64(time.Millisecond))
+	require.InDelta(t, float64(time.Second*2), float64(b.next()), float64(time.Millisecond))
+	require.InDelta(t, float64(time.Second*4), float64(b.next()), float64(time.Millisecond))
+	// capped at max
+	require.InDelta(t, float64(time.Second*5), float64(b.next()), float64(time.Millisecond))
+	require.InDelta(t, float64(time.Second*5), float64(b.next()), float64(time.Millisecond))
+
+	// jitter waits at least the half interval
+	b.reset()
+	b.random = func() float64 {
+		return 0
+	}
+	require.Equal(t, time.Millisecond*500, b.next())
+	require.Equal(t, time.Second, b.next())
+
+}
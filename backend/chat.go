@@ -7,22 +7,61 @@ import (
 	preKey "github.com/Bit-Nation/panthalassa/chat/prekey"
 	bpb "github.com/Bit-Nation/protobuffers"
 	x3dh "github.com/Bit-Nation/x3dh"
+	proto "github.com/golang/protobuf/proto"
 	ed25519 "golang.org/x/crypto/ed25519"
 )
 
+// pre key bundle of the cache if it's younger than the ttl
+func (b *Backend) cachedPreKeyBundle(userIDPubKey ed25519.PublicKey) (*bpb.BackendMessage_PreKeyBundle, error) {
+
+	if b.profileCache == nil {
+		return nil, nil
+	}
+
+	cached, err := b.profileCache.Get(userIDPubKey)
+	if err != nil || cached == nil {
+		return nil, err
+	}
+
+	if time.Since(cached.FetchedAt) > b.profileCacheTTL {
+		return nil, nil
+	}
+
+	protoBundle := &bpb.BackendMessage_PreKeyBundle{}
+	if err := proto.Unmarshal(cached.PreKeyBundle, protoBundle); err != nil {
+		return nil, err
+	}
+
+	return protoBundle, nil
+
+}
+
 // fetch pre key bundle from backend
 func (b *Backend) FetchPreKeyBundle(userIDPubKey ed25519.PublicKey) (x3dh.PreKeyBundle, error) {
 
-	// request pre key bundle
-	resp, err := b.request(bpb.BackendMessage_Request{
-		PreKeyBundle: userIDPubKey,
-	}, time.Second*4)
+	// use the cached pre key bundle if possible
+	protoBundle, err := b.cachedPreKeyBundle(userIDPubKey)
 	if err != nil {
-		return &PreKeyBundle{}, err
+		// we can still fetch it from the backend
+		logger.Error(err)
+	}
+
+	fetched := protoBundle == nil
+	if fetched {
+
+		// request pre key bundle
+		resp, err := b.request(bpb.BackendMessage_Request{
+			PreKeyBundle: userIDPubKey,
+		}, time.Second*4)
+		if err != nil {
+			return &PreKeyBundle{}, err
+		}
+		protoBundle = resp.PreKeyBundle
+
 	}
 
 	// unmarshal protobuf
-	bundle, err := PreKeyBundleFromProto(userIDPubKey, resp.PreKeyBundle)
+	bundle, err := PreKeyBundleFromProto(userIDPubKey, protoBundle)
 	if err != nil {
 		return &PreKeyBundle{}, err
 	}
@@ -38,11 +77,46 @@ func (b *Backend) FetchPreKeyBundle(userIDPubKey ed25519.PublicKey) (x3dh.PreKey
 		return &PreKeyBundle{}, errors.New("invalid pre key bundle signatures")
 	}
 
+	// cache the fetched pre key bundle. The one time pre key is
+	// handed out by the backend only once and must not be reused.
+	if fetched && b.profileCache != nil {
+		cacheable := *protoBundle
+		cacheable.OneTimePreKey = nil
+		rawBundle, err := proto.Marshal(&cacheable)
+		if err != nil {
+			return &PreKeyBundle{}, err
+		}
+		if err := b.profileCache.Put(userIDPubKey, rawBundle); err != nil {
+			logger.Error(err)
+		}
+	}
+
 	// parse pre key bundle
 	return bundle, nil
 
 }
 
+// remove the cached pre key bundle of the user so
+// that the next fetch hits the backend again
+func (b *Backend) InvalidateProfile(pubKey ed25519.PublicKey) error {
+	if b.profileCache == nil {
+		return nil
+	}
+	return b.profileCache.Invalidate(pubKey)
+}
+
+// upload a new signed pre key to the backend
+func (b *Backend) UploadSignedPreKey(signedPreKey preKey.PreKey) error {
+	protoSignedPreKey, err := signedPreKey.ToProtobuf()
+	if err != nil {
+		return err
+	}
+	_, err = b.request(bpb.BackendMessage_Request{
+		NewSignedPreKey: &protoSignedPreKey,
+	}, time.Second*10)
+	return err
+}
+
 // submit messages
 func (b *Backend) SubmitMessages(messages []*bpb.ChatMessage) error {
 	_, err := b.request(bpb.BackendMessage_Request{Messages: messages}, time.Second*20)
@@ -3,9 +3,13 @@ package backend
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	preKey "github.com/Bit-Nation/panthalassa/chat/prekey"
+	db "github.com/Bit-Nation/panthalassa/db"
 	keyManager "github.com/Bit-Nation/panthalassa/keyManager"
 	keyStore "github.com/Bit-Nation/panthalassa/keyStore"
 	mnemonic "github.com/Bit-Nation/panthalassa/mnemonic"
@@ -23,7 +27,8 @@ func TestBackend_FetchSignedPreKey(t *testing.T) {
 	require.Nil(t, err)
 	ks, err := keyStore.NewFromMnemonic(mne)
 	require.Nil(t, err)
-	km := keyManager.CreateFromKeyStore(ks)
+	km, err := keyManager.CreateFromKeyStore(ks)
+	require.Nil(t, err)
 
 	// target person signed pre key
 	c25519 := x3dh.NewCurve25519(rand.Reader)
@@ -91,7 +96,8 @@ func TestBackend_FetchSignedPreKeyInvalidSignature(t *testing.T) {
 	require.Nil(t, err)
 	ks, err := keyStore.NewFromMnemonic(mne)
 	require.Nil(t, err)
-	km := keyManager.CreateFromKeyStore(ks)
+	km, err := keyManager.CreateFromKeyStore(ks)
+	require.Nil(t, err)
 
 	// target person signed pre key
 	c25519 := x3dh.NewCurve25519(rand.Reader)
@@ -160,7 +166,8 @@ func TestBackend_FetchPreKeyBundle(t *testing.T) {
 	require.Nil(t, err)
 	ks, err := keyStore.NewFromMnemonic(mne)
 	require.Nil(t, err)
-	km := keyManager.CreateFromKeyStore(ks)
+	km, err := keyManager.CreateFromKeyStore(ks)
+	require.Nil(t, err)
 
 	// target person signed pre key
 	c25519 := x3dh.NewCurve25519(rand.Reader)
@@ -223,6 +230,219 @@ func TestBackend_FetchPreKeyBundle(t *testing.T) {
 
 }
 
+func TestBackend_FetchPreKeyBundleCached(t *testing.T) {
+
+	// key manager setup
+	mne, err := mnemonic.New()
+	require.Nil(t, err)
+	ks, err := keyStore.NewFromMnemonic(mne)
+	require.Nil(t, err)
+	km, err := keyManager.CreateFromKeyStore(ks)
+	require.Nil(t, err)
+
+	// signed pre key
+	c25519 := x3dh.NewCurve25519(rand.Reader)
+	signingKeyPair, err := c25519.GenerateKeyPair()
+	require.Nil(t, err)
+	signedPreKey := preKey.PreKey{}
+	signedPreKey.PublicKey = signingKeyPair.PublicKey
+	require.Nil(t, signedPreKey.Sign(*km))
+	signedPreProto, err := signedPreKey.ToProtobuf()
+	require.Nil(t, err)
+
+	// identity key
+	identityKey, err := km.IdentityPublicKey()
+	require.Nil(t, err)
+	rawIdentityKey, err := hex.DecodeString(identityKey)
+	require.Nil(t, err)
+
+	// profile
+	prof, err := profile.SignProfile("Florian", "earth", "base64", *km)
+	require.Nil(t, err)
+	protoProf, err := prof.ToProtobuf()
+	require.Nil(t, err)
+
+	// transport that counts the requests
+	var requests uint32
+	transport := testTransport{}
+	reqIDChan := make(chan string)
+	transport.send = func(msg *bpb.BackendMessage) error {
+		atomic.AddUint32(&requests, 1)
+		reqIDChan <- msg.RequestID
+		return nil
+	}
+	transport.nextMessage = func() (*bpb.BackendMessage, error) {
+		return &bpb.BackendMessage{
+			RequestID: <-reqIDChan,
+			Response: &bpb.BackendMessage_Response{
+				PreKeyBundle: &bpb.BackendMessage_PreKeyBundle{
+					SignedPreKey: &signedPreProto,
+					Profile:      protoProf,
+				},
+			},
+		}, nil
+	}
+
+	// in memory profile cache
+	lock := sync.Mutex{}
+	cached := map[string]db.CachedProfile{}
+	cache := &testProfileCache{
+		get: func(idPubKey ed25519.PublicKey) (*db.CachedProfile, error) {
+			lock.Lock()
+			defer lock.Unlock()
+			c, exist := cached[hex.EncodeToString(idPubKey)]
+			if !exist {
+				return nil, nil
+			}
+			return &c, nil
+		},
+		put: func(idPubKey ed25519.PublicKey, preKeyBundle []byte) error {
+			lock.Lock()
+			defer lock.Unlock()
+			cached[hex.EncodeToString(idPubKey)] = db.CachedProfile{
+				PreKeyBundle: preKeyBundle,
+				FetchedAt:    time.Now(),
+			}
+			return nil
+		},
+		invalidate: func(idPubKey ed25519.PublicKey) error {
+			lock.Lock()
+			defer lock.Unlock()
+			delete(cached, hex.EncodeToString(idPubKey))
+			return nil
+		},
+	}
+
+	b, err := NewBackend(&transport, km, &testSignedPreKeyStore{
+		all: func() []*x3dh.KeyPair {
+			return []*x3dh.KeyPair{&x3dh.KeyPair{}}
+		},
+	}, WithProfileCache(cache, time.Minute))
+	require.Nil(t, err)
+
+	// repeated fetches within the ttl only hit the backend once
+	for i := 0; i < 3; i++ {
+		bundle, err := b.FetchPreKeyBundle(rawIdentityKey)
+		require.Nil(t, err)
+		valid, err := bundle.ValidSignature()
+		require.Nil(t, err)
+		require.True(t, valid)
+	}
+	require.Equal(t, uint32(1), atomic.LoadUint32(&requests))
+
+	// invalidated profiles are fetched again
+	require.Nil(t, b.InvalidateProfile(rawIdentityKey))
+	_, err = b.FetchPreKeyBundle(rawIdentityKey)
+	require.Nil(t, err)
+	require.Equal(t, uint32(2), atomic.LoadUint32(&requests))
+
+	// expired profiles are fetched again
+	lock.Lock()
+	expired := cached[identityKey]
+	expired.FetchedAt = time.Now().Add(-time.Hour)
+	cached[identityKey] = expired
+	lock.Unlock()
+	_, err = b.FetchPreKeyBundle(rawIdentityKey)
+	require.Nil(t, err)
+	require.Equal(t, uint32(3), atomic.LoadUint32(&requests))
+
+}
+
+func TestBackend_FetchPreKeyBundleCacheWithoutOneTimePreKey(t *testing.T) {
+
+	// key manager setup
+	mne, err := mnemonic.New()
+	require.Nil(t, err)
+	ks, err := keyStore.NewFromMnemonic(mne)
+	require.Nil(t, err)
+	km, err := keyManager.CreateFromKeyStore(ks)
+	require.Nil(t, err)
+
+	// signed and one time pre key
+	c25519 := x3dh.NewCurve25519(rand.Reader)
+	signedPreKeyPair, err := c25519.GenerateKeyPair()
+	require.Nil(t, err)
+	signedPreKey := preKey.PreKey{}
+	signedPreKey.PublicKey = signedPreKeyPair.PublicKey
+	require.Nil(t, signedPreKey.Sign(*km))
+	signedPreProto, err := signedPreKey.ToProtobuf()
+	require.Nil(t, err)
+
+	oneTimePreKeyPair, err := c25519.GenerateKeyPair()
+	require.Nil(t, err)
+	oneTimePreKey := preKey.PreKey{}
+	oneTimePreKey.PublicKey = oneTimePreKeyPair.PublicKey
+	require.Nil(t, oneTimePreKey.Sign(*km))
+	oneTimePreProto, err := oneTimePreKey.ToProtobuf()
+	require.Nil(t, err)
+
+	// identity key
+	identityKey, err := km.IdentityPublicKey()
+	require.Nil(t, err)
+	rawIdentityKey, err := hex.DecodeString(identityKey)
+	require.Nil(t, err)
+
+	// profile
+	prof, err := profile.SignProfile("Florian", "earth", "base64", *km)
+	require.Nil(t, err)
+	protoProf, err := prof.ToProtobuf()
+	require.Nil(t, err)
+
+	transport := testTransport{}
+	reqIDChan := make(chan string)
+	transport.send = func(msg *bpb.BackendMessage) error {
+		reqIDChan <- msg.RequestID
+		return nil
+	}
+	transport.nextMessage = func() (*bpb.BackendMessage, error) {
+		return &bpb.BackendMessage{
+			RequestID: <-reqIDChan,
+			Response: &bpb.BackendMessage_Response{
+				PreKeyBundle: &bpb.BackendMessage_PreKeyBundle{
+					SignedPreKey:  &signedPreProto,
+					OneTimePreKey: &oneTimePreProto,
+					Profile:       protoProf,
+				},
+			},
+		}, nil
+	}
+
+	// in memory profile cache
+	var cached *db.CachedProfile
+	cache := &testProfileCache{
+		get: func(idPubKey ed25519.PublicKey) (*db.CachedProfile, error) {
+			return cached, nil
+		},
+		put: func(idPubKey ed25519.PublicKey, preKeyBundle []byte) error {
+			cached = &db.CachedProfile{
+				PreKeyBundle: preKeyBundle,
+				FetchedAt:    time.Now(),
+			}
+			return nil
+		},
+	}
+
+	b, err := NewBackend(&transport, km, &testSignedPreKeyStore{
+		all: func() []*x3dh.KeyPair {
+			return []*x3dh.KeyPair{&x3dh.KeyPair{}}
+		},
+	}, WithProfileCache(cache, time.Minute))
+	require.Nil(t, err)
+
+	// the fetched bundle contains the one time pre key
+	bundle, err := b.FetchPreKeyBundle(rawIdentityKey)
+	require.Nil(t, err)
+	require.Equal(t, &oneTimePreKeyPair.PublicKey, bundle.OneTimePreKey())
+
+	// the cached bundle must not contain it
+	require.NotNil(t, cached)
+	bundle, err = b.FetchPreKeyBundle(rawIdentityKey)
+	require.Nil(t, err)
+	require.Nil(t, bundle.OneTimePreKey())
+	require.Equal(t, signedPreKeyPair.PublicKey, bundle.SignedPreKey())
+
+}
+
 func TestBackend_SubmitMessage(t *testing.T) {
 
 	// transport
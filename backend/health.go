@@ -0,0 +1,64 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// returned by HealthCheck if the backend is not usable
+type HealthError struct {
+	Endpoint  string
+	LastError error
+	// zero if there never was a successful exchange
+	TimeSinceLastSuccess time.Duration
+}
+
+func (e HealthError) Error() string {
+	return fmt.Sprintf("backend %s is unhealthy - last error: %v, last success %s ago", e.Endpoint, e.LastError, e.TimeSinceLastSuccess)
+}
+
+type storedError struct {
+	err error
+}
+
+// remember the last error of the transport
+func (b *Backend) setLastError(err error) {
+	b.lastError.Store(storedError{err: err})
+}
+
+func (b *Backend) getLastError() error {
+	if e, ok := b.lastError.Load().(storedError); ok {
+		return e.err
+	}
+	return nil
+}
+
+// check if the backend is connected and authenticated.
+// The backend protocol has no ping request, so we wait
+// for the transport to be connected till the context is done.
+func (b *Backend) HealthCheck(ctx context.Context) error {
+
+	for {
+		if b.Connected() && b.Authenticated() {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			healthErr := HealthError{
+				Endpoint:  b.endpoint,
+				LastError: b.getLastError(),
+			}
+			if healthErr.LastError == nil {
+				healthErr.LastError = ctx.Err()
+			}
+			if lastSuccess := atomic.LoadInt64(&b.lastConnectedAt); lastSuccess != 0 {
+				healthErr.TimeSinceLastSuccess = time.Since(time.Unix(0, lastSuccess))
+			}
+			return healthErr
+		case <-time.After(time.Millisecond * 100):
+		}
+	}
+
+}
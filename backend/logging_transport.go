@@ -0,0 +1,82 @@
+package backend
+
+import (
+	bpb "github.com/Bit-Nation/protobuffers"
+	proto "github.com/gogo/protobuf/proto"
+	log "github.com/ipfs/go-log"
+)
+
+// transport decorator that logs all messages
+// that are send and received
+type LoggingTransport struct {
+	inner  Transport
+	logger log.EventLogger
+	// messages are only logged when enabled
+	Enabled bool
+}
+
+func NewLoggingTransport(inner Transport, logger log.EventLogger) *LoggingTransport {
+	return &LoggingTransport{
+		inner:   inner,
+		logger:  logger,
+		Enabled: true,
+	}
+}
+
+// type of the backend message
+func backendMessageType(msg *bpb.BackendMessage) string {
+	switch {
+	case msg.Error != "":
+		return "error"
+	case msg.Request != nil:
+		return "request"
+	case msg.Response != nil:
+		return "response"
+	}
+	return "unknown"
+}
+
+func (t *LoggingTransport) log(direction string, msg *bpb.BackendMessage) {
+	if !t.Enabled || msg == nil {
+		return
+	}
+	t.logger.Debugf(
+		"%s backend message of type: %s - request id: %s - size: %d bytes",
+		direction,
+		backendMessageType(msg),
+		msg.RequestID,
+		proto.Size(msg),
+	)
+}
+
+func (t *LoggingTransport) Send(msg *bpb.BackendMessage) error {
+	t.log("sending", msg)
+	return t.inner.Send(msg)
+}
+
+func (t *LoggingTransport) NextMessage() (*bpb.BackendMessage, error) {
+	msg, err := t.inner.NextMessage()
+	if err != nil {
+		return nil, err
+	}
+	t.log("received", msg)
+	return msg, nil
+}
+
+func (t *LoggingTransport) Close() error {
+	return t.inner.Close()
+}
+
+func (t *LoggingTransport) Connected() bool {
+	return t.inner.Connected()
+}
+
+func (t *LoggingTransport) UpdateBearerToken(token string) error {
+	return t.inner.UpdateBearerToken(token)
+}
+
+func (t *LoggingTransport) OnConnectionChange(fn func(connected bool)) {
+	if notifier, ok := t.inner.(ConnectionNotifier); ok {
+		notifier.OnConnectionChange(fn)
+	}
+}
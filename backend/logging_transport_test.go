@@ -0,0 +1,48 @@
+package backend
+
+import (
+	"testing"
+
+	bpb "github.com/Bit-Nation/protobuffers"
+	log "github.com/ipfs/go-log"
+	require "github.com/stretchr/testify/require"
+)
+
+func TestLoggingTransportForwards(t *testing.T) {
+
+	sent := []*bpb.BackendMessage{}
+	inner := &testTransport{
+		send: func(msg *bpb.BackendMessage) error {
+			sent = append(sent, msg)
+			return nil
+		},
+		nextMessage: func() (*bpb.BackendMessage, error) {
+			return &bpb.BackendMessage{RequestID: "received"}, nil
+		},
+	}
+
+	trans := NewLoggingTransport(inner, log.Logger("test"))
+
+	require.Nil(t, trans.Send(&bpb.BackendMessage{RequestID: "sent"}))
+	require.Equal(t, 1, len(sent))
+	require.Equal(t, "sent", sent[0].RequestID)
+
+	// still forwards while disabled
+	trans.Enabled = false
+	msg, err := trans.NextMessage()
+	require.Nil(t, err)
+	require.Equal(t, "received", msg.RequestID)
+
+}
+
+func TestBackendMessageType(t *testing.T) {
+	require.Equal(t, "request", backendMessageType(&bpb.BackendMessage{
+		Request: &bpb.BackendMessage_Request{},
+	}))
+	require.Equal(t, "response", backendMessageType(&bpb.BackendMessage{
+		Response: &bpb.BackendMessage_Response{},
+	}))
+	require.Equal(t, "error", backendMessageType(&bpb.BackendMessage{
+		Error: "failed",
+	}))
+}
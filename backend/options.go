@@ -0,0 +1,75 @@
+package backend
+
+import (
+	"time"
+
+	db "github.com/Bit-Nation/panthalassa/db"
+	uiapi "github.com/Bit-Nation/panthalassa/uiapi"
+)
+
+const (
+	defaultMaxQueueSize = 150
+	// amount of requests that can wait for a response
+	defaultMaxStackSize = 500
+	// time we wait for the re authentication after updating the token
+	defaultAuthTimeout = time.Second * 10
+	// time a cached pre key bundle is used before it's fetched again
+	defaultProfileCacheTTL = time.Minute * 30
+)
+
+type BackendOption func(*Backend)
+
+// use the same timeout for all requests to the backend
+// instead of the defaults of each request
+func WithRequestTimeout(d time.Duration) BackendOption {
+	return func(b *Backend) {
+		b.requestTimeout = d
+	}
+}
+
+// amount of outgoing requests that can be queued
+func WithMaxQueueSize(n int) BackendOption {
+	return func(b *Backend) {
+		b.outReqQueue = make(chan *request, n)
+	}
+}
+
+// time we wait for the re authentication after updating the token
+func WithAuthTimeout(d time.Duration) BackendOption {
+	return func(b *Backend) {
+		b.authTimeout = d
+	}
+}
+
+// register a request handler before the backend starts to receive messages
+func WithRequestHandler(h RequestHandler) BackendOption {
+	return func(b *Backend) {
+		b.initialReqHandlers = append(b.initialReqHandlers, h)
+	}
+}
+
+// used to inform the ui about the backend state
+func WithUiApi(api *uiapi.Api) BackendOption {
+	return func(b *Backend) {
+		b.uiApi = api
+	}
+}
+
+// endpoint of the backend used in health reports
+func WithEndpoint(endpoint string) BackendOption {
+	return func(b *Backend) {
+		b.endpoint = endpoint
+	}
+}
+
+// cache fetched pre key bundles for the given time
+// a ttl of 0 falls back to the default of 30 minutes
+func WithProfileCache(cache db.ProfileCache, ttl time.Duration) BackendOption {
+	return func(b *Backend) {
+		if ttl == 0 {
+			ttl = defaultProfileCacheTTL
+		}
+		b.profileCache = cache
+		b.profileCacheTTL = ttl
+	}
+}
@@ -29,7 +29,8 @@ func TestPreKeyBundleFromProto(t *testing.T) {
 	require.Nil(t, err)
 
 	// key manager
-	km := keyManager.CreateFromKeyStore(ks)
+	km, err := keyManager.CreateFromKeyStore(ks)
+	require.Nil(t, err)
 
 	// identity key
 	idPubKeyRaw, err := km.IdentityPublicKey()
@@ -0,0 +1,122 @@
+package backend
+
+import (
+	"encoding/base64"
+	"errors"
+	"time"
+
+	queue "github.com/Bit-Nation/panthalassa/queue"
+	bpb "github.com/Bit-Nation/protobuffers"
+	proto "github.com/golang/protobuf/proto"
+	uuid "github.com/satori/go.uuid"
+)
+
+// job type of requests that were still queued when we shut down
+const RetryBackendMessageJobType = "retry_backend_message"
+
+// returned to requests that got moved into the job storage
+var ErrRequestDrained = errors.New("request has been moved to the job queue")
+
+// persist all queued requests as jobs so that they are not lost.
+// The jobs are processed by the RetryMessageProcessor on the next start.
+func (b *Backend) DrainQueueToStorage(q queue.Storage) error {
+
+	for {
+		select {
+		case req := <-b.outReqQueue:
+
+			rawReq, err := proto.Marshal(req.Req)
+			if err != nil {
+				return err
+			}
+
+			id, err := uuid.NewV4()
+			if err != nil {
+				return err
+			}
+
+			err = q.PersistJob(queue.Job{
+				ID:   id.String(),
+				Type: RetryBackendMessageJobType,
+				Data: map[string]interface{}{
+					"request": base64.StdEncoding.EncodeToString(rawReq),
+				},
+			})
+			if err != nil {
+				return err
+			}
+
+			// the requester might be gone already
+			go func(req *request) {
+				req.RespChan <- &response{
+					err: ErrRequestDrained,
+				}
+			}(req)
+
+		default:
+			return nil
+		}
+	}
+
+}
+
+// processor that sends requests persisted by DrainQueueToStorage
+type RetryMessageProcessor struct {
+	backend *Backend
+	queue   *queue.Queue
+}
+
+func NewRetryMessageProcessor(b *Backend, q *queue.Queue) *RetryMessageProcessor {
+	return &RetryMessageProcessor{
+		backend: b,
+		queue:   q,
+	}
+}
+
+func (p *RetryMessageProcessor) Type() string {
+	return RetryBackendMessageJobType
+}
+
+// get the request from the job
+func (p *RetryMessageProcessor) jobToRequest(j queue.Job) (*bpb.BackendMessage_Request, error) {
+	rawReqStr, ok := j.Data["request"].(string)
+	if !ok {
+		return nil, errors.New("request is missing")
+	}
+	rawReq, err := base64.StdEncoding.DecodeString(rawReqStr)
+	if err != nil {
+		return nil, err
+	}
+	req := &bpb.BackendMessage_Request{}
+	if err := proto.Unmarshal(rawReq, req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func (p *RetryMessageProcessor) ValidJob(j queue.Job) error {
+	if p.Type() != j.Type {
+		return errors.New("invalid job type")
+	}
+	_, err := p.jobToRequest(j)
+	return err
+}
+
+func (p *RetryMessageProcessor) Process(j queue.Job) error {
+
+	if p.Type() != j.Type {
+		return errors.New("invalid job type")
+	}
+
+	req, err := p.jobToRequest(j)
+	if err != nil {
+		return err
+	}
+
+	if _, err := p.backend.request(*req, time.Second*20); err != nil {
+		return err
+	}
+
+	return p.queue.DeleteJob(j)
+
+}
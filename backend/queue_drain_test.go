@@ -0,0 +1,59 @@
+package backend
+
+import (
+	"testing"
+	"time"
+
+	queue "github.com/Bit-Nation/panthalassa/queue"
+	bpb "github.com/Bit-Nation/protobuffers"
+	require "github.com/stretchr/testify/require"
+)
+
+func TestBackend_DrainQueueToStorage(t *testing.T) {
+
+	b := &Backend{
+		outReqQueue: make(chan *request, 2),
+	}
+
+	respChan := make(chan *response)
+	b.outReqQueue <- &request{
+		Req: &bpb.BackendMessage_Request{
+			PreKeyBundle: []byte{1, 2, 3},
+		},
+		ReqID:    "first",
+		RespChan: respChan,
+	}
+
+	jobs := []queue.Job{}
+	storage := &testJobStorage{
+		persistJob: func(j queue.Job) error {
+			jobs = append(jobs, j)
+			return nil
+		},
+	}
+
+	require.Nil(t, b.DrainQueueToStorage(storage))
+	require.Equal(t, 0, len(b.outReqQueue))
+	require.Len(t, jobs, 1)
+	require.Equal(t, RetryBackendMessageJobType, jobs[0].Type)
+
+	// the requester is told that the request got drained
+	select {
+	case resp := <-respChan:
+		require.Equal(t, ErrRequestDrained, resp.err)
+	case <-time.After(time.Second):
+		require.FailNow(t, "timed out")
+	}
+
+	// the processor can restore the request from the job
+	p := NewRetryMessageProcessor(b, nil)
+	require.Nil(t, p.ValidJob(jobs[0]))
+	req, err := p.jobToRequest(jobs[0])
+	require.Nil(t, err)
+	require.Equal(t, []byte{1, 2, 3}, req.PreKeyBundle)
+
+	// an empty queue doesn't persist anything
+	require.Nil(t, b.DrainQueueToStorage(storage))
+	require.Len(t, jobs, 1)
+
+}
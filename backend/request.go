@@ -1,6 +1,7 @@
 package backend
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
@@ -18,19 +19,29 @@ type request struct {
 	Req      *bpb.BackendMessage_Request
 	ReqID    string
 	RespChan chan *response
+	// set when the request is handed to the sender
+	SeqNum uint64
 }
 
+// returned when too many requests are waiting for a response
+var ErrRequestStackFull = errors.New("request stack is full")
+
 // stack of requests
 type requestStack struct {
-	stack map[string]chan *response
-	lock  sync.Mutex
+	stack   map[string]chan *response
+	lock    sync.Mutex
+	maxSize int
 }
 
 // add response channel to stack
-func (s *requestStack) Add(reqID string, responseChan chan *response) {
+func (s *requestStack) Add(reqID string, responseChan chan *response) error {
 	s.lock.Lock()
 	defer s.lock.Unlock()
+	if len(s.stack) >= s.maxSize {
+		return ErrRequestStackFull
+	}
 	s.stack[reqID] = responseChan
+	return nil
 }
 
 // remove request id from stack
@@ -49,9 +60,20 @@ func (s *requestStack) Cut(reqID string) chan *response {
 	return responseChan
 }
 
+// amount of requests waiting for a response
+func (s *requestStack) Len() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.stack)
+}
+
 // will request the chat backend
 func (b *Backend) request(req bpb.BackendMessage_Request, timeOut time.Duration) (*bpb.BackendMessage_Response, error) {
 
+	if b.requestTimeout != 0 {
+		timeOut = b.requestTimeout
+	}
+
 	respChan := make(chan *response)
 
 	// request id
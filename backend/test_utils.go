@@ -1,8 +1,11 @@
 package backend
 
 import (
+	db "github.com/Bit-Nation/panthalassa/db"
+	queue "github.com/Bit-Nation/panthalassa/queue"
 	bpb "github.com/Bit-Nation/protobuffers"
 	x3dh "github.com/Bit-Nation/x3dh"
+	ed25519 "golang.org/x/crypto/ed25519"
 )
 
 type testTransport struct {
@@ -10,6 +13,12 @@ type testTransport struct {
 	// this will be the callback that should be called on a message
 	// from the transport
 	nextMessage func() (*bpb.BackendMessage, error)
+	// optional, the transport is connected if not set
+	connected func() bool
+	// optional
+	onConnectionChange func(fn func(connected bool))
+	// optional, the token is accepted if not set
+	updateBearerToken func(token string) error
 }
 
 func (t *testTransport) Send(msg *bpb.BackendMessage) error {
@@ -24,6 +33,26 @@ func (t *testTransport) Close() error {
 	return nil
 }
 
+func (t *testTransport) Connected() bool {
+	if t.connected != nil {
+		return t.connected()
+	}
+	return true
+}
+
+func (t *testTransport) OnConnectionChange(fn func(connected bool)) {
+	if t.onConnectionChange != nil {
+		t.onConnectionChange(fn)
+	}
+}
+
+func (t *testTransport) UpdateBearerToken(token string) error {
+	if t.updateBearerToken != nil {
+		return t.updateBearerToken(token)
+	}
+	return nil
+}
+
 func (t *testTransport) Start() error {
 	return nil
 }
@@ -33,6 +62,8 @@ type testSignedPreKeyStore struct {
 	put       func(signedPreKey x3dh.KeyPair) error
 	get       func(publicKey x3dh.PublicKey) (*x3dh.PrivateKey, error)
 	all       func() []*x3dh.KeyPair
+	// optional, there is no signed pre key if not set
+	newest func() (*db.SignedPreKey, error)
 }
 
 func (s *testSignedPreKeyStore) GetActive() (*x3dh.KeyPair, error) {
@@ -50,3 +81,50 @@ func (s *testSignedPreKeyStore) Get(publicKey x3dh.PublicKey) (*x3dh.PrivateKey,
 func (s *testSignedPreKeyStore) All() []*x3dh.KeyPair {
 	return s.all()
 }
+
+func (s *testSignedPreKeyStore) Newest() (*db.SignedPreKey, error) {
+	if s.newest != nil {
+		return s.newest()
+	}
+	return nil, nil
+}
+
+type testJobStorage struct {
+	persistJob func(j queue.Job) error
+}
+
+func (s *testJobStorage) PersistJob(j queue.Job) error {
+	return s.persistJob(j)
+}
+
+func (s *testJobStorage) DeleteJob(id string) error {
+	return nil
+}
+
+func (s *testJobStorage) Map(queue chan queue.Job) {}
+
+func (s *testJobStorage) MoveToDeadLetter(j queue.Job) error {
+	return nil
+}
+
+func (s *testJobStorage) DeadLetterJobs() ([]queue.Job, error) {
+	return nil, nil
+}
+
+type testProfileCache struct {
+	get        func(idPubKey ed25519.PublicKey) (*db.CachedProfile, error)
+	put        func(idPubKey ed25519.PublicKey, preKeyBundle []byte) error
+	invalidate func(idPubKey ed25519.PublicKey) error
+}
+
+func (c *testProfileCache) Get(idPubKey ed25519.PublicKey) (*db.CachedProfile, error) {
+	return c.get(idPubKey)
+}
+
+func (c *testProfileCache) Put(idPubKey ed25519.PublicKey, preKeyBundle []byte) error {
+	return c.put(idPubKey, preKeyBundle)
+}
+
+func (c *testProfileCache) Invalidate(idPubKey ed25519.PublicKey) error {
+	return c.invalidate(idPubKey)
+}
@@ -9,4 +9,19 @@ type Transport interface {
 	NextMessage() (*bpb.BackendMessage, error)
 	// close the transport
 	Close() error
+	// report if the transport is currently connected
+	// to the backend
+	Connected() bool
+	// replace the bearer token and re authenticate with the
+	// backend. Returns once authenticated with the new token
+	// or with the error why authenticating failed
+	UpdateBearerToken(token string) error
+}
+
+// implemented by transports that can tell
+// when the connection dropped
+type ConnectionNotifier interface {
+	// the listener is called with false when the connection
+	// dropped and with true once we are connected again
+	OnConnectionChange(fn func(connected bool))
 }
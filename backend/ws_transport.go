@@ -2,7 +2,9 @@ package backend
 
 import (
 	"encoding/base64"
+	"errors"
 	"net/http"
+	"sync"
 	"time"
 
 	keyManager "github.com/Bit-Nation/panthalassa/keyManager"
@@ -14,45 +16,136 @@ import (
 
 var wsTransLogger = log.Logger("ws transport")
 
+var errConnReplaced = errors.New("connection got replaced before it was established")
+
+var errTransportClosed = errors.New("transport got closed")
+
+// a new bearer token and the channel the
+// result of the reconnect is reported to
+type tokenUpdate struct {
+	token  string
+	result chan error
+}
+
 type WSTransport struct {
+	// closed once the transport got closed
 	closer chan struct{}
-	conn   *conn
-	write  chan *bpb.BackendMessage
-	read   chan *bpb.BackendMessage
-	km     *keyManager.KeyManager
+	// replaced by the reconnect routine
+	conn         *conn
+	connLock     sync.Mutex
+	write        chan *bpb.BackendMessage
+	read         chan *bpb.BackendMessage
+	km           *keyManager.KeyManager
+	tokenUpdates chan tokenUpdate
+	// the token we (re)connect with
+	bearerToken     string
+	bearerTokenLock sync.Mutex
+	// optional, called when the backend rejected the bearer token
+	refreshBearerToken func() (string, error)
+	extraHeaders       map[string]string
+	// used to wait between the (re)connect attempts
+	reconnectBackoff *backoff
+	connListeners    []func(connected bool)
+	connListenerLock sync.Mutex
 }
 
 // connection is kind of a extension of the gws.Conn
 // it has additional state + some utils we need
 type conn struct {
-	closer chan struct{}
-	wsConn *gws.Conn
+	// closed once the connection got closed or replaced
+	closer    chan struct{}
+	closeOnce sync.Once
+	// set once we are connected
+	wsConn      *gws.Conn
+	wsConnLock  sync.Mutex
+	dialed      chan struct{}
+	isConnected chan chan bool
+	// optional, receives nil once we are connected or the first
+	// dial error. Only the first outcome is reported.
+	result chan error
 }
 
+// report the outcome of the dial if someone waits for it
+func (c *conn) report(err error) {
+	if c.result == nil {
+		return
+	}
+	select {
+	case c.result <- err:
+	default:
+	}
+	c.result = nil
+}
+
+// stop all routines of the connection and
+// close the websocket if we are connected
 func (c *conn) Close() error {
-	c.closer <- struct{}{}
-	return nil
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.closer)
+		c.wsConnLock.Lock()
+		wsConn := c.wsConn
+		c.wsConnLock.Unlock()
+		if wsConn != nil {
+			err = wsConn.Close()
+		}
+	})
+	return err
 }
 
-func (t *WSTransport) newConn(closed chan struct{}, endpoint, bearerToken string) *conn {
+func (c *conn) closed() bool {
+	select {
+	case <-c.closer:
+		return true
+	default:
+		return false
+	}
+}
 
-	c := &conn{
-		closer: make(chan struct{}, 2),
+// close the connection in favour of a new one
+// a replaced connection doesn't trigger a reconnect
+func (c *conn) replace() {
+	if err := c.Close(); err != nil {
+		wsTransLogger.Error(err)
+	}
+}
+
+// wait for the duration. Returns false if the connection
+// or the transport got closed in the meantime.
+func (t *WSTransport) wait(c *conn, d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-c.closer:
+		return false
+	case <-t.closer:
+		return false
 	}
+}
+
+func (t *WSTransport) newConn(closed chan struct{}, endpoint, bearerToken string, result chan error) *conn {
 
-	// ask this for the closed state
-	isClosed := make(chan chan bool)
+	c := &conn{
+		closer:      make(chan struct{}),
+		dialed:      make(chan struct{}, 1),
+		isConnected: make(chan chan bool),
+		result:      result,
+	}
 
 	// connection state routine
 	go func() {
-		var closed bool
+		var dialed bool
 		for {
 			select {
-			// query for closed
-			case isClosedResp := <-isClosed:
-				isClosedResp <- closed
+			// query for connected
+			case isConnectedResp := <-c.isConnected:
+				isConnectedResp <- dialed && !c.closed()
+			case <-c.dialed:
+				dialed = true
 			case <-c.closer:
-				closed = true
+				return
+			case <-t.closer:
+				return
 			}
 		}
 	}()
@@ -65,32 +158,70 @@ func (t *WSTransport) newConn(closed chan struct{}, endpoint, bearerToken string
 		signedToken, err := t.km.IdentitySign([]byte(bearerToken))
 		if err != nil {
 			logger.Error(err)
+			c.report(err)
 			return
 		}
 
 		identityKey, err := t.km.IdentityPublicKey()
 		if err != nil {
 			logger.Error(err)
+			c.report(err)
 			return
 		}
 
 		// try to connect till success
+		var wsConn *gws.Conn
 		for {
-			conn, _, err := d.Dial(endpoint, http.Header{
-				"Bearer":   []string{base64.StdEncoding.EncodeToString(signedToken)},
-				"Identity": []string{identityKey},
-			})
+			select {
+			case <-t.closer:
+				c.report(errTransportClosed)
+				return
+			case <-c.closer:
+				// stop dialing with the old token
+				c.report(errConnReplaced)
+				return
+			default:
+			}
+			conn, resp, err := d.Dial(endpoint, t.handshakeHeader(signedToken, identityKey))
 			if err != nil {
 				wsTransLogger.Error(err)
-				time.Sleep(time.Second)
+				if resp != nil && (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden) {
+					err = ErrAuthFailed
+					// try again with a fresh token
+					if token, refreshed := t.refreshToken(); refreshed {
+						if newSignedToken, signErr := t.km.IdentitySign([]byte(token)); signErr == nil {
+							signedToken = newSignedToken
+						} else {
+							logger.Error(signErr)
+						}
+					}
+				}
+				c.report(err)
+				t.wait(c, t.reconnectBackoff.next())
 				continue
 			}
 
+			wsConn = conn
+			c.wsConnLock.Lock()
 			c.wsConn = conn
+			c.wsConnLock.Unlock()
+			// closed while we dialed
+			if c.closed() {
+				if err := wsConn.Close(); err != nil {
+					wsTransLogger.Error(err)
+				}
+				continue
+			}
+			c.dialed <- struct{}{}
+			t.reconnectBackoff.reset()
 			break
 		}
 
-		c.wsConn.SetCloseHandler(func(code int, text string) error {
+		// we authenticate with the handshake
+		t.connectionChanged(true)
+		c.report(nil)
+
+		wsConn.SetCloseHandler(func(code int, text string) error {
 			wsTransLogger.Warning("closed websocket, code: %d - message: %s", code, text)
 			return nil
 		})
@@ -100,21 +231,29 @@ func (t *WSTransport) newConn(closed chan struct{}, endpoint, bearerToken string
 
 			for {
 				// exit when connection got closed
-				isClosedRespChan := make(chan bool)
-				isClosed <- isClosedRespChan
-				if <-isClosedRespChan {
+				if c.closed() {
 					logger.Debug("stop reading from websocket")
 					break
 				}
 
 				// react message
-				mt, msg, err := c.wsConn.ReadMessage()
+				mt, msg, err := wsConn.ReadMessage()
 				if err != nil {
+					// the connection got closed or replaced on purpose
+					if c.closed() {
+						break
+					}
 					wsTransLogger.Error(err)
 					// Close the connect before sleep to be sure that everything related is closed
-					c.closer <- struct{}{}
-					time.Sleep(5 * time.Second)
-					closed <- struct{}{}
+					if err := c.Close(); err != nil {
+						wsTransLogger.Error(err)
+					}
+					t.connectionChanged(false)
+					select {
+					case <-time.After(t.reconnectBackoff.next()):
+						closed <- struct{}{}
+					case <-t.closer:
+					}
 					break
 				}
 				wsTransLogger.Debugf(
@@ -132,7 +271,11 @@ func (t *WSTransport) newConn(closed chan struct{}, endpoint, bearerToken string
 				}
 
 				// send to read channel so that it can be fetched from the NextMessage function
-				t.read <- m
+				select {
+				case t.read <- m:
+				case <-t.closer:
+					return
+				}
 
 			}
 
@@ -143,20 +286,23 @@ func (t *WSTransport) newConn(closed chan struct{}, endpoint, bearerToken string
 
 			for {
 
-				// exit when connection got closed
-				isClosedRespChan := make(chan bool)
-				isClosed <- isClosedRespChan
-				if <-isClosedRespChan {
-					logger.Debug("stop writing to websocket")
-					break
-				}
-
 				var msg (*bpb.BackendMessage)
 				select {
 				case msgToSend := <-t.write:
 					msg = msgToSend
 				case <-c.closer:
 					return
+				case <-t.closer:
+					return
+				}
+
+				// leave the message to the next connection
+				if c.closed() {
+					select {
+					case t.write <- msg:
+					case <-t.closer:
+					}
+					return
 				}
 
 				wsTransLogger.Debugf(
@@ -168,7 +314,7 @@ func (t *WSTransport) newConn(closed chan struct{}, endpoint, bearerToken string
 					wsTransLogger.Error(err)
 					continue
 				}
-				if err := c.wsConn.WriteMessage(gws.BinaryMessage, rawMsg); err != nil {
+				if err := wsConn.WriteMessage(gws.BinaryMessage, rawMsg); err != nil {
 					wsTransLogger.Error(err)
 				}
 
@@ -181,7 +327,65 @@ func (t *WSTransport) newConn(closed chan struct{}, endpoint, bearerToken string
 	return c
 }
 
-func NewWSTransport(endpoint, bearerToken string, km *keyManager.KeyManager) *WSTransport {
+// register a listener that is called when we got
+// disconnected and once we (re)connected
+func (t *WSTransport) OnConnectionChange(fn func(connected bool)) {
+	t.connListenerLock.Lock()
+	defer t.connListenerLock.Unlock()
+	t.connListeners = append(t.connListeners, fn)
+}
+
+func (t *WSTransport) connectionChanged(connected bool) {
+	t.connListenerLock.Lock()
+	listeners := append([]func(connected bool){}, t.connListeners...)
+	t.connListenerLock.Unlock()
+	for _, l := range listeners {
+		l(connected)
+	}
+}
+
+// fetch a new bearer token with the refresh callback
+// the new token is used for all following connections
+func (t *WSTransport) refreshToken() (string, bool) {
+	if t.refreshBearerToken == nil {
+		return "", false
+	}
+	token, err := t.refreshBearerToken()
+	if err != nil {
+		wsTransLogger.Error(err)
+		return "", false
+	}
+	t.setBearerToken(token)
+	return token, true
+}
+
+func (t *WSTransport) currentBearerToken() string {
+	t.bearerTokenLock.Lock()
+	defer t.bearerTokenLock.Unlock()
+	return t.bearerToken
+}
+
+func (t *WSTransport) setBearerToken(token string) {
+	t.bearerTokenLock.Lock()
+	defer t.bearerTokenLock.Unlock()
+	t.bearerToken = token
+}
+
+// headers sent with the websocket handshake
+// the extra headers can't replace the authentication headers
+func (t *WSTransport) handshakeHeader(signedToken []byte, identityKey string) http.Header {
+	header := http.Header{}
+	for k, v := range t.extraHeaders {
+		header.Set(k, v)
+	}
+	header["Bearer"] = []string{base64.StdEncoding.EncodeToString(signedToken)}
+	header["Identity"] = []string{identityKey}
+	return header
+}
+
+func NewWSTransport(conf ServerConfig, km *keyManager.KeyManager) *WSTransport {
+
+	endpoint := conf.WebSocketUrl
 
 	// construct ws transport
 	wst := &WSTransport{
@@ -189,27 +393,38 @@ func NewWSTransport(endpoint, bearerToken string, km *keyManager.KeyManager) *WS
 		write:  make(chan *bpb.BackendMessage, 100),
 		read:   make(chan *bpb.BackendMessage, 100),
 		km:     km,
+		// buffered so that token updates don't wait for the reconnect routine
+		tokenUpdates:       make(chan tokenUpdate, 1),
+		bearerToken:        conf.BearerToken,
+		refreshBearerToken: conf.RefreshBearerToken,
+		extraHeaders:       conf.ExtraHeaders,
+		reconnectBackoff:   newBackoff(conf.ReconnectMinInterval, conf.ReconnectMaxInterval),
 	}
 
+	// create initial connection - dialing happens in the background
+	connClosed := make(chan struct{}, 5)
+	wst.setConn(wst.newConn(connClosed, endpoint, wst.currentBearerToken(), nil))
+
 	// routine that keeps track of the connection
 	// close and re connect
-	connClosed := make(chan struct{}, 5)
 	go func() {
 		for {
 			select {
 			case <-wst.closer:
 				return
 			case <-connClosed:
-				wst.conn = wst.newConn(connClosed, endpoint, bearerToken)
+				wst.setConn(wst.newConn(connClosed, endpoint, wst.currentBearerToken(), nil))
+			case update := <-wst.tokenUpdates:
+				// reconnect with the new token
+				wst.setBearerToken(update.token)
+				if c := wst.currentConn(); c != nil {
+					c.replace()
+				}
+				wst.setConn(wst.newConn(connClosed, endpoint, update.token, update.result))
 			}
 		}
 	}()
 
-	// create initial connection
-	go func() {
-		wst.conn = wst.newConn(connClosed, endpoint, bearerToken)
-	}()
-
 	return wst
 
 }
@@ -223,10 +438,61 @@ func (t *WSTransport) NextMessage() (*bpb.BackendMessage, error) {
 	return <-t.read, nil
 }
 
+// the transport authenticates when dialing so we reconnect
+// with the new token. Returns once the new connection is
+// established or with the error of the first failed dial.
+func (t *WSTransport) UpdateBearerToken(token string) error {
+	update := tokenUpdate{
+		token:  token,
+		result: make(chan error, 1),
+	}
+	select {
+	case t.tokenUpdates <- update:
+	case <-t.closer:
+		return errTransportClosed
+	}
+	select {
+	case err := <-update.result:
+		return err
+	case <-t.closer:
+		return errTransportClosed
+	}
+}
+
+func (t *WSTransport) currentConn() *conn {
+	t.connLock.Lock()
+	defer t.connLock.Unlock()
+	return t.conn
+}
+
+func (t *WSTransport) setConn(c *conn) {
+	t.connLock.Lock()
+	defer t.connLock.Unlock()
+	t.conn = c
+}
+
+func (t *WSTransport) Connected() bool {
+	c := t.currentConn()
+	if c == nil {
+		return false
+	}
+	connected := make(chan bool, 1)
+	select {
+	case c.isConnected <- connected:
+		return <-connected
+	case <-c.closer:
+		return false
+	case <-t.closer:
+		return false
+	}
+}
+
 func (t *WSTransport) Close() error {
-	t.closer <- struct{}{}
-	if t.conn == nil {
+	// all routines of the transport listen on the closer
+	close(t.closer)
+	c := t.currentConn()
+	if c == nil {
 		return nil
 	}
-	return t.conn.Close()
+	return c.Close()
 }
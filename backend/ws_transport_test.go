@@ -1,7 +1,9 @@
 package backend
 
 import (
+	"encoding/base64"
 	"net/http"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -22,7 +24,8 @@ func TestWSTransport_Send(t *testing.T) {
 	require.Nil(t, err)
 	ks, err := keyStore.NewFromMnemonic(mne)
 	require.Nil(t, err)
-	km := keyManager.CreateFromKeyStore(ks)
+	km, err := keyManager.CreateFromKeyStore(ks)
+	require.Nil(t, err)
 
 	// setup test websocket server
 	router := mux.Router{}
@@ -54,7 +57,7 @@ func TestWSTransport_Send(t *testing.T) {
 	}()
 
 	// setup new transport
-	trans := NewWSTransport("ws://127.0.0.1:3857/ws", "", km)
+	trans := NewWSTransport(ServerConfig{WebSocketUrl: "ws://127.0.0.1:3857/ws"}, km)
 
 	// send test message to transport
 	err = trans.Send(&bpb.BackendMessage{
@@ -82,7 +85,8 @@ func TestWSTransport_NextMessage(t *testing.T) {
 	require.Nil(t, err)
 	ks, err := keyStore.NewFromMnemonic(mne)
 	require.Nil(t, err)
-	km := keyManager.CreateFromKeyStore(ks)
+	km, err := keyManager.CreateFromKeyStore(ks)
+	require.Nil(t, err)
 
 	// setup test websocket server
 	router := mux.Router{}
@@ -118,10 +122,303 @@ func TestWSTransport_NextMessage(t *testing.T) {
 		server.ListenAndServe()
 	}()
 
-	trans := NewWSTransport("ws://127.0.0.1:3857/ws", "", km)
+	trans := NewWSTransport(ServerConfig{WebSocketUrl: "ws://127.0.0.1:3857/ws"}, km)
 
 	msg, err := trans.NextMessage()
 	require.Nil(t, err)
 	require.Equal(t, "request-id", msg.RequestID)
 
 }
+
+func TestWSTransport_handshakeHeader(t *testing.T) {
+
+	trans := &WSTransport{
+		extraHeaders: map[string]string{
+			"X-App-Version": "1.0.0",
+			// must not replace the authentication
+			"Identity": "fake",
+		},
+	}
+
+	header := trans.handshakeHeader([]byte("token"), "identity")
+	require.Equal(t, "1.0.0", header.Get("X-App-Version"))
+	require.Equal(t, []string{"identity"}, header["Identity"])
+	require.Equal(t, []string{base64.StdEncoding.EncodeToString([]byte("token"))}, header["Bearer"])
+
+}
+
+func TestWSTransport_UpdateBearerToken(t *testing.T) {
+
+	// key manager setup
+	mne, err := mnemonic.New()
+	require.Nil(t, err)
+	ks, err := keyStore.NewFromMnemonic(mne)
+	require.Nil(t, err)
+	km, err := keyManager.CreateFromKeyStore(ks)
+	require.Nil(t, err)
+
+	// the server only accepts these tokens
+	accepted := map[string]bool{}
+	for _, token := range []string{"valid", "refreshed"} {
+		signedToken, err := km.IdentitySign([]byte(token))
+		require.Nil(t, err)
+		accepted[base64.StdEncoding.EncodeToString(signedToken)] = true
+	}
+
+	// setup test websocket server
+	router := mux.Router{}
+	server := &http.Server{Addr: ":3858", Handler: &router}
+	defer server.Close()
+	upgrader := gws.Upgrader{}
+	router.HandleFunc("/ws", func(writer http.ResponseWriter, request *http.Request) {
+		if bearer := request.Header["Bearer"]; len(bearer) != 1 || !accepted[bearer[0]] {
+			writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		conn, err := upgrader.Upgrade(writer, request, nil)
+		if err != nil {
+			panic(err)
+		}
+		// keep the connection open till the client closes it
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+
+	// start websocket server
+	go func() {
+		server.ListenAndServe()
+	}()
+
+	trans := NewWSTransport(ServerConfig{
+		WebSocketUrl:         "ws://127.0.0.1:3858/ws",
+		BearerToken:          "valid",
+		ReconnectMinInterval: time.Millisecond * 10,
+		ReconnectMaxInterval: time.Millisecond * 50,
+	}, km)
+
+	// wait for the server to come up
+	timeout := time.After(time.Second * 2)
+	for !trans.Connected() {
+		select {
+		case <-timeout:
+			require.FailNow(t, "timed out")
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+
+	// rejected token
+	require.Equal(t, ErrAuthFailed, trans.UpdateBearerToken("expired"))
+	require.False(t, trans.Connected())
+
+	// accepted token
+	require.Nil(t, trans.UpdateBearerToken("valid"))
+	require.True(t, trans.Connected())
+
+}
+
+func TestWSTransport_RefreshBearerToken(t *testing.T) {
+
+	// key manager setup
+	mne, err := mnemonic.New()
+	require.Nil(t, err)
+	ks, err := keyStore.NewFromMnemonic(mne)
+	require.Nil(t, err)
+	km, err := keyManager.CreateFromKeyStore(ks)
+	require.Nil(t, err)
+
+	signedToken, err := km.IdentitySign([]byte("refreshed"))
+	require.Nil(t, err)
+	refreshedToken := base64.StdEncoding.EncodeToString(signedToken)
+
+	// setup test websocket server
+	router := mux.Router{}
+	server := &http.Server{Addr: ":3859", Handler: &router}
+	defer server.Close()
+	upgrader := gws.Upgrader{}
+	router.HandleFunc("/ws", func(writer http.ResponseWriter, request *http.Request) {
+		if bearer := request.Header["Bearer"]; len(bearer) != 1 || bearer[0] != refreshedToken {
+			writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		conn, err := upgrader.Upgrade(writer, request, nil)
+		if err != nil {
+			panic(err)
+		}
+		// keep the connection open till the client closes it
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+
+	// start websocket server
+	go func() {
+		server.ListenAndServe()
+	}()
+
+	// the initial token is rejected
+	trans := NewWSTransport(ServerConfig{
+		WebSocketUrl:         "ws://127.0.0.1:3859/ws",
+		BearerToken:          "expired",
+		ReconnectMinInterval: time.Millisecond * 10,
+		ReconnectMaxInterval: time.Millisecond * 50,
+		RefreshBearerToken: func() (string, error) {
+			return "refreshed", nil
+		},
+	}, km)
+
+	timeout := time.After(time.Second * 2)
+	for !trans.Connected() {
+		select {
+		case <-timeout:
+			require.FailNow(t, "timed out")
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+	require.Equal(t, "refreshed", trans.currentBearerToken())
+
+}
+
+func TestWSTransport_Reconnect(t *testing.T) {
+
+	// key manager setup
+	mne, err := mnemonic.New()
+	require.Nil(t, err)
+	ks, err := keyStore.NewFromMnemonic(mne)
+	require.Nil(t, err)
+	km, err := keyManager.CreateFromKeyStore(ks)
+	require.Nil(t, err)
+
+	// setup test websocket server
+	router := mux.Router{}
+	server := &http.Server{Addr: ":3860", Handler: &router}
+	defer server.Close()
+	upgrader := gws.Upgrader{}
+	reader := make(chan []byte, 10)
+	var connections int32
+	router.HandleFunc("/ws", func(writer http.ResponseWriter, request *http.Request) {
+		conn, err := upgrader.Upgrade(writer, request, nil)
+		if err != nil {
+			panic(err)
+		}
+		// drop the first two connections
+		if atomic.AddInt32(&connections, 1) <= 2 {
+			time.Sleep(time.Millisecond * 50)
+			conn.Close()
+			return
+		}
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			reader <- msg
+		}
+	})
+
+	// start websocket server
+	go func() {
+		server.ListenAndServe()
+	}()
+
+	trans := NewWSTransport(ServerConfig{
+		WebSocketUrl:         "ws://127.0.0.1:3860/ws",
+		ReconnectMinInterval: time.Millisecond * 10,
+		ReconnectMaxInterval: time.Millisecond * 50,
+	}, km)
+	defer trans.Close()
+
+	disconnected := make(chan struct{}, 10)
+	trans.OnConnectionChange(func(connected bool) {
+		if !connected {
+			disconnected <- struct{}{}
+		}
+	})
+
+	// two consecutive disconnects
+	for i := 0; i < 2; i++ {
+		select {
+		case <-disconnected:
+		case <-time.After(time.Second * 5):
+			require.FailNow(t, "timed out waiting for disconnect")
+		}
+	}
+
+	// requests sent while we are disconnected
+	require.Nil(t, trans.Send(&bpb.BackendMessage{RequestID: "request-0"}))
+	require.Nil(t, trans.Send(&bpb.BackendMessage{RequestID: "request-1"}))
+
+	// are sent once we reconnected
+	received := map[string]bool{}
+	for len(received) < 2 {
+		select {
+		case rawProtoMsg := <-reader:
+			msg := bpb.BackendMessage{}
+			require.Nil(t, proto.Unmarshal(rawProtoMsg, &msg))
+			received[msg.RequestID] = true
+		case <-time.After(time.Second * 5):
+			require.FailNow(t, "timed out waiting for requests")
+		}
+	}
+	require.True(t, received["request-0"])
+	require.True(t, received["request-1"])
+	require.Equal(t, int32(3), atomic.LoadInt32(&connections))
+
+}
+
+func TestWSTransport_CloseStopsDialing(t *testing.T) {
+
+	// key manager setup
+	mne, err := mnemonic.New()
+	require.Nil(t, err)
+	ks, err := keyStore.NewFromMnemonic(mne)
+	require.Nil(t, err)
+	km, err := keyManager.CreateFromKeyStore(ks)
+	require.Nil(t, err)
+
+	// setup test websocket server that rejects every dial
+	router := mux.Router{}
+	server := &http.Server{Addr: ":3861", Handler: &router}
+	defer server.Close()
+	var dials int32
+	router.HandleFunc("/ws", func(writer http.ResponseWriter, request *http.Request) {
+		atomic.AddInt32(&dials, 1)
+		writer.WriteHeader(http.StatusUnauthorized)
+	})
+
+	// start websocket server
+	go func() {
+		server.ListenAndServe()
+	}()
+
+	trans := NewWSTransport(ServerConfig{
+		WebSocketUrl:         "ws://127.0.0.1:3861/ws",
+		ReconnectMinInterval: time.Millisecond * 10,
+		ReconnectMaxInterval: time.Millisecond * 20,
+	}, km)
+
+	// wait till we dialed a few times
+	timeout := time.After(time.Second * 2)
+	for atomic.LoadInt32(&dials) < 3 {
+		select {
+		case <-timeout:
+			require.FailNow(t, "timed out")
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+
+	require.Nil(t, trans.Close())
+	require.False(t, trans.Connected())
+	require.Equal(t, errTransportClosed, trans.UpdateBearerToken("token"))
+
+	// no more dials after the transport got closed
+	time.Sleep(time.Millisecond * 50)
+	afterClose := atomic.LoadInt32(&dials)
+	time.Sleep(time.Millisecond * 100)
+	require.Equal(t, afterClose, atomic.LoadInt32(&dials))
+
+}
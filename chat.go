@@ -1,12 +1,148 @@
 package panthalassa
 
 import (
+	"bytes"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"strconv"
+
+	chat "github.com/Bit-Nation/panthalassa/chat"
+	groupChatMod "github.com/Bit-Nation/panthalassa/dapp/module/groupchat"
+	db "github.com/Bit-Nation/panthalassa/db"
+	ed25519 "golang.org/x/crypto/ed25519"
 )
 
+// makes the group chat available to DApps
+type groupMessenger struct {
+	chat *chat.Chat
+}
+
+func (m *groupMessenger) SendGroupMessage(groupID []byte, msg []byte) error {
+	return m.chat.SendGroupMessage(groupID, msg)
+}
+
+func (m *groupMessenger) OnGroupMessage(groupID []byte, fn func(msg groupChatMod.Message)) func() {
+	return m.chat.OnGroupMessage(groupID, func(msg chat.GroupMessage) {
+		fn(groupChatMod.Message{
+			Sender:    msg.Sender,
+			Message:   msg.Message,
+			CreatedAt: msg.CreatedAt,
+		})
+	})
+}
+
+// create a group with the members (json array of hex encoded identity keys)
+// returns the hex encoded group id
+func CreateGroup(members string) (string, error) {
+
+	// make sure panthalassa has been started
+	if panthalassaInstance == nil {
+		return "", errors.New("you have to start panthalassa first")
+	}
+
+	rawMembers := []string{}
+	if err := json.Unmarshal([]byte(members), &rawMembers); err != nil {
+		return "", err
+	}
+
+	memberKeys := []ed25519.PublicKey{}
+	for _, rawMember := range rawMembers {
+		member, err := hex.DecodeString(rawMember)
+		if err != nil {
+			return "", err
+		}
+		if len(member) != 32 {
+			return "", errors.New("member must have a length of 32 bytes")
+		}
+		memberKeys = append(memberKeys, member)
+	}
+
+	groupID, err := panthalassaInstance.chat.CreateGroup(memberKeys)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(groupID), nil
+
+}
+
+// decode the hex encoded group id and member
+func decodeGroupMember(groupIDHex, memberHex string) ([]byte, ed25519.PublicKey, error) {
+
+	groupID, err := hex.DecodeString(groupIDHex)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(groupID) != 32 {
+		return nil, nil, errors.New("group id must have a length of 32 bytes")
+	}
+
+	member, err := hex.DecodeString(memberHex)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(member) != 32 {
+		return nil, nil, errors.New("member must have a length of 32 bytes")
+	}
+
+	return groupID, member, nil
+
+}
+
+// add a member to a group we created
+func AddGroupMember(groupIDHex, memberHex string) error {
+
+	// make sure panthalassa has been started
+	if panthalassaInstance == nil {
+		return errors.New("you have to start panthalassa first")
+	}
+
+	groupID, member, err := decodeGroupMember(groupIDHex, memberHex)
+	if err != nil {
+		return err
+	}
+
+	return panthalassaInstance.chat.AddMember(groupID, member)
+
+}
+
+// remove a member from a group we created
+func RemoveGroupMember(groupIDHex, memberHex string) error {
+
+	// make sure panthalassa has been started
+	if panthalassaInstance == nil {
+		return errors.New("you have to start panthalassa first")
+	}
+
+	groupID, member, err := decodeGroupMember(groupIDHex, memberHex)
+	if err != nil {
+		return err
+	}
+
+	return panthalassaInstance.chat.RemoveMember(groupID, member)
+
+}
+
+func LeaveGroup(groupIDHex string) error {
+
+	// make sure panthalassa has been started
+	if panthalassaInstance == nil {
+		return errors.New("you have to start panthalassa first")
+	}
+
+	groupID, err := hex.DecodeString(groupIDHex)
+	if err != nil {
+		return err
+	}
+	if len(groupID) != 32 {
+		return errors.New("group id must have a length of 32 bytes")
+	}
+
+	return panthalassaInstance.chat.LeaveGroup(groupID)
+
+}
+
 func SendMessage(partner, message string) error {
 
 	// make sure panthalassa has been started
@@ -55,6 +191,32 @@ func AllChats() (string, error) {
 	return string(chatList), nil
 }
 
+// all chats - the chat with the latest message first
+func AllChatsSortedByActivity() (string, error) {
+
+	// make sure panthalassa has been started
+	if panthalassaInstance == nil {
+		return "", errors.New("you have to start panthalassa first")
+	}
+
+	chats, err := panthalassaInstance.msgDB.AllChatsSortedByActivity()
+	if err != nil {
+		return "", err
+	}
+
+	chatsStr := []string{}
+	for _, chat := range chats {
+		chatsStr = append(chatsStr, hex.EncodeToString(chat))
+	}
+
+	chatList, err := json.Marshal(chatsStr)
+	if err != nil {
+		return "", err
+	}
+
+	return string(chatList), nil
+}
+
 func Messages(partner string, startStr string, amount int) (string, error) {
 
 	// unmarshal start
@@ -85,6 +247,69 @@ func Messages(partner string, startStr string, amount int) (string, error) {
 		return "", err
 	}
 
+	return marshalMessages(databaseMessages)
+
+}
+
+// fetch the messages of a chat that belong to the given DApp
+func GetDAppMessages(signingKeyHex string, partnerHex string, start int64, amount int) (string, error) {
+
+	// make sure panthalassa has been started
+	if panthalassaInstance == nil {
+		return "", errors.New("you have to start panthalassa first")
+	}
+
+	// DApp signing key
+	signingKey, err := hex.DecodeString(signingKeyHex)
+	if err != nil {
+		return "", err
+	}
+	if len(signingKey) != 32 {
+		return "", errors.New("signing key must have a length of 32 bytes")
+	}
+
+	// partner public key
+	partnerPub, err := hex.DecodeString(partnerHex)
+	if err != nil {
+		return "", err
+	}
+	if len(partnerPub) != 32 {
+		return "", errors.New("partner must have a length of 32 bytes")
+	}
+
+	databaseMessages, err := panthalassaInstance.chat.Messages(partnerPub, start, uint(amount))
+	if err != nil {
+		return "", err
+	}
+
+	// only keep messages of the DApp
+	dAppMessages := []db.Message{}
+	for _, msg := range databaseMessages {
+		if msg.DApp != nil && bytes.Equal(msg.DApp.DAppPublicKey, signingKey) {
+			dAppMessages = append(dAppMessages, msg)
+		}
+	}
+
+	return marshalMessages(dAppMessages)
+
+}
+
+// marshal database messages for the client
+func marshalMessages(databaseMessages []db.Message) (string, error) {
+
+	// marshal messages
+	messages, err := json.Marshal(toPlainMessages(databaseMessages))
+	if err != nil {
+		return "", err
+	}
+
+	return string(messages), nil
+
+}
+
+// turn database messages into the format the client expects
+func toPlainMessages(databaseMessages []db.Message) []map[string]interface{} {
+
 	// plain messages
 	plainMessages := []map[string]interface{}{}
 
@@ -108,12 +333,85 @@ func Messages(partner string, startStr string, amount int) (string, error) {
 		})
 	}
 
-	// marshal messages
-	messages, err := json.Marshal(plainMessages)
+	return plainMessages
+
+}
+
+// forward a message to another partner
+func ForwardMessage(originalPartnerHex string, dbID int64, newReceiverHex string) error {
+
+	// make sure panthalassa has been started
+	if panthalassaInstance == nil {
+		return errors.New("you have to start panthalassa first")
+	}
+
+	// partner the message was exchanged with
+	originalPartner, err := hex.DecodeString(originalPartnerHex)
+	if err != nil {
+		return err
+	}
+	if len(originalPartner) != 32 {
+		return errors.New("original partner must have a length of 32 bytes")
+	}
+
+	// partner to forward the message to
+	newReceiver, err := hex.DecodeString(newReceiverHex)
+	if err != nil {
+		return err
+	}
+	if len(newReceiver) != 32 {
+		return errors.New("receiver must have a length of 32 bytes")
+	}
+
+	return panthalassaInstance.chat.ForwardMessage(originalPartner, dbID, newReceiver)
+
+}
+
+// tell the partner that we read their messages up to
+// the received message with the given database id
+func SendReadReceipt(partnerHex string, readUpToDBID int64) error {
+
+	// make sure panthalassa has been started
+	if panthalassaInstance == nil {
+		return errors.New("you have to start panthalassa first")
+	}
+
+	partner, err := hex.DecodeString(partnerHex)
+	if err != nil {
+		return err
+	}
+	if len(partner) != 32 {
+		return errors.New("partner must have a length of 32 bytes")
+	}
+
+	return panthalassaInstance.chat.SendReadReceipt(partner, readUpToDBID)
+
+}
+
+// fetch all messages that haven't been sent yet
+// grouped by the hex encoded partner key
+func GetUnsentMessages() (string, error) {
+
+	// make sure panthalassa has been started
+	if panthalassaInstance == nil {
+		return "", errors.New("you have to start panthalassa first")
+	}
+
+	unsent, err := panthalassaInstance.chat.GetUnsentMessages()
 	if err != nil {
 		return "", err
 	}
 
-	return string(messages), nil
+	plainUnsent := map[string][]map[string]interface{}{}
+	for partner, messages := range unsent {
+		plainUnsent[partner] = toPlainMessages(messages)
+	}
+
+	rawUnsent, err := json.Marshal(plainUnsent)
+	if err != nil {
+		return "", err
+	}
+
+	return string(rawUnsent), nil
 
 }
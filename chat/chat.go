@@ -3,6 +3,9 @@ package chat
 import (
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
 
 	backend "github.com/Bit-Nation/panthalassa/backend"
 	preKey "github.com/Bit-Nation/panthalassa/chat/prekey"
@@ -19,15 +22,29 @@ import (
 
 var logger = log.Logger("chat")
 
+const (
+	// interval in which the maintenance tasks run
+	maintenanceInterval = time.Hour * 24
+	// accepted shared secrets older than this are deleted
+	sharedSecretMaxAge = time.Hour * 24 * 30
+)
+
 type Backend interface {
 	FetchPreKeyBundle(userIDPubKey ed25519.PublicKey) (x3dh.PreKeyBundle, error)
 	SubmitMessages(messages []*bpb.ChatMessage) error
 	FetchSignedPreKey(userIdPubKey ed25519.PublicKey) (preKey.PreKey, error)
+	UploadSignedPreKey(signedPreKey preKey.PreKey) error
 	AddRequestHandler(handler backend.RequestHandler)
+	Connected() bool
+	Authenticated() bool
 	Close() error
 }
 
 type Chat struct {
+	// accessed atomically - must stay at the top
+	// of the struct to be aligned on 32 bit platforms
+	stats ChatStats
+
 	messageDB            db.ChatMessageStorage
 	backend              Backend
 	sharedSecStorage     db.SharedSecretStorage
@@ -39,6 +56,32 @@ type Chat struct {
 	userStorage          db.UserStorage
 	uiApi                *uiapi.Api
 	queue                *queue.Queue
+	// hex encoded identity key -> cachedBundle
+	preKeyBundleCache      sync.Map
+	preKeyBundleRefreshing sync.Map
+	// stops the maintenance routine
+	closer chan struct{}
+	// sender public key ([32]byte) -> *senderLimiter
+	senderRateLimiter sync.Map
+	senderRateLock    sync.RWMutex
+	senderRate        float64
+	senderBurst       int
+	// holds the latest connection status
+	connectStatus chan ConnectStatus
+	// hex encoded group id -> *group.GroupSession
+	groupSessions sync.Map
+	// hex encoded group id || hex encoded sender -> group.SenderKey
+	groupSenderKeys sync.Map
+	groupListeners  groupListeners
+	// metadata of the groups we are a member of
+	groupDB db.GroupChatStorage
+	// signed pre keys older than this are rotated / refreshed
+	signedPreKeyValidity time.Duration
+	signedPreKeyLock     sync.Mutex
+	// used to determine if our signed pre key expired
+	now func() time.Time
+	// removes the listener that informs the ui about persisted messages
+	removePersistedListener func()
 }
 
 func (c *Chat) AllChats() ([]ed25519.PublicKey, error) {
@@ -49,6 +92,37 @@ func (c *Chat) Messages(partner ed25519.PublicKey, start int64, amount uint) ([]
 	return c.messageDB.Messages(partner, start, amount)
 }
 
+// fetch all messages that haven't been sent yet
+// the messages are grouped by the hex encoded partner key
+func (c *Chat) GetUnsentMessages() (map[string][]db.Message, error) {
+
+	partners, err := c.messageDB.AllChats()
+	if err != nil {
+		return nil, err
+	}
+
+	unsent := map[string][]db.Message{}
+	for _, partner := range partners {
+		for _, status := range []db.Status{db.StatusPersisted, db.StatusFailedToSend} {
+			messages, err := c.messageDB.GetMessagesByStatus(partner, status)
+			if err != nil {
+				return nil, err
+			}
+			// received messages are persisted too
+			for _, msg := range messages {
+				if msg.Received {
+					continue
+				}
+				key := hex.EncodeToString(partner)
+				unsent[key] = append(unsent[key], msg)
+			}
+		}
+	}
+
+	return unsent, nil
+
+}
+
 type Config struct {
 	MessageDB            db.ChatMessageStorage
 	Backend              Backend
@@ -60,12 +134,43 @@ type Config struct {
 	UserStorage          db.UserStorage
 	UiApi                *uiapi.Api
 	Queue                *queue.Queue
+	GroupChatStorage     db.GroupChatStorage
+	// defaults to db.SignedPreKeyValidTimeFrame
+	SignedPreKeyValidity time.Duration
 }
 
 func (c *Chat) Close() error {
+	if c.closer != nil {
+		close(c.closer)
+	}
+	if c.removePersistedListener != nil {
+		c.removePersistedListener()
+	}
 	return c.backend.Close()
 }
 
+// clean up data that is no longer needed
+func (c *Chat) maintenance() {
+	ticker := time.NewTicker(maintenanceInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.closer:
+			return
+		case <-ticker.C:
+			deleted, err := c.sharedSecStorage.CleanupExpired(sharedSecretMaxAge)
+			if err != nil {
+				logger.Error(err)
+				continue
+			}
+			logger.Infof("deleted %d expired shared secrets", deleted)
+			if err := c.rotateSignedPreKeyIfExpired(); err != nil {
+				logger.Error(err)
+			}
+		}
+	}
+}
+
 func NewChat(conf Config) (*Chat, error) {
 
 	// my chat id key pair
@@ -90,6 +195,11 @@ func NewChat(conf Config) (*Chat, error) {
 		userStorage:          conf.UserStorage,
 		uiApi:                conf.UiApi,
 		queue:                conf.Queue,
+		closer:               make(chan struct{}),
+		connectStatus:        make(chan ConnectStatus, 1),
+		signedPreKeyValidity: conf.SignedPreKeyValidity,
+		groupDB:              conf.GroupChatStorage,
+		now:                  time.Now,
 	}
 
 	err = c.queue.RegisterProcessor(&SubmitMessagesProcessor{
@@ -101,8 +211,13 @@ func NewChat(conf Config) (*Chat, error) {
 		return nil, err
 	}
 
+	// restore the groups we are a member of
+	if err := c.loadGroups(); err != nil {
+		return nil, err
+	}
+
 	// add message handler that will inform the ui about updates
-	c.messageDB.AddListener(c.handlePersistedMessage)
+	c.removePersistedListener = c.messageDB.AddListener(c.handlePersistedMessage)
 
 	// register messages handler
 	c.backend.AddRequestHandler(c.messagesHandler)
@@ -110,5 +225,9 @@ func NewChat(conf Config) (*Chat, error) {
 	// register now one time pre key handler
 	c.backend.AddRequestHandler(c.oneTimePreKeysHandler)
 
+	go c.maintenance()
+	go c.watchConnectStatus()
+	go c.sweepSenderLimiters()
+
 	return c, nil
 }
@@ -0,0 +1,94 @@
+package chat
+
+import (
+	"encoding/hex"
+	"testing"
+
+	db "github.com/Bit-Nation/panthalassa/db"
+	require "github.com/stretchr/testify/require"
+	ed25519 "golang.org/x/crypto/ed25519"
+)
+
+func TestChat_GetUnsentMessages(t *testing.T) {
+
+	partner := make(ed25519.PublicKey, 32)
+	partner[0] = 1
+
+	msgStorage := testMessageStorage{
+		allChats: func() ([]ed25519.PublicKey, error) {
+			return []ed25519.PublicKey{partner}, nil
+		},
+		getMessagesByStatus: func(p ed25519.PublicKey, status db.Status) ([]db.Message, error) {
+			require.Equal(t, partner, p)
+			switch status {
+			case db.StatusPersisted:
+				return []db.Message{
+					db.Message{ID: "persisted"},
+					// received messages are not unsent
+					db.Message{ID: "received", Received: true},
+				}, nil
+			case db.StatusFailedToSend:
+				return []db.Message{
+					db.Message{ID: "failed"},
+				}, nil
+			}
+			return nil, nil
+		},
+	}
+
+	c := Chat{
+		messageDB: &msgStorage,
+	}
+
+	unsent, err := c.GetUnsentMessages()
+	require.Nil(t, err)
+	require.Equal(t, 1, len(unsent))
+
+	messages := unsent[hex.EncodeToString(partner)]
+	require.Equal(t, 2, len(messages))
+	require.Equal(t, "persisted", messages[0].ID)
+	require.Equal(t, "failed", messages[1].ID)
+
+}
+
+func TestChat_ForwardMessage(t *testing.T) {
+
+	original := ed25519.PublicKey{1}
+	receiver := ed25519.PublicKey{2}
+
+	var forwarded db.Message
+	msgStorage := testMessageStorage{
+		getMessage: func(partner ed25519.PublicKey, messageID int64) (*db.Message, error) {
+			require.Equal(t, original, partner)
+			if messageID == 2 {
+				return &db.Message{
+					DApp: &db.DAppMessage{},
+				}, nil
+			}
+			require.Equal(t, int64(1), messageID)
+			return &db.Message{
+				ID:       "original-id",
+				Message:  []byte("hi"),
+				Received: true,
+			}, nil
+		},
+		persistMessageToSend: func(to ed25519.PublicKey, msg db.Message) error {
+			require.Equal(t, receiver, to)
+			forwarded = msg
+			return nil
+		},
+	}
+
+	c := Chat{
+		messageDB: &msgStorage,
+	}
+
+	require.Nil(t, c.ForwardMessage(original, 1, receiver))
+	require.Equal(t, []byte("hi"), forwarded.Message)
+	require.Equal(t, []byte(original), forwarded.ForwardedFrom)
+	// storage will assign a fresh id
+	require.Equal(t, "", forwarded.ID)
+
+	require.EqualError(t, c.ForwardMessage(original, 2, receiver), "can't forward DApp messages")
+
+}
@@ -0,0 +1,79 @@
+package chat
+
+import (
+	"time"
+)
+
+// state of the connection to the chat backend
+type ConnectStatus int
+
+const (
+	Disconnected ConnectStatus = iota
+	Connecting
+	Connected
+	AuthFailed
+)
+
+// the transport reconnects on it's own
+// so we check the backend on this interval
+const connectStatusInterval = time.Millisecond * 500
+
+func (s ConnectStatus) String() string {
+	switch s {
+	case Connecting:
+		return "connecting"
+	case Connected:
+		return "connected"
+	case AuthFailed:
+		return "auth_failed"
+	default:
+		return "disconnected"
+	}
+}
+
+// the channel always holds the latest status
+// and is closed once the chat got closed
+func (c *Chat) ConnectStatusChan() <-chan ConnectStatus {
+	return c.connectStatus
+}
+
+func currentConnectStatus(b Backend) ConnectStatus {
+	if !b.Authenticated() {
+		return AuthFailed
+	}
+	if b.Connected() {
+		return Connected
+	}
+	return Connecting
+}
+
+// replace the status in the channel with the latest one
+// must only be called from the watch routine
+func (c *Chat) setConnectStatus(s ConnectStatus) {
+	select {
+	case <-c.connectStatus:
+	default:
+	}
+	c.connectStatus <- s
+}
+
+// follow the connection state of the backend
+func (c *Chat) watchConnectStatus() {
+	ticker := time.NewTicker(connectStatusInterval)
+	defer ticker.Stop()
+	status := Disconnected
+	c.setConnectStatus(status)
+	for {
+		select {
+		case <-c.closer:
+			c.setConnectStatus(Disconnected)
+			close(c.connectStatus)
+			return
+		case <-ticker.C:
+			if newStatus := currentConnectStatus(c.backend); newStatus != status {
+				status = newStatus
+				c.setConnectStatus(status)
+			}
+		}
+	}
+}
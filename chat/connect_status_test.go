@@ -0,0 +1,50 @@
+package chat
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	require "github.com/stretchr/testify/require"
+)
+
+func TestChat_ConnectStatusChan(t *testing.T) {
+
+	var connected int32
+	c := &Chat{
+		backend: &testBackend{
+			connected: func() bool {
+				return atomic.LoadInt32(&connected) == 1
+			},
+			authenticated: func() bool {
+				return true
+			},
+		},
+		closer:        make(chan struct{}),
+		connectStatus: make(chan ConnectStatus, 1),
+	}
+	go c.watchConnectStatus()
+
+	next := func() ConnectStatus {
+		select {
+		case s := <-c.ConnectStatusChan():
+			return s
+		case <-time.After(time.Second * 2):
+			require.FailNow(t, "timed out")
+		}
+		return Disconnected
+	}
+
+	require.Equal(t, Disconnected, next())
+	require.Equal(t, Connecting, next())
+
+	atomic.StoreInt32(&connected, 1)
+	require.Equal(t, Connected, next())
+
+	// the channel is closed with the chat
+	close(c.closer)
+	require.Equal(t, Disconnected, next())
+	_, open := <-c.ConnectStatusChan()
+	require.False(t, open)
+
+}
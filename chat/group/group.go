@@ -0,0 +1,193 @@
+package group
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	ed25519 "golang.org/x/crypto/ed25519"
+)
+
+// Group messages follow the sender keys protocol. Every member
+// has an own sender key that is distributed to the other members
+// over the pairwise chats. Messages are encrypted once with the
+// sender key and signed with the signing key of the sender.
+
+var InvalidSignature = errors.New("invalid group message signature")
+
+// our session in a group
+type GroupSession struct {
+	GroupID    [32]byte
+	SenderKey  [32]byte
+	SigningKey ed25519.PrivateKey
+	// members we share the group with (excluding our self)
+	Members []ed25519.PublicKey
+}
+
+// sender key of another member
+type SenderKey struct {
+	Key        [32]byte
+	SigningKey ed25519.PublicKey
+}
+
+// sent to every member of the group
+type SenderKeyDistribution struct {
+	GroupID    []byte   `json:"group_id"`
+	SenderKey  []byte   `json:"sender_key"`
+	SigningKey []byte   `json:"signing_key"`
+	Members    [][]byte `json:"members"`
+}
+
+// sender key message header + encrypted message
+type Message struct {
+	GroupID    []byte `json:"group_id"`
+	Nonce      []byte `json:"nonce"`
+	CipherText []byte `json:"cipher_text"`
+	Signature  []byte `json:"signature"`
+}
+
+func validMembers(members []ed25519.PublicKey) error {
+	if len(members) == 0 {
+		return errors.New("a group needs at least one member")
+	}
+	for _, m := range members {
+		if len(m) != 32 {
+			return fmt.Errorf("invalid member public key of length %d", len(m))
+		}
+	}
+	return nil
+}
+
+// create a session for a new group
+func NewGroupSession(members []ed25519.PublicKey) (*GroupSession, error) {
+	var groupID [32]byte
+	if _, err := rand.Read(groupID[:]); err != nil {
+		return nil, err
+	}
+	return JoinGroupSession(groupID, members)
+}
+
+// create our session for a group we got invited to
+func JoinGroupSession(groupID [32]byte, members []ed25519.PublicKey) (*GroupSession, error) {
+
+	if err := validMembers(members); err != nil {
+		return nil, err
+	}
+
+	s := &GroupSession{
+		GroupID: groupID,
+		Members: members,
+	}
+
+	if _, err := rand.Read(s.SenderKey[:]); err != nil {
+		return nil, err
+	}
+
+	_, signingKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	s.SigningKey = signingKey
+
+	return s, nil
+
+}
+
+// distribution of our sender key
+func (s *GroupSession) Distribution() SenderKeyDistribution {
+	members := make([][]byte, len(s.Members))
+	for i, m := range s.Members {
+		members[i] = m
+	}
+	return SenderKeyDistribution{
+		GroupID:    s.GroupID[:],
+		SenderKey:  s.SenderKey[:],
+		SigningKey: s.SigningKey.Public().(ed25519.PublicKey),
+		Members:    members,
+	}
+}
+
+// validate the distribution and extract the sender key
+func (d SenderKeyDistribution) Key() (SenderKey, error) {
+	if len(d.GroupID) != 32 {
+		return SenderKey{}, errors.New("group id must be 32 bytes long")
+	}
+	if len(d.SenderKey) != 32 {
+		return SenderKey{}, errors.New("sender key must be 32 bytes long")
+	}
+	if len(d.SigningKey) != ed25519.PublicKeySize {
+		return SenderKey{}, errors.New("signing key must be 32 bytes long")
+	}
+	k := SenderKey{
+		SigningKey: d.SigningKey,
+	}
+	copy(k.Key[:], d.SenderKey)
+	return k, nil
+}
+
+// data covered by the signature of a message
+func signedData(m Message) []byte {
+	b := bytes.NewBuffer(nil)
+	b.Write(m.GroupID)
+	b.Write(m.Nonce)
+	b.Write(m.CipherText)
+	return b.Bytes()
+}
+
+// encrypt a message with our sender key
+func (s *GroupSession) Encrypt(plainText []byte) (Message, error) {
+
+	block, err := aes.NewCipher(s.SenderKey[:])
+	if err != nil {
+		return Message{}, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return Message{}, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return Message{}, err
+	}
+
+	m := Message{
+		GroupID:    s.GroupID[:],
+		Nonce:      nonce,
+		CipherText: gcm.Seal(nil, nonce, plainText, s.GroupID[:]),
+	}
+	m.Signature = ed25519.Sign(s.SigningKey, signedData(m))
+
+	return m, nil
+
+}
+
+// verify and decrypt a message with the sender key of the sender
+func Decrypt(m Message, key SenderKey) ([]byte, error) {
+
+	if len(m.GroupID) != 32 {
+		return nil, errors.New("group id must be 32 bytes long")
+	}
+
+	if !ed25519.Verify(key.SigningKey, signedData(m), m.Signature) {
+		return nil, InvalidSignature
+	}
+
+	block, err := aes.NewCipher(key.Key[:])
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(m.Nonce) != gcm.NonceSize() {
+		return nil, errors.New("invalid nonce size")
+	}
+
+	return gcm.Open(nil, m.Nonce, m.CipherText, m.GroupID)
+
+}
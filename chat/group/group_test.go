@@ -0,0 +1,46 @@
+package group
+
+import (
+	"crypto/rand"
+	"testing"
+
+	require "github.com/stretchr/testify/require"
+	ed25519 "golang.org/x/crypto/ed25519"
+)
+
+func TestGroupSession_EncryptDecrypt(t *testing.T) {
+
+	member, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+
+	s, err := NewGroupSession([]ed25519.PublicKey{member})
+	require.Nil(t, err)
+
+	// the member gets our sender key
+	key, err := s.Distribution().Key()
+	require.Nil(t, err)
+
+	msg, err := s.Encrypt([]byte("hi"))
+	require.Nil(t, err)
+	require.Equal(t, s.GroupID[:], msg.GroupID)
+
+	plain, err := Decrypt(msg, key)
+	require.Nil(t, err)
+	require.Equal(t, []byte("hi"), plain)
+
+	// manipulated messages are rejected
+	msg.CipherText[0] ^= 0xff
+	_, err = Decrypt(msg, key)
+	require.Equal(t, InvalidSignature, err)
+
+}
+
+func TestNewGroupSessionInvalidMembers(t *testing.T) {
+
+	_, err := NewGroupSession([]ed25519.PublicKey{})
+	require.EqualError(t, err, "a group needs at least one member")
+
+	_, err = NewGroupSession([]ed25519.PublicKey{[]byte("too short")})
+	require.EqualError(t, err, "invalid member public key of length 9")
+
+}
@@ -0,0 +1,75 @@
+package group
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+
+	ed25519 "golang.org/x/crypto/ed25519"
+)
+
+var InvalidMetadataSignature = errors.New("group metadata must be signed by the creator")
+
+// members of a group as decided by the creator. Every change
+// of the members is a new version signed by the creator.
+type Metadata struct {
+	GroupID []byte `json:"group_id"`
+	Creator []byte `json:"creator"`
+	// all members including the creator
+	Members   [][]byte `json:"members"`
+	Version   uint64   `json:"version"`
+	Signature []byte   `json:"signature"`
+}
+
+// data covered by the signature of the creator
+func (m Metadata) SignedData() []byte {
+	b := bytes.NewBuffer(nil)
+	b.Write(m.GroupID)
+	b.Write(m.Creator)
+	for _, member := range m.Members {
+		b.Write(member)
+	}
+	version := make([]byte, 8)
+	binary.BigEndian.PutUint64(version, m.Version)
+	b.Write(version)
+	return b.Bytes()
+}
+
+// validate the metadata and the signature of the creator
+func (m Metadata) Verify() error {
+	if len(m.GroupID) != 32 {
+		return errors.New("group id must be 32 bytes long")
+	}
+	if len(m.Creator) != ed25519.PublicKeySize {
+		return errors.New("creator must be 32 bytes long")
+	}
+	for _, member := range m.Members {
+		if len(member) != ed25519.PublicKeySize {
+			return errors.New("member must be 32 bytes long")
+		}
+	}
+	if !ed25519.Verify(m.Creator, m.SignedData(), m.Signature) {
+		return InvalidMetadataSignature
+	}
+	return nil
+}
+
+func (m Metadata) IsMember(key ed25519.PublicKey) bool {
+	for _, member := range m.Members {
+		if bytes.Equal(member, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// all members except the given key
+func (m Metadata) MembersExcept(key ed25519.PublicKey) []ed25519.PublicKey {
+	members := []ed25519.PublicKey{}
+	for _, member := range m.Members {
+		if !bytes.Equal(member, key) {
+			members = append(members, member)
+		}
+	}
+	return members
+}
@@ -0,0 +1,41 @@
+package group
+
+import (
+	"crypto/rand"
+	"testing"
+
+	require "github.com/stretchr/testify/require"
+	ed25519 "golang.org/x/crypto/ed25519"
+)
+
+func TestMetadata_Verify(t *testing.T) {
+
+	creator, creatorPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	member, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+
+	m := Metadata{
+		GroupID: make([]byte, 32),
+		Creator: creator,
+		Members: [][]byte{creator, member},
+		Version: 1,
+	}
+	m.Signature = ed25519.Sign(creatorPriv, m.SignedData())
+	require.Nil(t, m.Verify())
+
+	require.True(t, m.IsMember(member))
+	require.Equal(t, []ed25519.PublicKey{creator}, m.MembersExcept(member))
+
+	// changing the version invalidates the signature
+	m.Version = 2
+	require.Equal(t, InvalidMetadataSignature, m.Verify())
+
+	// adding a member invalidates the signature
+	m.Version = 1
+	other, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	m.Members = append(m.Members, other)
+	require.Equal(t, InvalidMetadataSignature, m.Verify())
+
+}
@@ -0,0 +1,751 @@
+package chat
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	group "github.com/Bit-Nation/panthalassa/chat/group"
+	db "github.com/Bit-Nation/panthalassa/db"
+	bpb "github.com/Bit-Nation/protobuffers"
+	uuid "github.com/satori/go.uuid"
+	ed25519 "golang.org/x/crypto/ed25519"
+)
+
+// types of the plain messages used by the group protocol
+// they are sent over the pairwise chats and never persisted
+const (
+	groupSenderKeyType = "GROUP:SENDER_KEY"
+	groupMessageType   = "GROUP:MESSAGE"
+	groupMetadataType  = "GROUP:METADATA"
+	groupLeaveType     = "GROUP:LEAVE"
+)
+
+var (
+	ErrGroupNotFound   = errors.New("group not found")
+	ErrNotGroupCreator = errors.New("only the creator of the group can change the members")
+	ErrNotGroupMember  = errors.New("sender is not a member of the group")
+)
+
+// sent to the members when we leave a group
+type groupLeave struct {
+	GroupID []byte `json:"group_id"`
+}
+
+// decrypted message of a group
+type GroupMessage struct {
+	GroupID   []byte
+	Sender    ed25519.PublicKey
+	Message   []byte
+	CreatedAt time.Time
+}
+
+type groupListeners struct {
+	lock      sync.Mutex
+	count     uint64
+	listeners map[string]map[uint64]func(msg GroupMessage)
+}
+
+func isGroupMessage(msg *bpb.PlainChatMessage) bool {
+	if isDAppMessage(msg) {
+		return false
+	}
+	switch msg.Type {
+	case groupSenderKeyType, groupMessageType, groupMetadataType, groupLeaveType:
+		return true
+	}
+	return false
+}
+
+func (c *Chat) ourIDKey() (ed25519.PublicKey, error) {
+	idKey, err := c.km.IdentityPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(idKey)
+}
+
+// send a message of the group protocol to a member
+func (c *Chat) sendGroupProtocolMessage(receiver ed25519.PublicKey, msgType string, payload interface{}) error {
+
+	params, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+
+	return c.sendPlainMessage(receiver, bpb.PlainChatMessage{
+		CreatedAt: time.Now().UnixNano(),
+		MessageID: id.String(),
+		Type:      msgType,
+		Params:    params,
+		Version:   1,
+	}, func(err error) error {
+		return err
+	})
+
+}
+
+// send our sender key to all members of the group
+func (c *Chat) distributeSenderKey(session *group.GroupSession) error {
+	distribution := session.Distribution()
+	for _, member := range session.Members {
+		if err := c.sendGroupProtocolMessage(member, groupSenderKeyType, distribution); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// create a new group and send our sender key to the members
+// returns the id of the created group
+func (c *Chat) CreateGroup(members []ed25519.PublicKey) ([]byte, error) {
+
+	ourIDKey, err := c.ourIDKey()
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := group.NewGroupSession(members)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := group.Metadata{
+		GroupID: session.GroupID[:],
+		Creator: ourIDKey,
+		Members: [][]byte{ourIDKey},
+		Version: 1,
+	}
+	for _, member := range members {
+		metadata.Members = append(metadata.Members, member)
+	}
+	if err := c.signGroupMetadata(&metadata); err != nil {
+		return nil, err
+	}
+	if err := c.putGroupMetadata(metadata); err != nil {
+		return nil, err
+	}
+
+	if err := c.storeGroupSession(session); err != nil {
+		return nil, err
+	}
+
+	if err := c.sendGroupMetadata(metadata, members); err != nil {
+		return nil, err
+	}
+
+	if err := c.distributeSenderKey(session); err != nil {
+		return nil, err
+	}
+
+	return session.GroupID[:], nil
+
+}
+
+// sign the metadata with our identity key
+func (c *Chat) signGroupMetadata(metadata *group.Metadata) error {
+	signature, err := c.km.IdentitySign(metadata.SignedData())
+	if err != nil {
+		return err
+	}
+	metadata.Signature = signature
+	return nil
+}
+
+// returns nil if we don't know the group
+func (c *Chat) storedGroupMetadata(groupID []byte) (*group.Metadata, error) {
+	if c.groupDB == nil {
+		return nil, nil
+	}
+	return c.groupDB.Get(groupID)
+}
+
+func (c *Chat) putGroupMetadata(metadata group.Metadata) error {
+	if c.groupDB == nil {
+		return nil
+	}
+	return c.groupDB.Put(metadata)
+}
+
+func (c *Chat) deleteGroupMetadata(groupID []byte) error {
+	if c.groupDB == nil {
+		return nil
+	}
+	return c.groupDB.Delete(groupID)
+}
+
+// the members of a group are only trusted when they are
+// part of the metadata signed by the creator of the group
+func (c *Chat) verifyGroupMember(groupID []byte, member ed25519.PublicKey) error {
+
+	metadata, err := c.storedGroupMetadata(groupID)
+	if err != nil {
+		return err
+	}
+	if metadata == nil {
+		return ErrGroupNotFound
+	}
+	if err := metadata.Verify(); err != nil {
+		return err
+	}
+	if !metadata.IsMember(member) {
+		return ErrNotGroupMember
+	}
+
+	return nil
+
+}
+
+// metadata of a group we created
+func (c *Chat) ownGroupMetadata(groupID []byte) (*group.Metadata, ed25519.PublicKey, error) {
+
+	metadata, err := c.storedGroupMetadata(groupID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if metadata == nil {
+		return nil, nil, ErrGroupNotFound
+	}
+
+	ourIDKey, err := c.ourIDKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !bytes.Equal(metadata.Creator, ourIDKey) {
+		return nil, nil, ErrNotGroupCreator
+	}
+
+	return metadata, ourIDKey, nil
+
+}
+
+func (c *Chat) sendGroupMetadata(metadata group.Metadata, receivers []ed25519.PublicKey) error {
+	for _, receiver := range receivers {
+		if err := c.sendGroupProtocolMessage(receiver, groupMetadataType, metadata); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sessions and sender keys are kept in memory and persisted
+// so that we still know about our groups after a restart
+func (c *Chat) loadGroups() error {
+
+	if c.groupDB == nil {
+		return nil
+	}
+
+	sessions, err := c.groupDB.Sessions()
+	if err != nil {
+		return err
+	}
+	for i := range sessions {
+		session := sessions[i]
+		c.groupSessions.Store(hex.EncodeToString(session.GroupID[:]), &session)
+	}
+
+	senderKeys, err := c.groupDB.SenderKeys()
+	if err != nil {
+		return err
+	}
+	for _, k := range senderKeys {
+		c.groupSenderKeys.Store(hex.EncodeToString(k.GroupID)+hex.EncodeToString(k.Member), k.Key)
+	}
+
+	return nil
+
+}
+
+func (c *Chat) storeGroupSession(session *group.GroupSession) error {
+	if c.groupDB != nil {
+		if err := c.groupDB.PutSession(*session); err != nil {
+			return err
+		}
+	}
+	c.groupSessions.Store(hex.EncodeToString(session.GroupID[:]), session)
+	return nil
+}
+
+func (c *Chat) deleteGroupSession(groupID []byte) error {
+	c.groupSessions.Delete(hex.EncodeToString(groupID))
+	if c.groupDB == nil {
+		return nil
+	}
+	return c.groupDB.DeleteSession(groupID)
+}
+
+func (c *Chat) storeSenderKey(groupID []byte, member ed25519.PublicKey, key group.SenderKey) error {
+	if c.groupDB != nil {
+		err := c.groupDB.PutSenderKey(db.GroupSenderKey{
+			GroupID: groupID,
+			Member:  member,
+			Key:     key,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	c.groupSenderKeys.Store(hex.EncodeToString(groupID)+hex.EncodeToString(member), key)
+	return nil
+}
+
+// drop the sender keys of the members
+func (c *Chat) dropSenderKeys(groupID []byte, members []ed25519.PublicKey) error {
+	groupKey := hex.EncodeToString(groupID)
+	for _, member := range members {
+		c.groupSenderKeys.Delete(groupKey + hex.EncodeToString(member))
+		if c.groupDB == nil {
+			continue
+		}
+		if err := c.groupDB.DeleteSenderKey(groupID, member); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// start a new session with a fresh sender key so that
+// removed members can't read our messages anymore
+func (c *Chat) rotateGroupSession(groupID []byte, members []ed25519.PublicKey) error {
+
+	var id [32]byte
+	copy(id[:], groupID)
+	session, err := group.JoinGroupSession(id, members)
+	if err != nil {
+		return err
+	}
+	if err := c.storeGroupSession(session); err != nil {
+		return err
+	}
+
+	return c.distributeSenderKey(session)
+
+}
+
+// sessions are shared with SendGroupMessage
+// so we store an updated copy
+func (c *Chat) updateGroupSessionMembers(session *group.GroupSession, members []ed25519.PublicKey) (*group.GroupSession, error) {
+	updated := *session
+	updated.Members = members
+	return &updated, c.storeGroupSession(&updated)
+}
+
+// add a member to a group we created
+func (c *Chat) AddMember(groupID []byte, member ed25519.PublicKey) error {
+
+	if len(member) != ed25519.PublicKeySize {
+		return errors.New("member must have a length of 32 bytes")
+	}
+
+	metadata, ourIDKey, err := c.ownGroupMetadata(groupID)
+	if err != nil {
+		return err
+	}
+	if metadata.IsMember(member) {
+		return nil
+	}
+
+	rawSession, exist := c.groupSessions.Load(hex.EncodeToString(groupID))
+	if !exist {
+		return ErrGroupNotFound
+	}
+
+	metadata.Members = append(metadata.Members, member)
+	metadata.Version++
+	if err := c.signGroupMetadata(metadata); err != nil {
+		return err
+	}
+	if err := c.putGroupMetadata(*metadata); err != nil {
+		return err
+	}
+
+	members := metadata.MembersExcept(ourIDKey)
+	session, err := c.updateGroupSessionMembers(rawSession.(*group.GroupSession), members)
+	if err != nil {
+		return err
+	}
+
+	// the other members send their sender keys
+	// to the new member once they get the metadata
+	if err := c.sendGroupMetadata(*metadata, members); err != nil {
+		return err
+	}
+
+	return c.sendGroupProtocolMessage(member, groupSenderKeyType, session.Distribution())
+
+}
+
+// remove a member from a group we created
+func (c *Chat) RemoveMember(groupID []byte, member ed25519.PublicKey) error {
+
+	metadata, ourIDKey, err := c.ownGroupMetadata(groupID)
+	if err != nil {
+		return err
+	}
+	if !metadata.IsMember(member) {
+		return nil
+	}
+	if bytes.Equal(member, ourIDKey) {
+		return errors.New("the creator can't be removed - leave the group instead")
+	}
+
+	metadata.Members = [][]byte{}
+	for _, m := range metadata.MembersExcept(member) {
+		metadata.Members = append(metadata.Members, m)
+	}
+	metadata.Version++
+	if err := c.signGroupMetadata(metadata); err != nil {
+		return err
+	}
+	if err := c.putGroupMetadata(*metadata); err != nil {
+		return err
+	}
+
+	// the removed member learns about the removal too
+	members := metadata.MembersExcept(ourIDKey)
+	if err := c.sendGroupMetadata(*metadata, append(members, member)); err != nil {
+		return err
+	}
+
+	if err := c.dropSenderKeys(groupID, []ed25519.PublicKey{member}); err != nil {
+		return err
+	}
+
+	if len(members) == 0 {
+		return c.deleteGroupSession(groupID)
+	}
+
+	return c.rotateGroupSession(groupID, members)
+
+}
+
+// inform the members that we left and forget about the group
+func (c *Chat) LeaveGroup(groupID []byte) error {
+
+	groupKey := hex.EncodeToString(groupID)
+	rawSession, exist := c.groupSessions.Load(groupKey)
+	if !exist {
+		return ErrGroupNotFound
+	}
+	session := rawSession.(*group.GroupSession)
+
+	for _, member := range session.Members {
+		if err := c.sendGroupProtocolMessage(member, groupLeaveType, groupLeave{GroupID: groupID}); err != nil {
+			return err
+		}
+	}
+
+	if err := c.deleteGroupSession(groupID); err != nil {
+		return err
+	}
+	if err := c.dropSenderKeys(groupID, session.Members); err != nil {
+		return err
+	}
+
+	return c.deleteGroupMetadata(groupID)
+
+}
+
+// encrypt the message with our sender key
+// and send it to all members of the group
+func (c *Chat) SendGroupMessage(groupID []byte, msg []byte) error {
+
+	rawSession, exist := c.groupSessions.Load(hex.EncodeToString(groupID))
+	if !exist {
+		return ErrGroupNotFound
+	}
+	session := rawSession.(*group.GroupSession)
+
+	encryptedMsg, err := session.Encrypt(msg)
+	if err != nil {
+		return err
+	}
+
+	for _, member := range session.Members {
+		if err := c.sendGroupProtocolMessage(member, groupMessageType, encryptedMsg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+
+}
+
+// register a listener for decrypted messages of the group
+// the returned function removes the listener
+func (c *Chat) OnGroupMessage(groupID []byte, fn func(msg GroupMessage)) func() {
+
+	key := hex.EncodeToString(groupID)
+
+	c.groupListeners.lock.Lock()
+	defer c.groupListeners.lock.Unlock()
+
+	if c.groupListeners.listeners == nil {
+		c.groupListeners.listeners = map[string]map[uint64]func(msg GroupMessage){}
+	}
+	if c.groupListeners.listeners[key] == nil {
+		c.groupListeners.listeners[key] = map[uint64]func(msg GroupMessage){}
+	}
+	c.groupListeners.count++
+	id := c.groupListeners.count
+	c.groupListeners.listeners[key][id] = fn
+
+	return func() {
+		c.groupListeners.lock.Lock()
+		defer c.groupListeners.lock.Unlock()
+		delete(c.groupListeners.listeners[key], id)
+	}
+
+}
+
+// handle a message of the group protocol sent by a member
+func (c *Chat) handleGroupMessage(sender ed25519.PublicKey, msg *bpb.PlainChatMessage) error {
+
+	switch msg.Type {
+	case groupSenderKeyType:
+
+		distribution := group.SenderKeyDistribution{}
+		if err := json.Unmarshal(msg.Params, &distribution); err != nil {
+			return err
+		}
+		senderKey, err := distribution.Key()
+		if err != nil {
+			return err
+		}
+
+		// we only join groups with the metadata of the creator
+		// so an unknown group or sender is rejected here
+		if err := c.verifyGroupMember(distribution.GroupID, sender); err != nil {
+			return err
+		}
+
+		groupKey := hex.EncodeToString(distribution.GroupID)
+		_, knownSender := c.groupSenderKeys.Load(groupKey + hex.EncodeToString(sender))
+		if err := c.storeSenderKey(distribution.GroupID, sender, senderKey); err != nil {
+			return err
+		}
+
+		rawSession, exist := c.groupSessions.Load(groupKey)
+		if !exist || knownSender {
+			return nil
+		}
+
+		// the member might have missed our sender key
+		// since it joined after we sent it
+		return c.sendGroupProtocolMessage(sender, groupSenderKeyType, rawSession.(*group.GroupSession).Distribution())
+
+	case groupMessageType:
+
+		encryptedMsg := group.Message{}
+		if err := json.Unmarshal(msg.Params, &encryptedMsg); err != nil {
+			return err
+		}
+
+		// removed members must not be able to send messages
+		if err := c.verifyGroupMember(encryptedMsg.GroupID, sender); err != nil {
+			return err
+		}
+
+		groupKey := hex.EncodeToString(encryptedMsg.GroupID)
+		rawSenderKey, exist := c.groupSenderKeys.Load(groupKey + hex.EncodeToString(sender))
+		if !exist {
+			return errors.New("got group message without a sender key of the sender")
+		}
+
+		plainText, err := group.Decrypt(encryptedMsg, rawSenderKey.(group.SenderKey))
+		if err != nil {
+			return err
+		}
+
+		groupMsg := GroupMessage{
+			GroupID:   encryptedMsg.GroupID,
+			Sender:    sender,
+			Message:   plainText,
+			CreatedAt: time.Unix(0, msg.CreatedAt),
+		}
+
+		c.groupListeners.lock.Lock()
+		listeners := []func(msg GroupMessage){}
+		for _, listener := range c.groupListeners.listeners[groupKey] {
+			listeners = append(listeners, listener)
+		}
+		c.groupListeners.lock.Unlock()
+
+		for _, listener := range listeners {
+			go listener(groupMsg)
+		}
+
+		return nil
+
+	case groupMetadataType:
+
+		metadata := group.Metadata{}
+		if err := json.Unmarshal(msg.Params, &metadata); err != nil {
+			return err
+		}
+		return c.handleGroupMetadata(sender, metadata)
+
+	case groupLeaveType:
+
+		leave := groupLeave{}
+		if err := json.Unmarshal(msg.Params, &leave); err != nil {
+			return err
+		}
+		return c.handleGroupLeave(sender, leave.GroupID)
+
+	}
+
+	return errors.New("unknown group message type: " + msg.Type)
+
+}
+
+// apply the members decided by the creator of the group
+func (c *Chat) handleGroupMetadata(sender ed25519.PublicKey, metadata group.Metadata) error {
+
+	if err := metadata.Verify(); err != nil {
+		return err
+	}
+	if !bytes.Equal(metadata.Creator, sender) {
+		return errors.New("group metadata must be sent by the creator")
+	}
+
+	existing, err := c.storedGroupMetadata(metadata.GroupID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		if !bytes.Equal(existing.Creator, metadata.Creator) {
+			return errors.New("group metadata of another creator")
+		}
+		// outdated or replayed metadata
+		if metadata.Version <= existing.Version {
+			return nil
+		}
+	}
+
+	ourIDKey, err := c.ourIDKey()
+	if err != nil {
+		return err
+	}
+
+	groupKey := hex.EncodeToString(metadata.GroupID)
+
+	// we got removed from the group
+	if !metadata.IsMember(ourIDKey) {
+		if rawSession, exist := c.groupSessions.Load(groupKey); exist {
+			if err := c.dropSenderKeys(metadata.GroupID, rawSession.(*group.GroupSession).Members); err != nil {
+				return err
+			}
+		}
+		if err := c.deleteGroupSession(metadata.GroupID); err != nil {
+			return err
+		}
+		return c.deleteGroupMetadata(metadata.GroupID)
+	}
+
+	if err := c.putGroupMetadata(metadata); err != nil {
+		return err
+	}
+
+	members := metadata.MembersExcept(ourIDKey)
+
+	// the creator added us to the group so
+	// we send our sender key to the members
+	rawSession, exist := c.groupSessions.Load(groupKey)
+	if !exist {
+		return c.rotateGroupSession(metadata.GroupID, members)
+	}
+	session := rawSession.(*group.GroupSession)
+
+	isIn := func(key ed25519.PublicKey, keys []ed25519.PublicKey) bool {
+		for _, k := range keys {
+			if bytes.Equal(k, key) {
+				return true
+			}
+		}
+		return false
+	}
+
+	removed := []ed25519.PublicKey{}
+	for _, member := range session.Members {
+		if !isIn(member, members) {
+			removed = append(removed, member)
+		}
+	}
+	added := []ed25519.PublicKey{}
+	for _, member := range members {
+		if !isIn(member, session.Members) {
+			added = append(added, member)
+		}
+	}
+
+	// removed members must not be able to read our messages
+	if len(removed) > 0 {
+		if err := c.dropSenderKeys(metadata.GroupID, removed); err != nil {
+			return err
+		}
+		return c.rotateGroupSession(metadata.GroupID, members)
+	}
+
+	session, err = c.updateGroupSessionMembers(session, members)
+	if err != nil {
+		return err
+	}
+	for _, member := range added {
+		if err := c.sendGroupProtocolMessage(member, groupSenderKeyType, session.Distribution()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+
+}
+
+// a member left the group
+func (c *Chat) handleGroupLeave(sender ed25519.PublicKey, groupID []byte) error {
+
+	if err := c.dropSenderKeys(groupID, []ed25519.PublicKey{sender}); err != nil {
+		return err
+	}
+
+	// as the creator we remove the member for everyone
+	metadata, _, err := c.ownGroupMetadata(groupID)
+	switch err {
+	case nil:
+		if metadata.IsMember(sender) {
+			return c.RemoveMember(groupID, sender)
+		}
+	case ErrGroupNotFound, ErrNotGroupCreator:
+	default:
+		return err
+	}
+
+	groupKey := hex.EncodeToString(groupID)
+	rawSession, exist := c.groupSessions.Load(groupKey)
+	if !exist {
+		return nil
+	}
+	session := rawSession.(*group.GroupSession)
+
+	members := []ed25519.PublicKey{}
+	for _, member := range session.Members {
+		if !bytes.Equal(member, sender) {
+			members = append(members, member)
+		}
+	}
+	if len(members) == 0 {
+		return c.deleteGroupSession(groupID)
+	}
+	_, err = c.updateGroupSessionMembers(session, members)
+	return err
+
+}
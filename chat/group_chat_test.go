@@ -0,0 +1,477 @@
+package chat
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+	"time"
+
+	group "github.com/Bit-Nation/panthalassa/chat/group"
+	preKey "github.com/Bit-Nation/panthalassa/chat/prekey"
+	db "github.com/Bit-Nation/panthalassa/db"
+	km "github.com/Bit-Nation/panthalassa/keyManager"
+	bpb "github.com/Bit-Nation/protobuffers"
+	x3dh "github.com/Bit-Nation/x3dh"
+	require "github.com/stretchr/testify/require"
+	ed25519 "golang.org/x/crypto/ed25519"
+)
+
+func identityKey(t *testing.T, keyManager *km.KeyManager) ed25519.PublicKey {
+	idKey, err := (&Chat{km: keyManager}).ourIDKey()
+	require.Nil(t, err)
+	return idKey
+}
+
+// metadata of the group signed by the creator
+func signedTestMetadata(t *testing.T, creator *km.KeyManager, groupID []byte, version uint64, members ...ed25519.PublicKey) group.Metadata {
+	m := group.Metadata{
+		GroupID: groupID,
+		Creator: identityKey(t, creator),
+		Members: [][]byte{identityKey(t, creator)},
+		Version: version,
+	}
+	for _, member := range members {
+		m.Members = append(m.Members, member)
+	}
+	signature, err := creator.IdentitySign(m.SignedData())
+	require.Nil(t, err)
+	m.Signature = signature
+	return m
+}
+
+// group chat storage that keeps everything in memory
+func newTestGroupStorage() *testGroupChatStorage {
+	metadata := map[string]group.Metadata{}
+	sessions := map[string]group.GroupSession{}
+	senderKeys := map[string]db.GroupSenderKey{}
+	return &testGroupChatStorage{
+		put: func(m group.Metadata) error {
+			metadata[hex.EncodeToString(m.GroupID)] = m
+			return nil
+		},
+		get: func(groupID []byte) (*group.Metadata, error) {
+			m, exist := metadata[hex.EncodeToString(groupID)]
+			if !exist {
+				return nil, nil
+			}
+			return &m, nil
+		},
+		delete: func(groupID []byte) error {
+			delete(metadata, hex.EncodeToString(groupID))
+			return nil
+		},
+		putSession: func(session group.GroupSession) error {
+			sessions[hex.EncodeToString(session.GroupID[:])] = session
+			return nil
+		},
+		sessions: func() ([]group.GroupSession, error) {
+			all := []group.GroupSession{}
+			for _, s := range sessions {
+				all = append(all, s)
+			}
+			return all, nil
+		},
+		deleteSession: func(groupID []byte) error {
+			delete(sessions, hex.EncodeToString(groupID))
+			return nil
+		},
+		putSenderKey: func(key db.GroupSenderKey) error {
+			senderKeys[hex.EncodeToString(key.GroupID)+hex.EncodeToString(key.Member)] = key
+			return nil
+		},
+		senderKeys: func() ([]db.GroupSenderKey, error) {
+			all := []db.GroupSenderKey{}
+			for _, k := range senderKeys {
+				all = append(all, k)
+			}
+			return all, nil
+		},
+		deleteSenderKey: func(groupID []byte, member ed25519.PublicKey) error {
+			delete(senderKeys, hex.EncodeToString(groupID)+hex.EncodeToString(member))
+			return nil
+		},
+	}
+}
+
+// chat that submits the messages it sends to the returned channel
+// the receivers need a signed pre key - so we need their key managers
+func newGroupTestChat(t *testing.T, keyManager *km.KeyManager, groupDB db.GroupChatStorage, receivers ...*km.KeyManager) (*Chat, chan *bpb.ChatMessage) {
+
+	curve := x3dh.NewCurve25519(rand.Reader)
+	signedPreKeys := map[string]*preKey.PreKey{}
+	for _, receiver := range receivers {
+		keyPair, err := curve.GenerateKeyPair()
+		require.Nil(t, err)
+		signedPreKey := preKey.PreKey{}
+		signedPreKey.PrivateKey = keyPair.PrivateKey
+		signedPreKey.PublicKey = keyPair.PublicKey
+		require.Nil(t, signedPreKey.Sign(*receiver))
+		signedPreKeys[hex.EncodeToString(identityKey(t, receiver))] = &signedPreKey
+	}
+
+	baseID := make([]byte, 32)
+	_, err := rand.Read(baseID)
+	require.Nil(t, err)
+
+	submitted := make(chan *bpb.ChatMessage, 10)
+	c := &Chat{
+		km:      keyManager,
+		groupDB: groupDB,
+		backend: &testBackend{
+			submitMessages: func(messages []*bpb.ChatMessage) error {
+				for _, msg := range messages {
+					submitted <- msg
+				}
+				return nil
+			},
+		},
+		sharedSecStorage: &testSharedSecretStorage{
+			hasAny: func(key ed25519.PublicKey) (bool, error) {
+				return true, nil
+			},
+			getYoungest: func(key ed25519.PublicKey) (*db.SharedSecret, error) {
+				return &db.SharedSecret{X3dhSS: x3dh.SharedSecret{1}, Accepted: true, BaseID: baseID}, nil
+			},
+		},
+		userStorage: &testUserStorage{
+			getSignedPreKey: func(idKey ed25519.PublicKey) (*preKey.PreKey, error) {
+				return signedPreKeys[hex.EncodeToString(idKey)], nil
+			},
+		},
+	}
+
+	return c, submitted
+
+}
+
+// the group protocol messages that got submitted by now
+func submittedTo(submitted chan *bpb.ChatMessage) []string {
+	receivers := []string{}
+	for {
+		select {
+		case msg := <-submitted:
+			receivers = append(receivers, hex.EncodeToString(msg.Receiver))
+		default:
+			return receivers
+		}
+	}
+}
+
+func TestChat_handleGroupMessage(t *testing.T) {
+
+	ourKM := createKeyManager()
+	ourIDKey := identityKey(t, ourKM)
+
+	// the sender created the group
+	senderKM := createKeyManager()
+	sender := identityKey(t, senderKM)
+
+	// member we don't have a sender key of
+	member := identityKey(t, createKeyManager())
+
+	senderSession, err := group.NewGroupSession([]ed25519.PublicKey{ourIDKey, member})
+	require.Nil(t, err)
+
+	storage := newTestGroupStorage()
+	require.Nil(t, storage.Put(signedTestMetadata(t, senderKM, senderSession.GroupID[:], 1, ourIDKey, member)))
+	c, submitted := newGroupTestChat(t, ourKM, storage, senderKM)
+
+	// we already joined the group
+	ourSession, err := group.JoinGroupSession(senderSession.GroupID, []ed25519.PublicKey{sender, member})
+	require.Nil(t, err)
+	require.Nil(t, c.storeGroupSession(ourSession))
+
+	received := make(chan GroupMessage, 1)
+	remove := c.OnGroupMessage(senderSession.GroupID[:], func(msg GroupMessage) {
+		received <- msg
+	})
+
+	// receive the sender key
+	distribution, err := json.Marshal(senderSession.Distribution())
+	require.Nil(t, err)
+	require.Nil(t, c.handlePlainMessage(sender, &bpb.PlainChatMessage{
+		Type:   groupSenderKeyType,
+		Params: distribution,
+	}))
+
+	// the sender gets our sender key once
+	require.Equal(t, []string{hex.EncodeToString(sender)}, submittedTo(submitted))
+	require.Nil(t, c.handlePlainMessage(sender, &bpb.PlainChatMessage{
+		Type:   groupSenderKeyType,
+		Params: distribution,
+	}))
+	require.Len(t, submittedTo(submitted), 0)
+
+	// receive a group message
+	encrypted, err := senderSession.Encrypt([]byte("hi group"))
+	require.Nil(t, err)
+	rawEncrypted, err := json.Marshal(encrypted)
+	require.Nil(t, err)
+	createdAt := time.Now()
+	require.Nil(t, c.handlePlainMessage(sender, &bpb.PlainChatMessage{
+		Type:      groupMessageType,
+		Params:    rawEncrypted,
+		CreatedAt: createdAt.UnixNano(),
+	}))
+
+	select {
+	case msg := <-received:
+		require.Equal(t, []byte("hi group"), msg.Message)
+		require.Equal(t, sender, msg.Sender)
+		require.Equal(t, senderSession.GroupID[:], msg.GroupID)
+		require.Equal(t, createdAt.UnixNano(), msg.CreatedAt.UnixNano())
+	case <-time.After(time.Second):
+		require.FailNow(t, "timed out")
+	}
+
+	remove()
+
+	// messages of members we don't have a sender key of are rejected
+	require.EqualError(t, c.handlePlainMessage(member, &bpb.PlainChatMessage{
+		Type:   groupMessageType,
+		Params: rawEncrypted,
+	}), "got group message without a sender key of the sender")
+
+	// so are sender keys and messages of someone that isn't a member
+	other, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	require.Equal(t, ErrNotGroupMember, c.handlePlainMessage(other, &bpb.PlainChatMessage{
+		Type:   groupSenderKeyType,
+		Params: distribution,
+	}))
+	require.Equal(t, ErrNotGroupMember, c.handlePlainMessage(other, &bpb.PlainChatMessage{
+		Type:   groupMessageType,
+		Params: rawEncrypted,
+	}))
+	require.Len(t, submittedTo(submitted), 0)
+
+}
+
+func TestChat_handleGroupSenderKeyUnknownGroup(t *testing.T) {
+
+	storage := newTestGroupStorage()
+	c := Chat{km: createKeyManager(), groupDB: storage}
+
+	attacker, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	victim, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+
+	attackerSession, err := group.NewGroupSession([]ed25519.PublicKey{victim})
+	require.Nil(t, err)
+	distribution, err := json.Marshal(attackerSession.Distribution())
+	require.Nil(t, err)
+
+	// we don't join a group without the metadata of the creator
+	// the chat would fail to send our sender key to the members
+	require.Equal(t, ErrGroupNotFound, c.handlePlainMessage(attacker, &bpb.PlainChatMessage{
+		Type:   groupSenderKeyType,
+		Params: distribution,
+	}))
+	_, exist := c.groupSessions.Load(hex.EncodeToString(attackerSession.GroupID[:]))
+	require.False(t, exist)
+	sessions, err := storage.Sessions()
+	require.Nil(t, err)
+	require.Len(t, sessions, 0)
+	senderKeys, err := storage.SenderKeys()
+	require.Nil(t, err)
+	require.Len(t, senderKeys, 0)
+
+}
+
+func TestChat_handleGroupMessageRemovedMember(t *testing.T) {
+
+	ourKM := createKeyManager()
+	ourIDKey := identityKey(t, ourKM)
+	creatorKM := createKeyManager()
+	creator := identityKey(t, creatorKM)
+	removed := identityKey(t, createKeyManager())
+
+	removedSession, err := group.NewGroupSession([]ed25519.PublicKey{ourIDKey, creator})
+	require.Nil(t, err)
+	groupID := removedSession.GroupID[:]
+
+	// the member got removed by the creator but we still have the key
+	storage := newTestGroupStorage()
+	require.Nil(t, storage.Put(signedTestMetadata(t, creatorKM, groupID, 2, ourIDKey)))
+	c := Chat{km: ourKM, groupDB: storage}
+	senderKey, err := removedSession.Distribution().Key()
+	require.Nil(t, err)
+	c.groupSenderKeys.Store(hex.EncodeToString(groupID)+hex.EncodeToString(removed), senderKey)
+
+	// the removed member can't send messages
+	encrypted, err := removedSession.Encrypt([]byte("still here"))
+	require.Nil(t, err)
+	rawEncrypted, err := json.Marshal(encrypted)
+	require.Nil(t, err)
+	require.Equal(t, ErrNotGroupMember, c.handlePlainMessage(removed, &bpb.PlainChatMessage{
+		Type:   groupMessageType,
+		Params: rawEncrypted,
+	}))
+
+	// and can't distribute a sender key again
+	distribution, err := json.Marshal(removedSession.Distribution())
+	require.Nil(t, err)
+	require.Equal(t, ErrNotGroupMember, c.handlePlainMessage(removed, &bpb.PlainChatMessage{
+		Type:   groupSenderKeyType,
+		Params: distribution,
+	}))
+
+}
+
+func TestChat_SendGroupMessageUnknownGroup(t *testing.T) {
+
+	c := Chat{}
+	require.Equal(t, ErrGroupNotFound, c.SendGroupMessage(make([]byte, 32), []byte("hi")))
+
+}
+
+func TestChat_handleGroupMetadata(t *testing.T) {
+
+	ourKM := createKeyManager()
+	ourIDKey := identityKey(t, ourKM)
+
+	creatorKM := createKeyManager()
+	creator := identityKey(t, creatorKM)
+
+	groupID := make([]byte, 32)
+	groupID[0] = 1
+
+	signedMetadata := func(version uint64, members ...ed25519.PublicKey) group.Metadata {
+		return signedTestMetadata(t, creatorKM, groupID, version, members...)
+	}
+
+	var stored *group.Metadata
+	deleted := false
+	c, submitted := newGroupTestChat(t, ourKM, &testGroupChatStorage{
+		get: func(id []byte) (*group.Metadata, error) {
+			return stored, nil
+		},
+		put: func(metadata group.Metadata) error {
+			stored = &metadata
+			return nil
+		},
+		delete: func(id []byte) error {
+			deleted = true
+			stored = nil
+			return nil
+		},
+	}, creatorKM)
+
+	// metadata must be signed by the creator
+	invalid := signedMetadata(1, ourIDKey)
+	invalid.Members = append(invalid.Members, make([]byte, 32))
+	require.Equal(t, group.InvalidMetadataSignature, c.handleGroupMetadata(creator, invalid))
+
+	// metadata must be sent by the creator
+	other, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	require.EqualError(t, c.handleGroupMetadata(other, signedMetadata(1, ourIDKey)), "group metadata must be sent by the creator")
+	require.Len(t, submittedTo(submitted), 0)
+
+	// we got added to the group and send our sender key to the members
+	require.Nil(t, c.handleGroupMetadata(creator, signedMetadata(2, ourIDKey)))
+	require.NotNil(t, stored)
+	require.Equal(t, uint64(2), stored.Version)
+	_, exist := c.groupSessions.Load(hex.EncodeToString(groupID))
+	require.True(t, exist)
+	require.Equal(t, []string{hex.EncodeToString(creator)}, submittedTo(submitted))
+
+	// outdated metadata is ignored
+	require.Nil(t, c.handleGroupMetadata(creator, signedMetadata(1, ourIDKey, other)))
+	require.Len(t, stored.Members, 2)
+	require.Len(t, submittedTo(submitted), 0)
+
+	// we got removed from the group
+	require.Nil(t, c.handleGroupMetadata(creator, signedMetadata(3, other)))
+	require.True(t, deleted)
+	_, exist = c.groupSessions.Load(hex.EncodeToString(groupID))
+	require.False(t, exist)
+
+}
+
+func TestChat_AddMemberNotCreator(t *testing.T) {
+
+	creator, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+
+	c := Chat{
+		km: createKeyManager(),
+		groupDB: &testGroupChatStorage{
+			get: func(id []byte) (*group.Metadata, error) {
+				return &group.Metadata{
+					GroupID: id,
+					Creator: creator,
+				}, nil
+			},
+		},
+	}
+
+	member, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	require.Equal(t, ErrNotGroupCreator, c.AddMember(make([]byte, 32), member))
+	require.Equal(t, ErrNotGroupCreator, c.RemoveMember(make([]byte, 32), member))
+
+}
+
+func TestChat_loadGroups(t *testing.T) {
+
+	ourKM := createKeyManager()
+	ourIDKey := identityKey(t, ourKM)
+
+	senderKM := createKeyManager()
+	sender := identityKey(t, senderKM)
+
+	senderSession, err := group.NewGroupSession([]ed25519.PublicKey{ourIDKey})
+	require.Nil(t, err)
+
+	storage := newTestGroupStorage()
+	require.Nil(t, storage.Put(signedTestMetadata(t, senderKM, senderSession.GroupID[:], 1, ourIDKey)))
+	c, _ := newGroupTestChat(t, ourKM, storage, senderKM)
+
+	// we joined the group and got the sender key
+	ourSession, err := group.JoinGroupSession(senderSession.GroupID, []ed25519.PublicKey{sender})
+	require.Nil(t, err)
+	require.Nil(t, c.storeGroupSession(ourSession))
+	distribution, err := json.Marshal(senderSession.Distribution())
+	require.Nil(t, err)
+	require.Nil(t, c.handlePlainMessage(sender, &bpb.PlainChatMessage{
+		Type:   groupSenderKeyType,
+		Params: distribution,
+	}))
+	sessions, err := storage.Sessions()
+	require.Nil(t, err)
+	require.Len(t, sessions, 1)
+	senderKeys, err := storage.SenderKeys()
+	require.Nil(t, err)
+	require.Len(t, senderKeys, 1)
+
+	// after a restart we still know the group
+	restarted := Chat{km: ourKM, groupDB: storage}
+	require.Nil(t, restarted.loadGroups())
+	rawSession, exist := restarted.groupSessions.Load(hex.EncodeToString(senderSession.GroupID[:]))
+	require.True(t, exist)
+	require.Equal(t, ourSession, rawSession.(*group.GroupSession))
+
+	received := make(chan GroupMessage, 1)
+	restarted.OnGroupMessage(senderSession.GroupID[:], func(msg GroupMessage) {
+		received <- msg
+	})
+	encrypted, err := senderSession.Encrypt([]byte("hi again"))
+	require.Nil(t, err)
+	rawEncrypted, err := json.Marshal(encrypted)
+	require.Nil(t, err)
+	require.Nil(t, restarted.handlePlainMessage(sender, &bpb.PlainChatMessage{
+		Type:   groupMessageType,
+		Params: rawEncrypted,
+	}))
+
+	select {
+	case msg := <-received:
+		require.Equal(t, []byte("hi again"), msg.Message)
+	case <-time.After(time.Second):
+		require.FailNow(t, "timed out")
+	}
+
+}
@@ -6,7 +6,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"strconv"
@@ -14,6 +16,7 @@ import (
 	preKey "github.com/Bit-Nation/panthalassa/chat/prekey"
 	db "github.com/Bit-Nation/panthalassa/db"
 	queue "github.com/Bit-Nation/panthalassa/queue"
+	uiapi "github.com/Bit-Nation/panthalassa/uiapi"
 	bpb "github.com/Bit-Nation/protobuffers"
 	x3dh "github.com/Bit-Nation/x3dh"
 	uuid "github.com/satori/go.uuid"
@@ -23,18 +26,34 @@ import (
 func (c *Chat) messagesHandler(req *bpb.BackendMessage_Request) (*bpb.BackendMessage_Response, error) {
 
 	wg := sync.WaitGroup{}
+	var rateLimited uint32
 	if len(req.Messages) > 0 {
 		for _, msg := range req.Messages {
 			wg.Add(1)
 			go func(msg *bpb.ChatMessage) {
 				defer wg.Done()
-				err := c.handleReceivedMessage(msg)
+				// a broken message must not take down the handler
+				defer func() {
+					if r := recover(); r != nil {
+						logger.Error("panic in handleReceivedMessage", r, string(debug.Stack()))
+					}
+				}()
+				err := c.ReceiveMessage(msg)
+				if err == ErrSenderRateLimited {
+					atomic.StoreUint32(&rateLimited, 1)
+					return
+				}
 				if err != nil {
 					logger.Error(err)
 				}
 			}(msg)
 		}
 		wg.Wait()
+		// don't acknowledge the messages so that the
+		// backend delivers the rate limited ones again
+		if atomic.LoadUint32(&rateLimited) == 1 {
+			return nil, ErrSenderRateLimited
+		}
 		return &bpb.BackendMessage_Response{}, nil
 	}
 
@@ -160,14 +179,17 @@ func (c *Chat) handlePersistedMessage(e db.MessagePersistedEvent) {
 	}
 
 	if e.Message.Received {
-		c.uiApi.Send("MESSAGE:RECEIVED", map[string]interface{}{
-			"db_id":      strconv.FormatInt(e.DBMessageID, 10),
-			"content":    string(e.Message.Message),
-			"created_at": e.Message.CreatedAt,
-			"chat":       hex.EncodeToString(e.Partner),
-			"received":   e.Message.Received,
-			"dapp":       dapp,
+		err := c.uiApi.Dispatch(uiapi.MessageReceivedEvent{
+			DBID:      strconv.FormatInt(e.DBMessageID, 10),
+			Content:   string(e.Message.Message),
+			CreatedAt: e.Message.CreatedAt,
+			Chat:      hex.EncodeToString(e.Partner),
+			Received:  e.Message.Received,
+			DApp:      dapp,
 		})
+		if err != nil {
+			logger.Error(err)
+		}
 	}
 
 }
@@ -0,0 +1,78 @@
+package chat
+
+import (
+	"encoding/hex"
+	"time"
+
+	x3dh "github.com/Bit-Nation/x3dh"
+	ed25519 "golang.org/x/crypto/ed25519"
+)
+
+const (
+	// cached bundles are not used after this time
+	preKeyBundleTTL = time.Minute * 5
+	// cached bundles are refreshed in the background after this time
+	preKeyBundleRefreshAge = time.Minute * 4
+)
+
+type cachedBundle struct {
+	bundle    x3dh.PreKeyBundle
+	fetchedAt time.Time
+}
+
+// fetch the pre key bundle of the receiver
+// a cached bundle is returned if present and not expired
+func (c *Chat) fetchPreKeyBundle(receiver ed25519.PublicKey) (x3dh.PreKeyBundle, error) {
+
+	key := hex.EncodeToString(receiver)
+
+	if cached, exist := c.preKeyBundleCache.Load(key); exist {
+		entry := cached.(cachedBundle)
+		age := time.Since(entry.fetchedAt)
+		if age < preKeyBundleTTL {
+			if age > preKeyBundleRefreshAge {
+				go c.refreshPreKeyBundle(receiver)
+			}
+			return entry.bundle, nil
+		}
+	}
+
+	bundle, err := c.backend.FetchPreKeyBundle(receiver)
+	if err != nil {
+		return nil, err
+	}
+	c.preKeyBundleCache.Store(key, cachedBundle{
+		bundle:    bundle,
+		fetchedAt: time.Now(),
+	})
+	return bundle, nil
+
+}
+
+// refresh a cached pre key bundle
+// only one refresh per receiver is running at a time
+func (c *Chat) refreshPreKeyBundle(receiver ed25519.PublicKey) {
+
+	key := hex.EncodeToString(receiver)
+	if _, running := c.preKeyBundleRefreshing.LoadOrStore(key, struct{}{}); running {
+		return
+	}
+	defer c.preKeyBundleRefreshing.Delete(key)
+
+	bundle, err := c.backend.FetchPreKeyBundle(receiver)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	c.preKeyBundleCache.Store(key, cachedBundle{
+		bundle:    bundle,
+		fetchedAt: time.Now(),
+	})
+
+}
+
+// remove the cached pre key bundle of the receiver
+// should be called when the receiver rotated keys
+func (c *Chat) InvalidatePreKeyCache(receiver ed25519.PublicKey) {
+	c.preKeyBundleCache.Delete(hex.EncodeToString(receiver))
+}
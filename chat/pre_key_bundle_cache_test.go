@@ -0,0 +1,66 @@
+package chat
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	x3dh "github.com/Bit-Nation/x3dh"
+	require "github.com/stretchr/testify/require"
+	ed25519 "golang.org/x/crypto/ed25519"
+)
+
+func TestChat_fetchPreKeyBundleCache(t *testing.T) {
+
+	fetches := make(chan struct{}, 10)
+	backend := testBackend{
+		fetchPreKeyBundle: func(userIDPubKey ed25519.PublicKey) (x3dh.PreKeyBundle, error) {
+			fetches <- struct{}{}
+			return testPreKeyBundle{}, nil
+		},
+	}
+
+	c := Chat{
+		backend: &backend,
+	}
+
+	receiver := ed25519.PublicKey{1}
+
+	// cache miss fetches from the backend
+	_, err := c.fetchPreKeyBundle(receiver)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(fetches))
+
+	// cache hit doesn't fetch
+	_, err = c.fetchPreKeyBundle(receiver)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(fetches))
+
+	// old bundle is refreshed in the background
+	c.preKeyBundleCache.Store(hex.EncodeToString(receiver), cachedBundle{
+		bundle:    testPreKeyBundle{},
+		fetchedAt: time.Now().Add(-preKeyBundleRefreshAge - time.Second),
+	})
+	_, err = c.fetchPreKeyBundle(receiver)
+	require.Nil(t, err)
+	select {
+	case <-time.After(time.Second):
+		require.FailNow(t, "expected background refresh")
+	case <-fetches:
+	}
+	<-fetches
+	// wait till the refreshed bundle got stored
+	for {
+		if _, running := c.preKeyBundleRefreshing.Load(hex.EncodeToString(receiver)); !running {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	// invalidated bundle is fetched again
+	c.InvalidatePreKeyCache(receiver)
+	_, err = c.fetchPreKeyBundle(receiver)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(fetches))
+
+}
@@ -1,6 +1,7 @@
 package prekey
 
 import (
+	"crypto/rand"
 	"encoding/hex"
 	"testing"
 	"time"
@@ -8,6 +9,9 @@ import (
 	keyManager "github.com/Bit-Nation/panthalassa/keyManager"
 	keyStore "github.com/Bit-Nation/panthalassa/keyStore"
 	mnemonic "github.com/Bit-Nation/panthalassa/mnemonic"
+	pb "github.com/Bit-Nation/protobuffers"
+	x3dh "github.com/Bit-Nation/x3dh"
+	proto "github.com/golang/protobuf/proto"
 	require "github.com/stretchr/testify/require"
 )
 
@@ -32,7 +36,8 @@ func TestSign(t *testing.T) {
 	ks, err := keyStore.NewFromMnemonic(mne)
 	require.Nil(t, err)
 
-	km := keyManager.CreateFromKeyStore(ks)
+	km, err := keyManager.CreateFromKeyStore(ks)
+	require.Nil(t, err)
 
 	k := PreKey{}
 	k.PublicKey = [32]byte{1}
@@ -74,6 +79,50 @@ func TestPreKey_ToProtobufAndBack(t *testing.T) {
 
 }
 
+func TestPreKeyProtobufRoundTrip(t *testing.T) {
+
+	mne, err := mnemonic.New()
+	require.Nil(t, err)
+
+	ks, err := keyStore.NewFromMnemonic(mne)
+	require.Nil(t, err)
+
+	km, err := keyManager.CreateFromKeyStore(ks)
+	require.Nil(t, err)
+
+	c25519 := x3dh.NewCurve25519(rand.Reader)
+	keyPair, err := c25519.GenerateKeyPair()
+	require.Nil(t, err)
+
+	// create and sign pre key
+	k := PreKey{
+		time: time.Now(),
+	}
+	k.PublicKey = keyPair.PublicKey
+	require.Nil(t, k.Sign(*km))
+
+	// convert to protobuf and serialize
+	pp, err := k.ToProtobuf()
+	require.Nil(t, err)
+	rawPreKey, err := proto.Marshal(&pp)
+	require.Nil(t, err)
+
+	// unmarshal and convert back
+	unmarshaled := pb.PreKey{}
+	require.Nil(t, proto.Unmarshal(rawPreKey, &unmarshaled))
+	roundTripped, err := FromProtoBuf(unmarshaled)
+	require.Nil(t, err)
+
+	require.Equal(t, k.PublicKey, roundTripped.PublicKey)
+	require.Equal(t, k.signature, roundTripped.signature)
+	require.Equal(t, k.time.Unix(), roundTripped.time.Unix())
+
+	valid, err := roundTripped.VerifySignature(k.identityPublicKey[:])
+	require.Nil(t, err)
+	require.True(t, valid)
+
+}
+
 func TestPreKey_OlderThan(t *testing.T) {
 	k := PreKey{
 		time: time.Now().Truncate(time.Second * 10),
@@ -0,0 +1,126 @@
+package chat
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// messages per second we accept from one sender
+	defaultSenderRate = 10
+	// amount of messages a sender can send at once
+	defaultSenderBurst = 30
+	// interval in which idle limiters are dropped
+	senderLimiterSweepInterval = time.Minute
+)
+
+// returned when an authenticated sender exceeded the rate limit
+// the message is not acknowledged so the backend delivers it again
+var ErrSenderRateLimited = errors.New("sender exceeded the message rate limit")
+
+// token bucket limiting the messages of one sender
+type senderLimiter struct {
+	lock     sync.Mutex
+	rate     float64
+	burst    float64
+	tokens   float64
+	lastSeen time.Time
+	now      func() time.Time
+}
+
+func newSenderLimiter(rate float64, burst int) *senderLimiter {
+	return &senderLimiter{
+		rate:     rate,
+		burst:    float64(burst),
+		tokens:   float64(burst),
+		lastSeen: time.Now(),
+		now:      time.Now,
+	}
+}
+
+// report if another message is allowed
+// and consume a token if so
+func (l *senderLimiter) Allow() bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	// refill the tokens for the elapsed time
+	now := l.now()
+	l.tokens += now.Sub(l.lastSeen).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.lastSeen = now
+
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// a limiter is idle once its bucket would be refilled completely.
+// Dropping it then is the same as keeping it.
+func (l *senderLimiter) idle() bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	refilled := l.tokens + l.now().Sub(l.lastSeen).Seconds()*l.rate
+	return refilled >= l.burst
+}
+
+// change the limit for incoming messages per sender
+// existing limiters are dropped so the new limit applies to everyone
+func (c *Chat) SetSenderRateLimit(r float64, burst int) {
+	c.senderRateLock.Lock()
+	defer c.senderRateLock.Unlock()
+	c.senderRate = r
+	c.senderBurst = burst
+	c.senderRateLimiter.Range(func(key, value interface{}) bool {
+		c.senderRateLimiter.Delete(key)
+		return true
+	})
+}
+
+// check if we accept another message from the sender
+func (c *Chat) allowMessageFrom(sender [32]byte) bool {
+	c.senderRateLock.RLock()
+	defer c.senderRateLock.RUnlock()
+
+	if limiter, exist := c.senderRateLimiter.Load(sender); exist {
+		return limiter.(*senderLimiter).Allow()
+	}
+
+	r, burst := float64(defaultSenderRate), defaultSenderBurst
+	if c.senderRate != 0 || c.senderBurst != 0 {
+		r, burst = c.senderRate, c.senderBurst
+	}
+
+	limiter, _ := c.senderRateLimiter.LoadOrStore(sender, newSenderLimiter(r, burst))
+	return limiter.(*senderLimiter).Allow()
+}
+
+// drop the limiters of senders that didn't send anything for a while
+func (c *Chat) evictIdleSenderLimiters() {
+	c.senderRateLimiter.Range(func(key, value interface{}) bool {
+		if value.(*senderLimiter).idle() {
+			c.senderRateLimiter.Delete(key)
+		}
+		return true
+	})
+}
+
+// periodically evict idle limiters so the map doesn't
+// grow with every sender we ever got a message from
+func (c *Chat) sweepSenderLimiters() {
+	ticker := time.NewTicker(senderLimiterSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.closer:
+			return
+		case <-ticker.C:
+			c.evictIdleSenderLimiters()
+		}
+	}
+}
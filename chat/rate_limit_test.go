@@ -0,0 +1,109 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	bpb "github.com/Bit-Nation/protobuffers"
+	require "github.com/stretchr/testify/require"
+)
+
+func TestSenderLimiter_Allow(t *testing.T) {
+
+	now := time.Now()
+	l := newSenderLimiter(2, 3)
+	l.lastSeen = now
+	l.now = func() time.Time {
+		return now
+	}
+
+	// burst is available right away
+	require.True(t, l.Allow())
+	require.True(t, l.Allow())
+	require.True(t, l.Allow())
+	require.False(t, l.Allow())
+
+	// a rate of 2 refills one token in 500ms
+	now = now.Add(time.Millisecond * 500)
+	require.True(t, l.Allow())
+	require.False(t, l.Allow())
+
+	// tokens never exceed the burst
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		require.True(t, l.Allow())
+	}
+	require.False(t, l.Allow())
+
+}
+
+func TestChat_SetSenderRateLimit(t *testing.T) {
+
+	c := Chat{}
+	alice := [32]byte{1}
+	bob := [32]byte{2}
+
+	// default burst
+	for i := 0; i < defaultSenderBurst; i++ {
+		require.True(t, c.allowMessageFrom(alice))
+	}
+	require.False(t, c.allowMessageFrom(alice))
+
+	// the new limit applies to known senders too
+	c.SetSenderRateLimit(1, 1)
+	require.True(t, c.allowMessageFrom(alice))
+	require.False(t, c.allowMessageFrom(alice))
+
+	// senders are limited independently
+	require.True(t, c.allowMessageFrom(bob))
+	require.False(t, c.allowMessageFrom(bob))
+
+}
+
+func TestChat_handlePlainMessageRateLimited(t *testing.T) {
+
+	c := Chat{}
+	c.SetSenderRateLimit(1, 1)
+
+	sender := make([]byte, 32)
+	sender[0] = 1
+	var senderKey [32]byte
+	copy(senderKey[:], sender)
+	require.True(t, c.allowMessageFrom(senderKey))
+
+	// the message must fail so it's not acknowledged
+	err := c.handlePlainMessage(sender, &bpb.PlainChatMessage{Message: []byte("hi")})
+	require.Equal(t, ErrSenderRateLimited, err)
+
+}
+
+func TestChat_evictIdleSenderLimiters(t *testing.T) {
+
+	now := time.Now()
+	limiter := func(clock *time.Time) *senderLimiter {
+		l := newSenderLimiter(1, 2)
+		l.lastSeen = *clock
+		l.now = func() time.Time {
+			return *clock
+		}
+		require.True(t, l.Allow())
+		return l
+	}
+
+	activeClock, idleClock := now, now
+	c := Chat{}
+	c.senderRateLimiter.Store([32]byte{1}, limiter(&activeClock))
+	c.senderRateLimiter.Store([32]byte{2}, limiter(&idleClock))
+
+	// the active bucket is still missing half a token
+	// while the idle one has been refilled completely
+	activeClock = now.Add(time.Millisecond * 500)
+	idleClock = now.Add(time.Second * 5)
+	c.evictIdleSenderLimiters()
+
+	_, exist := c.senderRateLimiter.Load([32]byte{1})
+	require.True(t, exist)
+	_, exist = c.senderRateLimiter.Load([32]byte{2})
+	require.False(t, exist)
+
+}
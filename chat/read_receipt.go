@@ -0,0 +1,95 @@
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	db "github.com/Bit-Nation/panthalassa/db"
+	bpb "github.com/Bit-Nation/protobuffers"
+	uuid "github.com/satori/go.uuid"
+	ed25519 "golang.org/x/crypto/ed25519"
+)
+
+const readReceiptType = "CHAT:READ_RECEIPT"
+
+func isReadReceipt(msg *bpb.PlainChatMessage) bool {
+	return !isDAppMessage(msg) && msg.Type == readReceiptType
+}
+
+// tell the partner that we read all messages up to the received message
+// database ids are local - so the receipt references the message id
+func (c *Chat) SendReadReceipt(partner ed25519.PublicKey, readUpToDBID int64) error {
+
+	msg, err := c.messageDB.GetMessage(partner, readUpToDBID)
+	if err != nil {
+		return err
+	}
+	if msg == nil {
+		return fmt.Errorf("message %d of partner %x doesn't exist", readUpToDBID, partner)
+	}
+	if !msg.Received {
+		return errors.New("can only send read receipts for received messages")
+	}
+
+	params, err := json.Marshal(db.ReadReceipt{
+		MessageID: msg.ID,
+	})
+	if err != nil {
+		return err
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+
+	return c.sendPlainMessage(partner, bpb.PlainChatMessage{
+		CreatedAt: time.Now().UnixNano(),
+		MessageID: id.String(),
+		Type:      readReceiptType,
+		Params:    params,
+		Version:   1,
+	}, func(err error) error {
+		return err
+	})
+
+}
+
+// mark our messages up to the read one as delivered
+func (c *Chat) handleReadReceipt(sender ed25519.PublicKey, receipt db.ReadReceipt) error {
+
+	sent, err := c.messageDB.GetMessagesByStatus(sender, db.StatusSent)
+	if err != nil {
+		return err
+	}
+
+	// resolve the message id to our database id
+	var readUpToDBID int64
+	found := false
+	for _, m := range sent {
+		if !m.Received && db.MessageIDEqual(m.ID, receipt.MessageID) {
+			readUpToDBID = m.DatabaseID
+			found = true
+			break
+		}
+	}
+
+	// the message might already be marked
+	if !found {
+		return nil
+	}
+
+	for _, m := range sent {
+		if m.Received || m.DatabaseID > readUpToDBID {
+			continue
+		}
+		if err := c.messageDB.UpdateStatus(sender, m.DatabaseID, db.StatusDelivered); err != nil {
+			return err
+		}
+	}
+
+	return nil
+
+}
@@ -0,0 +1,169 @@
+package chat
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"testing"
+
+	preKey "github.com/Bit-Nation/panthalassa/chat/prekey"
+	db "github.com/Bit-Nation/panthalassa/db"
+	bpb "github.com/Bit-Nation/protobuffers"
+	x3dh "github.com/Bit-Nation/x3dh"
+	proto "github.com/gogo/protobuf/proto"
+	require "github.com/stretchr/testify/require"
+	dr "github.com/tiabc/doubleratchet"
+	ed25519 "golang.org/x/crypto/ed25519"
+)
+
+// Bob read the messages of Alice and sends a read receipt
+func TestChat_SendReadReceipt(t *testing.T) {
+
+	kmAlice := createKeyManager()
+	idPubKeyAliceStr, err := kmAlice.IdentityPublicKey()
+	require.Nil(t, err)
+	rawIdPubKeyAlice, err := hex.DecodeString(idPubKeyAliceStr)
+	require.Nil(t, err)
+
+	kmBob := createKeyManager()
+	idPubKeyBobStr, err := kmBob.IdentityPublicKey()
+	require.Nil(t, err)
+	rawIdPubKeyBob, err := hex.DecodeString(idPubKeyBobStr)
+	require.Nil(t, err)
+
+	// alice signed pre key
+	curve := x3dh.NewCurve25519(rand.Reader)
+	drKeyPair, err := curve.GenerateKeyPair()
+	require.Nil(t, err)
+	signedPreKeyAlice := preKey.PreKey{}
+	signedPreKeyAlice.PrivateKey = drKeyPair.PrivateKey
+	signedPreKeyAlice.PublicKey = drKeyPair.PublicKey
+	require.Nil(t, signedPreKeyAlice.Sign(*kmAlice))
+
+	sharedSecretBaseID := make([]byte, 32)
+	_, err = rand.Read(sharedSecretBaseID)
+	require.Nil(t, err)
+
+	// messages of alice in the chat of alice
+	aliceMessages := []db.Message{
+		{ID: "first", DatabaseID: 1, Status: db.StatusSent},
+		{ID: "received", DatabaseID: 2, Status: db.StatusSent, Received: true},
+		{ID: "second", DatabaseID: 3, Status: db.StatusSent},
+		{ID: "third", DatabaseID: 4, Status: db.StatusSent},
+	}
+
+	// bob's chat that sends the read receipt
+	var submitted *bpb.ChatMessage
+	bobChat := Chat{
+		messageDB: &testMessageStorage{
+			getMessage: func(partner ed25519.PublicKey, messageID int64) (*db.Message, error) {
+				require.Equal(t, rawIdPubKeyAlice, []byte(partner))
+				switch messageID {
+				case 7:
+					return &db.Message{ID: "second", DatabaseID: 7, Received: true}, nil
+				case 8:
+					return &db.Message{ID: "own", DatabaseID: 8}, nil
+				}
+				return nil, nil
+			},
+		},
+		backend: &testBackend{
+			submitMessages: func(messages []*bpb.ChatMessage) error {
+				require.Len(t, messages, 1)
+				submitted = messages[0]
+				return nil
+			},
+		},
+		sharedSecStorage: &testSharedSecretStorage{
+			hasAny: func(key ed25519.PublicKey) (bool, error) {
+				return true, nil
+			},
+			getYoungest: func(key ed25519.PublicKey) (*db.SharedSecret, error) {
+				return &db.SharedSecret{X3dhSS: x3dh.SharedSecret{1}, Accepted: true, BaseID: sharedSecretBaseID}, nil
+			},
+		},
+		userStorage: &testUserStorage{
+			getSignedPreKey: func(idKey ed25519.PublicKey) (*preKey.PreKey, error) {
+				return &signedPreKeyAlice, nil
+			},
+		},
+		km:           kmBob,
+		drKeyStorage: &dr.KeysStorageInMemory{},
+	}
+
+	// only received messages can be marked as read
+	require.EqualError(t, bobChat.SendReadReceipt(rawIdPubKeyAlice, 8), "can only send read receipts for received messages")
+	require.EqualError(t, bobChat.SendReadReceipt(rawIdPubKeyAlice, 9), "message 9 of partner "+idPubKeyAliceStr+" doesn't exist")
+
+	require.Nil(t, bobChat.SendReadReceipt(rawIdPubKeyAlice, 7))
+	require.NotNil(t, submitted)
+	require.Equal(t, rawIdPubKeyBob, submitted.Sender)
+
+	// alice decrypts the read receipt
+	var dh dr.Key
+	copy(dh[:], submitted.Message.DoubleRatchetPK)
+	drSession, err := dr.New([32]byte{1}, &drDhPair{
+		x3dhPair: x3dh.KeyPair{
+			PublicKey:  signedPreKeyAlice.PublicKey,
+			PrivateKey: signedPreKeyAlice.PrivateKey,
+		},
+	})
+	require.Nil(t, err)
+	decryptedRawMessage, err := drSession.RatchetDecrypt(dr.Message{
+		Header: dr.MessageHeader{
+			DH: dh,
+			N:  submitted.Message.N,
+			PN: submitted.Message.Pn,
+		},
+		Ciphertext: submitted.Message.CipherText,
+	}, nil)
+	require.Nil(t, err)
+	plainMsg := bpb.PlainChatMessage{}
+	require.Nil(t, proto.Unmarshal(decryptedRawMessage, &plainMsg))
+
+	// alice's chat marks her messages up to the read one
+	updated := map[int64]db.Status{}
+	aliceChat := Chat{
+		messageDB: &testMessageStorage{
+			getMessagesByStatus: func(partner ed25519.PublicKey, status db.Status) ([]db.Message, error) {
+				require.Equal(t, rawIdPubKeyBob, []byte(partner))
+				require.Equal(t, db.StatusSent, status)
+				return aliceMessages, nil
+			},
+			updateStatus: func(partner ed25519.PublicKey, msgID int64, newStatus db.Status) error {
+				require.Equal(t, rawIdPubKeyBob, []byte(partner))
+				updated[msgID] = newStatus
+				return nil
+			},
+			persistReceivedMessage: func(partner ed25519.PublicKey, msg db.Message) error {
+				require.FailNow(t, "read receipts must not be persisted")
+				return nil
+			},
+		},
+		km: kmAlice,
+	}
+
+	require.Nil(t, aliceChat.handlePlainMessage(rawIdPubKeyBob, &plainMsg))
+	require.Equal(t, map[int64]db.Status{
+		1: db.StatusDelivered,
+		3: db.StatusDelivered,
+	}, updated)
+
+}
+
+func TestChat_handleReadReceiptUnknownMessage(t *testing.T) {
+
+	c := Chat{
+		messageDB: &testMessageStorage{
+			getMessagesByStatus: func(partner ed25519.PublicKey, status db.Status) ([]db.Message, error) {
+				return []db.Message{{ID: "first", DatabaseID: 1, Status: db.StatusSent}}, nil
+			},
+			updateStatus: func(partner ed25519.PublicKey, msgID int64, newStatus db.Status) error {
+				require.FailNow(t, "status must not be updated")
+				return nil
+			},
+		},
+	}
+
+	require.Nil(t, c.handleReadReceipt(ed25519.PublicKey{1}, db.ReadReceipt{MessageID: "unknown"}))
+
+}
@@ -3,6 +3,7 @@ package chat
 import (
 	"encoding/hex"
 	"errors"
+	"sync/atomic"
 	"time"
 
 	db "github.com/Bit-Nation/panthalassa/db"
@@ -71,6 +72,57 @@ func (c *Chat) decryptMessage(msg dr.Message, sharedSecret x3dh.SharedSecret, si
 
 }
 
+// persist a received message and count it
+func (c *Chat) persistReceivedMessage(partner ed25519.PublicKey, msg db.Message) error {
+	if err := c.messageDB.PersistReceivedMessage(partner, msg); err != nil {
+		return err
+	}
+	atomic.AddUint64(&c.stats.MessagesReceived, 1)
+	return nil
+}
+
+// persist a decrypted message
+// fails with ErrSenderRateLimited when the sender floods us
+// messages of the group protocol are passed to the group handler
+// and read receipts update the status of our messages
+func (c *Chat) handlePlainMessage(sender ed25519.PublicKey, plainMsg *bpb.PlainChatMessage) error {
+
+	// the sender is authenticated once the message got decrypted,
+	// so the limit can't be used to silence someone else
+	var senderKey [32]byte
+	copy(senderKey[:], sender)
+	if !c.allowMessageFrom(senderKey) {
+		logger.Warningf("rejecting message from %x - rate limit exceeded", sender)
+		return ErrSenderRateLimited
+	}
+
+	if isGroupMessage(plainMsg) {
+		return c.handleGroupMessage(sender, plainMsg)
+	}
+
+	// convert proto message to database message
+	dbMessage, err := protoPlainMsgToMessage(plainMsg)
+	if err != nil {
+		return err
+	}
+	dbMessage.Sender = sender
+
+	// read receipts only update the status of our messages
+	if dbMessage.ReadReceipt != nil {
+		return c.handleReadReceipt(sender, *dbMessage.ReadReceipt)
+	}
+
+	return c.persistReceivedMessage(sender, dbMessage)
+
+}
+
+// handle a received chat message
+// messages delivered by the backend and messages
+// delivered directly by a peer go through this
+func (c *Chat) ReceiveMessage(msg *bpb.ChatMessage) error {
+	return c.handleReceivedMessage(msg)
+}
+
 func (c *Chat) handleReceivedMessage(msg *bpb.ChatMessage) error {
 
 	// @todo HERE would message authentication happen if we decide to implement it
@@ -174,15 +226,10 @@ func (c *Chat) handleReceivedMessage(msg *bpb.ChatMessage) error {
 
 			decryptedMsg, err := c.decryptMessage(drMessage, sharedSecret.X3dhSS, &signedPreKey)
 			if err != nil {
+				atomic.AddUint64(&c.stats.DecryptionFailures, 1)
 				return err
 			}
-			// convert proto plain message to decrypted message
-			dbMessage, err := protoPlainMsgToMessage(&decryptedMsg)
-			dbMessage.Sender = sender
-			if err != nil {
-				return err
-			}
-			return c.messageDB.PersistReceivedMessage(msg.Sender, dbMessage)
+			return c.handlePlainMessage(msg.Sender, &decryptedMsg)
 		}
 
 		// fetch used one time pre key
@@ -232,6 +279,7 @@ func (c *Chat) handleReceivedMessage(msg *bpb.ChatMessage) error {
 		logger.Debug("try to decrypt message with newly created shared secret")
 		protoMessage, err := drSession.RatchetDecrypt(drMessage, nil)
 		if err != nil {
+			atomic.AddUint64(&c.stats.DecryptionFailures, 1)
 			return err
 		}
 
@@ -257,6 +305,13 @@ func (c *Chat) handleReceivedMessage(msg *bpb.ChatMessage) error {
 			return errors.New("abort chat initialization - invalid shared secret creation date")
 		}
 
+		// a partner we already have a shared secret with
+		// initialized a new chat
+		hadSharedSecret, err := c.sharedSecStorage.HasAny(sender)
+		if err != nil {
+			return err
+		}
+
 		// persist shared secret in accepted mode
 		err = c.sharedSecStorage.Put(sender, db.SharedSecret{
 			X3dhSS: sharedX3dhSec,
@@ -270,15 +325,12 @@ func (c *Chat) handleReceivedMessage(msg *bpb.ChatMessage) error {
 		if err != nil {
 			return err
 		}
-
-		// convert plain protobuf message to database message
-		dbMessage, err := protoPlainMsgToMessage(&plainMsg)
-		dbMessage.Sender = sender
-		if err != nil {
-			return err
+		atomic.AddUint64(&c.stats.SharedSecretsCreated, 1)
+		if hadSharedSecret {
+			atomic.AddUint64(&c.stats.SessionResets, 1)
 		}
 
-		return c.messageDB.PersistReceivedMessage(sender, dbMessage)
+		return c.handlePlainMessage(sender, &plainMsg)
 
 	}
 
@@ -304,18 +356,12 @@ func (c *Chat) handleReceivedMessage(msg *bpb.ChatMessage) error {
 	// decrypt message with fetched x3dh shared secret
 	plainMsg, err := c.decryptMessage(drMessage, sharedSec.X3dhSS, nil)
 	if err != nil {
-		return err
-	}
-
-	// convert proto message to database message
-	dbMessage, err := protoPlainMsgToMessage(&plainMsg)
-	dbMessage.Sender = sender
-	if err != nil {
+		atomic.AddUint64(&c.stats.DecryptionFailures, 1)
 		return err
 	}
 
 	// persist message
-	if err := c.messageDB.PersistReceivedMessage(msg.Sender, dbMessage); err != nil {
+	if err := c.handlePlainMessage(msg.Sender, &plainMsg); err != nil {
 		return err
 	}
 
@@ -55,6 +55,54 @@ func TestDoNotHandleOwnMessages(t *testing.T) {
 
 }
 
+func TestReceiveMessageUsesBackendPath(t *testing.T) {
+
+	km := createKeyManager()
+
+	c := Chat{
+		km: km,
+	}
+
+	myIDKey, err := km.IdentityPublicKey()
+	require.Nil(t, err)
+	myIDRawKey, err := hex.DecodeString(myIDKey)
+	require.Nil(t, err)
+
+	msg := &bpb.ChatMessage{
+		Sender:           myIDRawKey,
+		UsedSharedSecret: make([]byte, 32),
+	}
+
+	// direct delivery and backend delivery must result in the same handling
+	require.Equal(t, c.handleReceivedMessage(msg), c.ReceiveMessage(msg))
+	require.EqualError(t, c.ReceiveMessage(msg), "in can't handle messages I created my self - this is non sense")
+
+	// backend delivery
+	resp, err := c.messagesHandler(&bpb.BackendMessage_Request{
+		Messages: []*bpb.ChatMessage{msg},
+	})
+	require.Nil(t, err)
+	require.NotNil(t, resp)
+
+}
+
+func TestMessagesHandlerRecoversFromPanic(t *testing.T) {
+
+	// the missing key manager panics while handling the message
+	c := Chat{}
+
+	resp, err := c.messagesHandler(&bpb.BackendMessage_Request{
+		Messages: []*bpb.ChatMessage{
+			&bpb.ChatMessage{
+				Sender: make([]byte, 32),
+			},
+		},
+	})
+	require.Nil(t, err)
+	require.NotNil(t, resp)
+
+}
+
 func TestSenderTooShort(t *testing.T) {
 
 	km := createKeyManager()
@@ -350,6 +398,9 @@ func TestChatInitSharedSecretAgreementAndMsgPersistence(t *testing.T) {
 			secretForChatInitMsg: func(partner ed25519.PublicKey, id []byte) (*db.SharedSecret, error) {
 				return nil, nil
 			},
+			hasAny: func(key ed25519.PublicKey) (bool, error) {
+				return false, nil
+			},
 			put: func(key ed25519.PublicKey, sharedSecret db.SharedSecret) error {
 				// must be true since we received a chat init message
 				require.True(t, sharedSecret.Accepted)
@@ -391,6 +442,11 @@ func TestChatInitSharedSecretAgreementAndMsgPersistence(t *testing.T) {
 	err = c.handleReceivedMessage(msg)
 	require.Nil(t, err)
 
+	require.Equal(t, ChatStats{
+		MessagesReceived:     1,
+		SharedSecretsCreated: 1,
+	}, c.Statistics())
+
 }
 
 func TestChatHandleInvalidShortSharedSecretID(t *testing.T) {
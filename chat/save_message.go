@@ -1,6 +1,8 @@
 package chat
 
 import (
+	"errors"
+	"fmt"
 	"time"
 
 	db "github.com/Bit-Nation/panthalassa/db"
@@ -19,3 +21,29 @@ func (c *Chat) SavePrivateMessage(to ed25519.PublicKey, rawMessage []byte) error
 	}
 	return c.messageDB.PersistMessageToSend(to, msg)
 }
+
+// forward a message to a different partner
+// the forwarded message is persisted as a new outgoing message
+func (c *Chat) ForwardMessage(originalPartner ed25519.PublicKey, dbID int64, newReceiver ed25519.PublicKey) error {
+
+	original, err := c.messageDB.GetMessage(originalPartner, dbID)
+	if err != nil {
+		return err
+	}
+	if original == nil {
+		return fmt.Errorf("message %d of partner %x doesn't exist", dbID, originalPartner)
+	}
+
+	// DApp messages are bound to the DApp state of the chat
+	if original.DApp != nil {
+		return errors.New("can't forward DApp messages")
+	}
+
+	// a fresh message id is assigned when persisting
+	return c.messageDB.PersistMessageToSend(newReceiver, db.Message{
+		Message:       original.Message,
+		CreatedAt:     nowAsUnix(),
+		ForwardedFrom: originalPartner,
+	})
+
+}
@@ -0,0 +1,66 @@
+package chat
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+
+	aes "github.com/Bit-Nation/panthalassa/crypto/aes"
+	hkdf "golang.org/x/crypto/hkdf"
+)
+
+// derive the key used to encrypt data only we can read
+func (c *Chat) selfEncryptionKey() (aes.Secret, error) {
+
+	idKeyStr, err := c.km.IdentityPrivateKey()
+	if err != nil {
+		return aes.Secret{}, err
+	}
+	idKey, err := hex.DecodeString(idKeyStr)
+	if err != nil {
+		return aes.Secret{}, err
+	}
+
+	var key aes.Secret
+	kdf := hkdf.New(sha256.New, idKey, nil, []byte("self-encryption"))
+	if _, err := io.ReadFull(kdf, key[:]); err != nil {
+		return aes.Secret{}, err
+	}
+
+	return key, nil
+
+}
+
+// encrypt data (e.g. notes) for our self
+func (c *Chat) EncryptForSelf(plaintext []byte) ([]byte, error) {
+
+	key, err := c.selfEncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+
+	ct, err := aes.CTREncrypt(plaintext, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return ct.Marshal()
+
+}
+
+// decrypt data that was encrypted with EncryptForSelf
+func (c *Chat) DecryptFromSelf(ciphertext []byte) ([]byte, error) {
+
+	key, err := c.selfEncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+
+	ct, err := aes.Unmarshal(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	return aes.CTRDecrypt(ct, key)
+
+}
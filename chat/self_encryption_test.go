@@ -0,0 +1,30 @@
+package chat
+
+import (
+	"testing"
+
+	require "github.com/stretchr/testify/require"
+)
+
+func TestChat_EncryptForSelf(t *testing.T) {
+
+	c := Chat{
+		km: createKeyManager(),
+	}
+
+	ct, err := c.EncryptForSelf([]byte("my note"))
+	require.Nil(t, err)
+	require.NotContains(t, string(ct), "my note")
+
+	plain, err := c.DecryptFromSelf(ct)
+	require.Nil(t, err)
+	require.Equal(t, "my note", string(plain))
+
+	// someone else can't decrypt it
+	other := Chat{
+		km: createKeyManager(),
+	}
+	_, err = other.DecryptFromSelf(ct)
+	require.NotNil(t, err)
+
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"sync/atomic"
 	"time"
 
 	prekey "github.com/Bit-Nation/panthalassa/chat/prekey"
@@ -25,6 +26,11 @@ func (c *Chat) SendMessage(receiver ed25519.PublicKey, dbMessage db.Message) err
 		return err
 	}
 
+	// a failed rotation must not prevent the message from being sent
+	if err := c.rotateSignedPreKeyIfExpired(); err != nil {
+		logger.Error(err)
+	}
+
 	// create plain message from database message
 	plainMessage := bpb.PlainChatMessage{
 		CreatedAt: dbMessage.CreatedAt,
@@ -58,6 +64,17 @@ func (c *Chat) SendMessage(receiver ed25519.PublicKey, dbMessage db.Message) err
 		return err
 	}
 
+	if err := c.sendPlainMessage(receiver, plainMessage, handleSendError); err != nil {
+		return err
+	}
+
+	return c.messageDB.UpdateStatus(receiver, dbMessage.DatabaseID, db.StatusSent)
+}
+
+// encrypt the plain message and submit it to the backend
+// errors are passed through handleSendError
+func (c *Chat) sendPlainMessage(receiver ed25519.PublicKey, plainMessage bpb.PlainChatMessage, handleSendError func(err error) error) error {
+
 	var fetchSignedPreKey = func(userIDPubKey ed25519.PublicKey) (prekey.PreKey, error) {
 		signedPreKey, err := c.userStorage.GetSignedPreKey(receiver)
 		if err != nil {
@@ -96,7 +113,7 @@ func (c *Chat) SendMessage(receiver ed25519.PublicKey, dbMessage db.Message) err
 	// if we don't have a shared secret we create one
 	if !exist {
 		// fetch pre key bundle
-		preKeyBundle, err := c.backend.FetchPreKeyBundle(receiver)
+		preKeyBundle, err := c.fetchPreKeyBundle(receiver)
 		if err != nil {
 			return handleSendError(err)
 		}
@@ -105,6 +122,9 @@ func (c *Chat) SendMessage(receiver ed25519.PublicKey, dbMessage db.Message) err
 		if err != nil {
 			return handleSendError(err)
 		}
+		// the one time pre key of the bundle is used now
+		// so the bundle must not be used again
+		c.InvalidatePreKeyCache(receiver)
 
 		// ephemeral key signature
 		eks, err := c.km.IdentitySign(initializedProtocol.EphemeralKey[:])
@@ -140,6 +160,7 @@ func (c *Chat) SendMessage(receiver ed25519.PublicKey, dbMessage db.Message) err
 		if err := c.sharedSecStorage.Put(receiver, ss); err != nil {
 			return handleSendError(err)
 		}
+		atomic.AddUint64(&c.stats.SharedSecretsCreated, 1)
 	}
 
 	// fetch shared secret
@@ -171,7 +192,7 @@ func (c *Chat) SendMessage(receiver ed25519.PublicKey, dbMessage db.Message) err
 	}
 
 	// check if signed pre key expired
-	expired := signedPreKey.OlderThan(db.SignedPreKeyValidTimeFrame)
+	expired := signedPreKey.OlderThan(c.signedPreKeyValidTimeFrame())
 	if expired {
 		err = c.refreshSignedPreKey(receiver)
 		if err != nil {
@@ -219,7 +240,7 @@ func (c *Chat) SendMessage(receiver ed25519.PublicKey, dbMessage db.Message) err
 
 	// construct chat message
 	msgToSend := bpb.ChatMessage{
-		MessageID: []byte(dbMessage.ID),
+		MessageID: []byte(plainMessage.MessageID),
 		Receiver:  receiver,
 		Message: &bpb.DoubleRatchetMsg{
 			DoubleRatchetPK: drMessage.Header.DH[:],
@@ -285,6 +306,7 @@ func (c *Chat) SendMessage(receiver ed25519.PublicKey, dbMessage db.Message) err
 	if err != nil {
 		return handleSendError(err)
 	}
+	atomic.AddUint64(&c.stats.MessagesSent, 1)
 
-	return c.messageDB.UpdateStatus(receiver, dbMessage.DatabaseID, db.StatusSent)
+	return nil
 }
@@ -0,0 +1,78 @@
+package chat
+
+import (
+	"crypto/rand"
+	"time"
+
+	preKey "github.com/Bit-Nation/panthalassa/chat/prekey"
+	db "github.com/Bit-Nation/panthalassa/db"
+	x3dh "github.com/Bit-Nation/x3dh"
+)
+
+// create a new signed pre key and upload it to the backend
+// the chat id key pair is not rotated
+func (c *Chat) RefreshPreKeyBundle() error {
+	return c.RotateSignedPreKey()
+}
+
+// time frame in which signed pre keys are valid
+func (c *Chat) signedPreKeyValidTimeFrame() time.Duration {
+	if c.signedPreKeyValidity == 0 {
+		return db.SignedPreKeyValidTimeFrame
+	}
+	return c.signedPreKeyValidity
+}
+
+// rotate our signed pre key in the case it's older than the valid time frame
+func (c *Chat) rotateSignedPreKeyIfExpired() error {
+
+	c.signedPreKeyLock.Lock()
+	defer c.signedPreKeyLock.Unlock()
+
+	if c.now == nil {
+		return nil
+	}
+
+	newest, err := c.signedPreKeyStorage.Newest()
+	if err != nil {
+		return err
+	}
+	// the backend creates the first signed pre key
+	if newest == nil {
+		return nil
+	}
+
+	// keys are persisted with the default valid time frame
+	createdAt := time.Unix(newest.ValidTill, 0).Add(-db.SignedPreKeyValidTimeFrame)
+	if c.now().Sub(createdAt) < c.signedPreKeyValidTimeFrame() {
+		return nil
+	}
+
+	return c.RotateSignedPreKey()
+
+}
+
+// create a new signed pre key, upload it to the backend and persist it
+func (c *Chat) RotateSignedPreKey() error {
+
+	c25519 := x3dh.NewCurve25519(rand.Reader)
+	keyPair, err := c25519.GenerateKeyPair()
+	if err != nil {
+		return err
+	}
+
+	signedPreKey := preKey.PreKey{}
+	signedPreKey.KeyPair = keyPair
+	if err := signedPreKey.Sign(*c.km); err != nil {
+		return err
+	}
+
+	// upload first so that we don't persist
+	// a key nobody can use
+	if err := c.backend.UploadSignedPreKey(signedPreKey); err != nil {
+		return err
+	}
+
+	return c.signedPreKeyStorage.Put(keyPair)
+
+}
@@ -0,0 +1,180 @@
+package chat
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	preKey "github.com/Bit-Nation/panthalassa/chat/prekey"
+	db "github.com/Bit-Nation/panthalassa/db"
+	x3dh "github.com/Bit-Nation/x3dh"
+	require "github.com/stretchr/testify/require"
+)
+
+func TestChat_RefreshPreKeyBundle(t *testing.T) {
+
+	km := createKeyManager()
+
+	var uploaded preKey.PreKey
+	var persisted x3dh.KeyPair
+	c := Chat{
+		km: km,
+		backend: &testBackend{
+			uploadSignedPreKey: func(signedPreKey preKey.PreKey) error {
+				uploaded = signedPreKey
+				return nil
+			},
+		},
+		signedPreKeyStorage: &testSignedPreKeyStore{
+			put: func(signedPreKey x3dh.KeyPair) error {
+				persisted = signedPreKey
+				return nil
+			},
+		},
+	}
+
+	require.Nil(t, c.RefreshPreKeyBundle())
+	require.Equal(t, uploaded.PublicKey, persisted.PublicKey)
+
+	// uploaded key must be signed by us
+	idKeyStr, err := km.IdentityPublicKey()
+	require.Nil(t, err)
+	idKey, err := hex.DecodeString(idKeyStr)
+	require.Nil(t, err)
+	valid, err := uploaded.VerifySignature(idKey)
+	require.Nil(t, err)
+	require.True(t, valid)
+
+}
+
+func TestChat_RefreshPreKeyBundleUploadError(t *testing.T) {
+
+	c := Chat{
+		km: createKeyManager(),
+		backend: &testBackend{
+			uploadSignedPreKey: func(signedPreKey preKey.PreKey) error {
+				return errors.New("failed to upload")
+			},
+		},
+		signedPreKeyStorage: &testSignedPreKeyStore{
+			put: func(signedPreKey x3dh.KeyPair) error {
+				require.FailNow(t, "must not persist a key that wasn't uploaded")
+				return nil
+			},
+		},
+	}
+
+	require.EqualError(t, c.RefreshPreKeyBundle(), "failed to upload")
+
+}
+
+func TestChat_RotateSignedPreKeyIfExpired(t *testing.T) {
+
+	now := time.Unix(1000, 0)
+	uploads := 0
+	// the persisted key was created at the start
+	persisted := &db.SignedPreKey{
+		ValidTill: now.Add(db.SignedPreKeyValidTimeFrame).Unix(),
+	}
+	c := Chat{
+		km: createKeyManager(),
+		backend: &testBackend{
+			uploadSignedPreKey: func(signedPreKey preKey.PreKey) error {
+				uploads++
+				return nil
+			},
+		},
+		signedPreKeyStorage: &testSignedPreKeyStore{
+			put: func(signedPreKey x3dh.KeyPair) error {
+				persisted = &db.SignedPreKey{
+					ValidTill: now.Add(db.SignedPreKeyValidTimeFrame).Unix(),
+					PublicKey: signedPreKey.PublicKey,
+				}
+				return nil
+			},
+			newest: func() (*db.SignedPreKey, error) {
+				return persisted, nil
+			},
+		},
+		signedPreKeyValidity: time.Hour,
+		now: func() time.Time {
+			return now
+		},
+	}
+
+	// the key is still valid
+	now = now.Add(time.Minute * 59)
+	require.Nil(t, c.rotateSignedPreKeyIfExpired())
+	require.Equal(t, 0, uploads)
+
+	// advance past the validity window
+	now = now.Add(time.Minute * 2)
+	require.Nil(t, c.rotateSignedPreKeyIfExpired())
+	require.Equal(t, 1, uploads)
+	require.Equal(t, now.Add(db.SignedPreKeyValidTimeFrame).Unix(), persisted.ValidTill)
+
+	// the new key is valid for another window
+	now = now.Add(time.Minute * 30)
+	require.Nil(t, c.rotateSignedPreKeyIfExpired())
+	require.Equal(t, 1, uploads)
+
+}
+
+func TestChat_RotateSignedPreKeyIfExpiredAfterRestart(t *testing.T) {
+
+	now := time.Unix(1000, 0)
+	uploads := 0
+	// the key was persisted before this chat got created
+	createdAt := now.Add(-time.Hour * 2)
+	newChat := func() *Chat {
+		return &Chat{
+			km: createKeyManager(),
+			backend: &testBackend{
+				uploadSignedPreKey: func(signedPreKey preKey.PreKey) error {
+					uploads++
+					return nil
+				},
+			},
+			signedPreKeyStorage: &testSignedPreKeyStore{
+				put: func(signedPreKey x3dh.KeyPair) error {
+					createdAt = now
+					return nil
+				},
+				newest: func() (*db.SignedPreKey, error) {
+					return &db.SignedPreKey{
+						ValidTill: createdAt.Add(db.SignedPreKeyValidTimeFrame).Unix(),
+					}, nil
+				},
+			},
+			signedPreKeyValidity: time.Hour,
+			now: func() time.Time {
+				return now
+			},
+		}
+	}
+
+	// restarting doesn't extend the lifetime of the key
+	require.Nil(t, newChat().rotateSignedPreKeyIfExpired())
+	require.Equal(t, 1, uploads)
+	require.Nil(t, newChat().rotateSignedPreKeyIfExpired())
+	require.Equal(t, 1, uploads)
+
+}
+
+func TestChat_RotateSignedPreKeyIfExpiredWithoutKey(t *testing.T) {
+
+	c := Chat{
+		backend: &testBackend{
+			uploadSignedPreKey: func(signedPreKey preKey.PreKey) error {
+				require.FailNow(t, "the backend creates the first signed pre key")
+				return nil
+			},
+		},
+		signedPreKeyStorage: &testSignedPreKeyStore{},
+		now:                 time.Now,
+	}
+
+	require.Nil(t, c.rotateSignedPreKeyIfExpired())
+
+}
@@ -0,0 +1,27 @@
+package chat
+
+import (
+	"sync/atomic"
+)
+
+// counters are kept in memory only and start
+// from zero every time the chat is created
+type ChatStats struct {
+	MessagesSent         uint64 `json:"messages_sent"`
+	MessagesReceived     uint64 `json:"messages_received"`
+	DecryptionFailures   uint64 `json:"decryption_failures"`
+	SharedSecretsCreated uint64 `json:"shared_secrets_created"`
+	// chat initializations of partners we already had a shared secret with
+	SessionResets uint64 `json:"session_resets"`
+}
+
+// snapshot of the chat counters
+func (c *Chat) Statistics() ChatStats {
+	return ChatStats{
+		MessagesSent:         atomic.LoadUint64(&c.stats.MessagesSent),
+		MessagesReceived:     atomic.LoadUint64(&c.stats.MessagesReceived),
+		DecryptionFailures:   atomic.LoadUint64(&c.stats.DecryptionFailures),
+		SharedSecretsCreated: atomic.LoadUint64(&c.stats.SharedSecretsCreated),
+		SessionResets:        atomic.LoadUint64(&c.stats.SessionResets),
+	}
+}
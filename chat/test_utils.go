@@ -1,7 +1,10 @@
 package chat
 
 import (
+	"time"
+
 	backend "github.com/Bit-Nation/panthalassa/backend"
+	group "github.com/Bit-Nation/panthalassa/chat/group"
 	preKey "github.com/Bit-Nation/panthalassa/chat/prekey"
 	db "github.com/Bit-Nation/panthalassa/db"
 	km "github.com/Bit-Nation/panthalassa/keyManager"
@@ -18,9 +21,12 @@ type testMessageStorage struct {
 	updateStatus           func(partner ed25519.PublicKey, msgID int64, newStatus db.Status) error
 	messages               func(partner ed25519.PublicKey, start int64, amount uint) ([]db.Message, error)
 	allChats               func() ([]ed25519.PublicKey, error)
-	addListener            func(fn func(e db.MessagePersistedEvent))
+	addListener            func(fn func(e db.MessagePersistedEvent)) func()
 	getMessage             func(partner ed25519.PublicKey, messageID int64) (*db.Message, error)
 	persistDAppMessage     func(partner ed25519.PublicKey, msg db.DAppMessage) error
+	getMessagesByStatus    func(partner ed25519.PublicKey, status db.Status) ([]db.Message, error)
+	deleteMessage          func(partner ed25519.PublicKey, dbID int64) error
+	deleteChat             func(partner ed25519.PublicKey) error
 }
 
 type testSharedSecretStorage struct {
@@ -30,13 +36,17 @@ type testSharedSecretStorage struct {
 	secretForChatInitMsg func(partner ed25519.PublicKey, id []byte) (*db.SharedSecret, error)
 	accept               func(partner ed25519.PublicKey, sharedSec *db.SharedSecret) error
 	get                  func(key ed25519.PublicKey, sharedSecretID []byte) (*db.SharedSecret, error)
+	cleanupExpired       func(maxAge time.Duration) (int, error)
 }
 
 type testBackend struct {
-	fetchPreKeyBundle func(userIDPubKey ed25519.PublicKey) (x3dh.PreKeyBundle, error)
-	submitMessages    func(msg []*bpb.ChatMessage) error
-	fetchSignedPreKey func(userIdPubKey ed25519.PublicKey) (preKey.PreKey, error)
-	addRequestHandler func(backend.RequestHandler)
+	fetchPreKeyBundle  func(userIDPubKey ed25519.PublicKey) (x3dh.PreKeyBundle, error)
+	submitMessages     func(msg []*bpb.ChatMessage) error
+	fetchSignedPreKey  func(userIdPubKey ed25519.PublicKey) (preKey.PreKey, error)
+	uploadSignedPreKey func(signedPreKey preKey.PreKey) error
+	addRequestHandler  func(backend.RequestHandler)
+	connected          func() bool
+	authenticated      func() bool
 }
 
 type testSignedPreKeyStore struct {
@@ -44,6 +54,22 @@ type testSignedPreKeyStore struct {
 	put       func(signedPreKey x3dh.KeyPair) error
 	get       func(publicKey x3dh.PublicKey) (*x3dh.PrivateKey, error)
 	all       func() []*x3dh.KeyPair
+	// optional, there is no signed pre key if not set
+	newest func() (*db.SignedPreKey, error)
+}
+
+type testGroupChatStorage struct {
+	put    func(metadata group.Metadata) error
+	get    func(groupID []byte) (*group.Metadata, error)
+	all    func() ([]group.Metadata, error)
+	delete func(groupID []byte) error
+	// optional, sessions and sender keys aren't persisted if not set
+	putSession      func(session group.GroupSession) error
+	sessions        func() ([]group.GroupSession, error)
+	deleteSession   func(groupID []byte) error
+	putSenderKey    func(key db.GroupSenderKey) error
+	senderKeys      func() ([]db.GroupSenderKey, error)
+	deleteSenderKey func(groupID []byte, member ed25519.PublicKey) error
 }
 
 type testUserStorage struct {
@@ -93,6 +119,13 @@ func (s *testSignedPreKeyStore) All() []*x3dh.KeyPair {
 	return s.all()
 }
 
+func (s *testSignedPreKeyStore) Newest() (*db.SignedPreKey, error) {
+	if s.newest != nil {
+		return s.newest()
+	}
+	return nil, nil
+}
+
 func (b testPreKeyBundle) IdentityKey() x3dh.PublicKey {
 	return b.identityKey
 }
@@ -133,6 +166,10 @@ func (s *testSharedSecretStorage) Get(key ed25519.PublicKey, sharedSecretID []by
 	return s.get(key, sharedSecretID)
 }
 
+func (s *testSharedSecretStorage) CleanupExpired(maxAge time.Duration) (int, error) {
+	return s.cleanupExpired(maxAge)
+}
+
 func (s *testMessageStorage) PersistMessageToSend(partner ed25519.PublicKey, msg db.Message) error {
 	return s.persistMessageToSend(partner, msg)
 }
@@ -153,8 +190,8 @@ func (s *testMessageStorage) AllChats() ([]ed25519.PublicKey, error) {
 	return s.allChats()
 }
 
-func (s *testMessageStorage) AddListener(fn func(e db.MessagePersistedEvent)) {
-	s.addListener(fn)
+func (s *testMessageStorage) AddListener(fn func(e db.MessagePersistedEvent)) func() {
+	return s.addListener(fn)
 }
 
 func (s *testMessageStorage) GetMessage(partner ed25519.PublicKey, messageID int64) (*db.Message, error) {
@@ -173,10 +210,22 @@ func (b *testBackend) FetchSignedPreKey(userIdPubKey ed25519.PublicKey) (preKey.
 	return b.fetchSignedPreKey(userIdPubKey)
 }
 
+func (b *testBackend) UploadSignedPreKey(signedPreKey preKey.PreKey) error {
+	return b.uploadSignedPreKey(signedPreKey)
+}
+
 func (b *testBackend) AddRequestHandler(handler backend.RequestHandler) {
 	b.addRequestHandler(handler)
 }
 
+func (b *testBackend) Connected() bool {
+	return b.connected()
+}
+
+func (b *testBackend) Authenticated() bool {
+	return b.authenticated()
+}
+
 func (b *testBackend) Close() error {
 	return nil
 }
@@ -193,6 +242,76 @@ func (s *testMessageStorage) PersistDAppMessage(partner ed25519.PublicKey, msg d
 	return s.persistDAppMessage(partner, msg)
 }
 
+func (s *testMessageStorage) GetMessagesByStatus(partner ed25519.PublicKey, status db.Status) ([]db.Message, error) {
+	return s.getMessagesByStatus(partner, status)
+}
+
+func (s *testMessageStorage) DeleteMessage(partner ed25519.PublicKey, dbID int64) error {
+	return s.deleteMessage(partner, dbID)
+}
+
+func (s *testMessageStorage) DeleteChat(partner ed25519.PublicKey) error {
+	return s.deleteChat(partner)
+}
+
+func (s *testGroupChatStorage) Put(metadata group.Metadata) error {
+	return s.put(metadata)
+}
+
+func (s *testGroupChatStorage) Get(groupID []byte) (*group.Metadata, error) {
+	return s.get(groupID)
+}
+
+func (s *testGroupChatStorage) All() ([]group.Metadata, error) {
+	return s.all()
+}
+
+func (s *testGroupChatStorage) Delete(groupID []byte) error {
+	return s.delete(groupID)
+}
+
+func (s *testGroupChatStorage) PutSession(session group.GroupSession) error {
+	if s.putSession == nil {
+		return nil
+	}
+	return s.putSession(session)
+}
+
+func (s *testGroupChatStorage) Sessions() ([]group.GroupSession, error) {
+	if s.sessions == nil {
+		return nil, nil
+	}
+	return s.sessions()
+}
+
+func (s *testGroupChatStorage) DeleteSession(groupID []byte) error {
+	if s.deleteSession == nil {
+		return nil
+	}
+	return s.deleteSession(groupID)
+}
+
+func (s *testGroupChatStorage) PutSenderKey(key db.GroupSenderKey) error {
+	if s.putSenderKey == nil {
+		return nil
+	}
+	return s.putSenderKey(key)
+}
+
+func (s *testGroupChatStorage) SenderKeys() ([]db.GroupSenderKey, error) {
+	if s.senderKeys == nil {
+		return nil, nil
+	}
+	return s.senderKeys()
+}
+
+func (s *testGroupChatStorage) DeleteSenderKey(groupID []byte, member ed25519.PublicKey) error {
+	if s.deleteSenderKey == nil {
+		return nil
+	}
+	return s.deleteSenderKey(groupID, member)
+}
+
 func createKeyManager() *km.KeyManager {
 
 	mne, err := mnemonic.New()
@@ -205,6 +324,11 @@ func createKeyManager() *km.KeyManager {
 		panic(err)
 	}
 
-	return km.CreateFromKeyStore(keyStore)
+	keyManager, err := km.CreateFromKeyStore(keyStore)
+	if err != nil {
+		panic(err)
+	}
+
+	return keyManager
 
 }
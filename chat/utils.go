@@ -49,7 +49,7 @@ func (c *Chat) refreshSignedPreKey(idPubKey ed25519.PublicKey) error {
 	}
 
 	// check if signed pre key didn't expire
-	expired := signedPreKey.OlderThan(db.SignedPreKeyValidTimeFrame)
+	expired := signedPreKey.OlderThan(c.signedPreKeyValidTimeFrame())
 	if expired {
 		return errors.New("signed pre key expired")
 	}
@@ -185,6 +185,17 @@ func protoPlainMsgToMessage(msg *bpb.PlainChatMessage) (db.Message, error) {
 		m.Message = nil
 	}
 
+	if isReadReceipt(msg) {
+		m.ReadReceipt = &db.ReadReceipt{}
+		if err := json.Unmarshal(msg.Params, m.ReadReceipt); err != nil {
+			return db.Message{}, err
+		}
+		if m.ReadReceipt.MessageID == "" {
+			return db.Message{}, errors.New("read receipt is missing the message id")
+		}
+		m.Message = nil
+	}
+
 	return m, nil
 
 }
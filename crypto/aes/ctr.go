@@ -37,6 +37,7 @@ func CTREncrypt(plainText PlainText, secret Secret) (CipherText, error) {
 		IV:         iv,
 		CipherText: cipherText,
 		Version:    2,
+		Algorithm:  AlgorithmCTR,
 	}
 
 	// create mac
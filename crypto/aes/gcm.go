@@ -0,0 +1,75 @@
+package aes
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+)
+
+var gcmRandReader io.Reader = rand.Reader
+
+// encrypt plain text by given key using AES GCM 256.
+// The authentication tag is part of the cipher text.
+func GCMEncrypt(plainText PlainText, secret Secret) (CipherText, error) {
+
+	// block
+	block, err := aes.NewCipher(secret[:])
+	if err != nil {
+		return CipherText{}, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return CipherText{}, err
+	}
+
+	// nonce
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(gcmRandReader, nonce); err != nil {
+		return CipherText{}, err
+	}
+
+	ct := CipherText{
+		IV:        nonce,
+		Version:   3,
+		Algorithm: AlgorithmGCM,
+	}
+
+	// the version and algorithm are authenticated too
+	ct.CipherText = aead.Seal(nil, nonce, plainText, gcmAdditionalData(ct))
+
+	return ct, nil
+
+}
+
+// decrypt cipher text created by GCMEncrypt
+func GCMDecrypt(cipherText CipherText, secret Secret) (PlainText, error) {
+
+	// block
+	block, err := aes.NewCipher(secret[:])
+	if err != nil {
+		return PlainText{}, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return PlainText{}, err
+	}
+
+	if len(cipherText.IV) != aead.NonceSize() {
+		return PlainText{}, MacError
+	}
+
+	plainText, err := aead.Open(nil, cipherText.IV, cipherText.CipherText, gcmAdditionalData(cipherText))
+	if err != nil {
+		return PlainText{}, MacError
+	}
+
+	return plainText, nil
+
+}
+
+func gcmAdditionalData(ct CipherText) []byte {
+	return append([]byte{ct.Version}, []byte(ct.Algorithm)...)
+}
@@ -0,0 +1,99 @@
+package aes
+
+import (
+	"testing"
+
+	require "github.com/stretchr/testify/require"
+)
+
+func TestGCMEncryptDecrypt(t *testing.T) {
+
+	secret := Secret{
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x10, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	}
+	value := []byte("I am the value")
+
+	// encrypt
+	ct, err := GCMEncrypt(value, secret)
+	require.Nil(t, err)
+	require.Equal(t, uint8(3), ct.Version)
+	require.Equal(t, AlgorithmGCM, ct.Algorithm)
+
+	// marshal and unmarshal
+	rawCt, err := ct.Marshal()
+	require.Nil(t, err)
+	ct, err = Unmarshal(rawCt)
+	require.Nil(t, err)
+
+	// decrypt
+	plainText, err := Decrypt(ct, secret)
+	require.Nil(t, err)
+	require.Equal(t, string(value), string(plainText))
+
+}
+
+func TestGCMDecryptTampered(t *testing.T) {
+
+	secret := Secret{0x01}
+	value := []byte("I am the value")
+
+	// tampered cipher text
+	ct, err := GCMEncrypt(value, secret)
+	require.Nil(t, err)
+	ct.CipherText[0] ^= 0xff
+	plainText, err := GCMDecrypt(ct, secret)
+	require.EqualError(t, err, MacError.Error())
+	require.Equal(t, PlainText{}, plainText)
+
+	// tampered nonce
+	ct, err = GCMEncrypt(value, secret)
+	require.Nil(t, err)
+	ct.IV[0] ^= 0xff
+	_, err = GCMDecrypt(ct, secret)
+	require.EqualError(t, err, MacError.Error())
+
+	// tampered version
+	ct, err = GCMEncrypt(value, secret)
+	require.Nil(t, err)
+	ct.Version = 4
+	_, err = GCMDecrypt(ct, secret)
+	require.EqualError(t, err, MacError.Error())
+
+	// wrong key
+	ct, err = GCMEncrypt(value, secret)
+	require.Nil(t, err)
+	_, err = GCMDecrypt(ct, Secret{0x02})
+	require.EqualError(t, err, MacError.Error())
+
+}
+
+func TestDecryptLegacyCipherText(t *testing.T) {
+
+	secret := Secret{0x01}
+	value := []byte("I am the value")
+
+	// cipher texts created before the algorithm was recorded
+	ct, err := CTREncrypt(value, secret)
+	require.Nil(t, err)
+	ct.Algorithm = ""
+	rawCt, err := ct.Marshal()
+	require.Nil(t, err)
+	ct, err = Unmarshal(rawCt)
+	require.Nil(t, err)
+	require.Equal(t, AlgorithmCTR, ct.UsedAlgorithm())
+
+	plainText, err := Decrypt(ct, secret)
+	require.Nil(t, err)
+	require.Equal(t, string(value), string(plainText))
+
+}
+
+func TestUnmarshalUnknownAlgorithm(t *testing.T) {
+
+	_, err := Unmarshal([]byte(`{"algorithm":"rot13"}`))
+	require.EqualError(t, err, "unknown cipher text algorithm: rot13")
+
+}
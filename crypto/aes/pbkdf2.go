@@ -0,0 +1,55 @@
+package aes
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	pbkdf2 "golang.org/x/crypto/pbkdf2"
+)
+
+// min amount of PBKDF2 iterations
+const MinPBKDF2Iterations = 100000
+
+// returned for PBKDF2 params below the minimum
+type ErrWeakParams struct {
+	Minimum    int
+	Iterations int
+}
+
+func (e ErrWeakParams) Error() string {
+	return fmt.Sprintf("weak key derivation params - got %d iterations but need at least %d", e.Iterations, e.Minimum)
+}
+
+// make sure the amount of iterations is strong enough
+func ValidatePBKDF2Params(iterations int) error {
+	if iterations < MinPBKDF2Iterations {
+		return ErrWeakParams{
+			Minimum:    MinPBKDF2Iterations,
+			Iterations: iterations,
+		}
+	}
+	return nil
+}
+
+// Derive an aes secret from the password with PBKDF2-SHA256.
+// PBKDF2 is cheaper to compute than scrypt, but it only costs CPU
+// time and no memory, so it's a lot cheaper to brute force on GPUs.
+// Only use it for data that is already protected by scrypt, e.g. as an
+// inner layer of an export that gets encrypted with scrypt anyway.
+func DeriveKeyFromPassword(password, salt []byte, iterations int) (Secret, error) {
+
+	if err := ValidatePBKDF2Params(iterations); err != nil {
+		return Secret{}, err
+	}
+
+	if len(salt) == 0 {
+		return Secret{}, errors.New("salt must not be empty")
+	}
+
+	var secret Secret
+	copy(secret[:], pbkdf2.Key(password, salt, iterations, len(secret), sha256.New))
+
+	return secret, nil
+
+}
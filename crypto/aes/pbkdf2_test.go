@@ -0,0 +1,34 @@
+package aes
+
+import (
+	"encoding/hex"
+	"testing"
+
+	require "github.com/stretchr/testify/require"
+)
+
+func TestDeriveKeyFromPassword(t *testing.T) {
+
+	secret, err := DeriveKeyFromPassword([]byte("password"), []byte("salt"), 100000)
+	require.Nil(t, err)
+	require.Equal(t, "0394a2ede332c9a13eb82e9b24631604c31df978b4e2f0fbd2c549944f9d79a5", hex.EncodeToString(secret[:]))
+
+	// empty salt
+	_, err = DeriveKeyFromPassword([]byte("password"), []byte{}, 100000)
+	require.EqualError(t, err, "salt must not be empty")
+
+}
+
+func TestValidatePBKDF2Params(t *testing.T) {
+
+	require.Nil(t, ValidatePBKDF2Params(MinPBKDF2Iterations))
+
+	err := ValidatePBKDF2Params(1000)
+	require.Equal(t, ErrWeakParams{Minimum: 100000, Iterations: 1000}, err)
+	require.EqualError(t, err, "weak key derivation params - got 1000 iterations but need at least 100000")
+
+	// weak params are rejected when deriving a key
+	_, err = DeriveKeyFromPassword([]byte("password"), []byte("salt"), 1000)
+	require.Equal(t, ErrWeakParams{Minimum: 100000, Iterations: 1000}, err)
+
+}
@@ -11,11 +11,31 @@ import (
 type PlainText []byte
 type Secret [32]byte
 
+const (
+	// authenticated encryption - see GCMEncrypt
+	AlgorithmGCM = "aes-gcm"
+	// encryption + HMAC - see CTREncrypt
+	AlgorithmCTR = "aes-ctr"
+	// created by the chacha20poly1305 package
+	AlgorithmChaCha20Poly1305 = "chacha20-poly1305"
+)
+
 type CipherText struct {
 	IV         []byte `json:"iv"`
 	CipherText []byte `json:"cipher_text"`
 	Mac        []byte `json:"mac"`
 	Version    uint8  `json:"v"`
+	// cipher texts created before the algorithm was
+	// recorded are identified by their version
+	Algorithm string `json:"algorithm,omitempty"`
+}
+
+// the algorithm the cipher text was created with
+func (c CipherText) UsedAlgorithm() string {
+	if c.Algorithm == "" {
+		return AlgorithmCTR
+	}
+	return c.Algorithm
 }
 
 var MacError = errors.New("invalid key - message authentication failed")
@@ -88,5 +108,28 @@ func Unmarshal(rawCipherText []byte) (CipherText, error) {
 	if err := json.Unmarshal(rawCipherText, &ct); err != nil {
 		return CipherText{}, err
 	}
-	return ct, nil
+	switch ct.UsedAlgorithm() {
+	case AlgorithmGCM, AlgorithmCTR, AlgorithmChaCha20Poly1305:
+		return ct, nil
+	default:
+		return CipherText{}, fmt.Errorf("unknown cipher text algorithm: %s", ct.Algorithm)
+	}
+}
+
+// decrypt the cipher text with the algorithm it was created with
+func Decrypt(cipherText CipherText, secret Secret) (PlainText, error) {
+	switch cipherText.UsedAlgorithm() {
+	case AlgorithmGCM:
+		return GCMDecrypt(cipherText, secret)
+	case AlgorithmCTR:
+		// version one cipher texts are CFB encrypted
+		if cipherText.Version == 1 {
+			return CFBDecrypt(cipherText, secret)
+		}
+		return CTRDecrypt(cipherText, secret)
+	case AlgorithmChaCha20Poly1305:
+		return PlainText{}, errors.New("chacha20-poly1305 cipher texts must be decrypted with the chacha20poly1305 package")
+	default:
+		return PlainText{}, fmt.Errorf("unknown cipher text algorithm: %s", cipherText.Algorithm)
+	}
 }
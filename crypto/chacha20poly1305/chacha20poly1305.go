@@ -0,0 +1,72 @@
+package chacha20poly1305
+
+import (
+	"crypto/rand"
+	"io"
+
+	aes "github.com/Bit-Nation/panthalassa/crypto/aes"
+	chacha "golang.org/x/crypto/chacha20poly1305"
+)
+
+// the cipher text format is shared with the aes package
+// so that both can be persisted in the same places
+type (
+	PlainText  = aes.PlainText
+	Secret     = aes.Secret
+	CipherText = aes.CipherText
+)
+
+var randReader io.Reader = rand.Reader
+
+// encrypt plain text by given key using ChaCha20-Poly1305.
+// Faster than AES on devices without AES instructions.
+func Encrypt(plainText PlainText, secret Secret) (CipherText, error) {
+
+	aead, err := chacha.New(secret[:])
+	if err != nil {
+		return CipherText{}, err
+	}
+
+	// 12 byte nonce
+	nonce := make([]byte, chacha.NonceSize)
+	if _, err := io.ReadFull(randReader, nonce); err != nil {
+		return CipherText{}, err
+	}
+
+	ct := CipherText{
+		IV:        nonce,
+		Version:   3,
+		Algorithm: aes.AlgorithmChaCha20Poly1305,
+	}
+
+	// the version and algorithm are authenticated too
+	ct.CipherText = aead.Seal(nil, nonce, plainText, additionalData(ct))
+
+	return ct, nil
+
+}
+
+// decrypt cipher text created by Encrypt
+func Decrypt(cipherText CipherText, secret Secret) (PlainText, error) {
+
+	aead, err := chacha.New(secret[:])
+	if err != nil {
+		return PlainText{}, err
+	}
+
+	if len(cipherText.IV) != chacha.NonceSize {
+		return PlainText{}, aes.MacError
+	}
+
+	plainText, err := aead.Open(nil, cipherText.IV, cipherText.CipherText, additionalData(cipherText))
+	if err != nil {
+		return PlainText{}, aes.MacError
+	}
+
+	return plainText, nil
+
+}
+
+func additionalData(ct CipherText) []byte {
+	return append([]byte{ct.Version}, []byte(ct.Algorithm)...)
+}
@@ -0,0 +1,79 @@
+package chacha20poly1305
+
+import (
+	"testing"
+
+	aes "github.com/Bit-Nation/panthalassa/crypto/aes"
+	require "github.com/stretchr/testify/require"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+
+	secret := Secret{0x01, 0x02}
+	value := []byte("I am the value")
+
+	// encrypt
+	ct, err := Encrypt(value, secret)
+	require.Nil(t, err)
+	require.Equal(t, aes.AlgorithmChaCha20Poly1305, ct.Algorithm)
+	require.Len(t, ct.IV, 12)
+
+	// marshal and unmarshal
+	rawCt, err := ct.Marshal()
+	require.Nil(t, err)
+	ct, err = aes.Unmarshal(rawCt)
+	require.Nil(t, err)
+
+	// decrypt
+	plainText, err := Decrypt(ct, secret)
+	require.Nil(t, err)
+	require.Equal(t, string(value), string(plainText))
+
+	// nonces must not be reused
+	otherCt, err := Encrypt(value, secret)
+	require.Nil(t, err)
+	require.NotEqual(t, ct.IV, otherCt.IV)
+
+}
+
+func TestDecryptTampered(t *testing.T) {
+
+	secret := Secret{0x01}
+	value := []byte("I am the value")
+
+	// flip a single bit of the cipher text
+	ct, err := Encrypt(value, secret)
+	require.Nil(t, err)
+	ct.CipherText[0] ^= 0x01
+	plainText, err := Decrypt(ct, secret)
+	require.EqualError(t, err, aes.MacError.Error())
+	require.Equal(t, PlainText{}, plainText)
+
+	// flip a bit of the authentication tag
+	ct, err = Encrypt(value, secret)
+	require.Nil(t, err)
+	ct.CipherText[len(ct.CipherText)-1] ^= 0x01
+	_, err = Decrypt(ct, secret)
+	require.EqualError(t, err, aes.MacError.Error())
+
+	// tampered nonce
+	ct, err = Encrypt(value, secret)
+	require.Nil(t, err)
+	ct.IV[0] ^= 0x01
+	_, err = Decrypt(ct, secret)
+	require.EqualError(t, err, aes.MacError.Error())
+
+	// tampered algorithm
+	ct, err = Encrypt(value, secret)
+	require.Nil(t, err)
+	ct.Algorithm = aes.AlgorithmGCM
+	_, err = Decrypt(ct, secret)
+	require.EqualError(t, err, aes.MacError.Error())
+
+	// wrong key
+	ct, err = Encrypt(value, secret)
+	require.Nil(t, err)
+	_, err = Decrypt(ct, Secret{0x02})
+	require.EqualError(t, err, aes.MacError.Error())
+
+}
@@ -0,0 +1,91 @@
+package scrypt
+
+import (
+	"crypto/rand"
+	"errors"
+
+	secure "github.com/Bit-Nation/panthalassa/crypto/secure"
+	argon2 "golang.org/x/crypto/argon2"
+)
+
+// argon2id parameters recommended by OWASP
+const (
+	argon2Time    = 2
+	argon2Memory  = 19 * 1024
+	argon2Threads = 1
+)
+
+// upper bound for the memory of stored parameters (in KiB)
+// so that a manipulated cipher text can't exhaust the memory
+const maxArgon2Memory = 1024 * 1024
+
+// derive the key with argon2id - a memory hard alternative to scrypt
+// that can be tuned for devices with little RAM.
+// Zero values use the parameters recommended by OWASP.
+type Argon2idConfig struct {
+	Time uint32
+	// memory in KiB
+	Memory  uint32
+	Threads uint8
+}
+
+func (c Argon2idConfig) KDF() string {
+	return KDFArgon2id
+}
+
+type Argon2Key struct {
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+	KeyLen  uint32 `json:"key_len"`
+	Salt    []byte `json:"salt"`
+}
+
+// derives a key from password
+func makeArgon2Key(pw []byte, c Argon2idConfig) (Argon2Key, *secure.Bytes, error) {
+
+	k := Argon2Key{
+		Time:    c.Time,
+		Memory:  c.Memory,
+		Threads: c.Threads,
+		KeyLen:  keyLength,
+		Salt:    make([]byte, saltLength),
+	}
+	if k.Time == 0 {
+		k.Time = argon2Time
+	}
+	if k.Memory == 0 {
+		k.Memory = argon2Memory
+	}
+	if k.Threads == 0 {
+		k.Threads = argon2Threads
+	}
+
+	// create salt for argon2
+	if _, err := rand.Read(k.Salt); err != nil {
+		return Argon2Key{}, nil, err
+	}
+
+	key, err := k.derive(pw)
+	if err != nil {
+		return Argon2Key{}, nil, err
+	}
+
+	return k, secure.NewBytes(key), nil
+
+}
+
+// derive the key with the parameters
+func (k Argon2Key) derive(pw []byte) ([]byte, error) {
+	// argon2 panics on invalid parameters
+	if k.Time < 1 || k.Threads < 1 {
+		return nil, errors.New("invalid argon2 parameters")
+	}
+	if k.Memory > maxArgon2Memory {
+		return nil, errors.New("argon2 memory exceeds the limit")
+	}
+	if k.KeyLen != keyLength {
+		return nil, errors.New("key must be of length 32 in order to be used with AES")
+	}
+	return argon2.IDKey(pw, k.Salt, k.Time, k.Memory, k.Threads, k.KeyLen), nil
+}
@@ -0,0 +1,97 @@
+package scrypt
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestArgon2KeyDefaults(t *testing.T) {
+
+	k, key, err := makeArgon2Key([]byte("a"), Argon2idConfig{})
+	require.Nil(t, err)
+	require.Equal(t, uint32(argon2Time), k.Time)
+	require.Equal(t, uint32(argon2Memory), k.Memory)
+	require.Equal(t, uint8(argon2Threads), k.Threads)
+	require.Equal(t, saltLength, len(k.Salt))
+	require.Equal(t, 32, key.Len())
+
+}
+
+func TestArgon2EncryptAndDecrypt(t *testing.T) {
+
+	value := []byte("i am the value")
+	key := []byte("password")
+
+	ct, err := NewCipherText(value, key, Argon2idConfig{
+		Time:    1,
+		Memory:  1024,
+		Threads: 2,
+	})
+	require.Nil(t, err)
+	require.Equal(t, KDFArgon2id, ct.KDF)
+	require.Equal(t, uint32(1024), ct.Argon2Key.Memory)
+
+	// the kdf must survive the json round trip
+	rawCt, err := ct.Marshal()
+	require.Nil(t, err)
+	decoded := CipherText{}
+	require.Nil(t, json.Unmarshal(rawCt, &decoded))
+
+	plainText, err := DecryptCipherText(decoded, key)
+	require.Nil(t, err)
+	require.Equal(t, string(value), string(plainText))
+
+	// wrong password
+	_, err = DecryptCipherText(decoded, []byte("wrong password"))
+	require.NotNil(t, err)
+
+	// manipulated parameters must not make argon2 panic
+	decoded.Argon2Key.Threads = 0
+	_, err = DecryptCipherText(decoded, key)
+	require.EqualError(t, err, "invalid argon2 parameters")
+
+}
+
+func TestScryptCipherTextWithoutKDF(t *testing.T) {
+
+	value := []byte("i am the value")
+	key := []byte("password")
+
+	ct, err := NewCipherText(value, key, ScryptConfig{})
+	require.Nil(t, err)
+	require.Equal(t, "", ct.KDF)
+
+	// cipher texts created before the kdf was added have no kdf
+	rawCt, err := ct.Marshal()
+	require.Nil(t, err)
+	require.NotContains(t, string(rawCt), `"kdf"`)
+
+	decoded := CipherText{}
+	require.Nil(t, json.Unmarshal(rawCt, &decoded))
+	plainText, err := DecryptCipherText(decoded, key)
+	require.Nil(t, err)
+	require.Equal(t, string(value), string(plainText))
+
+	// unknown kdf
+	decoded.KDF = "bcrypt"
+	_, err = DecryptCipherText(decoded, key)
+	require.EqualError(t, err, "unknown kdf: bcrypt")
+
+}
+
+func TestKDFConfigFromName(t *testing.T) {
+
+	kdf, err := KDFConfigFromName("argon2id")
+	require.Nil(t, err)
+	require.Equal(t, Argon2idConfig{}, kdf)
+
+	kdf, err = KDFConfigFromName("scrypt")
+	require.Nil(t, err)
+	require.Equal(t, ScryptConfig{}, kdf)
+
+	_, err = KDFConfigFromName("md5")
+	require.EqualError(t, err, "unknown kdf: md5")
+
+}
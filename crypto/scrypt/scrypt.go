@@ -4,8 +4,10 @@ import (
 	"crypto/rand"
 	"encoding/json"
 	"errors"
+	"fmt"
 
 	aes "github.com/Bit-Nation/panthalassa/crypto/aes"
+	secure "github.com/Bit-Nation/panthalassa/crypto/secure"
 	scrypt "golang.org/x/crypto/scrypt"
 )
 
@@ -24,13 +26,46 @@ type Key struct {
 	P      int    `json:"p"`
 	KeyLen int    `json:"key_len"`
 	Salt   []byte `json:"salt"`
-	key    aes.Secret
+	key    *secure.Bytes
+}
+
+// key derivation functions a CipherText can be encrypted with
+const (
+	KDFScrypt   = "scrypt"
+	KDFArgon2id = "argon2id"
+)
+
+// picks the key derivation function used by NewCipherText
+type KDFConfig interface {
+	// name of the KDF stored in the CipherText
+	KDF() string
+}
+
+// derive the key with scrypt (the default)
+type ScryptConfig struct{}
+
+func (c ScryptConfig) KDF() string {
+	return KDFScrypt
+}
+
+// KDF config by name (e.g. for mobile callers)
+func KDFConfigFromName(name string) (KDFConfig, error) {
+	switch name {
+	case KDFScrypt:
+		return ScryptConfig{}, nil
+	case KDFArgon2id:
+		return Argon2idConfig{}, nil
+	}
+	return nil, fmt.Errorf("unknown kdf: %s", name)
 }
 
 type CipherText struct {
 	CipherText aes.CipherText `json:"cipher_text"`
 	ScryptKey  Key            `json:"scrypt_key"`
 	Version    uint8          `json:"version"`
+	// cipher texts without a kdf were encrypted with scrypt
+	KDF       string     `json:"kdf,omitempty"`
+	Argon2Key *Argon2Key `json:"argon2_key,omitempty"`
 }
 
 // exports CipherText as json
@@ -54,52 +89,98 @@ func makeScryptKey(pw []byte) (Key, error) {
 		return Key{}, err
 	}
 	if len(key) != 32 {
+		secure.Zero(key)
 		return Key{}, errors.New("key must be of length 32 in order to be used with AES")
 	}
 
-	var aesSecret aes.Secret
-	copy(aesSecret[:], key[:])
-
 	sV := Key{
 		N:      n,
 		R:      r,
 		P:      p,
 		KeyLen: keyLength,
 		Salt:   salt,
-		key:    aesSecret,
+		key:    secure.NewBytes(key),
 	}
 
 	return sV, nil
 }
 
 //Create new ScryptCipherText
-func NewCipherText(plainText []byte, password []byte) (CipherText, error) {
+//The key is derived with scrypt if kdf is nil
+func NewCipherText(plainText []byte, password []byte, kdf KDFConfig) (CipherText, error) {
+
+	ct := CipherText{
+		Version: 1,
+	}
 
-	derivedKey, err := makeScryptKey(password)
+	var derivedKey *secure.Bytes
+	switch c := kdf.(type) {
+	case nil, ScryptConfig:
+		scryptKey, err := makeScryptKey(password)
+		if err != nil {
+			return CipherText{}, err
+		}
+		ct.ScryptKey = scryptKey
+		derivedKey = scryptKey.key
+	case Argon2idConfig:
+		argon2Key, key, err := makeArgon2Key(password, c)
+		if err != nil {
+			return CipherText{}, err
+		}
+		ct.KDF = KDFArgon2id
+		ct.Argon2Key = &argon2Key
+		derivedKey = key
+	default:
+		return CipherText{}, fmt.Errorf("unknown kdf: %s", kdf.KDF())
+	}
+
+	// the derived key is only needed for the encryption
+	var aesSecret aes.Secret
+	copy(aesSecret[:], derivedKey.Bytes())
+	derivedKey.Zero()
+	defer secure.Zero(aesSecret[:])
+
+	cipherText, err := aes.CTREncrypt(plainText, aesSecret)
 	if err != nil {
 		return CipherText{}, err
 	}
+	ct.CipherText = cipherText
 
-	cipherText, err := aes.CTREncrypt(plainText, derivedKey.key)
+	return ct, nil
 
-	return CipherText{
-		CipherText: cipherText,
-		ScryptKey:  derivedKey,
-		Version:    1,
-	}, nil
+}
 
+// derive the key with the KDF the cipher text was encrypted with
+func (c CipherText) deriveKey(password []byte) ([]byte, error) {
+	switch c.KDF {
+	case "", KDFScrypt:
+		return scrypt.Key(password, c.ScryptKey.Salt, c.ScryptKey.N, c.ScryptKey.R, c.ScryptKey.P, c.ScryptKey.KeyLen)
+	case KDFArgon2id:
+		if c.Argon2Key == nil {
+			return nil, errors.New("argon2 parameters are missing")
+		}
+		return c.Argon2Key.derive(password)
+	}
+	return nil, fmt.Errorf("unknown kdf: %s", c.KDF)
 }
 
 // decrypt scrypt cipher
+// the KDF and its parameters are taken from the cipher text
 func DecryptCipherText(cipherText CipherText, password []byte) (aes.PlainText, error) {
 
-	key, err := scrypt.Key(password, cipherText.ScryptKey.Salt, cipherText.ScryptKey.N, cipherText.ScryptKey.R, cipherText.ScryptKey.P, cipherText.ScryptKey.KeyLen)
+	key, err := cipherText.deriveKey(password)
 	if err != nil {
 		return aes.PlainText{}, err
 	}
+	if len(key) < 32 {
+		secure.Zero(key)
+		return aes.PlainText{}, errors.New("key must be of length 32 in order to be used with AES")
+	}
 
 	var AESSecret aes.Secret
 	copy(AESSecret[:], key[:32])
+	secure.Zero(key)
+	defer secure.Zero(AESSecret[:])
 
 	// version 0 of the CipherText used CFB
 	if cipherText.Version == uint8(0) {
@@ -107,4 +188,5 @@ func DecryptCipherText(cipherText CipherText, password []byte) (aes.PlainText, e
 	}
 
 	return aes.CTRDecrypt(cipherText.CipherText, AESSecret)
+
 }
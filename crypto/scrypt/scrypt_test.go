@@ -17,7 +17,7 @@ func TestScryptValueKeyCreation(t *testing.T) {
 	require.Equal(t, p, sV.P)
 	require.Equal(t, r, sV.R)
 	require.Equal(t, saltLength, len(sV.Salt))
-	require.Equal(t, 32, len(sV.key))
+	require.Equal(t, 32, sV.key.Len())
 
 }
 
@@ -27,7 +27,7 @@ func TestSuccessEncryptAndDecrypt(t *testing.T) {
 	key := []byte("password")
 
 	//create cipher text
-	cipherText, err := NewCipherText(value, key)
+	cipherText, err := NewCipherText(value, key, nil)
 	require.Nil(t, err)
 
 	// mock cfb decrypt function
@@ -58,7 +58,7 @@ func TestFailDecryption(t *testing.T) {
 	key := []byte("password")
 
 	//create cipher text
-	ethKey, err := NewCipherText(value, key)
+	ethKey, err := NewCipherText(value, key, nil)
 	require.Nil(t, err)
 
 	//decrypt cipher text
@@ -74,7 +74,7 @@ func TestDecryptOldVersion(t *testing.T) {
 	value := []byte("i am the value")
 	key := []byte("password")
 
-	ct, err := NewCipherText(value, key)
+	ct, err := NewCipherText(value, key, nil)
 	require.Nil(t, err)
 
 	// set to old version (deprecated)
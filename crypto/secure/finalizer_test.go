@@ -0,0 +1,33 @@
+// +build !race
+
+package secure
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	require "github.com/stretchr/testify/require"
+)
+
+// finalizers are not guaranteed to run. We retry the GC
+// a few times and skip the check under the race detector
+// since it changes when objects are collected.
+func TestBytes_Finalizer(t *testing.T) {
+
+	raw := []byte{1, 2, 3, 4}
+	func() {
+		NewBytes(raw)
+	}()
+
+	for i := 0; i < 20; i++ {
+		runtime.GC()
+		time.Sleep(time.Millisecond * 10)
+		if raw[0] == 0 {
+			break
+		}
+	}
+
+	require.Equal(t, []byte{0, 0, 0, 0}, raw)
+
+}
@@ -0,0 +1,45 @@
+package secure
+
+import (
+	"runtime"
+)
+
+// overwrite the bytes with zeros
+// KeepAlive makes sure the writes are not optimized away
+func Zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+	runtime.KeepAlive(b)
+}
+
+// key material that is zeroed once it's not used anymore.
+// Copies of the bytes (e.g. made by the GC or by converting them
+// to an array) are not covered, so keep them as short as possible.
+type Bytes struct {
+	b []byte
+}
+
+// wrap b - the caller must not use b afterwards
+func NewBytes(b []byte) *Bytes {
+	s := &Bytes{b: b}
+	// zero the bytes in the case Zero is never called
+	runtime.SetFinalizer(s, func(s *Bytes) {
+		s.Zero()
+	})
+	return s
+}
+
+// the wrapped bytes - only valid till Zero is called
+func (s *Bytes) Bytes() []byte {
+	return s.b
+}
+
+func (s *Bytes) Len() int {
+	return len(s.b)
+}
+
+// zero the wrapped bytes
+func (s *Bytes) Zero() {
+	Zero(s.b)
+}
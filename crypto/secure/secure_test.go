@@ -0,0 +1,29 @@
+package secure
+
+import (
+	"testing"
+
+	require "github.com/stretchr/testify/require"
+)
+
+func TestZero(t *testing.T) {
+
+	key := []byte{1, 2, 3, 4}
+	Zero(key)
+	require.Equal(t, []byte{0, 0, 0, 0}, key)
+
+}
+
+func TestBytes_Zero(t *testing.T) {
+
+	key := NewBytes([]byte{1, 2, 3, 4})
+	require.Equal(t, 4, key.Len())
+
+	raw := key.Bytes()
+	key.Zero()
+
+	// read back through the wrapped slice
+	require.Equal(t, []byte{0, 0, 0, 0}, raw)
+	require.Equal(t, []byte{0, 0, 0, 0}, key.Bytes())
+
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	module "github.com/Bit-Nation/panthalassa/dapp/module"
@@ -19,6 +21,14 @@ import (
 
 var sysLog = log.Logger("dapp")
 
+var ErrDAppFunctionTimeout = cbModule.ErrDAppFunctionTimeout
+
+var ErrDevModeRequired = errors.New("executing scripts is only allowed in development mode")
+
+var ErrReloadRequiresDevMode = errors.New("reloading DApps is only allowed in development mode")
+
+var errStartTimeout = errors.New("timeout - failed to start DApp")
+
 type DApp struct {
 	vm     *otto.Otto
 	logger *logger.Logger
@@ -30,53 +40,269 @@ type DApp struct {
 	cbMod        *cbModule.Module
 	dbMod        *dbModule.BoltStorage
 	vmModules    []module.Module
+	// 1 if the DApp is paused
+	paused int32
+	// closed once the paused DApp is resumed
+	resumed   chan struct{}
+	pauseLock sync.Mutex
+	// amount of calls that are executing JavaScript right now
+	executing int32
+	// 1 once the DApp is closed
+	closing   int32
+	closeOnce sync.Once
+	// 1 if connected to a DApp development host
+	devMode int32
+	// modules passed to New - registered again on reload
+	modules []module.Module
+	db      *bolt.DB
+	conf    DAppConfig
+	timeOut time.Duration
+	// guards the vm and the modules bound to it (swapped on reload)
+	lock sync.RWMutex
+}
+
+// pause the DApp. The VM will be blocked
+// the next time it executes JavaScript
+func (d *DApp) Pause() {
+	d.pauseLock.Lock()
+	defer d.pauseLock.Unlock()
+	if d.resumed != nil {
+		return
+	}
+	d.resumed = make(chan struct{})
+	atomic.StoreInt32(&d.paused, 1)
+	d.interruptWhilePaused(d.currentVM())
+}
+
+// make the vm wait for Resume. A pending interrupt of an
+// earlier pause is kept since it waits for the current pause too.
+func (d *DApp) interruptWhilePaused(vm *otto.Otto) {
+	select {
+	case vm.Interrupt <- d.waitWhilePaused:
+	default:
+	}
+}
+
+// blocks till the DApp is resumed
+func (d *DApp) waitWhilePaused() {
+	d.pauseLock.Lock()
+	resumed := d.resumed
+	d.pauseLock.Unlock()
+	if resumed != nil {
+		<-resumed
+	}
 }
 
-// close DApp
+// resume a paused DApp
+func (d *DApp) Resume() {
+	d.pauseLock.Lock()
+	defer d.pauseLock.Unlock()
+	if d.resumed == nil {
+		return
+	}
+	close(d.resumed)
+	d.resumed = nil
+	atomic.StoreInt32(&d.paused, 0)
+}
+
+// close DApp. An idle DApp is closed right away, a DApp that
+// executes JavaScript is closed by interrupting the vm or
+// once the execution returned.
 func (d *DApp) Close() {
-	d.vm.Interrupt <- func() {
-		d.logger.Info(fmt.Sprintf("shutting down: %s (%s)", hex.EncodeToString(d.app.UsedSigningKey), d.app.Name))
-		for _, mod := range d.vmModules {
-			if err := mod.Close(); err != nil {
-				sysLog.Error(err)
-			}
+	atomic.StoreInt32(&d.closing, 1)
+	// idle vms never take an interrupt
+	if atomic.LoadInt32(&d.executing) == 0 {
+		d.shutdown()
+		return
+	}
+	// in case there is a pending interrupt (e.g. of a pause)
+	// leave shuts the DApp down after the execution
+	select {
+	case d.currentVM().Interrupt <- d.shutdown:
+	default:
+	}
+}
+
+// close the modules and remove the DApp from the registry
+func (d *DApp) shutdown() {
+	d.closeOnce.Do(func() {
+		d.lock.RLock()
+		app, vmModules := d.app, d.vmModules
+		d.lock.RUnlock()
+		d.logger.Info(fmt.Sprintf("shutting down: %s (%s)", hex.EncodeToString(app.UsedSigningKey), app.Name))
+		closeModules(vmModules)
+		d.closeChan <- app
+	})
+}
+
+// track calls that execute JavaScript in the vm
+func (d *DApp) enter() {
+	atomic.AddInt32(&d.executing, 1)
+}
+
+func (d *DApp) leave() {
+	if atomic.AddInt32(&d.executing, -1) == 0 && atomic.LoadInt32(&d.closing) == 1 {
+		d.shutdown()
+	}
+}
+
+func closeModules(vmModules []module.Module) {
+	for _, mod := range vmModules {
+		if err := mod.Close(); err != nil {
+			sysLog.Error(err)
 		}
-		d.closeChan <- d.app
 	}
 }
 
+func (d *DApp) currentVM() *otto.Otto {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return d.vm
+}
+
+// allow ExecuteScript (only used during DApp development)
+func (d *DApp) EnableDevMode() {
+	atomic.StoreInt32(&d.devMode, 1)
+}
+
+// run a script in the context of the DApp and return the
+// stringified result. Only available in development mode.
+func (d *DApp) ExecuteScript(script string) (string, error) {
+	if atomic.LoadInt32(&d.devMode) != 1 {
+		return "", ErrDevModeRequired
+	}
+	d.enter()
+	defer d.leave()
+	value, err := d.currentVM().Run(script)
+	if err != nil {
+		return "", err
+	}
+	return value.String(), nil
+}
+
+// replace the code of the running DApp (only used during DApp development).
+// The signature must be valid for the DApp with the new code. A fresh vm
+// with all modules registered again is created to run the new code.
+// The current vm keeps running in case the new code fails to start.
+func (d *DApp) Reload(newCode string, signature []byte) error {
+
+	if atomic.LoadInt32(&d.devMode) != 1 {
+		return ErrReloadRequiresDevMode
+	}
+
+	// nothing is executed in the current vm till the reload is done
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	updated := *d.app
+	updated.Code = []byte(newCode)
+	updated.Signature = signature
+
+	// check if the new code is valid
+	valid, err := updated.VerifySignature()
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return InvalidSignature
+	}
+
+	next, err := newVM(d.logger, &updated, d.modules, d.db, d.conf)
+	if err != nil {
+		return err
+	}
+	if err := next.run(d.timeOut); err != nil {
+		closeModules(next.vmModules[len(d.modules):])
+		return err
+	}
+
+	// the modules created for the current vm are closed so that
+	// no handler that was registered by the old code is called anymore.
+	// The modules passed to New are now registered in the new vm.
+	closeModules(d.vmModules[len(d.modules):])
+
+	d.vm = next.vm
+	d.app = next.app
+	d.dAppRenderer = next.dAppRenderer
+	d.msgRenderer = next.msgRenderer
+	d.cbMod = next.cbMod
+	d.dbMod = next.dbMod
+	d.vmModules = next.vmModules
+
+	// the new vm must not run while the DApp is paused
+	if atomic.LoadInt32(&d.paused) == 1 {
+		d.interruptWhilePaused(d.vm)
+	}
+
+	return nil
+
+}
+
 func (d *DApp) ID() string {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
 	return hex.EncodeToString(d.app.UsedSigningKey)
 }
 
 func (d *DApp) OpenDApp(context string) error {
-	return d.dAppRenderer.OpenDApp(context)
+	d.lock.RLock()
+	dr := d.dAppRenderer
+	d.lock.RUnlock()
+	d.enter()
+	defer d.leave()
+	return dr.OpenDApp(context)
 }
 
 func (d *DApp) RenderMessage(payload string) (string, error) {
-	return d.msgRenderer.RenderMessage(payload)
+	d.lock.RLock()
+	mr := d.msgRenderer
+	d.lock.RUnlock()
+	d.enter()
+	defer d.leave()
+	return mr.RenderMessage(payload)
 }
 
-func (d *DApp) CallFunction(id uint, args string) error {
-	return d.cbMod.CallFunction(id, args)
+// call a registered function of the DApp
+// returns ErrDAppFunctionTimeout if the function didn't finish in time
+// and ErrInvalidFunctionArgs if required parameters are missing
+func (d *DApp) CallFunction(id uint, args string, timeout time.Duration) error {
+	d.lock.RLock()
+	app, cbm := d.app, d.cbMod
+	d.lock.RUnlock()
+	if err := app.ValidateFunctionArgs(id, args); err != nil {
+		return err
+	}
+	d.enter()
+	defer d.leave()
+	return cbm.CallFunction(id, args, timeout)
 }
 
-// will start a DApp based on the given config file
-func New(l *logger.Logger, app *Data, vmModules []module.Module, closer chan<- *Data, timeOut time.Duration, db *bolt.DB) (*DApp, error) {
+type DAppConfig struct {
+	// locale of the user (e.g. "de-CH")
+	// used to pick the name exposed as app.name
+	Locale string
+	// enables development only features like ExecuteScript
+	DevMode bool
+}
 
-	// check if app is valid
-	valid, err := app.VerifySignature()
-	if err != nil {
-		return nil, err
-	}
-	if !valid {
-		return nil, InvalidSignature
-	}
+// create a vm with the given modules and the modules every DApp has.
+// The code of the DApp is not executed yet.
+func newVM(l *logger.Logger, app *Data, vmModules []module.Module, db *bolt.DB, conf DAppConfig) (*DApp, error) {
+
+	// the modules of the caller must not be mutated
+	vmModules = append([]module.Module{}, vmModules...)
 
 	// create VM
 	vm := otto.New()
 	vm.Interrupt = make(chan func(), 1)
 
+	// expose app information to the DApp
+	if err := vm.Set("app", map[string]interface{}{
+		"name": app.LocalizedName(conf.Locale),
+	}); err != nil {
+		return nil, err
+	}
+
 	// register all vm modules
 	for _, m := range vmModules {
 		if err := m.Register(vm); err != nil {
@@ -116,25 +342,29 @@ func New(l *logger.Logger, app *Data, vmModules []module.Module, closer chan<- *
 		return nil, err
 	}
 
-	dApp := &DApp{
+	return &DApp{
 		vm:           vm,
 		logger:       l,
 		app:          app,
-		closeChan:    closer,
 		dAppRenderer: dr,
 		msgRenderer:  mr,
 		cbMod:        cbm,
 		dbMod:        dAppDBStorage,
 		vmModules:    vmModules,
-	}
+	}, nil
+
+}
+
+// run the code of the DApp with the given timeout
+func (d *DApp) run(timeOut time.Duration) error {
 
 	wait := make(chan error, 1)
 
 	// start the DApp async
 	go func() {
-		_, err := vm.Run(app.Code)
+		_, err := d.vm.Run(d.app.Code)
 		if err != nil {
-			l.Errorf(err.Error())
+			d.logger.Errorf(err.Error())
 		}
 		wait <- err
 	}()
@@ -142,14 +372,51 @@ func New(l *logger.Logger, app *Data, vmModules []module.Module, closer chan<- *
 	// wait for the DApp with given timeout
 	select {
 	case err := <-wait:
-		if err != nil {
-			return nil, err
-		}
-		return dApp, nil
+		return err
 	case <-time.After(timeOut):
-		vm.Interrupt <- func() {}
-		closer <- app
-		return nil, errors.New("timeout - failed to start DApp")
+		d.vm.Interrupt <- func() {}
+		return errStartTimeout
 	}
 
 }
+
+// will start a DApp based on the given config file
+func New(l *logger.Logger, app *Data, vmModules []module.Module, closer chan<- *Data, timeOut time.Duration, db *bolt.DB, conf DAppConfig) (*DApp, error) {
+
+	// make sure we understand the DApp
+	if err := app.CheckSchemaVersion(); err != nil {
+		return nil, err
+	}
+
+	// check if app is valid
+	valid, err := app.VerifySignature()
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		return nil, InvalidSignature
+	}
+
+	dApp, err := newVM(l, app, vmModules, db, conf)
+	if err != nil {
+		return nil, err
+	}
+	dApp.closeChan = closer
+	dApp.modules = vmModules
+	dApp.db = db
+	dApp.conf = conf
+	dApp.timeOut = timeOut
+	if conf.DevMode {
+		dApp.devMode = 1
+	}
+
+	if err := dApp.run(timeOut); err != nil {
+		if err == errStartTimeout {
+			closer <- app
+		}
+		return nil, err
+	}
+
+	return dApp, nil
+
+}
@@ -17,6 +17,37 @@ import (
 
 var InvalidSignature = errors.New("failed to verify signature for DApp")
 
+// the newest DApp schema this runtime understands
+const currentMaxSchemaVersion uint = 1
+
+// returned for DApps that were published for a newer runtime
+type ErrUnsupportedDAppSchema struct {
+	Got          uint
+	MaxSupported uint
+}
+
+func (e ErrUnsupportedDAppSchema) Error() string {
+	return fmt.Sprintf("DApp schema version %d is not supported - max supported version is %d", e.Got, e.MaxSupported)
+}
+
+// returned when required parameters of a DApp function are missing
+type ErrInvalidFunctionArgs struct {
+	FunctionID uint
+	Missing    []string
+}
+
+func (e ErrInvalidFunctionArgs) Error() string {
+	return fmt.Sprintf("missing parameters for function %d: %s", e.FunctionID, strings.Join(e.Missing, ", "))
+}
+
+// signature of a function the DApp registers
+type FunctionSpec struct {
+	// id the function is registered with
+	ID uint `json:"id"`
+	// keys the arguments object must contain
+	Params []string `json:"params"`
+}
+
 type SV struct {
 	Major uint `json:"major"`
 	Minor uint `json:"minor"`
@@ -36,6 +67,97 @@ type Data struct {
 	Signature      []byte            `json:"signature"`
 	Engine         SV                `json:"engine"`
 	Version        int               `json:"version"`
+	// capabilities the DApp requires (e.g. "chat.send")
+	Permissions []string `json:"permissions,omitempty"`
+	// optional url responding with {"version": N} of the latest release
+	UpdateURL string `json:"update_url,omitempty"`
+	// version of the DApp format - DApps without one have version 1
+	SchemaVersion uint `json:"schema_version,omitempty"`
+	// optional signatures of the functions the DApp registers
+	Functions []FunctionSpec `json:"functions,omitempty"`
+}
+
+// schema version of the DApp (defaults to 1)
+func (r Data) Schema() uint {
+	if r.SchemaVersion == 0 {
+		return 1
+	}
+	return r.SchemaVersion
+}
+
+// make sure the arguments contain all parameters the function
+// requires. Functions without a spec accept any arguments.
+func (r Data) ValidateFunctionArgs(functionID uint, args string) error {
+
+	for _, spec := range r.Functions {
+		if spec.ID != functionID {
+			continue
+		}
+
+		parsedArgs := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(args), &parsedArgs); err != nil {
+			return fmt.Errorf("arguments of function %d must be a JSON object: %s", functionID, err)
+		}
+		if parsedArgs == nil {
+			return fmt.Errorf("arguments of function %d must be a JSON object", functionID)
+		}
+
+		missing := []string{}
+		for _, param := range spec.Params {
+			if _, exist := parsedArgs[param]; !exist {
+				missing = append(missing, param)
+			}
+		}
+		if len(missing) > 0 {
+			return ErrInvalidFunctionArgs{
+				FunctionID: functionID,
+				Missing:    missing,
+			}
+		}
+		return nil
+	}
+
+	return nil
+
+}
+
+// make sure this runtime is able to understand the DApp
+func (r Data) CheckSchemaVersion() error {
+	if r.Schema() > currentMaxSchemaVersion {
+		return ErrUnsupportedDAppSchema{
+			Got:          r.Schema(),
+			MaxSupported: currentMaxSchemaVersion,
+		}
+	}
+	return nil
+}
+
+// report if the DApp requires the permission
+func (r Data) HasPermission(permission string) bool {
+	for _, p := range r.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// permissions the DApp requires that haven't been granted
+func (r Data) MissingPermissions(granted []string) []string {
+	missing := []string{}
+	for _, required := range r.Permissions {
+		isGranted := false
+		for _, g := range granted {
+			if g == required {
+				isGranted = true
+				break
+			}
+		}
+		if !isGranted {
+			missing = append(missing, required)
+		}
+	}
+	return missing
 }
 
 // hash the published DApp
@@ -87,6 +209,41 @@ func (r Data) Hash() ([]byte, error) {
 		return nil, err
 	}
 
+	// write sorted permissions - DApps without permissions
+	// keep the hash they had before permissions were added
+	permissions := append([]string{}, r.Permissions...)
+	sort.Strings(permissions)
+	for _, p := range permissions {
+		if _, err := buff.WriteString(p); err != nil {
+			return nil, err
+		}
+	}
+
+	// write update url
+	if _, err := buff.WriteString(r.UpdateURL); err != nil {
+		return nil, err
+	}
+
+	// write schema version - only when set so that
+	// the hash of existing DApps doesn't change
+	if r.SchemaVersion != 0 {
+		if _, err := buff.WriteString(strconv.Itoa(int(r.SchemaVersion))); err != nil {
+			return nil, err
+		}
+	}
+
+	// write function signatures
+	for _, f := range r.Functions {
+		if _, err := buff.WriteString(strconv.Itoa(int(f.ID))); err != nil {
+			return nil, err
+		}
+		for _, p := range f.Params {
+			if _, err := buff.WriteString(p); err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	// hash it
 	multiHash, err := mh.Sum(buff.Bytes(), mh.SHA2_256, -1)
 	if err != nil {
@@ -110,6 +267,77 @@ func (r Data) VerifySignature() (bool, error) {
 
 }
 
+// pick the name matching the locale (e.g. "de-CH")
+// falls back to the base language, then english
+// and then to the first language in alphabetical order
+func (r Data) LocalizedName(locale string) string {
+
+	locale = strings.ToLower(locale)
+	if name, exist := r.Name[locale]; exist {
+		return name
+	}
+
+	// try base language of the locale
+	if i := strings.IndexAny(locale, "-_"); i > 0 {
+		if name, exist := r.Name[locale[:i]]; exist {
+			return name
+		}
+	}
+
+	if name, exist := r.Name["en"]; exist {
+		return name
+	}
+
+	var languages []string
+	for k := range r.Name {
+		languages = append(languages, k)
+	}
+	if len(languages) == 0 {
+		return ""
+	}
+	sort.Strings(languages)
+
+	return r.Name[languages[0]]
+
+}
+
+const (
+	maxDAppNameLength = 64
+	maxDAppCodeSize   = 5 * 1024 * 1024
+)
+
+// validate the required fields of the DApp
+func (r Data) Validate() error {
+
+	// validate name
+	if len(r.Name) == 0 {
+		return errors.New("a DApp must have at least one name")
+	}
+	for lang, name := range r.Name {
+		if len(name) == 0 || len(name) > maxDAppNameLength {
+			return fmt.Errorf("invalid DApp name for language %s - must have between 1 and %d characters", lang, maxDAppNameLength)
+		}
+	}
+
+	// validate code
+	if len(r.Code) == 0 || len(r.Code) > maxDAppCodeSize {
+		return fmt.Errorf("invalid DApp code size of %d bytes - must be between 1 and %d bytes", len(r.Code), maxDAppCodeSize)
+	}
+
+	// validate version
+	if r.Version < 1 {
+		return errors.New("version must be at least 1")
+	}
+
+	// validate signing key
+	if len(r.UsedSigningKey) != 32 {
+		return fmt.Errorf("invalid length of signing key %d", len(r.UsedSigningKey))
+	}
+
+	return nil
+
+}
+
 func (r Data) Marshal() ([]byte, error) {
 	return json.Marshal(r)
 }
@@ -156,6 +384,10 @@ type RawData struct {
 	Signature      string            `json:"signature"`
 	Engine         string            `json:"engine"`
 	Version        string            `json:"version"`
+	Permissions    []string          `json:"permissions"`
+	UpdateURL      string            `json:"update_url"`
+	SchemaVersion  uint              `json:"schema_version"`
+	Functions      []FunctionSpec    `json:"functions"`
 }
 
 func ParseJsonToData(b RawData) (Data, error) {
@@ -201,6 +433,10 @@ func ParseJsonToData(b RawData) (Data, error) {
 		Signature:      rawSignature,
 		Engine:         sv,
 		Version:        v,
+		Permissions:    b.Permissions,
+		UpdateURL:      b.UpdateURL,
+		SchemaVersion:  b.SchemaVersion,
+		Functions:      b.Functions,
 	}, nil
 
 }
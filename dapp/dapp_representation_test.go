@@ -98,3 +98,81 @@ func TestDAppVerifySignature(t *testing.T) {
 	require.True(t, valid)
 
 }
+
+func TestDAppLocalizedName(t *testing.T) {
+
+	app := Data{
+		Name: map[string]string{
+			"de": "Hallo",
+			"en": "Hello",
+			"fr": "Bonjour",
+		},
+	}
+
+	// exact match
+	require.Equal(t, "Bonjour", app.LocalizedName("fr"))
+
+	// base language of the locale
+	require.Equal(t, "Hallo", app.LocalizedName("de-CH"))
+	require.Equal(t, "Hallo", app.LocalizedName("de_AT"))
+
+	// fall back to english
+	require.Equal(t, "Hello", app.LocalizedName("es-ES"))
+	require.Equal(t, "Hello", app.LocalizedName(""))
+
+	// fall back to first language if there is no english name
+	delete(app.Name, "en")
+	require.Equal(t, "Hallo", app.LocalizedName("es"))
+
+	require.Equal(t, "", Data{}.LocalizedName("en"))
+
+}
+
+func TestDAppHashPermissions(t *testing.T) {
+
+	app := Data{
+		Name:    map[string]string{"en": "app"},
+		Version: 1,
+	}
+	withoutPermissions, err := app.Hash()
+	require.Nil(t, err)
+
+	// the permissions are signed too
+	app.Permissions = []string{"eth.sign", "chat.send"}
+	withPermissions, err := app.Hash()
+	require.Nil(t, err)
+	require.NotEqual(t, withoutPermissions, withPermissions)
+
+	// order doesn't matter
+	app.Permissions = []string{"chat.send", "eth.sign"}
+	reordered, err := app.Hash()
+	require.Nil(t, err)
+	require.Equal(t, withPermissions, reordered)
+
+}
+
+func TestDAppValidateFunctionArgs(t *testing.T) {
+
+	app := Data{
+		Functions: []FunctionSpec{
+			{ID: 1, Params: []string{"amount", "to"}},
+		},
+	}
+
+	// all required parameters are present
+	require.Nil(t, app.ValidateFunctionArgs(1, `{"amount": 3, "to": "0x0", "memo": "hi"}`))
+
+	// missing parameter
+	require.Equal(t, ErrInvalidFunctionArgs{
+		FunctionID: 1,
+		Missing:    []string{"to"},
+	}, app.ValidateFunctionArgs(1, `{"amount": 3}`))
+
+	// the arguments must be an object
+	require.EqualError(t, app.ValidateFunctionArgs(1, `null`), "arguments of function 1 must be a JSON object")
+	require.Error(t, app.ValidateFunctionArgs(1, `[1, 2]`))
+
+	// functions without a spec accept anything
+	require.Nil(t, app.ValidateFunctionArgs(2, `not even json`))
+
+}
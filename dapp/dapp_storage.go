@@ -1,10 +1,15 @@
 package dapp
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
+	"time"
 
 	uiapi "github.com/Bit-Nation/panthalassa/uiapi"
 	bolt "github.com/coreos/bbolt"
@@ -13,12 +18,99 @@ import (
 
 var (
 	dAppStoreBucketName = []byte("dapps")
+	// signing key -> unix nano timestamp of first install
+	dAppInstallTimesBucketName = []byte("dapp_install_times")
+	// sha256 of the code -> code
+	dAppCodeBucketName = []byte("dapp_code")
 )
 
+// the persisted DApp doesn't contain the code
+// the code is stored in the code bucket instead
+type persistedDApp struct {
+	Data
+	CodeHash []byte `json:"code_hash,omitempty"`
+}
+
+// unmarshal a persisted DApp and attach its code
+func loadDApp(tx *bolt.Tx, rawDApp []byte) (*Data, error) {
+
+	d := persistedDApp{}
+	if err := json.Unmarshal(rawDApp, &d); err != nil {
+		return nil, err
+	}
+
+	// DApps persisted before the code bucket existed have their code inline
+	if len(d.CodeHash) == 0 {
+		return &d.Data, nil
+	}
+
+	codeBucket := tx.Bucket(dAppCodeBucketName)
+	if codeBucket == nil {
+		return nil, errors.New("DApp code bucket doesn't exist")
+	}
+	code := codeBucket.Get(d.CodeHash)
+	if code == nil {
+		return nil, fmt.Errorf("missing code %x of DApp %x", d.CodeHash, d.UsedSigningKey)
+	}
+	d.Code = append([]byte{}, code...)
+
+	return &d.Data, nil
+
+}
+
+// check if another DApp than the given one references the code
+func codeReferenced(dAppStorageBucket *bolt.Bucket, codeHash []byte, except []byte) (bool, error) {
+	referenced := false
+	err := dAppStorageBucket.ForEach(func(signingKey, rawDApp []byte) error {
+		if bytes.Equal(signingKey, except) {
+			return nil
+		}
+		d := persistedDApp{}
+		if err := json.Unmarshal(rawDApp, &d); err != nil {
+			return err
+		}
+		if bytes.Equal(d.CodeHash, codeHash) {
+			referenced = true
+		}
+		return nil
+	})
+	return referenced, err
+}
+
+// returned when the same version of a DApp is saved again
+type ErrDAppAlreadyInstalled struct {
+	SigningKey string
+	Version    int
+}
+
+func (e ErrDAppAlreadyInstalled) Error() string {
+	return fmt.Sprintf("version %d of DApp %s is already installed", e.Version, e.SigningKey)
+}
+
+// returned when an older version of an installed DApp is saved
+type ErrDAppDowngrade struct {
+	CurrentVersion int
+	NewVersion     int
+}
+
+func (e ErrDAppDowngrade) Error() string {
+	return fmt.Sprintf("can't downgrade DApp from version %d to %d", e.CurrentVersion, e.NewVersion)
+}
+
+// used to determine the install time of a DApp
+var now = time.Now
+
 type Storage interface {
 	SaveDApp(dApp Data) error
+	// same as SaveDApp but the same version replaces the installed
+	// one. Used for DApps pushed by the development server.
+	SaveDevDApp(dApp Data) error
 	All() ([]*Data, error)
+	// all DApps - newest installation first
+	AllSortedByInstallTime() ([]*Data, error)
 	Get(signingKey ed25519.PublicKey) (*Data, error)
+	// all DApps that require the permission
+	FindByPermission(permission string) ([]*Data, error)
 }
 
 type BoltDAppStorage struct {
@@ -34,16 +126,34 @@ func NewDAppStorage(db *bolt.DB, api *uiapi.Api) *BoltDAppStorage {
 }
 
 func (s *BoltDAppStorage) SaveDApp(dApp Data) error {
+	return s.saveDApp(dApp, false)
+}
+
+func (s *BoltDAppStorage) SaveDevDApp(dApp Data) error {
+	return s.saveDApp(dApp, true)
+}
+
+// persist the DApp - the same version is only
+// replaced if replaceSameVersion is true
+func (s *BoltDAppStorage) saveDApp(dApp Data, replaceSameVersion bool) error {
 	return s.db.Update(func(tx *bolt.Tx) error {
 
-		if dApp.Version < 1 {
-			return errors.New("version must be at least 1")
+		if err := dApp.Validate(); err != nil {
+			return err
+		}
+
+		// we can't persist DApps this runtime can't parse
+		if err := dApp.CheckSchemaVersion(); err != nil {
+			return err
 		}
 
 		tx.OnCommit(func() {
-			s.uiApi.Send("DAPP:PERSISTED", map[string]interface{}{
-				"dapp_signing_key": hex.EncodeToString(dApp.UsedSigningKey),
+			err := s.uiApi.Dispatch(uiapi.DAppPersistedEvent{
+				DAppSigningKey: hex.EncodeToString(dApp.UsedSigningKey),
 			})
+			if err != nil {
+				sysLog.Error(err)
+			}
 		})
 
 		valid, err := dApp.VerifySignature()
@@ -60,11 +170,73 @@ func (s *BoltDAppStorage) SaveDApp(dApp Data) error {
 			return err
 		}
 
-		// marshal dApp
-		rawDApp, err := json.Marshal(dApp)
+		// make sure this or a newer version is not installed yet
+		installedDApp := persistedDApp{}
+		if rawInstalledDApp := dAppStorageBucket.Get(dApp.UsedSigningKey); rawInstalledDApp != nil {
+			if err := json.Unmarshal(rawInstalledDApp, &installedDApp); err != nil {
+				return err
+			}
+			if installedDApp.Version == dApp.Version && !replaceSameVersion {
+				return ErrDAppAlreadyInstalled{
+					SigningKey: hex.EncodeToString(dApp.UsedSigningKey),
+					Version:    dApp.Version,
+				}
+			}
+			// an older bundle must never replace a newer one
+			if dApp.Version < installedDApp.Version {
+				return ErrDAppDowngrade{
+					CurrentVersion: installedDApp.Version,
+					NewVersion:     dApp.Version,
+				}
+			}
+		}
+
+		// persist the code addressed by its hash
+		codeHash := sha256.Sum256(dApp.Code)
+		codeBucket, err := tx.CreateBucketIfNotExists(dAppCodeBucketName)
 		if err != nil {
 			return err
 		}
+		if err := codeBucket.Put(codeHash[:], dApp.Code); err != nil {
+			return err
+		}
+
+		// remove the code of the replaced version if nobody else uses it
+		if len(installedDApp.CodeHash) != 0 && !bytes.Equal(installedDApp.CodeHash, codeHash[:]) {
+			referenced, err := codeReferenced(dAppStorageBucket, installedDApp.CodeHash, dApp.UsedSigningKey)
+			if err != nil {
+				return err
+			}
+			if !referenced {
+				if err := codeBucket.Delete(installedDApp.CodeHash); err != nil {
+					return err
+				}
+			}
+		}
+
+		// marshal dApp without its code
+		persisted := persistedDApp{
+			Data:     dApp,
+			CodeHash: codeHash[:],
+		}
+		persisted.Code = nil
+		rawDApp, err := json.Marshal(persisted)
+		if err != nil {
+			return err
+		}
+
+		// record the install time - updates keep the first install time
+		installTimes, err := tx.CreateBucketIfNotExists(dAppInstallTimesBucketName)
+		if err != nil {
+			return err
+		}
+		if installTimes.Get(dApp.UsedSigningKey) == nil {
+			installedAt := make([]byte, 8)
+			binary.BigEndian.PutUint64(installedAt, uint64(now().UnixNano()))
+			if err := installTimes.Put(dApp.UsedSigningKey, installedAt); err != nil {
+				return err
+			}
+		}
 
 		// persist dApp
 		return dAppStorageBucket.Put(dApp.UsedSigningKey, rawDApp)
@@ -87,13 +259,13 @@ func (s *BoltDAppStorage) All() ([]*Data, error) {
 		return dAppStorage.ForEach(func(_, rawDApp []byte) error {
 
 			// unmarshal build
-			d := Data{}
-			if err := json.Unmarshal(rawDApp, &d); err != nil {
+			d, err := loadDApp(tx, rawDApp)
+			if err != nil {
 				return err
 			}
 
 			// add to list of Dapps
-			dApps = append(dApps, &d)
+			dApps = append(dApps, d)
 
 			return nil
 
@@ -104,23 +276,100 @@ func (s *BoltDAppStorage) All() ([]*Data, error) {
 	return dApps, err
 }
 
-func (s *BoltDAppStorage) Get(signingKey ed25519.PublicKey) (*Data, error) {
+func (s *BoltDAppStorage) FindByPermission(permission string) ([]*Data, error) {
 
-	var dApp *Data
-	dApp = nil
+	dApps := []*Data{}
 
 	err := s.db.View(func(tx *bolt.Tx) error {
-		err := s.db.View(func(tx *bolt.Tx) error {
-			if dAppStorage := tx.Bucket(dAppStoreBucketName); dAppStorage != nil {
-				if rawDAppData := dAppStorage.Get(signingKey); rawDAppData != nil {
-					if err := json.Unmarshal(rawDAppData, &dApp); err != nil {
-						return err
-					}
+
+		// fetch dApp's bucket
+		dAppStorage := tx.Bucket(dAppStoreBucketName)
+		if dAppStorage == nil {
+			return nil
+		}
+
+		return dAppStorage.ForEach(func(_, rawDApp []byte) error {
+
+			// unmarshal build
+			d, err := loadDApp(tx, rawDApp)
+			if err != nil {
+				return err
+			}
+
+			if d.HasPermission(permission) {
+				dApps = append(dApps, d)
+			}
+
+			return nil
+
+		})
+
+	})
+
+	return dApps, err
+
+}
+
+func (s *BoltDAppStorage) AllSortedByInstallTime() ([]*Data, error) {
+
+	dApps := []*Data{}
+	installedAt := map[string]uint64{}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+
+		// fetch dApp's bucket
+		dAppStorage := tx.Bucket(dAppStoreBucketName)
+		if dAppStorage == nil {
+			return nil
+		}
+
+		installTimes := tx.Bucket(dAppInstallTimesBucketName)
+
+		return dAppStorage.ForEach(func(signingKey, rawDApp []byte) error {
+
+			// unmarshal build
+			d, err := loadDApp(tx, rawDApp)
+			if err != nil {
+				return err
+			}
+			dApps = append(dApps, d)
+
+			// DApps persisted before install times
+			// were recorded are treated as the oldest
+			if installTimes != nil {
+				if rawInstalledAt := installTimes.Get(signingKey); rawInstalledAt != nil {
+					installedAt[string(signingKey)] = binary.BigEndian.Uint64(rawInstalledAt)
 				}
 			}
+
 			return nil
+
 		})
-		return err
+
+	})
+
+	sort.SliceStable(dApps, func(i, j int) bool {
+		return installedAt[string(dApps[i].UsedSigningKey)] > installedAt[string(dApps[j].UsedSigningKey)]
+	})
+
+	return dApps, err
+
+}
+
+func (s *BoltDAppStorage) Get(signingKey ed25519.PublicKey) (*Data, error) {
+
+	var dApp *Data
+	dApp = nil
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if dAppStorage := tx.Bucket(dAppStoreBucketName); dAppStorage != nil {
+			if rawDAppData := dAppStorage.Get(signingKey); rawDAppData != nil {
+				var err error
+				dApp, err = loadDApp(tx, rawDAppData)
+				return err
+			}
+		}
+		return nil
 	})
 
 	return dApp, err
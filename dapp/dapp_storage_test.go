@@ -2,6 +2,8 @@ package dapp
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -73,11 +75,20 @@ func TestBoltStorage_SaveDApp(t *testing.T) {
 		rawDApp := dAppStorage.Get(pub)
 		require.NotNil(t, rawDApp)
 
-		// make sure that the dApps are the same
-		// since we persisted the whole Dapp
-		dApp := Data{}
+		// the DApp is persisted without its code
+		dApp := persistedDApp{}
 		require.Nil(t, json.Unmarshal(rawDApp, &dApp))
-		require.Equal(t, dAppJson, dApp)
+		codeHash := sha256.Sum256(dAppJson.Code)
+		require.Equal(t, codeHash[:], dApp.CodeHash)
+		require.Empty(t, dApp.Code)
+		withoutCode := dAppJson
+		withoutCode.Code = nil
+		require.Equal(t, withoutCode, dApp.Data)
+
+		// the code is addressed by its hash
+		codeBucket := tx.Bucket(dAppCodeBucketName)
+		require.NotNil(t, codeBucket)
+		require.Equal(t, dAppJson.Code, codeBucket.Get(codeHash[:]))
 
 		return nil
 
@@ -171,6 +182,190 @@ func TestBoltStorage_All(t *testing.T) {
 
 }
 
+func TestBoltDAppStorage_AllSortedByInstallTime(t *testing.T) {
+
+	db := createDB()
+
+	dAppStorage := BoltDAppStorage{
+		db: db,
+		uiApi: uiApi.New(&testUpstream{send: func(s string) {
+
+		}}),
+	}
+
+	// reset clock after test
+	defer func() {
+		now = time.Now
+	}()
+
+	signedDApp := func(pub ed25519.PublicKey, priv ed25519.PrivateKey, version int) Data {
+		dApp := Data{
+			Name: map[string]string{
+				"en-us": "send and request money",
+			},
+			UsedSigningKey: pub,
+			Code:           []byte(`var wallet = "0x930aa9a843266bdb02847168d571e7913907dd84"`),
+			Engine:         SV{1, 2, 3},
+			Version:        version,
+		}
+		dAppHash, err := dApp.Hash()
+		require.Nil(t, err)
+		dApp.Signature = ed25519.Sign(priv, dAppHash)
+		return dApp
+	}
+
+	firstPub, firstPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	secondPub, secondPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+
+	first := signedDApp(firstPub, firstPriv, 1)
+	second := signedDApp(secondPub, secondPriv, 1)
+
+	now = func() time.Time { return time.Unix(100, 0) }
+	require.Nil(t, dAppStorage.SaveDApp(first))
+	now = func() time.Time { return time.Unix(200, 0) }
+	require.Nil(t, dAppStorage.SaveDApp(second))
+
+	// updating a DApp must not change it's install time
+	now = func() time.Time { return time.Unix(300, 0) }
+	require.Nil(t, dAppStorage.SaveDApp(signedDApp(firstPub, firstPriv, 2)))
+
+	dApps, err := dAppStorage.AllSortedByInstallTime()
+	require.Nil(t, err)
+	require.Equal(t, 2, len(dApps))
+	require.Equal(t, second.UsedSigningKey, dApps[0].UsedSigningKey)
+	require.Equal(t, first.UsedSigningKey, dApps[1].UsedSigningKey)
+
+}
+
+func TestBoltDAppStorage_SaveDAppValidation(t *testing.T) {
+
+	dAppStorage := BoltDAppStorage{
+		db: createDB(),
+		uiApi: uiApi.New(&testUpstream{send: func(s string) {
+
+		}}),
+	}
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+
+	dAppJson := Data{
+		Name: map[string]string{
+			"en-us": "send and request money",
+		},
+		UsedSigningKey: pub,
+		Code:           []byte(`var wallet = "0x930aa9a843266bdb02847168d571e7913907dd84"`),
+		Engine:         SV{1, 2, 3},
+		Version:        1,
+	}
+
+	sign := func(d Data) Data {
+		dAppHash, err := d.Hash()
+		require.Nil(t, err)
+		d.Signature = ed25519.Sign(priv, dAppHash)
+		return d
+	}
+
+	// name is required
+	invalid := dAppJson
+	invalid.Name = map[string]string{}
+	require.EqualError(t, dAppStorage.SaveDApp(sign(invalid)), "a DApp must have at least one name")
+
+	// code is required
+	invalid = dAppJson
+	invalid.Code = []byte{}
+	require.EqualError(t, dAppStorage.SaveDApp(sign(invalid)), "invalid DApp code size of 0 bytes - must be between 1 and 5242880 bytes")
+
+	// version is required
+	invalid = dAppJson
+	invalid.Version = 0
+	require.EqualError(t, dAppStorage.SaveDApp(sign(invalid)), "version must be at least 1")
+
+	// DApps with a future schema version are rejected
+	invalid = dAppJson
+	invalid.SchemaVersion = 2
+	require.Equal(t, ErrUnsupportedDAppSchema{
+		Got:          2,
+		MaxSupported: 1,
+	}, dAppStorage.SaveDApp(sign(invalid)))
+
+	// same version can't be installed twice
+	require.Nil(t, dAppStorage.SaveDApp(sign(dAppJson)))
+	err = dAppStorage.SaveDApp(sign(dAppJson))
+	require.Equal(t, ErrDAppAlreadyInstalled{
+		SigningKey: hex.EncodeToString(pub),
+		Version:    1,
+	}, err)
+
+	// newer versions replace the installed one
+	update := dAppJson
+	update.Version = 3
+	require.Nil(t, dAppStorage.SaveDApp(sign(update)))
+
+	// older versions are rejected
+	downgrade := dAppJson
+	downgrade.Version = 2
+	require.Equal(t, ErrDAppDowngrade{
+		CurrentVersion: 3,
+		NewVersion:     2,
+	}, dAppStorage.SaveDApp(sign(downgrade)))
+	installed, err := dAppStorage.Get(pub)
+	require.Nil(t, err)
+	require.Equal(t, 3, installed.Version)
+
+}
+
+func TestBoltDAppStorage_SaveDevDApp(t *testing.T) {
+
+	dAppStorage := BoltDAppStorage{
+		db: createDB(),
+		uiApi: uiApi.New(&testUpstream{
+			send: func(s string) {},
+		}),
+	}
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+
+	dAppJson := Data{
+		Name: map[string]string{
+			"en-us": "send and request money",
+		},
+		UsedSigningKey: pub,
+		Code:           []byte(`var version = 1`),
+		Engine:         SV{1, 2, 3},
+		Version:        2,
+	}
+
+	sign := func(d Data) Data {
+		dAppHash, err := d.Hash()
+		require.Nil(t, err)
+		d.Signature = ed25519.Sign(priv, dAppHash)
+		return d
+	}
+
+	require.Nil(t, dAppStorage.SaveDApp(sign(dAppJson)))
+
+	// the development server pushes the same version with changed code
+	update := dAppJson
+	update.Code = []byte(`var version = 2`)
+	require.Nil(t, dAppStorage.SaveDevDApp(sign(update)))
+	installed, err := dAppStorage.Get(pub)
+	require.Nil(t, err)
+	require.Equal(t, []byte(`var version = 2`), installed.Code)
+
+	// older versions are still rejected
+	downgrade := dAppJson
+	downgrade.Version = 1
+	require.Equal(t, ErrDAppDowngrade{
+		CurrentVersion: 2,
+		NewVersion:     1,
+	}, dAppStorage.SaveDevDApp(sign(downgrade)))
+
+}
+
 func TestBoltDAppStorage_Get(t *testing.T) {
 
 	db := createDB()
@@ -220,6 +415,72 @@ func TestBoltDAppStorage_Get(t *testing.T) {
 
 }
 
+func TestBoltDAppStorage_CodeStorage(t *testing.T) {
+
+	db := createDB()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+
+	dAppStorage := BoltDAppStorage{
+		db: db,
+		uiApi: uiApi.New(&testUpstream{
+			send: func(s string) {},
+		}),
+	}
+
+	sign := func(d Data) Data {
+		dAppHash, err := d.Hash()
+		require.Nil(t, err)
+		d.Signature = ed25519.Sign(priv, dAppHash)
+		return d
+	}
+
+	codeCount := func() int {
+		count := 0
+		require.Nil(t, db.View(func(tx *bolt.Tx) error {
+			count = tx.Bucket(dAppCodeBucketName).Stats().KeyN
+			return nil
+		}))
+		return count
+	}
+
+	dAppJson := Data{
+		Name: map[string]string{
+			"en-us": "send and request money",
+		},
+		UsedSigningKey: pub,
+		Code:           []byte(`var version = 1`),
+		Engine:         SV{1, 2, 3},
+		Version:        1,
+	}
+	require.Nil(t, dAppStorage.SaveDApp(sign(dAppJson)))
+	require.Equal(t, 1, codeCount())
+
+	// an update with the same code doesn't duplicate it
+	sameCode := dAppJson
+	sameCode.Version = 2
+	require.Nil(t, dAppStorage.SaveDApp(sign(sameCode)))
+	require.Equal(t, 1, codeCount())
+
+	// an update with new code removes the old code
+	newCode := dAppJson
+	newCode.Version = 3
+	newCode.Code = []byte(`var version = 3`)
+	require.Nil(t, dAppStorage.SaveDApp(sign(newCode)))
+	require.Equal(t, 1, codeCount())
+
+	fetched, err := dAppStorage.Get(pub)
+	require.Nil(t, err)
+	require.Equal(t, newCode.Code, fetched.Code)
+
+	all, err := dAppStorage.All()
+	require.Nil(t, err)
+	require.Len(t, all, 1)
+	require.Equal(t, newCode.Code, all[0].Code)
+
+}
+
 func createDB() *bolt.DB {
 	dbPath, err := filepath.Abs(os.TempDir() + "/" + time.Now().String())
 	if err != nil {
@@ -231,3 +492,53 @@ func createDB() *bolt.DB {
 	}
 	return db
 }
+
+func TestBoltDAppStorage_FindByPermission(t *testing.T) {
+
+	db := createDB()
+
+	dAppStorage := BoltDAppStorage{
+		db: db,
+		uiApi: uiApi.New(&testUpstream{send: func(s string) {
+
+		}}),
+	}
+
+	// persist a DApp with the given permissions
+	save := func(permissions []string) Data {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		require.Nil(t, err)
+		dApp := Data{
+			Name:           map[string]string{"en": "app"},
+			UsedSigningKey: pub,
+			Code:           []byte(`var a = 1`),
+			Engine:         SV{1, 2, 3},
+			Version:        1,
+			Permissions:    permissions,
+		}
+		dAppHash, err := dApp.Hash()
+		require.Nil(t, err)
+		dApp.Signature = ed25519.Sign(priv, dAppHash)
+		require.Nil(t, dAppStorage.SaveDApp(dApp))
+		return dApp
+	}
+
+	// no DApps persisted yet
+	found, err := dAppStorage.FindByPermission("chat.send")
+	require.Nil(t, err)
+	require.Equal(t, 0, len(found))
+
+	chatDApp := save([]string{"chat.send", "storage.read"})
+	save([]string{"eth.sign"})
+	save(nil)
+
+	found, err = dAppStorage.FindByPermission("chat.send")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(found))
+	require.Equal(t, chatDApp, *found[0])
+
+	found, err = dAppStorage.FindByPermission("unknown")
+	require.Nil(t, err)
+	require.Equal(t, 0, len(found))
+
+}
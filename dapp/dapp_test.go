@@ -7,6 +7,7 @@ import (
 
 	dAppMod "github.com/Bit-Nation/panthalassa/dapp/module"
 	log "github.com/op/go-logging"
+	otto "github.com/robertkrimen/otto"
 	require "github.com/stretchr/testify/require"
 	ed25519 "golang.org/x/crypto/ed25519"
 )
@@ -40,7 +41,7 @@ func TestStartDAppSuccess(t *testing.T) {
 
 	closer := make(chan *Data)
 
-	_, err = New(log.MustGetLogger(""), &app, []dAppMod.Module{}, closer, time.Second, nil)
+	_, err = New(log.MustGetLogger(""), &app, []dAppMod.Module{}, closer, time.Second, nil, DAppConfig{})
 	require.Nil(t, err)
 
 }
@@ -74,7 +75,7 @@ func TestStartDAppHalting(t *testing.T) {
 
 	closer := make(chan *Data, 1)
 
-	dApp, err := New(log.MustGetLogger(""), &app, []dAppMod.Module{}, closer, time.Second, nil)
+	dApp, err := New(log.MustGetLogger(""), &app, []dAppMod.Module{}, closer, time.Second, nil, DAppConfig{})
 	require.Nil(t, dApp)
 	require.EqualError(t, err, "timeout - failed to start DApp")
 
@@ -113,8 +114,260 @@ func TestStartInvalidSignature(t *testing.T) {
 
 	closer := make(chan *Data, 1)
 
-	dApp, err := New(log.MustGetLogger(""), &app, []dAppMod.Module{}, closer, time.Second, nil)
+	dApp, err := New(log.MustGetLogger(""), &app, []dAppMod.Module{}, closer, time.Second, nil, DAppConfig{})
 	require.Nil(t, dApp)
 	require.EqualError(t, err, "failed to verify signature for DApp")
 
 }
+
+func TestStartUnsupportedSchema(t *testing.T) {
+
+	app := Data{
+		Name: map[string]string{
+			"en-us": "send and request money",
+		},
+		SchemaVersion: 2,
+	}
+
+	closer := make(chan *Data, 1)
+
+	dApp, err := New(log.MustGetLogger(""), &app, []dAppMod.Module{}, closer, time.Second, nil, DAppConfig{})
+	require.Nil(t, dApp)
+	require.EqualError(t, err, "DApp schema version 2 is not supported - max supported version is 1")
+
+}
+
+func TestDAppPauseResume(t *testing.T) {
+
+	vm := otto.New()
+	vm.Interrupt = make(chan func(), 1)
+
+	dApp := &DApp{
+		vm: vm,
+	}
+
+	// pausing twice must only interrupt the vm once
+	dApp.Pause()
+	dApp.Pause()
+	require.Equal(t, 1, len(vm.Interrupt))
+	require.Equal(t, int32(1), dApp.paused)
+
+	interrupt := <-vm.Interrupt
+
+	// the interrupt must block till the DApp is resumed
+	done := make(chan struct{})
+	go func() {
+		interrupt()
+		done <- struct{}{}
+	}()
+
+	select {
+	case <-done:
+		require.FailNow(t, "interrupt returned while paused")
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	dApp.Resume()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		require.FailNow(t, "timed out")
+	}
+
+}
+
+func TestDAppPauseIdleVM(t *testing.T) {
+
+	vm := otto.New()
+	vm.Interrupt = make(chan func(), 1)
+
+	dApp := &DApp{
+		vm: vm,
+	}
+
+	// an idle vm never takes the interrupt
+	// pausing it again must not block
+	done := make(chan struct{})
+	go func() {
+		dApp.Pause()
+		dApp.Resume()
+		dApp.Pause()
+		done <- struct{}{}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		require.FailNow(t, "pausing an idle DApp blocked")
+	}
+	require.Equal(t, 1, len(vm.Interrupt))
+
+	// the pending interrupt waits for the current pause
+	interrupt := <-vm.Interrupt
+	go func() {
+		interrupt()
+		done <- struct{}{}
+	}()
+
+	select {
+	case <-done:
+		require.FailNow(t, "interrupt returned while paused")
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	dApp.Resume()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		require.FailNow(t, "timed out")
+	}
+
+}
+
+func TestDAppCloseIdleVM(t *testing.T) {
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+
+	app := Data{
+		Name: map[string]string{
+			"en-us": "send and request money",
+		},
+		UsedSigningKey: pub,
+		Code:           []byte("var i = 1"),
+		Image:          []byte("base64..."),
+		Engine: SV{
+			Major: 0,
+			Minor: 1,
+			Patch: 0,
+		},
+	}
+
+	appHash, err := app.Hash()
+	require.Nil(t, err)
+	app.Signature = ed25519.Sign(priv, appHash)
+
+	closer := make(chan *Data, 1)
+
+	dApp, err := New(log.MustGetLogger(""), &app, []dAppMod.Module{}, closer, time.Second, nil, DAppConfig{})
+	require.Nil(t, err)
+
+	// the pause interrupt is never taken by the idle vm
+	dApp.Pause()
+	dApp.Resume()
+
+	done := make(chan struct{})
+	go func() {
+		dApp.Close()
+		// closing twice must not block
+		dApp.Close()
+		done <- struct{}{}
+	}()
+
+	select {
+	case closed := <-closer:
+		require.Equal(t, &app, closed)
+	case <-time.After(time.Second):
+		require.FailNow(t, "idle DApp wasn't closed")
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		require.FailNow(t, "closing the DApp blocked")
+	}
+
+}
+
+func TestDAppExecuteScript(t *testing.T) {
+
+	dApp := &DApp{
+		vm: otto.New(),
+	}
+
+	// not allowed outside of development mode
+	_, err := dApp.ExecuteScript("1 + 1")
+	require.Equal(t, ErrDevModeRequired, err)
+
+	dApp.EnableDevMode()
+
+	result, err := dApp.ExecuteScript("var counter = 41; counter + 1")
+	require.Nil(t, err)
+	require.Equal(t, "42", result)
+
+	// scripts share the state of the vm
+	result, err = dApp.ExecuteScript("counter")
+	require.Nil(t, err)
+	require.Equal(t, "41", result)
+
+	_, err = dApp.ExecuteScript("undefinedFunction()")
+	require.NotNil(t, err)
+
+}
+
+func TestDAppReload(t *testing.T) {
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+
+	app := Data{
+		Name: map[string]string{
+			"en-us": "send and request money",
+		},
+		UsedSigningKey: pub,
+		Code:           []byte("var version = 1"),
+		Image:          []byte("base64..."),
+		Engine: SV{
+			Major: 0,
+			Minor: 1,
+			Patch: 0,
+		},
+	}
+
+	appHash, err := app.Hash()
+	require.Nil(t, err)
+	app.Signature = ed25519.Sign(priv, appHash)
+
+	// sign the DApp with the given code
+	sign := func(code string) []byte {
+		updated := app
+		updated.Code = []byte(code)
+		updatedHash, err := updated.Hash()
+		require.Nil(t, err)
+		return ed25519.Sign(priv, updatedHash)
+	}
+
+	closer := make(chan *Data, 1)
+
+	dApp, err := New(log.MustGetLogger(""), &app, []dAppMod.Module{}, closer, time.Second, nil, DAppConfig{})
+	require.Nil(t, err)
+
+	// not allowed outside of development mode
+	require.Equal(t, ErrReloadRequiresDevMode, dApp.Reload("var version = 2", sign("var version = 2")))
+
+	dApp.EnableDevMode()
+	oldVM := dApp.vm
+
+	// the new code must be signed
+	require.Equal(t, InvalidSignature, dApp.Reload("var version = 2", sign("var version = 3")))
+	require.True(t, oldVM == dApp.vm)
+
+	// the current vm is kept if the new code fails
+	require.NotNil(t, dApp.Reload("undefinedFunction()", sign("undefinedFunction()")))
+	require.True(t, oldVM == dApp.vm)
+
+	require.Nil(t, dApp.Reload("var version = 2", sign("var version = 2")))
+	require.False(t, oldVM == dApp.vm)
+	require.Equal(t, []byte("var version = 2"), dApp.app.Code)
+
+	result, err := dApp.ExecuteScript("version")
+	require.Nil(t, err)
+	require.Equal(t, "2", result)
+
+	// the old vm is untouched
+	value, err := oldVM.Get("version")
+	require.Nil(t, err)
+	require.Equal(t, "1", value.String())
+
+}
@@ -3,6 +3,8 @@ package callbacks
 import (
 	"errors"
 	"fmt"
+	"sync/atomic"
+	"time"
 
 	reqLim "github.com/Bit-Nation/panthalassa/dapp/request_limitation"
 	validator "github.com/Bit-Nation/panthalassa/dapp/validator"
@@ -13,6 +15,9 @@ import (
 
 var debugger = log.Logger("callbacks")
 
+// returned when a called function didn't "return" in time
+var ErrDAppFunctionTimeout = errors.New("dapp function call timed out")
+
 // with this module it's possible to register functions
 // from inside of the vm and call them by there id
 
@@ -145,7 +150,9 @@ func (m *Module) Close() error {
 // with the given payload as an object and a callback
 // e.g. myRegisteredFunction(payloadObj, cb)
 // the callback must be called in order to "return" from the function
-func (m *Module) CallFunction(id uint, payload string) error {
+// in the case the callback is not called within the timeout
+// the execution is interrupted and ErrDAppFunctionTimeout is returned
+func (m *Module) CallFunction(id uint, payload string, timeout time.Duration) error {
 
 	debugger.Debug(fmt.Errorf("call function with id: %d and payload: %s", id, payload))
 
@@ -176,7 +183,24 @@ func (m *Module) CallFunction(id uint, payload string) error {
 
 	alreadyCalled := false
 
-	_, err = fn.Call(*fn, objArgs, func(call otto.FunctionCall) otto.Value {
+	// 1 while the function is executed by the vm
+	executing := int32(1)
+
+	// interrupt the vm if the function is still executed after the timeout
+	timedOut := make(chan struct{})
+	timer := time.AfterFunc(timeout, func() {
+		close(timedOut)
+		if atomic.LoadInt32(&executing) == 1 && m.vm.Interrupt != nil {
+			m.vm.Interrupt <- func() {
+				if atomic.LoadInt32(&executing) == 1 {
+					panic(ErrDAppFunctionTimeout)
+				}
+			}
+		}
+	})
+	defer timer.Stop()
+
+	err = m.callWithInterrupt(fn, objArgs, func(call otto.FunctionCall) otto.Value {
 
 		defer func() {
 			m.rmCBChan <- &done
@@ -201,14 +225,43 @@ func (m *Module) CallFunction(id uint, payload string) error {
 		return otto.Value{}
 
 	})
+	atomic.StoreInt32(&executing, 0)
+	if err == ErrDAppFunctionTimeout {
+		go func() {
+			m.rmCBChan <- &done
+		}()
+		return err
+	}
 	if err != nil {
 		m.logger.Error(err.Error())
 	}
 
-	return <-done
+	select {
+	case err := <-done:
+		return err
+	case <-timedOut:
+		go func() {
+			m.rmCBChan <- &done
+		}()
+		return ErrDAppFunctionTimeout
+	}
 
 }
 
+// call the function and recover from the timeout interrupt
+func (m *Module) callWithInterrupt(fn *otto.Value, args ...interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if r != ErrDAppFunctionTimeout {
+				panic(r)
+			}
+			err = ErrDAppFunctionTimeout
+		}
+	}()
+	_, err = fn.Call(*fn, args...)
+	return err
+}
+
 // registerFunction will take a function as it's first and only parameter
 // if the parameter is not a function it will throw an error
 // a ID (uint) is returned that represents the id of the registered function
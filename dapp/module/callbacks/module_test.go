@@ -127,7 +127,7 @@ func TestFuncCallSuccess(t *testing.T) {
 	}
 	require.NotNil(t, <-respChan)
 
-	require.Nil(t, m.CallFunction(1, `{key: "value"}`))
+	require.Nil(t, m.CallFunction(1, `{key: "value"}`, time.Second))
 
 }
 
@@ -174,7 +174,7 @@ func TestFuncCallError(t *testing.T) {
 	}
 	require.NotNil(t, <-respChan)
 
-	require.Equal(t, "I am an error", m.CallFunction(1, `{key: "value"}`).Error())
+	require.Equal(t, "I am an error", m.CallFunction(1, `{key: "value"}`, time.Second).Error())
 
 }
 
@@ -232,7 +232,7 @@ func TestFuncCallBackTwice(t *testing.T) {
 	}
 	require.NotNil(t, <-respChan)
 
-	m.CallFunction(1, `{key: "value"}`)
+	m.CallFunction(1, `{key: "value"}`, time.Second)
 
 }
 
@@ -242,7 +242,7 @@ func TestModule_CallFunctionThatIsNotRegistered(t *testing.T) {
 	vm := otto.New()
 	require.Nil(t, m.Register(vm))
 
-	err := m.CallFunction(1, "{}")
+	err := m.CallFunction(1, "{}", time.Second)
 	require.EqualError(t, err, "function with id: 1 does not exist")
 
 }
@@ -260,6 +260,38 @@ func TestModule_Close(t *testing.T) {
 	})
 	require.Nil(t, err)
 
-	require.EqualError(t, m.CallFunction(1, "{}"), "closed application")
+	require.EqualError(t, m.CallFunction(1, "{}", time.Second), "closed application")
+
+}
+
+func TestModule_CallFunctionTimeout(t *testing.T) {
+
+	m := New(log.MustGetLogger(""))
+	vm := otto.New()
+	vm.Interrupt = make(chan func(), 1)
+	require.Nil(t, m.Register(vm))
+
+	// function that never calls the callback
+	_, err := vm.Call("registerFunction", vm, func(call otto.FunctionCall) otto.Value {
+		return otto.Value{}
+	})
+	require.Nil(t, err)
+
+	require.Equal(t, ErrDAppFunctionTimeout, m.CallFunction(1, "{}", time.Millisecond*100))
+
+}
+
+func TestModule_CallFunctionTimeoutInterruptsVM(t *testing.T) {
+
+	m := New(log.MustGetLogger(""))
+	vm := otto.New()
+	vm.Interrupt = make(chan func(), 1)
+	require.Nil(t, m.Register(vm))
+
+	// function that never returns
+	_, err := vm.Run(`registerFunction(function(payload, cb) { while(true) {} })`)
+	require.Nil(t, err)
+
+	require.Equal(t, ErrDAppFunctionTimeout, m.CallFunction(1, "{}", time.Millisecond*100))
 
 }
@@ -0,0 +1,153 @@
+package chat
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	module "github.com/Bit-Nation/panthalassa/dapp/module"
+	reqLim "github.com/Bit-Nation/panthalassa/dapp/request_limitation"
+	validator "github.com/Bit-Nation/panthalassa/dapp/validator"
+	db "github.com/Bit-Nation/panthalassa/db"
+	logger "github.com/op/go-logging"
+	otto "github.com/robertkrimen/otto"
+	uuid "github.com/satori/go.uuid"
+	ed25519 "golang.org/x/crypto/ed25519"
+)
+
+// type of the DApp messages sent by this module
+const MessageType = "CHAT_MESSAGE"
+
+// DApps need this permission to use the module
+const Permission = "sendMessage"
+
+// with this module a DApp can send messages to a chat
+// e.g. replies of a chat bot
+type Module struct {
+	msgStorage db.ChatMessageStorage
+	dAppPubKey ed25519.PublicKey
+	checker    module.PermissionChecker
+	logger     *logger.Logger
+	throttling *reqLim.Throttling
+}
+
+func New(msgStorage db.ChatMessageStorage, dAppPubKey ed25519.PublicKey, checker module.PermissionChecker, l *logger.Logger) *Module {
+	return &Module{
+		msgStorage: msgStorage,
+		dAppPubKey: dAppPubKey,
+		checker:    checker,
+		logger:     l,
+		// one message per second
+		throttling: reqLim.NewThrottling(1, time.Second, 10, errors.New("can't add more chat messages to stack")),
+	}
+}
+
+func (m *Module) Close() error {
+	return m.throttling.Close()
+}
+
+// chat.sendMessage(partnerHex, messageBase64, callback)
+// the callback is called with (error, messageID)
+func (m *Module) Register(vm *otto.Otto) error {
+
+	if m.checker == nil || !m.checker.Granted(Permission) {
+		return fmt.Errorf("permission %s hasn't been granted", Permission)
+	}
+
+	chatObj, err := vm.Object("({})")
+	if err != nil {
+		return err
+	}
+
+	err = chatObj.Set("sendMessage", func(call otto.FunctionCall) otto.Value {
+
+		// validate function call
+		v := validator.New()
+		// partner
+		v.Set(0, &validator.TypeString)
+		// base64 encoded message
+		v.Set(1, &validator.TypeString)
+		// callback
+		v.Set(2, &validator.TypeFunction)
+		cb := call.Argument(2)
+
+		// utils to handle an occurred error
+		handleError := func(errMsg string) otto.Value {
+			if cb.IsFunction() {
+				if _, err := cb.Call(cb, errMsg); err != nil {
+					m.logger.Error(err.Error())
+				}
+				return otto.Value{}
+			}
+			m.logger.Error(errMsg)
+			return otto.Value{}
+		}
+		if err := v.Validate(vm, call); err != nil {
+			return handleError(err.String())
+		}
+
+		// decode partner
+		partner, err := hex.DecodeString(call.Argument(0).String())
+		if err != nil {
+			return handleError(err.Error())
+		}
+		if len(partner) != 32 {
+			return handleError("partner must be 32 bytes long")
+		}
+
+		// decode message
+		message, err := base64.StdEncoding.DecodeString(call.Argument(1).String())
+		if err != nil {
+			return handleError(err.Error())
+		}
+		if len(message) == 0 {
+			return handleError("message must not be empty")
+		}
+
+		id, err := uuid.NewV4()
+		if err != nil {
+			return handleError(err.Error())
+		}
+
+		err = m.throttling.Exec(func() {
+
+			// DApp messages can't contain plain text
+			// so the message is passed in the params
+			msg := db.Message{
+				ID: id.String(),
+				DApp: &db.DAppMessage{
+					DAppPublicKey: m.dAppPubKey,
+					Type:          MessageType,
+					Params: map[string]interface{}{
+						"message": call.Argument(1).String(),
+					},
+					ShouldSend: true,
+				},
+			}
+
+			if err := m.msgStorage.PersistMessageToSend(partner, msg); err != nil {
+				handleError(err.Error())
+				return
+			}
+
+			if _, err := cb.Call(cb, nil, id.String()); err != nil {
+				m.logger.Error(err.Error())
+			}
+
+		})
+		if err != nil {
+			return handleError(err.Error())
+		}
+
+		return otto.Value{}
+
+	})
+	if err != nil {
+		return err
+	}
+
+	return vm.Set("chat", chatObj)
+
+}
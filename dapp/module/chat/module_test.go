@@ -0,0 +1,111 @@
+package chat
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	db "github.com/Bit-Nation/panthalassa/db"
+	log "github.com/op/go-logging"
+	otto "github.com/robertkrimen/otto"
+	require "github.com/stretchr/testify/require"
+	ed25519 "golang.org/x/crypto/ed25519"
+)
+
+func TestModule_RegisterWithoutPermission(t *testing.T) {
+
+	dAppPubKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+
+	vm := otto.New()
+	m := New(&testMessageStorage{}, dAppPubKey, &testPermissionChecker{}, log.MustGetLogger(""))
+	require.EqualError(t, m.Register(vm), "permission sendMessage hasn't been granted")
+
+	chatObj, err := vm.Get("chat")
+	require.Nil(t, err)
+	require.True(t, chatObj.IsUndefined())
+
+}
+
+func TestModule_SendMessage(t *testing.T) {
+
+	vm := otto.New()
+
+	dAppPubKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+
+	partner, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+
+	persisted := make(chan db.Message, 1)
+	msgStorage := testMessageStorage{
+		persistMessageToSend: func(to ed25519.PublicKey, msg db.Message) error {
+			require.Equal(t, partner, to)
+			persisted <- msg
+			return nil
+		},
+	}
+
+	m := New(&msgStorage, dAppPubKey, &testPermissionChecker{granted: []string{Permission}}, log.MustGetLogger(""))
+	require.Nil(t, m.Register(vm))
+
+	chatObj, err := vm.Get("chat")
+	require.Nil(t, err)
+
+	called := make(chan string, 1)
+	_, err = chatObj.Object().Call(
+		"sendMessage",
+		hex.EncodeToString(partner),
+		base64.StdEncoding.EncodeToString([]byte("hi")),
+		func(call otto.FunctionCall) otto.Value {
+			if call.Argument(0).IsDefined() && !call.Argument(0).IsNull() {
+				require.Fail(t, call.Argument(0).String())
+			}
+			called <- call.Argument(1).String()
+			return otto.Value{}
+		},
+	)
+	require.Nil(t, err)
+
+	select {
+	case msg := <-persisted:
+		require.Equal(t, []byte(dAppPubKey), msg.DApp.DAppPublicKey)
+		require.Equal(t, MessageType, msg.DApp.Type)
+		require.True(t, msg.DApp.ShouldSend)
+		require.Equal(t, base64.StdEncoding.EncodeToString([]byte("hi")), msg.DApp.Params["message"])
+		require.Equal(t, msg.ID, <-called)
+	case <-time.After(time.Second * 2):
+		require.FailNow(t, "timed out")
+	}
+
+}
+
+func TestModule_SendMessageInvalidPartner(t *testing.T) {
+
+	vm := otto.New()
+
+	dAppPubKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+
+	m := New(&testMessageStorage{}, dAppPubKey, &testPermissionChecker{granted: []string{Permission}}, log.MustGetLogger(""))
+	require.Nil(t, m.Register(vm))
+
+	chatObj, err := vm.Get("chat")
+	require.Nil(t, err)
+
+	called := make(chan string, 1)
+	_, err = chatObj.Object().Call(
+		"sendMessage",
+		"abcd",
+		base64.StdEncoding.EncodeToString([]byte("hi")),
+		func(call otto.FunctionCall) otto.Value {
+			called <- call.Argument(0).String()
+			return otto.Value{}
+		},
+	)
+	require.Nil(t, err)
+	require.Equal(t, "partner must be 32 bytes long", <-called)
+
+}
@@ -21,7 +21,8 @@ func TestModule_Register(t *testing.T) {
 	require.Nil(t, err)
 
 	// open key manager form key store
-	km := keyManager.CreateFromKeyStore(store)
+	km, err := keyManager.CreateFromKeyStore(store)
+	require.Nil(t, err)
 
 	// create address module
 	mod := New(km)
@@ -0,0 +1,200 @@
+package groupchat
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	module "github.com/Bit-Nation/panthalassa/dapp/module"
+	reqLim "github.com/Bit-Nation/panthalassa/dapp/request_limitation"
+	validator "github.com/Bit-Nation/panthalassa/dapp/validator"
+	logger "github.com/op/go-logging"
+	otto "github.com/robertkrimen/otto"
+	ed25519 "golang.org/x/crypto/ed25519"
+)
+
+// DApps need this permission to use the module
+const Permission = "groupChat"
+
+// message received in a group
+type Message struct {
+	Sender    ed25519.PublicKey
+	Message   []byte
+	CreatedAt time.Time
+}
+
+// group messaging used by the module
+type Messenger interface {
+	SendGroupMessage(groupID []byte, msg []byte) error
+	// the returned function removes the listener
+	OnGroupMessage(groupID []byte, fn func(msg Message)) func()
+}
+
+// with this module a DApp can send and receive group messages
+// e.g. for chat bots or games with multiple players
+type Module struct {
+	messenger  Messenger
+	checker    module.PermissionChecker
+	logger     *logger.Logger
+	throttling *reqLim.Throttling
+	lock       sync.Mutex
+	removers   []func()
+}
+
+func New(messenger Messenger, checker module.PermissionChecker, l *logger.Logger) *Module {
+	return &Module{
+		messenger: messenger,
+		checker:   checker,
+		logger:    l,
+		// one message per second
+		throttling: reqLim.NewThrottling(1, time.Second, 10, errors.New("can't add more group messages to stack")),
+	}
+}
+
+// remove all registered listeners
+func (m *Module) Close() error {
+	m.lock.Lock()
+	for _, remove := range m.removers {
+		remove()
+	}
+	m.removers = nil
+	m.lock.Unlock()
+	return m.throttling.Close()
+}
+
+func decodeGroupID(groupIDHex string) ([]byte, error) {
+	groupID, err := hex.DecodeString(groupIDHex)
+	if err != nil {
+		return nil, err
+	}
+	if len(groupID) != 32 {
+		return nil, errors.New("group id must be 32 bytes long")
+	}
+	return groupID, nil
+}
+
+// groupchat.sendMessage(groupIDHex, messageBase64, callback)
+// the callback is called with (error)
+// groupchat.onMessage(groupIDHex, callback)
+// the callback is called with ({sender_hex, message_b64, timestamp})
+func (m *Module) Register(vm *otto.Otto) error {
+
+	if m.checker == nil || !m.checker.Granted(Permission) {
+		return fmt.Errorf("permission %s hasn't been granted", Permission)
+	}
+
+	groupObj, err := vm.Object("({})")
+	if err != nil {
+		return err
+	}
+
+	err = groupObj.Set("sendMessage", func(call otto.FunctionCall) otto.Value {
+
+		// validate function call
+		v := validator.New()
+		// group id
+		v.Set(0, &validator.TypeString)
+		// base64 encoded message
+		v.Set(1, &validator.TypeString)
+		// callback
+		v.Set(2, &validator.TypeFunction)
+		cb := call.Argument(2)
+
+		// utils to handle an occurred error
+		handleError := func(errMsg string) otto.Value {
+			if cb.IsFunction() {
+				if _, err := cb.Call(cb, errMsg); err != nil {
+					m.logger.Error(err.Error())
+				}
+				return otto.Value{}
+			}
+			m.logger.Error(errMsg)
+			return otto.Value{}
+		}
+		if err := v.Validate(vm, call); err != nil {
+			return handleError(err.String())
+		}
+
+		groupID, err := decodeGroupID(call.Argument(0).String())
+		if err != nil {
+			return handleError(err.Error())
+		}
+
+		// decode message
+		message, err := base64.StdEncoding.DecodeString(call.Argument(1).String())
+		if err != nil {
+			return handleError(err.Error())
+		}
+		if len(message) == 0 {
+			return handleError("message must not be empty")
+		}
+
+		err = m.throttling.Exec(func() {
+
+			if err := m.messenger.SendGroupMessage(groupID, message); err != nil {
+				handleError(err.Error())
+				return
+			}
+
+			if _, err := cb.Call(cb); err != nil {
+				m.logger.Error(err.Error())
+			}
+
+		})
+		if err != nil {
+			return handleError(err.Error())
+		}
+
+		return otto.Value{}
+
+	})
+	if err != nil {
+		return err
+	}
+
+	err = groupObj.Set("onMessage", func(call otto.FunctionCall) otto.Value {
+
+		// validate function call
+		v := validator.New()
+		// group id
+		v.Set(0, &validator.TypeString)
+		// callback
+		v.Set(1, &validator.TypeFunction)
+		if err := v.Validate(vm, call); err != nil {
+			return *err
+		}
+
+		groupID, err := decodeGroupID(call.Argument(0).String())
+		if err != nil {
+			return vm.MakeCustomError("ValidationError", err.Error())
+		}
+
+		cb := call.Argument(1)
+		remove := m.messenger.OnGroupMessage(groupID, func(msg Message) {
+			_, err := cb.Call(cb, map[string]interface{}{
+				"sender_hex":  hex.EncodeToString(msg.Sender),
+				"message_b64": base64.StdEncoding.EncodeToString(msg.Message),
+				"timestamp":   msg.CreatedAt.Unix(),
+			})
+			if err != nil {
+				m.logger.Error(err.Error())
+			}
+		})
+
+		m.lock.Lock()
+		m.removers = append(m.removers, remove)
+		m.lock.Unlock()
+
+		return otto.Value{}
+
+	})
+	if err != nil {
+		return err
+	}
+
+	return vm.Set("groupchat", groupObj)
+
+}
@@ -0,0 +1,157 @@
+package groupchat
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	log "github.com/op/go-logging"
+	otto "github.com/robertkrimen/otto"
+	require "github.com/stretchr/testify/require"
+	ed25519 "golang.org/x/crypto/ed25519"
+)
+
+func TestModule_SendMessage(t *testing.T) {
+
+	vm := otto.New()
+
+	groupID := make([]byte, 32)
+	_, err := rand.Read(groupID)
+	require.Nil(t, err)
+
+	sent := make(chan []byte, 1)
+	m := New(&testMessenger{
+		sendGroupMessage: func(id []byte, msg []byte) error {
+			require.Equal(t, groupID, id)
+			sent <- msg
+			return nil
+		},
+	}, &testPermissionChecker{granted: []string{Permission}}, log.MustGetLogger(""))
+	require.Nil(t, m.Register(vm))
+
+	groupObj, err := vm.Get("groupchat")
+	require.Nil(t, err)
+
+	called := make(chan struct{}, 1)
+	_, err = groupObj.Object().Call(
+		"sendMessage",
+		hex.EncodeToString(groupID),
+		base64.StdEncoding.EncodeToString([]byte("hi")),
+		func(call otto.FunctionCall) otto.Value {
+			if call.Argument(0).IsDefined() && !call.Argument(0).IsNull() {
+				require.Fail(t, call.Argument(0).String())
+			}
+			called <- struct{}{}
+			return otto.Value{}
+		},
+	)
+	require.Nil(t, err)
+
+	select {
+	case msg := <-sent:
+		require.Equal(t, []byte("hi"), msg)
+		<-called
+	case <-time.After(time.Second * 2):
+		require.FailNow(t, "timed out")
+	}
+
+}
+
+func TestModule_SendMessageInvalidGroupID(t *testing.T) {
+
+	vm := otto.New()
+
+	m := New(&testMessenger{}, &testPermissionChecker{granted: []string{Permission}}, log.MustGetLogger(""))
+	require.Nil(t, m.Register(vm))
+
+	groupObj, err := vm.Get("groupchat")
+	require.Nil(t, err)
+
+	called := make(chan string, 1)
+	_, err = groupObj.Object().Call(
+		"sendMessage",
+		"abcd",
+		base64.StdEncoding.EncodeToString([]byte("hi")),
+		func(call otto.FunctionCall) otto.Value {
+			called <- call.Argument(0).String()
+			return otto.Value{}
+		},
+	)
+	require.Nil(t, err)
+	require.Equal(t, "group id must be 32 bytes long", <-called)
+
+}
+
+func TestModule_OnMessage(t *testing.T) {
+
+	vm := otto.New()
+
+	groupID := make([]byte, 32)
+	_, err := rand.Read(groupID)
+	require.Nil(t, err)
+
+	sender, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+
+	var listener func(msg Message)
+	removed := false
+	m := New(&testMessenger{
+		onGroupMessage: func(id []byte, fn func(msg Message)) func() {
+			require.Equal(t, groupID, id)
+			listener = fn
+			return func() {
+				removed = true
+			}
+		},
+	}, &testPermissionChecker{granted: []string{Permission}}, log.MustGetLogger(""))
+	require.Nil(t, m.Register(vm))
+
+	groupObj, err := vm.Get("groupchat")
+	require.Nil(t, err)
+
+	received := make(chan *otto.Object, 1)
+	_, err = groupObj.Object().Call(
+		"onMessage",
+		hex.EncodeToString(groupID),
+		func(call otto.FunctionCall) otto.Value {
+			received <- call.Argument(0).Object()
+			return otto.Value{}
+		},
+	)
+	require.Nil(t, err)
+	require.NotNil(t, listener)
+
+	createdAt := time.Unix(1500000000, 0)
+	listener(Message{
+		Sender:    sender,
+		Message:   []byte("hi"),
+		CreatedAt: createdAt,
+	})
+
+	msg := <-received
+	senderHex, err := msg.Get("sender_hex")
+	require.Nil(t, err)
+	require.Equal(t, hex.EncodeToString(sender), senderHex.String())
+	message, err := msg.Get("message_b64")
+	require.Nil(t, err)
+	require.Equal(t, base64.StdEncoding.EncodeToString([]byte("hi")), message.String())
+	timestamp, err := msg.Get("timestamp")
+	require.Nil(t, err)
+	ts, err := timestamp.ToInteger()
+	require.Nil(t, err)
+	require.Equal(t, createdAt.Unix(), ts)
+
+	// listeners are removed on close
+	require.Nil(t, m.Close())
+	require.True(t, removed)
+
+}
+
+func TestModule_RegisterWithoutPermission(t *testing.T) {
+
+	m := New(&testMessenger{}, &testPermissionChecker{}, log.MustGetLogger(""))
+	require.EqualError(t, m.Register(otto.New()), "permission groupChat hasn't been granted")
+
+}
@@ -0,0 +1,27 @@
+package groupchat
+
+type testMessenger struct {
+	sendGroupMessage func(groupID []byte, msg []byte) error
+	onGroupMessage   func(groupID []byte, fn func(msg Message)) func()
+}
+
+func (m *testMessenger) SendGroupMessage(groupID []byte, msg []byte) error {
+	return m.sendGroupMessage(groupID, msg)
+}
+
+func (m *testMessenger) OnGroupMessage(groupID []byte, fn func(msg Message)) func() {
+	return m.onGroupMessage(groupID, fn)
+}
+
+type testPermissionChecker struct {
+	granted []string
+}
+
+func (c *testPermissionChecker) Granted(permission string) bool {
+	for _, g := range c.granted {
+		if g == permission {
+			return true
+		}
+	}
+	return false
+}
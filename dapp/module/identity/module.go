@@ -0,0 +1,223 @@
+package identity
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	module "github.com/Bit-Nation/panthalassa/dapp/module"
+	reqLim "github.com/Bit-Nation/panthalassa/dapp/request_limitation"
+	validator "github.com/Bit-Nation/panthalassa/dapp/validator"
+	keyManager "github.com/Bit-Nation/panthalassa/keyManager"
+	logger "github.com/op/go-logging"
+	otto "github.com/robertkrimen/otto"
+	ed25519 "golang.org/x/crypto/ed25519"
+)
+
+// DApps need this permission to use the module
+const Permission = "identitySigning"
+
+// time the user has to approve a signing request
+const approvalTimeout = time.Second * 60
+
+// amount of bytes shown to the user when asking for approval
+const dataPreviewLength = 32
+
+// asks the user to approve a signing request
+type Approver interface {
+	Request(name string, payload map[string]interface{}, timeout time.Duration) (map[string]interface{}, error)
+}
+
+// with this module a DApp can prove the identity of the user
+// every signature must be approved by the user
+type Module struct {
+	km         *keyManager.KeyManager
+	approver   Approver
+	dAppPubKey ed25519.PublicKey
+	checker    module.PermissionChecker
+	logger     *logger.Logger
+	throttling *reqLim.Throttling
+}
+
+func New(km *keyManager.KeyManager, approver Approver, dAppPubKey ed25519.PublicKey, checker module.PermissionChecker, l *logger.Logger) *Module {
+	return &Module{
+		km:         km,
+		approver:   approver,
+		dAppPubKey: dAppPubKey,
+		checker:    checker,
+		logger:     l,
+		throttling: reqLim.NewThrottling(6, time.Minute, 10, errors.New("can't add more signing requests to stack")),
+	}
+}
+
+func (m *Module) Close() error {
+	return m.throttling.Close()
+}
+
+// ask the user if the data may be signed
+func (m *Module) approved(data []byte) (bool, error) {
+
+	if m.approver == nil {
+		return false, errors.New("signing requests can't be approved")
+	}
+
+	preview := data
+	if len(preview) > dataPreviewLength {
+		preview = preview[:dataPreviewLength]
+	}
+
+	resp, err := m.approver.Request("DAPP:SIGN_REQUEST", map[string]interface{}{
+		"dapp_id":      hex.EncodeToString(m.dAppPubKey),
+		"data_preview": hex.EncodeToString(preview),
+	}, approvalTimeout)
+	if err != nil {
+		return false, err
+	}
+
+	approved, _ := resp["approved"].(bool)
+	return approved, nil
+
+}
+
+// identity.sign(dataHex, callback)
+// the callback is called with (error, signatureHex)
+// identity.verify(pubKeyHex, dataHex, signatureHex, callback)
+// the callback is called with (error, valid)
+func (m *Module) Register(vm *otto.Otto) error {
+
+	if m.checker == nil || !m.checker.Granted(Permission) {
+		return fmt.Errorf("permission %s hasn't been granted", Permission)
+	}
+
+	identityObj, err := vm.Object("({})")
+	if err != nil {
+		return err
+	}
+
+	err = identityObj.Set("sign", func(call otto.FunctionCall) otto.Value {
+
+		// validate function call
+		v := validator.New()
+		// hex encoded data
+		v.Set(0, &validator.TypeString)
+		// callback
+		v.Set(1, &validator.TypeFunction)
+		cb := call.Argument(1)
+
+		// utils to handle an occurred error
+		handleError := func(errMsg string) otto.Value {
+			if cb.IsFunction() {
+				if _, err := cb.Call(cb, errMsg); err != nil {
+					m.logger.Error(err.Error())
+				}
+				return otto.Value{}
+			}
+			m.logger.Error(errMsg)
+			return otto.Value{}
+		}
+		if err := v.Validate(vm, call); err != nil {
+			return handleError(err.String())
+		}
+
+		data, err := hex.DecodeString(call.Argument(0).String())
+		if err != nil {
+			return handleError(err.Error())
+		}
+
+		err = m.throttling.Exec(func() {
+
+			approved, err := m.approved(data)
+			if err != nil {
+				handleError(err.Error())
+				return
+			}
+			if !approved {
+				handleError("user rejected")
+				return
+			}
+
+			signature, err := m.km.IdentitySign(data)
+			if err != nil {
+				handleError(err.Error())
+				return
+			}
+
+			if _, err := cb.Call(cb, nil, hex.EncodeToString(signature)); err != nil {
+				m.logger.Error(err.Error())
+			}
+
+		})
+		if err != nil {
+			return handleError(err.Error())
+		}
+
+		return otto.Value{}
+
+	})
+	if err != nil {
+		return err
+	}
+
+	err = identityObj.Set("verify", func(call otto.FunctionCall) otto.Value {
+
+		// validate function call
+		v := validator.New()
+		// hex encoded public key
+		v.Set(0, &validator.TypeString)
+		// hex encoded data
+		v.Set(1, &validator.TypeString)
+		// hex encoded signature
+		v.Set(2, &validator.TypeString)
+		// callback
+		v.Set(3, &validator.TypeFunction)
+		cb := call.Argument(3)
+
+		// utils to handle an occurred error
+		handleError := func(errMsg string) otto.Value {
+			if cb.IsFunction() {
+				if _, err := cb.Call(cb, errMsg); err != nil {
+					m.logger.Error(err.Error())
+				}
+				return otto.Value{}
+			}
+			m.logger.Error(errMsg)
+			return otto.Value{}
+		}
+		if err := v.Validate(vm, call); err != nil {
+			return handleError(err.String())
+		}
+
+		pubKey, err := hex.DecodeString(call.Argument(0).String())
+		if err != nil {
+			return handleError(err.Error())
+		}
+		if len(pubKey) != ed25519.PublicKeySize {
+			return handleError("public key must be 32 bytes long")
+		}
+
+		data, err := hex.DecodeString(call.Argument(1).String())
+		if err != nil {
+			return handleError(err.Error())
+		}
+
+		signature, err := hex.DecodeString(call.Argument(2).String())
+		if err != nil {
+			return handleError(err.Error())
+		}
+
+		valid := ed25519.Verify(pubKey, data, signature)
+		if _, err := cb.Call(cb, nil, valid); err != nil {
+			m.logger.Error(err.Error())
+		}
+
+		return otto.Value{}
+
+	})
+	if err != nil {
+		return err
+	}
+
+	return vm.Set("identity", identityObj)
+
+}
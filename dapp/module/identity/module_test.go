@@ -0,0 +1,161 @@
+package identity
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	keyManager "github.com/Bit-Nation/panthalassa/keyManager"
+	keyStore "github.com/Bit-Nation/panthalassa/keyStore"
+	mnemonic "github.com/Bit-Nation/panthalassa/mnemonic"
+	log "github.com/op/go-logging"
+	otto "github.com/robertkrimen/otto"
+	require "github.com/stretchr/testify/require"
+	ed25519 "golang.org/x/crypto/ed25519"
+)
+
+type testApprover struct {
+	request func(name string, payload map[string]interface{}, timeout time.Duration) (map[string]interface{}, error)
+}
+
+func (a *testApprover) Request(name string, payload map[string]interface{}, timeout time.Duration) (map[string]interface{}, error) {
+	return a.request(name, payload, timeout)
+}
+
+type testPermissionChecker struct {
+	granted []string
+}
+
+func (c *testPermissionChecker) Granted(permission string) bool {
+	for _, g := range c.granted {
+		if g == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func createKeyManager() *keyManager.KeyManager {
+	mne, err := mnemonic.New()
+	if err != nil {
+		panic(err)
+	}
+	ks, err := keyStore.NewFromMnemonic(mne)
+	if err != nil {
+		panic(err)
+	}
+	km, err := keyManager.CreateFromKeyStore(ks)
+	if err != nil {
+		panic(err)
+	}
+	return km
+}
+
+func TestModule_RegisterWithoutPermission(t *testing.T) {
+
+	vm := otto.New()
+	m := New(createKeyManager(), nil, make(ed25519.PublicKey, 32), &testPermissionChecker{}, log.MustGetLogger(""))
+	require.EqualError(t, m.Register(vm), "permission identitySigning hasn't been granted")
+
+	identityObj, err := vm.Get("identity")
+	require.Nil(t, err)
+	require.True(t, identityObj.IsUndefined())
+
+}
+
+func sign(t *testing.T, approved bool) (string, string) {
+
+	vm := otto.New()
+	km := createKeyManager()
+	dAppPubKey := make(ed25519.PublicKey, 32)
+
+	m := New(km, &testApprover{
+		request: func(name string, payload map[string]interface{}, timeout time.Duration) (map[string]interface{}, error) {
+			require.Equal(t, "DAPP:SIGN_REQUEST", name)
+			require.Equal(t, hex.EncodeToString(dAppPubKey), payload["dapp_id"])
+			require.Equal(t, "0102", payload["data_preview"])
+			return map[string]interface{}{"approved": approved}, nil
+		},
+	}, dAppPubKey, &testPermissionChecker{granted: []string{Permission}}, log.MustGetLogger(""))
+	require.Nil(t, m.Register(vm))
+
+	identityObj, err := vm.Get("identity")
+	require.Nil(t, err)
+
+	type result struct {
+		err       string
+		signature string
+	}
+	called := make(chan result, 1)
+	_, err = identityObj.Object().Call("sign", "0102", func(call otto.FunctionCall) otto.Value {
+		r := result{}
+		if call.Argument(0).IsDefined() && !call.Argument(0).IsNull() {
+			r.err = call.Argument(0).String()
+		} else {
+			r.signature = call.Argument(1).String()
+		}
+		called <- r
+		return otto.Value{}
+	})
+	require.Nil(t, err)
+
+	select {
+	case r := <-called:
+		idKey, err := km.IdentityPublicKey()
+		require.Nil(t, err)
+		if r.err != "" {
+			return r.err, idKey
+		}
+		return r.signature, idKey
+	case <-time.After(time.Second * 5):
+		require.FailNow(t, "timed out")
+	}
+	return "", ""
+
+}
+
+func TestModule_SignApproved(t *testing.T) {
+
+	signature, idKey := sign(t, true)
+
+	rawSignature, err := hex.DecodeString(signature)
+	require.Nil(t, err)
+	rawIdKey, err := hex.DecodeString(idKey)
+	require.Nil(t, err)
+	require.True(t, ed25519.Verify(rawIdKey, []byte{1, 2}, rawSignature))
+
+}
+
+func TestModule_SignRejected(t *testing.T) {
+
+	errMsg, _ := sign(t, false)
+	require.Equal(t, "user rejected", errMsg)
+
+}
+
+func TestModule_Verify(t *testing.T) {
+
+	vm := otto.New()
+	km := createKeyManager()
+	m := New(km, nil, make(ed25519.PublicKey, 32), &testPermissionChecker{granted: []string{Permission}}, log.MustGetLogger(""))
+	require.Nil(t, m.Register(vm))
+
+	idKey, err := km.IdentityPublicKey()
+	require.Nil(t, err)
+	signature, err := km.IdentitySign([]byte{1, 2})
+	require.Nil(t, err)
+
+	identityObj, err := vm.Get("identity")
+	require.Nil(t, err)
+
+	valid := make(chan bool, 1)
+	_, err = identityObj.Object().Call("verify", idKey, "0102", hex.EncodeToString(signature), func(call otto.FunctionCall) otto.Value {
+		v, err := call.Argument(1).ToBoolean()
+		require.Nil(t, err)
+		valid <- v
+		return otto.Value{}
+	})
+	require.Nil(t, err)
+	require.True(t, <-valid)
+
+}
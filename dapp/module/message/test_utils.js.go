@@ -11,9 +11,12 @@ type testMessageStorage struct {
 	updateStatus           func(partner ed25519.PublicKey, msgID int64, newStatus db.Status) error
 	messages               func(partner ed25519.PublicKey, start int64, amount uint) ([]db.Message, error)
 	allChats               func() ([]ed25519.PublicKey, error)
-	addListener            func(fn func(e db.MessagePersistedEvent))
+	addListener            func(fn func(e db.MessagePersistedEvent)) func()
 	getMessage             func(partner ed25519.PublicKey, messageID int64) (*db.Message, error)
 	persistDAppMessage     func(partner ed25519.PublicKey, msg db.DAppMessage) error
+	getMessagesByStatus    func(partner ed25519.PublicKey, status db.Status) ([]db.Message, error)
+	deleteMessage          func(partner ed25519.PublicKey, dbID int64) error
+	deleteChat             func(partner ed25519.PublicKey) error
 }
 
 func (s *testMessageStorage) PersistMessageToSend(partner ed25519.PublicKey, msg db.Message) error {
@@ -36,8 +39,8 @@ func (s *testMessageStorage) AllChats() ([]ed25519.PublicKey, error) {
 	return s.allChats()
 }
 
-func (s *testMessageStorage) AddListener(fn func(e db.MessagePersistedEvent)) {
-	s.addListener(fn)
+func (s *testMessageStorage) AddListener(fn func(e db.MessagePersistedEvent)) func() {
+	return s.addListener(fn)
 }
 
 func (s *testMessageStorage) GetMessage(partner ed25519.PublicKey, messageID int64) (*db.Message, error) {
@@ -47,3 +50,15 @@ func (s *testMessageStorage) GetMessage(partner ed25519.PublicKey, messageID int
 func (s *testMessageStorage) PersistDAppMessage(partner ed25519.PublicKey, msg db.DAppMessage) error {
 	return s.persistDAppMessage(partner, msg)
 }
+
+func (s *testMessageStorage) GetMessagesByStatus(partner ed25519.PublicKey, status db.Status) ([]db.Message, error) {
+	return s.getMessagesByStatus(partner, status)
+}
+
+func (s *testMessageStorage) DeleteMessage(partner ed25519.PublicKey, dbID int64) error {
+	return s.deleteMessage(partner, dbID)
+}
+
+func (s *testMessageStorage) DeleteChat(partner ed25519.PublicKey) error {
+	return s.deleteChat(partner)
+}
@@ -8,3 +8,8 @@ type Module interface {
 	Register(vm *otto.Otto) error
 	Close() error
 }
+
+// reports if the user granted a permission to the DApp
+type PermissionChecker interface {
+	Granted(permission string) bool
+}
@@ -0,0 +1,106 @@
+package dapp
+
+import (
+	"fmt"
+	"strings"
+
+	bolt "github.com/coreos/bbolt"
+	ed25519 "golang.org/x/crypto/ed25519"
+)
+
+var dAppPermissionBucketName = []byte("dapp_permissions")
+
+// returned when the user didn't grant all permissions a DApp requires
+type ErrPermissionDenied struct {
+	Missing []string
+}
+
+func (e ErrPermissionDenied) Error() string {
+	return fmt.Sprintf("permissions not granted: %s", strings.Join(e.Missing, ", "))
+}
+
+// permissions the user granted to DApps
+type PermissionStorage interface {
+	Granted(signingKey ed25519.PublicKey) ([]string, error)
+	Grant(signingKey ed25519.PublicKey, permissions []string) error
+	Revoke(signingKey ed25519.PublicKey, permission string) error
+}
+
+type BoltPermissionStorage struct {
+	db *bolt.DB
+}
+
+func NewBoltPermissionStorage(db *bolt.DB) *BoltPermissionStorage {
+	return &BoltPermissionStorage{
+		db: db,
+	}
+}
+
+func (s *BoltPermissionStorage) Granted(signingKey ed25519.PublicKey) ([]string, error) {
+
+	granted := []string{}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+
+		permissionBucket := tx.Bucket(dAppPermissionBucketName)
+		if permissionBucket == nil {
+			return nil
+		}
+
+		dAppBucket := permissionBucket.Bucket(signingKey)
+		if dAppBucket == nil {
+			return nil
+		}
+
+		return dAppBucket.ForEach(func(permission, _ []byte) error {
+			granted = append(granted, string(permission))
+			return nil
+		})
+
+	})
+
+	return granted, err
+
+}
+
+func (s *BoltPermissionStorage) Grant(signingKey ed25519.PublicKey, permissions []string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+
+		permissionBucket, err := tx.CreateBucketIfNotExists(dAppPermissionBucketName)
+		if err != nil {
+			return err
+		}
+
+		dAppBucket, err := permissionBucket.CreateBucketIfNotExists(signingKey)
+		if err != nil {
+			return err
+		}
+
+		for _, permission := range permissions {
+			if err := dAppBucket.Put([]byte(permission), []byte{1}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+
+	})
+}
+
+func (s *BoltPermissionStorage) Revoke(signingKey ed25519.PublicKey, permission string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+
+		permissionBucket := tx.Bucket(dAppPermissionBucketName)
+		if permissionBucket == nil {
+			return nil
+		}
+
+		dAppBucket := permissionBucket.Bucket(signingKey)
+		if dAppBucket == nil {
+			return nil
+		}
+
+		return dAppBucket.Delete([]byte(permission))
+
+	})
+}
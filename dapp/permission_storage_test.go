@@ -0,0 +1,46 @@
+package dapp
+
+import (
+	"testing"
+
+	require "github.com/stretchr/testify/require"
+)
+
+func TestBoltPermissionStorage(t *testing.T) {
+
+	storage := NewBoltPermissionStorage(createDB())
+	signingKey := make([]byte, 32)
+
+	// nothing granted yet
+	granted, err := storage.Granted(signingKey)
+	require.Nil(t, err)
+	require.Len(t, granted, 0)
+
+	require.Nil(t, storage.Grant(signingKey, []string{"groupChat", "chat.send"}))
+	granted, err = storage.Granted(signingKey)
+	require.Nil(t, err)
+	require.Equal(t, []string{"chat.send", "groupChat"}, granted)
+
+	// other DApps don't get the permissions
+	otherKey := make([]byte, 32)
+	otherKey[0] = 1
+	granted, err = storage.Granted(otherKey)
+	require.Nil(t, err)
+	require.Len(t, granted, 0)
+
+	require.Nil(t, storage.Revoke(signingKey, "chat.send"))
+	granted, err = storage.Granted(signingKey)
+	require.Nil(t, err)
+	require.Equal(t, []string{"groupChat"}, granted)
+
+}
+
+func TestData_MissingPermissions(t *testing.T) {
+
+	d := Data{
+		Permissions: []string{"chat.send", "groupChat"},
+	}
+	require.Equal(t, []string{"groupChat"}, d.MissingPermissions([]string{"chat.send"}))
+	require.Equal(t, []string{}, d.MissingPermissions([]string{"groupChat", "chat.send"}))
+
+}
@@ -7,12 +7,17 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	api "github.com/Bit-Nation/panthalassa/api"
 	dapp "github.com/Bit-Nation/panthalassa/dapp"
 	module "github.com/Bit-Nation/panthalassa/dapp/module"
+	chatMod "github.com/Bit-Nation/panthalassa/dapp/module/chat"
 	ethAddrMod "github.com/Bit-Nation/panthalassa/dapp/module/ethAddress"
+	groupChatMod "github.com/Bit-Nation/panthalassa/dapp/module/groupchat"
+	identityMod "github.com/Bit-Nation/panthalassa/dapp/module/identity"
 	loggerMod "github.com/Bit-Nation/panthalassa/dapp/module/logger"
 	messageModule "github.com/Bit-Nation/panthalassa/dapp/module/message"
 	modalMod "github.com/Bit-Nation/panthalassa/dapp/module/modal"
@@ -23,6 +28,7 @@ import (
 	uuidv4Mod "github.com/Bit-Nation/panthalassa/dapp/module/uuidv4"
 	db "github.com/Bit-Nation/panthalassa/db"
 	keyManager "github.com/Bit-Nation/panthalassa/keyManager"
+	uiapi "github.com/Bit-Nation/panthalassa/uiapi"
 	bolt "github.com/coreos/bbolt"
 	log "github.com/ipfs/go-log"
 	host "github.com/libp2p/go-libp2p-host"
@@ -64,10 +70,84 @@ type Registry struct {
 	fetchDAppChan      chan fetchDAppChanStr
 	addDevStreamChan   chan addDevStreamChanStr
 	fetchDevStreamChan chan fetchDAppStreamStr
+	countDAppsChan     chan chan int
+	allDAppsChan       chan chan []*dapp.DApp
+	renderCache        *renderCache
+	// 1 once we connected to a development server
+	devMode int32
 }
 
 type Config struct {
 	EthWSEndpoint string
+	// locale of the user used to pick the DApp name
+	Locale string
+	// used to ask the user for approvals
+	UiApi *uiapi.Api
+	// group messaging for DApps with the group chat permission
+	GroupChat groupChatMod.Messenger
+	// permissions the user granted to DApps
+	PermissionStorage dapp.PermissionStorage
+}
+
+// time the user has to grant the permissions of a DApp
+const permissionApprovalTimeout = time.Second * 60
+
+// permissions the user granted to a DApp
+type grantedPermissions []string
+
+func (p grantedPermissions) Granted(permission string) bool {
+	for _, g := range p {
+		if g == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// make sure the user granted all permissions the DApp requires
+// the user is asked for the permissions that haven't been granted yet
+func (r *Registry) grantPermissions(dApp *dapp.Data) (grantedPermissions, error) {
+
+	if len(dApp.Permissions) == 0 {
+		return grantedPermissions{}, nil
+	}
+
+	if r.conf.PermissionStorage == nil {
+		return nil, dapp.ErrPermissionDenied{Missing: dApp.Permissions}
+	}
+
+	granted, err := r.conf.PermissionStorage.Granted(dApp.UsedSigningKey)
+	if err != nil {
+		return nil, err
+	}
+
+	missing := dApp.MissingPermissions(granted)
+	if len(missing) == 0 {
+		return granted, nil
+	}
+
+	// permissions can't be granted without the ui api
+	if r.conf.UiApi == nil {
+		return nil, dapp.ErrPermissionDenied{Missing: missing}
+	}
+
+	resp, err := r.conf.UiApi.Request("DAPP:PERMISSION_REQUEST", map[string]interface{}{
+		"dapp_id":     hex.EncodeToString(dApp.UsedSigningKey),
+		"permissions": missing,
+	}, permissionApprovalTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if approved, _ := resp["approved"].(bool); !approved {
+		return nil, dapp.ErrPermissionDenied{Missing: missing}
+	}
+
+	if err := r.conf.PermissionStorage.Grant(dApp.UsedSigningKey, missing); err != nil {
+		return nil, err
+	}
+
+	return append(granted, missing...), nil
+
 }
 
 // create new dApp registry
@@ -86,6 +166,9 @@ func NewDAppRegistry(h host.Host, conf Config, api *api.API, km *keyManager.KeyM
 		fetchDAppChan:      make(chan fetchDAppChanStr),
 		addDevStreamChan:   make(chan addDevStreamChanStr),
 		fetchDevStreamChan: make(chan fetchDAppStreamStr),
+		countDAppsChan:     make(chan chan int),
+		allDAppsChan:       make(chan chan []*dapp.DApp),
+		renderCache:        newRenderCache(renderCacheSize, renderCacheTTL),
 	}
 
 	// load all default DApps
@@ -98,8 +181,14 @@ func NewDAppRegistry(h host.Host, conf Config, api *api.API, km *keyManager.KeyM
 		if err != nil {
 			return nil, err
 		}
+		// default DApps are saved on every start
+		// a newer installed version is kept
 		if err := dAppDB.SaveDApp(dApp); err != nil {
-			return nil, err
+			switch err.(type) {
+			case dapp.ErrDAppAlreadyInstalled, dapp.ErrDAppDowngrade:
+			default:
+				return nil, err
+			}
 		}
 	}
 
@@ -136,6 +225,16 @@ func NewDAppRegistry(h host.Host, conf Config, api *api.API, km *keyManager.KeyM
 				fetchDevStream.respChan <- stream
 			case dApp := <-r.addDAppChan:
 				dAppInstances[dApp.ID()] = dApp
+			// count running DApps
+			case countResp := <-r.countDAppsChan:
+				countResp <- len(dAppInstances)
+			// fetch all running DApps
+			case allResp := <-r.allDAppsChan:
+				dApps := []*dapp.DApp{}
+				for _, dApp := range dAppInstances {
+					dApps = append(dApps, dApp)
+				}
+				allResp <- dApps
 			}
 		}
 	}()
@@ -156,12 +255,21 @@ func (r *Registry) StartDApp(dAppSigningKey ed25519.PublicKey, timeOut time.Dura
 		return fmt.Errorf("failed to fetch DApp for signing key: %x", dAppSigningKey)
 	}
 
+	// the DApp must not run without the permissions it requires
+	granted, err := r.grantPermissions(dApp)
+	if err != nil {
+		return err
+	}
+
 	// get logger
 	var l *golog.Logger
 	if l, err = golog.GetLogger("app name"); err != nil {
 		return err
 	}
 
+	// modules every DApp gets
+	// the bundled default DApps (dapps.go) are signed without
+	// permissions and rely on them
 	vmModules := []module.Module{
 		uuidv4Mod.New(l),
 		modalMod.New(l, r.api, dApp.UsedSigningKey),
@@ -173,6 +281,26 @@ func (r *Registry) StartDApp(dAppSigningKey ed25519.PublicKey, timeOut time.Dura
 		messageModule.New(r.msgDB, dAppSigningKey, l),
 	}
 
+	// sending chat messages is only available to DApps that require it
+	if granted.Granted(chatMod.Permission) {
+		vmModules = append(vmModules, chatMod.New(r.msgDB, dAppSigningKey, granted, l))
+	}
+
+	// signing with the identity key is only available to DApps that require it
+	if granted.Granted(identityMod.Permission) {
+		// signing requests can't be approved without the ui api
+		var signApprover identityMod.Approver
+		if r.conf.UiApi != nil {
+			signApprover = r.conf.UiApi
+		}
+		vmModules = append(vmModules, identityMod.New(r.km, signApprover, dAppSigningKey, granted, l))
+	}
+
+	// group chat is only available to DApps that require it
+	if r.conf.GroupChat != nil && granted.Granted(groupChatMod.Permission) {
+		vmModules = append(vmModules, groupChatMod.New(r.conf.GroupChat, granted, l))
+	}
+
 	// if there is a stream for this DApp
 	// we would like to mutate the logger
 	// to write to the stream we have for development
@@ -198,7 +326,10 @@ func (r *Registry) StartDApp(dAppSigningKey ed25519.PublicKey, timeOut time.Dura
 		l.SetBackend(golog.AddModuleLevel(golog.NewLogBackend(ioutil.Discard, "", 0)))
 	}
 
-	app, err := dapp.New(l, dApp, vmModules, r.closeChan, timeOut, r.db)
+	app, err := dapp.New(l, dApp, vmModules, r.closeChan, timeOut, r.db, dapp.DAppConfig{
+		Locale:  r.conf.Locale,
+		DevMode: atomic.LoadInt32(&r.devMode) == 1,
+	})
 	if err != nil {
 		l.Error(err.Error())
 		return err
@@ -237,11 +368,30 @@ func (r *Registry) OpenDApp(signingKey ed25519.PublicKey, context string) error
 }
 
 func (r *Registry) RenderMessage(signingKey ed25519.PublicKey, payload string) (string, error) {
+
+	// cached messages don't need the vm
+	if rendered, exist := r.renderCache.get(signingKey, payload); exist {
+		return rendered, nil
+	}
+
 	dApp := r.fetchDApp(signingKey)
 	if dApp == nil {
 		return "", errors.New("it seems like that this app hasn't been started yet")
 	}
-	return dApp.RenderMessage(payload)
+
+	rendered, err := dApp.RenderMessage(payload)
+	if err != nil {
+		return "", err
+	}
+	r.renderCache.put(signingKey, payload, rendered)
+
+	return rendered, nil
+}
+
+// remove the cached rendered messages of a DApp
+func (r *Registry) ClearRenderCache(signingKey ed25519.PublicKey) error {
+	r.renderCache.clear(signingKey)
+	return nil
 }
 
 // use this to connect to a development server
@@ -264,19 +414,107 @@ func (r *Registry) ConnectDevelopmentServer(addr ma.Multiaddr) error {
 		return err
 	}
 
+	// DApps started from now on run in development mode too
+	// (DApps must be in development mode before we receive updates)
+	atomic.StoreInt32(&r.devMode, 1)
+	for _, dApp := range r.runningDApps() {
+		dApp.EnableDevMode()
+	}
+
 	// handle stream
-	r.devStreamHandler(str)
+	return r.devStreamHandler(str)
+}
 
-	return nil
+// run a script in a DApp started in development mode
+func (r *Registry) ExecuteScript(signingKey ed25519.PublicKey, script string) (string, error) {
+	dApp := r.fetchDApp(signingKey)
+	if dApp == nil {
+		return "", errors.New("it seems like that this app hasn't been started yet")
+	}
+	return dApp.ExecuteScript(script)
 }
 
 // call a function in a DApp
-func (r *Registry) CallFunction(signingKey ed25519.PublicKey, funcId uint, args string) error {
+func (r *Registry) CallFunction(signingKey ed25519.PublicKey, funcId uint, args string, timeout time.Duration) error {
 	dApp := r.fetchDApp(signingKey)
 	if dApp == nil {
 		return errors.New("it seems like that this app hasn't been started yet")
 	}
-	return dApp.CallFunction(funcId, args)
+	return dApp.CallFunction(funcId, args, timeout)
+}
+
+// amount of currently running DApps
+func (r *Registry) RunningDApps() int {
+	respChan := make(chan int)
+	r.countDAppsChan <- respChan
+	return <-respChan
+}
+
+// fetch all running DApps
+func (r *Registry) runningDApps() []*dapp.DApp {
+	respChan := make(chan []*dapp.DApp)
+	r.allDAppsChan <- respChan
+	return <-respChan
+}
+
+// pause all running DApps (e.g. when the app goes to background)
+func (r *Registry) PauseAll() {
+	for _, dApp := range r.runningDApps() {
+		dApp.Pause()
+	}
+}
+
+// resume all paused DApps
+func (r *Registry) ResumeAll() {
+	for _, dApp := range r.runningDApps() {
+		dApp.Resume()
+	}
+}
+
+// shut down all running DApps and wait till they are closed
+// or the context is done
+func (r *Registry) Shutdown(ctx context.Context) error {
+
+	dApps := r.runningDApps()
+	for _, dApp := range dApps {
+		// a paused DApp that is executing JavaScript
+		// would never handle the close. Idle DApps are closed right away.
+		dApp.Resume()
+		dApp.Close()
+	}
+
+	// wait for the DApps to be removed from the state
+	pending := dApps
+	for {
+		stillRunning := []*dapp.DApp{}
+		for _, dApp := range pending {
+			signingKey, err := hex.DecodeString(dApp.ID())
+			if err != nil {
+				return err
+			}
+			if r.fetchDApp(signingKey) != nil {
+				stillRunning = append(stillRunning, dApp)
+				continue
+			}
+			r.ClearRenderCache(signingKey)
+		}
+		pending = stillRunning
+
+		if len(pending) == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			ids := []string{}
+			for _, dApp := range pending {
+				ids = append(ids, dApp.ID())
+			}
+			return fmt.Errorf("failed to shut down DApps: %s (%s)", strings.Join(ids, ", "), ctx.Err())
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+
 }
 
 func (r *Registry) ShutDown(signingKey ed25519.PublicKey) error {
@@ -285,5 +523,5 @@ func (r *Registry) ShutDown(signingKey ed25519.PublicKey) error {
 		return errors.New("it seems like that this app hasn't been started yet")
 	}
 	dApp.Close()
-	return nil
+	return r.ClearRenderCache(signingKey)
 }
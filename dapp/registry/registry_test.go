@@ -1,15 +1,21 @@
 package registry
 
 import (
+	"context"
+	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
 	"testing"
 	"time"
 
 	dapp "github.com/Bit-Nation/panthalassa/dapp"
+	chatMod "github.com/Bit-Nation/panthalassa/dapp/module/chat"
+	groupChatMod "github.com/Bit-Nation/panthalassa/dapp/module/groupchat"
+	identityMod "github.com/Bit-Nation/panthalassa/dapp/module/identity"
 	keyManager "github.com/Bit-Nation/panthalassa/keyManager"
 	keyStore "github.com/Bit-Nation/panthalassa/keyStore"
 	mnemonic "github.com/Bit-Nation/panthalassa/mnemonic"
+	uiapi "github.com/Bit-Nation/panthalassa/uiapi"
 	require "github.com/stretchr/testify/require"
 	ed25519 "golang.org/x/crypto/ed25519"
 )
@@ -18,22 +24,49 @@ const testDApp = `{"name":{"en-us":"DApp Name"},"engine":"0.1.0","image":"aW1hZ2
 
 type memDAppStorage struct {
 	saveDApp func(dApp dapp.Data) error
-	all      func() ([]*dapp.Data, error)
-	get      func(signingKey ed25519.PublicKey) (*dapp.Data, error)
+	// optional, saveDApp is used if not set
+	saveDevDApp func(dApp dapp.Data) error
+	all         func() ([]*dapp.Data, error)
+	get         func(signingKey ed25519.PublicKey) (*dapp.Data, error)
 }
 
 func (s *memDAppStorage) SaveDApp(dApp dapp.Data) error {
 	return s.saveDApp(dApp)
 }
 
+func (s *memDAppStorage) SaveDevDApp(dApp dapp.Data) error {
+	if s.saveDevDApp != nil {
+		return s.saveDevDApp(dApp)
+	}
+	return s.saveDApp(dApp)
+}
+
 func (s *memDAppStorage) All() ([]*dapp.Data, error) {
 	return s.all()
 }
 
+func (s *memDAppStorage) AllSortedByInstallTime() ([]*dapp.Data, error) {
+	return s.all()
+}
+
 func (s *memDAppStorage) Get(signingKey ed25519.PublicKey) (*dapp.Data, error) {
 	return s.get(signingKey)
 }
 
+func (s *memDAppStorage) FindByPermission(permission string) ([]*dapp.Data, error) {
+	dApps, err := s.all()
+	if err != nil {
+		return nil, err
+	}
+	found := []*dapp.Data{}
+	for _, d := range dApps {
+		if d.HasPermission(permission) {
+			found = append(found, d)
+		}
+	}
+	return found, nil
+}
+
 func TestRegistry_StartDApp(t *testing.T) {
 
 	// signing key
@@ -45,7 +78,8 @@ func TestRegistry_StartDApp(t *testing.T) {
 	require.Nil(t, err)
 	ks, err := keyStore.NewFromMnemonic(mne)
 	require.Nil(t, err)
-	km := keyManager.CreateFromKeyStore(ks)
+	km, err := keyManager.CreateFromKeyStore(ks)
+	require.Nil(t, err)
 
 	dAppStorage := memDAppStorage{
 		get: func(signingKey ed25519.PublicKey) (*dapp.Data, error) {
@@ -64,3 +98,287 @@ func TestRegistry_StartDApp(t *testing.T) {
 	require.Nil(t, reg.StartDApp(signingKey, time.Second*2))
 
 }
+
+func TestRegistry_ShutdownWithoutDApps(t *testing.T) {
+
+	// key manager
+	mne, err := mnemonic.New()
+	require.Nil(t, err)
+	ks, err := keyStore.NewFromMnemonic(mne)
+	require.Nil(t, err)
+	km, err := keyManager.CreateFromKeyStore(ks)
+	require.Nil(t, err)
+
+	dAppStorage := memDAppStorage{
+		saveDApp: func(dApp dapp.Data) error {
+			return nil
+		},
+	}
+
+	reg, err := NewDAppRegistry(nil, Config{}, nil, km, &dAppStorage, nil, nil)
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.Nil(t, reg.Shutdown(ctx))
+	require.Equal(t, 0, reg.RunningDApps())
+
+}
+
+func TestRegistry_ShutdownIdleDApp(t *testing.T) {
+
+	// signing key
+	signingKey, err := hex.DecodeString("ff1fd817be47bfe6d3e055dcbe62447069b86c698132e782bbba2e70124b5448")
+	require.Nil(t, err)
+
+	// key manager
+	mne, err := mnemonic.New()
+	require.Nil(t, err)
+	ks, err := keyStore.NewFromMnemonic(mne)
+	require.Nil(t, err)
+	km, err := keyManager.CreateFromKeyStore(ks)
+	require.Nil(t, err)
+
+	dAppStorage := memDAppStorage{
+		get: func(signingKey ed25519.PublicKey) (*dapp.Data, error) {
+			rawDApp := dapp.RawData{}
+			require.Nil(t, json.Unmarshal([]byte(testDApp), &rawDApp))
+			dAppData, err := dapp.ParseJsonToData(rawDApp)
+			return &dAppData, err
+		},
+		saveDApp: func(dApp dapp.Data) error {
+			return nil
+		},
+	}
+
+	reg, err := NewDAppRegistry(nil, Config{}, nil, km, &dAppStorage, nil, nil)
+	require.Nil(t, err)
+	require.Nil(t, reg.StartDApp(signingKey, time.Second*2))
+
+	// the idle vm never takes the pause interrupt
+	reg.PauseAll()
+	reg.ResumeAll()
+	reg.PauseAll()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.Nil(t, reg.Shutdown(ctx))
+	require.Equal(t, 0, reg.RunningDApps())
+
+}
+
+type testPermissionStorage struct {
+	granted []string
+}
+
+func (s *testPermissionStorage) Granted(signingKey ed25519.PublicKey) ([]string, error) {
+	return s.granted, nil
+}
+
+func (s *testPermissionStorage) Grant(signingKey ed25519.PublicKey, permissions []string) error {
+	s.granted = append(s.granted, permissions...)
+	return nil
+}
+
+func (s *testPermissionStorage) Revoke(signingKey ed25519.PublicKey, permission string) error {
+	return nil
+}
+
+type testUpstream struct {
+	send func(data string)
+}
+
+func (u *testUpstream) Send(data string) {
+	u.send(data)
+}
+
+// ui api that answers permission requests
+func permissionUiApi(approve bool) *uiapi.Api {
+	var api *uiapi.Api
+	api = uiapi.New(&testUpstream{
+		send: func(data string) {
+			call := struct {
+				Payload map[string]interface{} `json:"payload"`
+			}{}
+			if err := json.Unmarshal([]byte(data), &call); err != nil {
+				panic(err)
+			}
+			go api.Receive(call.Payload["request_id"].(string), map[string]interface{}{
+				"approved": approve,
+			})
+		},
+	})
+	return api
+}
+
+func TestRegistry_StartDAppWithoutPermission(t *testing.T) {
+
+	// key manager
+	mne, err := mnemonic.New()
+	require.Nil(t, err)
+	ks, err := keyStore.NewFromMnemonic(mne)
+	require.Nil(t, err)
+	km, err := keyManager.CreateFromKeyStore(ks)
+	require.Nil(t, err)
+
+	signingKey := make([]byte, 32)
+	dAppStorage := memDAppStorage{
+		get: func(signingKey ed25519.PublicKey) (*dapp.Data, error) {
+			// the code would fail if it got executed
+			return &dapp.Data{
+				UsedSigningKey: signingKey,
+				Code:           []byte("throw new Error('executed')"),
+				Permissions:    []string{"groupChat"},
+			}, nil
+		},
+		saveDApp: func(dApp dapp.Data) error {
+			return nil
+		},
+	}
+
+	permissions := &testPermissionStorage{}
+	reg, err := NewDAppRegistry(nil, Config{
+		PermissionStorage: permissions,
+		UiApi:             permissionUiApi(false),
+	}, nil, km, &dAppStorage, nil, nil)
+	require.Nil(t, err)
+
+	// the user denied the permission
+	require.Equal(t, dapp.ErrPermissionDenied{
+		Missing: []string{"groupChat"},
+	}, reg.StartDApp(signingKey, time.Second*2))
+	require.Equal(t, 0, reg.RunningDApps())
+	require.Len(t, permissions.granted, 0)
+
+	// the ui api is required to ask for the permission
+	reg.conf.UiApi = nil
+	require.Equal(t, dapp.ErrPermissionDenied{
+		Missing: []string{"groupChat"},
+	}, reg.StartDApp(signingKey, time.Second*2))
+	require.Equal(t, 0, reg.RunningDApps())
+
+}
+
+// DApp signed with a new signing key
+func signedTestDApp(t *testing.T, code string, permissions []string) *dapp.Data {
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+
+	dApp := &dapp.Data{
+		Name:           map[string]string{"en-us": "DApp Name"},
+		UsedSigningKey: pub,
+		Code:           []byte(code),
+		Engine:         dapp.SV{Minor: 1},
+		Version:        1,
+		Permissions:    permissions,
+	}
+	hash, err := dApp.Hash()
+	require.Nil(t, err)
+	dApp.Signature = ed25519.Sign(priv, hash)
+
+	return dApp
+
+}
+
+// start the DApp with the granted permissions
+// the DApp code must throw to fail the start
+func startTestDApp(t *testing.T, dApp *dapp.Data, granted []string) error {
+
+	mne, err := mnemonic.New()
+	require.Nil(t, err)
+	ks, err := keyStore.NewFromMnemonic(mne)
+	require.Nil(t, err)
+	km, err := keyManager.CreateFromKeyStore(ks)
+	require.Nil(t, err)
+
+	dAppStorage := memDAppStorage{
+		get: func(signingKey ed25519.PublicKey) (*dapp.Data, error) {
+			return dApp, nil
+		},
+		saveDApp: func(dApp dapp.Data) error {
+			return nil
+		},
+	}
+
+	reg, err := NewDAppRegistry(nil, Config{
+		GroupChat:         &nopMessenger{},
+		PermissionStorage: &testPermissionStorage{granted: granted},
+	}, nil, km, &dAppStorage, nil, nil)
+	require.Nil(t, err)
+
+	return reg.StartDApp(dApp.UsedSigningKey, time.Second*2)
+
+}
+
+func TestRegistry_StartDAppIdentityWithoutPermission(t *testing.T) {
+
+	dApp := signedTestDApp(t, `if (typeof identity !== "undefined") { throw new Error("identity is available") }`, nil)
+	require.Nil(t, startTestDApp(t, dApp, nil))
+
+}
+
+func TestRegistry_StartDAppIdentityWithPermission(t *testing.T) {
+
+	dApp := signedTestDApp(t, `if (typeof identity === "undefined") { throw new Error("identity is missing") }`, []string{identityMod.Permission})
+	require.Nil(t, startTestDApp(t, dApp, []string{identityMod.Permission}))
+
+}
+
+type nopMessenger struct{}
+
+func (m *nopMessenger) SendGroupMessage(groupID []byte, msg []byte) error {
+	return nil
+}
+
+func (m *nopMessenger) OnGroupMessage(groupID []byte, fn func(msg groupChatMod.Message)) func() {
+	return func() {}
+}
+
+// the privileged modules are only registered for DApps
+// the user granted the matching permission
+func TestRegistry_StartDAppPrivilegedModules(t *testing.T) {
+
+	privileged := []string{chatMod.Permission, identityMod.Permission, groupChatMod.Permission}
+
+	require.Nil(t, startTestDApp(t, signedTestDApp(t, `
+		if (typeof chat !== "undefined") { throw new Error("chat is available") }
+		if (typeof identity !== "undefined") { throw new Error("identity is available") }
+		if (typeof groupchat !== "undefined") { throw new Error("groupchat is available") }
+	`, nil), nil))
+
+	require.Nil(t, startTestDApp(t, signedTestDApp(t, `
+		if (typeof chat === "undefined") { throw new Error("chat is missing") }
+		if (typeof identity === "undefined") { throw new Error("identity is missing") }
+		if (typeof groupchat === "undefined") { throw new Error("groupchat is missing") }
+	`, privileged), privileged))
+
+}
+
+func TestRegistry_grantPermissions(t *testing.T) {
+
+	permissions := &testPermissionStorage{
+		granted: []string{"chat.send"},
+	}
+	reg := &Registry{
+		conf: Config{
+			PermissionStorage: permissions,
+			UiApi:             permissionUiApi(true),
+		},
+	}
+
+	dApp := &dapp.Data{
+		UsedSigningKey: make([]byte, 32),
+		Permissions:    []string{"chat.send", "groupChat"},
+	}
+
+	granted, err := reg.grantPermissions(dApp)
+	require.Nil(t, err)
+	require.True(t, granted.Granted("chat.send"))
+	require.True(t, granted.Granted("groupChat"))
+	require.False(t, granted.Granted("eth.sign"))
+
+	// the granted permission got persisted
+	require.Equal(t, []string{"chat.send", "groupChat"}, permissions.granted)
+
+}
@@ -0,0 +1,116 @@
+package registry
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+const (
+	renderCacheSize = 256
+	renderCacheTTL  = time.Second * 60
+)
+
+type renderCacheEntry struct {
+	key        [32]byte
+	signingKey string
+	result     string
+	createdAt  time.Time
+}
+
+// least recently used cache for rendered DApp messages
+type renderCache struct {
+	lock    sync.Mutex
+	entries map[[32]byte]*list.Element
+	order   *list.List
+	size    int
+	ttl     time.Duration
+	now     func() time.Time
+}
+
+func newRenderCache(size int, ttl time.Duration) *renderCache {
+	return &renderCache{
+		entries: map[[32]byte]*list.Element{},
+		order:   list.New(),
+		size:    size,
+		ttl:     ttl,
+		now:     time.Now,
+	}
+}
+
+// cache key of a message that is rendered by a DApp
+func renderCacheKey(signingKey []byte, payload string) [32]byte {
+	h := sha256.New()
+	h.Write(signingKey)
+	h.Write([]byte(payload))
+	var key [32]byte
+	copy(key[:], h.Sum(nil))
+	return key
+}
+
+func (c *renderCache) get(signingKey []byte, payload string) (string, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	elem, exist := c.entries[renderCacheKey(signingKey, payload)]
+	if !exist {
+		return "", false
+	}
+
+	// remove expired entry
+	entry := elem.Value.(*renderCacheEntry)
+	if c.now().Sub(entry.createdAt) > c.ttl {
+		c.order.Remove(elem)
+		delete(c.entries, entry.key)
+		return "", false
+	}
+
+	c.order.MoveToFront(elem)
+	return entry.result, true
+}
+
+func (c *renderCache) put(signingKey []byte, payload, result string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	key := renderCacheKey(signingKey, payload)
+
+	// update existing entry
+	if elem, exist := c.entries[key]; exist {
+		entry := elem.Value.(*renderCacheEntry)
+		entry.result = result
+		entry.createdAt = c.now()
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&renderCacheEntry{
+		key:        key,
+		signingKey: hex.EncodeToString(signingKey),
+		result:     result,
+		createdAt:  c.now(),
+	})
+
+	// evict least recently used entry
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*renderCacheEntry).key)
+	}
+}
+
+// remove all cached messages of a DApp
+func (c *renderCache) clear(signingKey []byte) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	signingKeyStr := hex.EncodeToString(signingKey)
+	for key, elem := range c.entries {
+		if elem.Value.(*renderCacheEntry).signingKey == signingKeyStr {
+			c.order.Remove(elem)
+			delete(c.entries, key)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package registry
+
+import (
+	"testing"
+	"time"
+
+	require "github.com/stretchr/testify/require"
+)
+
+func TestRenderCache(t *testing.T) {
+
+	c := newRenderCache(2, time.Minute)
+
+	c.put([]byte("dapp"), "msg one", "one")
+	c.put([]byte("dapp"), "msg two", "two")
+
+	res, exist := c.get([]byte("dapp"), "msg one")
+	require.True(t, exist)
+	require.Equal(t, "one", res)
+
+	// msg two is the least recently used entry
+	c.put([]byte("dapp"), "msg three", "three")
+	_, exist = c.get([]byte("dapp"), "msg two")
+	require.False(t, exist)
+
+	// same message rendered by another DApp
+	_, exist = c.get([]byte("other dapp"), "msg one")
+	require.False(t, exist)
+
+	// clear cache of DApp
+	c.clear([]byte("dapp"))
+	_, exist = c.get([]byte("dapp"), "msg one")
+	require.False(t, exist)
+
+}
+
+func TestRenderCacheExpired(t *testing.T) {
+
+	c := newRenderCache(2, time.Minute)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	c.put([]byte("dapp"), "msg", "rendered")
+
+	now = now.Add(time.Minute * 2)
+	_, exist := c.get([]byte("dapp"), "msg")
+	require.False(t, exist)
+
+}
@@ -10,10 +10,47 @@ import (
 	net "github.com/libp2p/go-libp2p-net"
 )
 
+const (
+	// sent to the development server after connecting
+	// with the message types we understand
+	devCapabilitiesMessageType = "CAPABILITIES"
+	// updated DApp that is reloaded in case it's running
+	devDAppUpdateMessageType = "DAPP_UPDATE"
+)
+
+// message of the development protocol. Messages without
+// a type are DApps (the format used before message types were added)
+type devMessage struct {
+	Type         string        `json:"type"`
+	MessageTypes []string      `json:"message_types,omitempty"`
+	DApp         *dapp.RawData `json:"dapp,omitempty"`
+}
+
+// write base64 encoded json message terminated by a new line
+func writeDevMessage(str net.Stream, msg devMessage) error {
+	rawMsg, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = str.Write(append([]byte(base64.StdEncoding.EncodeToString(rawMsg)), 0x0A))
+	return err
+}
+
 // this stream handler is used for development purpose
 // when we receive a DApp we will send it to the client
 // the client will then decide what to do with it.
-func (r *Registry) devStreamHandler(str net.Stream) {
+// Running DApps are reloaded when we receive an update for them.
+func (r *Registry) devStreamHandler(str net.Stream) error {
+
+	// negotiate the message types with the development server
+	err := writeDevMessage(str, devMessage{
+		Type:         devCapabilitiesMessageType,
+		MessageTypes: []string{devDAppUpdateMessageType},
+	})
+	if err != nil {
+		str.Reset()
+		return err
+	}
 
 	go func() {
 
@@ -21,8 +58,8 @@ func (r *Registry) devStreamHandler(str net.Stream) {
 
 		for {
 
-			// read DApp from stream
-			jsonDAppBytes, err := reader.ReadBytes(0x0A)
+			// read message from stream
+			rawMsgBytes, err := reader.ReadBytes(0x0A)
 			if err != nil {
 				logger.Error(err)
 				if err == io.EOF {
@@ -34,16 +71,34 @@ func (r *Registry) devStreamHandler(str net.Stream) {
 			}
 
 			// decode base64 json
-			rawJsonDApp, err := base64.StdEncoding.DecodeString(string(jsonDAppBytes))
+			rawMsg, err := base64.StdEncoding.DecodeString(string(rawMsgBytes))
 			if err != nil {
 				logger.Error(err)
 				continue
 			}
 
+			msg := devMessage{}
+			if err := json.Unmarshal(rawMsg, &msg); err != nil {
+				logger.Error(err)
+				continue
+			}
+
 			// unmarshal DApp data
 			rawDAppData := dapp.RawData{}
-			if err := json.Unmarshal(rawJsonDApp, &rawDAppData); err != nil {
-				logger.Error(err)
+			switch msg.Type {
+			case "":
+				if err := json.Unmarshal(rawMsg, &rawDAppData); err != nil {
+					logger.Error(err)
+					continue
+				}
+			case devDAppUpdateMessageType:
+				if msg.DApp == nil {
+					logger.Error("received DApp update without DApp")
+					continue
+				}
+				rawDAppData = *msg.DApp
+			default:
+				logger.Error("received message of unknown type: ", msg.Type)
 				continue
 			}
 
@@ -71,13 +126,37 @@ func (r *Registry) devStreamHandler(str net.Stream) {
 				continue
 			}
 
-			// persist received app
-			if err := r.dAppDB.SaveDApp(dAppData); err != nil {
+			// persist received app - the development server
+			// may push the same version again after a change
+			if err := r.dAppDB.SaveDevDApp(dAppData); err != nil {
+				logger.Error("failed to save DApp: ", dAppData.Name, err)
+				continue
+			}
+
+			// messages of the updated DApp must be rendered again
+			if err := r.ClearRenderCache(dAppData.UsedSigningKey); err != nil {
 				logger.Error(err)
 			}
 
+			if msg.Type == devDAppUpdateMessageType {
+				r.reloadDApp(dAppData)
+			}
+
 		}
 
 	}()
 
+	return nil
+
+}
+
+// replace the code of the DApp in case it's running
+func (r *Registry) reloadDApp(dAppData dapp.Data) {
+	dApp := r.fetchDApp(dAppData.UsedSigningKey)
+	if dApp == nil {
+		return
+	}
+	if err := dApp.Reload(string(dAppData.Code), dAppData.Signature); err != nil {
+		logger.Error("failed to reload DApp: ", dAppData.Name, err)
+	}
 }
@@ -1,19 +1,34 @@
 package registry
 
 import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
 	"time"
 
+	dapp "github.com/Bit-Nation/panthalassa/dapp"
+	keyManager "github.com/Bit-Nation/panthalassa/keyManager"
+	keyStore "github.com/Bit-Nation/panthalassa/keyStore"
+	mnemonic "github.com/Bit-Nation/panthalassa/mnemonic"
+
 	crypto "github.com/libp2p/go-libp2p-crypto"
 	net "github.com/libp2p/go-libp2p-net"
 	peer "github.com/libp2p/go-libp2p-peer"
 	ma "github.com/multiformats/go-multiaddr"
+	require "github.com/stretchr/testify/require"
+	ed25519 "golang.org/x/crypto/ed25519"
 )
 
 // test stream implementation
 type stream struct {
 	net.Stream
 	data                           []byte
+	written                        []byte
 	failRead, failWrite, failClose bool
 	reset                          bool
 	conn                           net.Conn
@@ -41,11 +56,24 @@ func (s *stream) SetWriteDeadline(t time.Time) error {
 }
 
 func (s *stream) Write(b []byte) (int, error) {
-	return 0, errors.New("write is not implemented")
+	if s.failWrite {
+		return 0, errors.New("failed to write")
+	}
+	s.written = append(s.written, b...)
+	return len(b), nil
 }
 
+// read the data of the stream - io.EOF is returned once all data is read
 func (s *stream) Read(b []byte) (int, error) {
-	return 0, errors.New("read is not implemented")
+	if s.failRead {
+		return 0, errors.New("failed to read")
+	}
+	if len(s.data) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(b, s.data)
+	s.data = s.data[n:]
+	return n, nil
 }
 
 func (s *stream) Conn() net.Conn {
@@ -98,3 +126,161 @@ func (c *conn) RemotePublicKey() crypto.PubKey {
 	panic("not implemented")
 	return nil
 }
+
+// signed DApp with the given code
+func signedDApp(t *testing.T, pub ed25519.PublicKey, priv ed25519.PrivateKey, code string) dapp.Data {
+	dAppData := dapp.Data{
+		Name: map[string]string{
+			"en-us": "DApp Name",
+		},
+		UsedSigningKey: pub,
+		Code:           []byte(code),
+		Image:          []byte("image"),
+		Engine: dapp.SV{
+			Major: 0,
+			Minor: 1,
+			Patch: 0,
+		},
+		Version: 1,
+	}
+	hash, err := dAppData.Hash()
+	require.Nil(t, err)
+	dAppData.Signature = ed25519.Sign(priv, hash)
+	return dAppData
+}
+
+// encode the DApp as a message of the development protocol
+func devUpdateMessage(t *testing.T, dAppData dapp.Data) []byte {
+	rawMsg, err := json.Marshal(devMessage{
+		Type: devDAppUpdateMessageType,
+		DApp: &dapp.RawData{
+			Name:           dAppData.Name,
+			UsedSigningKey: hex.EncodeToString(dAppData.UsedSigningKey),
+			Code:           string(dAppData.Code),
+			Image:          base64.StdEncoding.EncodeToString(dAppData.Image),
+			Signature:      hex.EncodeToString(dAppData.Signature),
+			Engine:         dAppData.Engine.String(),
+			Version:        "1",
+		},
+	})
+	require.Nil(t, err)
+	return append([]byte(base64.StdEncoding.EncodeToString(rawMsg)), 0x0A)
+}
+
+func TestRegistry_DevStreamDAppUpdate(t *testing.T) {
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+
+	// key manager
+	mne, err := mnemonic.New()
+	require.Nil(t, err)
+	ks, err := keyStore.NewFromMnemonic(mne)
+	require.Nil(t, err)
+	km, err := keyManager.CreateFromKeyStore(ks)
+	require.Nil(t, err)
+
+	installed := signedDApp(t, pub, priv, "var version = 1")
+	dAppStorage := memDAppStorage{
+		get: func(signingKey ed25519.PublicKey) (*dapp.Data, error) {
+			return &installed, nil
+		},
+		saveDApp: func(dApp dapp.Data) error {
+			return nil
+		},
+	}
+
+	reg, err := NewDAppRegistry(nil, Config{}, nil, km, &dAppStorage, nil, nil)
+	require.Nil(t, err)
+	atomic.StoreInt32(&reg.devMode, 1)
+	require.Nil(t, reg.StartDApp(pub, time.Second*2))
+
+	dApp := reg.fetchDApp(pub)
+	require.NotNil(t, dApp)
+	version, err := dApp.ExecuteScript("version")
+	require.Nil(t, err)
+	require.Equal(t, "1", version)
+
+	str := &stream{
+		data: devUpdateMessage(t, signedDApp(t, pub, priv, "var version = 2")),
+	}
+	require.Nil(t, reg.devStreamHandler(str))
+
+	// we must tell the development server that we understand updates
+	rawCapabilities, err := base64.StdEncoding.DecodeString(string(str.written))
+	require.Nil(t, err)
+	capabilities := devMessage{}
+	require.Nil(t, json.Unmarshal(rawCapabilities, &capabilities))
+	require.Equal(t, devCapabilitiesMessageType, capabilities.Type)
+	require.Equal(t, []string{devDAppUpdateMessageType}, capabilities.MessageTypes)
+
+	// wait for the DApp to be reloaded
+	start := time.Now()
+	for version != "2" {
+		if time.Since(start) > time.Second*2 {
+			require.FailNow(t, "timed out waiting for the DApp to be reloaded")
+		}
+		time.Sleep(time.Millisecond * 10)
+		version, err = dApp.ExecuteScript("version")
+		require.Nil(t, err)
+	}
+
+	// the same DApp is still running - only the vm got replaced
+	require.True(t, dApp == reg.fetchDApp(pub))
+	require.Equal(t, 1, reg.RunningDApps())
+
+}
+
+func TestRegistry_DevStreamDAppUpdateSaveFailed(t *testing.T) {
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+
+	// key manager
+	mne, err := mnemonic.New()
+	require.Nil(t, err)
+	ks, err := keyStore.NewFromMnemonic(mne)
+	require.Nil(t, err)
+	km, err := keyManager.CreateFromKeyStore(ks)
+	require.Nil(t, err)
+
+	installed := signedDApp(t, pub, priv, "var version = 1")
+	saved := make(chan struct{}, 1)
+	dAppStorage := memDAppStorage{
+		get: func(signingKey ed25519.PublicKey) (*dapp.Data, error) {
+			return &installed, nil
+		},
+		saveDApp: func(dApp dapp.Data) error {
+			return nil
+		},
+		saveDevDApp: func(dApp dapp.Data) error {
+			saved <- struct{}{}
+			return dapp.ErrDAppDowngrade{CurrentVersion: 2, NewVersion: 1}
+		},
+	}
+
+	reg, err := NewDAppRegistry(nil, Config{}, nil, km, &dAppStorage, nil, nil)
+	require.Nil(t, err)
+	atomic.StoreInt32(&reg.devMode, 1)
+	require.Nil(t, reg.StartDApp(pub, time.Second*2))
+
+	str := &stream{
+		data: devUpdateMessage(t, signedDApp(t, pub, priv, "var version = 2")),
+	}
+	require.Nil(t, reg.devStreamHandler(str))
+
+	select {
+	case <-saved:
+	case <-time.After(time.Second * 2):
+		require.FailNow(t, "timed out waiting for the DApp to be saved")
+	}
+
+	// the DApp that couldn't be saved must not be loaded
+	time.Sleep(time.Millisecond * 100)
+	dApp := reg.fetchDApp(pub)
+	require.NotNil(t, dApp)
+	version, err := dApp.ExecuteScript("version")
+	require.Nil(t, err)
+	require.Equal(t, "1", version)
+
+}
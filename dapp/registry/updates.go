@@ -0,0 +1,84 @@
+package registry
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// latest releases are small - don't read more than this
+const maxUpdateResponseSize = 1024
+
+type DAppUpdate struct {
+	SigningKey       string `json:"signing_key_hex"`
+	InstalledVersion int    `json:"installed_version"`
+	LatestVersion    int    `json:"latest_version"`
+	UpdateAvailable  bool   `json:"update_available"`
+	// set if the update url couldn't be fetched
+	Error string `json:"error,omitempty"`
+}
+
+// fetch the latest version from the update url
+func fetchLatestVersion(client *http.Client, updateURL string) (int, error) {
+
+	resp, err := client.Get(updateURL)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("update url responded with status %d", resp.StatusCode)
+	}
+
+	latest := struct {
+		Version int `json:"version"`
+	}{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxUpdateResponseSize)).Decode(&latest); err != nil {
+		return 0, err
+	}
+
+	return latest.Version, nil
+
+}
+
+// check the update url of all installed DApps that have one
+func (r *Registry) CheckForUpdates(timeout time.Duration) ([]DAppUpdate, error) {
+
+	dApps, err := r.dAppDB.All()
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: timeout}
+	updates := []DAppUpdate{}
+	for _, dApp := range dApps {
+
+		if dApp.UpdateURL == "" {
+			continue
+		}
+
+		update := DAppUpdate{
+			SigningKey:       hex.EncodeToString(dApp.UsedSigningKey),
+			InstalledVersion: dApp.Version,
+		}
+
+		latest, err := fetchLatestVersion(client, dApp.UpdateURL)
+		if err != nil {
+			logger.Error(err)
+			update.Error = err.Error()
+		} else {
+			update.LatestVersion = latest
+			update.UpdateAvailable = latest > dApp.Version
+		}
+
+		updates = append(updates, update)
+
+	}
+
+	return updates, nil
+
+}
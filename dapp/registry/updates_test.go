@@ -0,0 +1,48 @@
+package registry
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	dapp "github.com/Bit-Nation/panthalassa/dapp"
+	require "github.com/stretchr/testify/require"
+)
+
+func TestRegistry_CheckForUpdates(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/latest":
+			fmt.Fprint(w, `{"version": 3}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	r := &Registry{
+		dAppDB: &memDAppStorage{
+			all: func() ([]*dapp.Data, error) {
+				return []*dapp.Data{
+					&dapp.Data{UsedSigningKey: []byte{1}, Version: 2, UpdateURL: server.URL + "/latest"},
+					&dapp.Data{UsedSigningKey: []byte{2}, Version: 3, UpdateURL: server.URL + "/latest"},
+					&dapp.Data{UsedSigningKey: []byte{3}, Version: 1, UpdateURL: server.URL + "/missing"},
+					// DApps without update url are not checked
+					&dapp.Data{UsedSigningKey: []byte{4}, Version: 1},
+				}, nil
+			},
+		},
+	}
+
+	updates, err := r.CheckForUpdates(time.Second)
+	require.Nil(t, err)
+	require.Equal(t, []DAppUpdate{
+		{SigningKey: "01", InstalledVersion: 2, LatestVersion: 3, UpdateAvailable: true},
+		{SigningKey: "02", InstalledVersion: 3, LatestVersion: 3, UpdateAvailable: false},
+		{SigningKey: "03", InstalledVersion: 1, Error: "update url responded with status 404"},
+	}, updates)
+
+}
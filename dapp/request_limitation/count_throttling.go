@@ -95,7 +95,11 @@ func NewCountThrottling(concurrency uint, coolDown time.Duration, maxQueue uint,
 			}
 
 			select {
-			case job := <-t.stack:
+			case job, ok := <-t.stack:
+				// exit when stack got closed
+				if !ok {
+					return
+				}
 				incInWork <- struct{}{}
 				incCurrent <- struct{}{}
 				go job(t.decCurrent)
@@ -77,7 +77,11 @@ func NewThrottling(concurrency uint, coolDown time.Duration, maxQueue uint, queu
 			}
 
 			select {
-			case job := <-t.stack:
+			case job, ok := <-t.stack:
+				// exit when stack got closed
+				if !ok {
+					return
+				}
 				incInWork <- struct{}{}
 				go job()
 				go func() {
@@ -17,6 +17,17 @@ func TestThrottling_Exec(t *testing.T) {
 
 }
 
+func TestThrottling_Close(t *testing.T) {
+
+	throttling := NewThrottling(1, time.Second, 1, errors.New("queue is full"))
+	require.Nil(t, throttling.Close())
+
+	// the worker must not run the zero value
+	// it receives from the closed stack
+	time.Sleep(time.Millisecond * 100)
+
+}
+
 /**
 @todo this test is failing from time to time
 func TestThrottling_ExecCoolDown(t *testing.T) {
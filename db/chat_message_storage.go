@@ -1,11 +1,14 @@
 package db
 
 import (
+	"bytes"
+	"crypto/subtle"
 	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	aes "github.com/Bit-Nation/panthalassa/crypto/aes"
@@ -18,6 +21,12 @@ import (
 
 var (
 	privateChatBucketName = []byte("private_chat")
+	// secondary indexes of the private chat messages
+	// the index entries are keyed by partner || database id
+	statusIndexBucketName = []byte("private_chat_status_index")
+	senderIndexBucketName = []byte("private_chat_sender_index")
+	// partner -> database id of the latest message
+	chatActivityBucketName = []byte("chat_activity")
 )
 
 // message status
@@ -46,9 +55,13 @@ type ChatMessageStorage interface {
 	UpdateStatus(partner ed25519.PublicKey, msgID int64, newStatus Status) error
 	AllChats() ([]ed25519.PublicKey, error)
 	Messages(partner ed25519.PublicKey, start int64, amount uint) ([]Message, error)
-	AddListener(func(e MessagePersistedEvent))
+	// returns a function that removes the listener again
+	AddListener(func(e MessagePersistedEvent)) func()
 	GetMessage(partner ed25519.PublicKey, messageID int64) (*Message, error)
 	PersistDAppMessage(partner ed25519.PublicKey, msg DAppMessage) error
+	GetMessagesByStatus(partner ed25519.PublicKey, status Status) ([]Message, error)
+	DeleteMessage(partner ed25519.PublicKey, dbID int64) error
+	DeleteChat(partner ed25519.PublicKey) error
 }
 
 type DAppMessage struct {
@@ -58,6 +71,12 @@ type DAppMessage struct {
 	ShouldSend    bool                   `json:"should_send"`
 }
 
+// the partner read our messages up to the referenced one
+type ReadReceipt struct {
+	// id of the last message that was read
+	MessageID string `json:"message_id"`
+}
+
 type Message struct {
 	ID         string       `json:"message_id"`
 	Version    uint         `json:"version"`
@@ -68,6 +87,11 @@ type Message struct {
 	CreatedAt  int64        `json:"created_at"`
 	Sender     []byte       `json:"sender"`
 	DatabaseID int64        `json:"db_id"`
+	// partner the message got forwarded from
+	// this is only stored locally
+	ForwardedFrom []byte `json:"forwarded_from,omitempty"`
+	// read receipts are handled when received and never persisted
+	ReadReceipt *ReadReceipt `json:"read_receipt,omitempty"`
 }
 
 // validate a given message
@@ -119,24 +143,42 @@ var ValidMessage = func(m Message) error {
 
 }
 
+// compare two message ids in constant time
+func MessageIDEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
 type MessagePersistedEvent struct {
 	Partner     ed25519.PublicKey
 	Message     Message
 	DBMessageID int64
 }
 
+// DBMessageID is 0 in the case the whole chat got deleted
+type MessageDeletedEvent struct {
+	Partner     ed25519.PublicKey
+	DBMessageID int64
+}
+
 type BoltChatMessageStorage struct {
 	db                  *bolt.DB
-	postPersistListener []func(event MessagePersistedEvent)
+	listenersLock       sync.RWMutex
+	listenerCount       uint64
+	postPersistListener map[uint64]func(event MessagePersistedEvent)
+	deleteListener      []func(event MessageDeletedEvent)
 	km                  *km.KeyManager
 }
 
 func NewChatMessageStorage(db *bolt.DB, listeners []func(event MessagePersistedEvent), km *km.KeyManager) *BoltChatMessageStorage {
-	return &BoltChatMessageStorage{
+	s := &BoltChatMessageStorage{
 		db:                  db,
-		postPersistListener: listeners,
+		postPersistListener: map[uint64]func(event MessagePersistedEvent){},
 		km:                  km,
 	}
+	for _, l := range listeners {
+		s.AddListener(l)
+	}
+	return s
 }
 
 func (s *BoltChatMessageStorage) persistMessage(partner ed25519.PublicKey, msg Message) error {
@@ -201,8 +243,20 @@ func (s *BoltChatMessageStorage) persistMessage(partner ed25519.PublicKey, msg M
 			return err
 		}
 
+		// add message to the secondary indexes
+		if err := indexMessage(tx, partner, msg); err != nil {
+			return err
+		}
+
+		// remember the latest activity of the chat
+		if err := recordChatActivity(tx, partner, msg.DatabaseID); err != nil {
+			return err
+		}
+
 		// tell listeners that we persisted the message
 		tx.OnCommit(func() {
+			s.listenersLock.RLock()
+			defer s.listenersLock.RUnlock()
 			for _, listener := range s.postPersistListener {
 				go listener(MessagePersistedEvent{
 					Partner:     partner,
@@ -217,6 +271,295 @@ func (s *BoltChatMessageStorage) persistMessage(partner ed25519.PublicKey, msg M
 	})
 }
 
+// store the database id as the latest activity of the chat
+// in the case it's younger than the recorded one
+func recordChatActivity(tx *bolt.Tx, partner ed25519.PublicKey, dbID int64) error {
+	activity, err := tx.CreateBucketIfNotExists(chatActivityBucketName)
+	if err != nil {
+		return err
+	}
+	if latest := activity.Get(partner); latest != nil && int64(binary.BigEndian.Uint64(latest)) >= dbID {
+		return nil
+	}
+	rawDBID := make([]byte, 8)
+	binary.BigEndian.PutUint64(rawDBID, uint64(dbID))
+	return activity.Put(partner, rawDBID)
+}
+
+// key of an index entry (partner || database id)
+func indexEntryKey(partner ed25519.PublicKey, dbID int64) []byte {
+	key := make([]byte, len(partner)+8)
+	copy(key, partner)
+	binary.BigEndian.PutUint64(key[len(partner):], uint64(dbID))
+	return key
+}
+
+// write the secondary index entries of a message
+func indexMessage(tx *bolt.Tx, partner ed25519.PublicKey, msg Message) error {
+
+	entryKey := indexEntryKey(partner, msg.DatabaseID)
+
+	// status index
+	statusIndex, err := tx.CreateBucketIfNotExists(statusIndexBucketName)
+	if err != nil {
+		return err
+	}
+	statusBucket, err := statusIndex.CreateBucketIfNotExists(uintToBytes(uint(msg.Status)))
+	if err != nil {
+		return err
+	}
+	if err := statusBucket.Put(entryKey, []byte{}); err != nil {
+		return err
+	}
+
+	// DApp messages don't have a sender
+	if len(msg.Sender) != 32 {
+		return nil
+	}
+
+	// sender index
+	senderIndex, err := tx.CreateBucketIfNotExists(senderIndexBucketName)
+	if err != nil {
+		return err
+	}
+	senderBucket, err := senderIndex.CreateBucketIfNotExists(msg.Sender)
+	if err != nil {
+		return err
+	}
+	return senderBucket.Put(entryKey, []byte{})
+
+}
+
+// remove the secondary index entries of a message
+func unindexMessage(tx *bolt.Tx, partner ed25519.PublicKey, msg Message) error {
+
+	entryKey := indexEntryKey(partner, msg.DatabaseID)
+
+	// status index
+	if statusIndex := tx.Bucket(statusIndexBucketName); statusIndex != nil {
+		if statusBucket := statusIndex.Bucket(uintToBytes(uint(msg.Status))); statusBucket != nil {
+			if err := statusBucket.Delete(entryKey); err != nil {
+				return err
+			}
+		}
+	}
+
+	// sender index
+	if len(msg.Sender) != 32 {
+		return nil
+	}
+	if senderIndex := tx.Bucket(senderIndexBucketName); senderIndex != nil {
+		if senderBucket := senderIndex.Bucket(msg.Sender); senderBucket != nil {
+			return senderBucket.Delete(entryKey)
+		}
+	}
+
+	return nil
+
+}
+
+// decrypt a raw encrypted message
+func (s *BoltChatMessageStorage) decryptMessage(rawEncMsg []byte) (Message, error) {
+
+	// unmarshal cipher text
+	ct, err := aes.Unmarshal(rawEncMsg)
+	if err != nil {
+		return Message{}, err
+	}
+
+	// decrypt cipher text
+	plainMsg, err := s.km.AESDecrypt(ct)
+	if err != nil {
+		return Message{}, err
+	}
+
+	msg := Message{}
+	return msg, json.Unmarshal(plainMsg, &msg)
+
+}
+
+// rebuild the secondary indexes (status, sender) based on the
+// persisted messages. Returns the amount of re indexed messages.
+func (s *BoltChatMessageStorage) Reindex() (int, error) {
+
+	reindexed := 0
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+
+		// delete the existing indexes
+		for _, indexBucketName := range [][]byte{statusIndexBucketName, senderIndexBucketName} {
+			if tx.Bucket(indexBucketName) == nil {
+				continue
+			}
+			if err := tx.DeleteBucket(indexBucketName); err != nil {
+				return err
+			}
+		}
+
+		// private chats
+		privChats := tx.Bucket(privateChatBucketName)
+		if privChats == nil {
+			return nil
+		}
+
+		return privChats.ForEach(func(partner, value []byte) error {
+
+			// partner chats are buckets and therefore don't have a value
+			if value != nil || len(partner) != 32 {
+				return nil
+			}
+
+			partnerBucket := privChats.Bucket(partner)
+			if partnerBucket == nil {
+				return nil
+			}
+
+			return partnerBucket.ForEach(func(_, rawEncMsg []byte) error {
+
+				msg, err := s.decryptMessage(rawEncMsg)
+				if err != nil {
+					return err
+				}
+
+				if err := indexMessage(tx, partner, msg); err != nil {
+					return err
+				}
+
+				reindexed++
+				return nil
+
+			})
+
+		})
+
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return reindexed, nil
+
+}
+
+// count the received messages that are still in the persisted state.
+// Based on the status and sender index so nothing needs to be decrypted.
+func (s *BoltChatMessageStorage) UnreadMessages() (int, error) {
+
+	myIdKeyStr, err := s.km.IdentityPublicKey()
+	if err != nil {
+		return 0, err
+	}
+	myIdKey, err := hex.DecodeString(myIdKeyStr)
+	if err != nil {
+		return 0, err
+	}
+
+	unread := 0
+
+	err = s.db.View(func(tx *bolt.Tx) error {
+
+		statusIndex := tx.Bucket(statusIndexBucketName)
+		if statusIndex == nil {
+			return nil
+		}
+		persisted := statusIndex.Bucket(uintToBytes(uint(StatusPersisted)))
+		if persisted == nil {
+			return nil
+		}
+
+		// messages we sent our self
+		var sent *bolt.Bucket
+		if senderIndex := tx.Bucket(senderIndexBucketName); senderIndex != nil {
+			sent = senderIndex.Bucket(myIdKey)
+		}
+
+		return persisted.ForEach(func(entryKey, _ []byte) error {
+			if sent != nil && sent.Get(entryKey) != nil {
+				return nil
+			}
+			unread++
+			return nil
+		})
+
+	})
+
+	return unread, err
+
+}
+
+type StorageStats struct {
+	TotalMessages int64 `json:"total_messages"`
+	// bytes used by the leaf pages of the partner buckets
+	TotalEncryptedBytes int64 `json:"total_encrypted_bytes"`
+	PartnerCount        int   `json:"partner_count"`
+	OldestMessageUnix   int64 `json:"oldest_message_unix"`
+	NewestMessageUnix   int64 `json:"newest_message_unix"`
+}
+
+// collect statistics about the stored messages.
+// The database ids are the creation dates of the messages
+// so nothing needs to be decrypted.
+func (s *BoltChatMessageStorage) Stats() (StorageStats, error) {
+
+	stats := StorageStats{}
+	var oldest, newest int64
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+
+		privateChats := tx.Bucket(privateChatBucketName)
+		if privateChats == nil {
+			return nil
+		}
+
+		return privateChats.ForEach(func(partner, _ []byte) error {
+
+			partnerBucket := privateChats.Bucket(partner)
+			if partnerBucket == nil {
+				return nil
+			}
+			stats.PartnerCount++
+
+			bucketStats := partnerBucket.Stats()
+			stats.TotalMessages += int64(bucketStats.KeyN)
+			// small buckets are inlined into their parent page
+			stats.TotalEncryptedBytes += int64(bucketStats.LeafInuse + bucketStats.InlineBucketInuse)
+
+			cursor := partnerBucket.Cursor()
+			if first, _ := cursor.First(); len(first) == 8 {
+				createdAt := int64(binary.BigEndian.Uint64(first))
+				if oldest == 0 || createdAt < oldest {
+					oldest = createdAt
+				}
+			}
+			if last, _ := cursor.Last(); len(last) == 8 {
+				createdAt := int64(binary.BigEndian.Uint64(last))
+				if createdAt > newest {
+					newest = createdAt
+				}
+			}
+
+			return nil
+
+		})
+
+	})
+	if err != nil {
+		return StorageStats{}, err
+	}
+
+	// created at is stored in nano seconds
+	if oldest != 0 {
+		stats.OldestMessageUnix = time.Unix(0, oldest).Unix()
+	}
+	if newest != 0 {
+		stats.NewestMessageUnix = time.Unix(0, newest).Unix()
+	}
+
+	return stats, nil
+
+}
+
 // fetch all chat partners
 func (s *BoltChatMessageStorage) AllChats() ([]ed25519.PublicKey, error) {
 	chats := []ed25519.PublicKey{}
@@ -238,7 +581,157 @@ func (s *BoltChatMessageStorage) AllChats() ([]ed25519.PublicKey, error) {
 	return chats, err
 }
 
+// fetch all chat partners - the chat with the latest message first
+func (s *BoltChatMessageStorage) AllChatsSortedByActivity() ([]ed25519.PublicKey, error) {
+	chats := []ed25519.PublicKey{}
+	latest := map[string]int64{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+
+		// all private chats
+		privateChats := tx.Bucket(privateChatBucketName)
+		if privateChats == nil {
+			return nil
+		}
+
+		activity := tx.Bucket(chatActivityBucketName)
+
+		return privateChats.ForEach(func(partner, value []byte) error {
+
+			// partner chats are buckets and therefore don't have a value
+			if value != nil || len(partner) != 32 {
+				return nil
+			}
+			// keys are only valid during the transaction
+			chats = append(chats, append(ed25519.PublicKey{}, partner...))
+
+			if activity != nil {
+				if rawDBID := activity.Get(partner); rawDBID != nil {
+					latest[string(partner)] = int64(binary.BigEndian.Uint64(rawDBID))
+					return nil
+				}
+			}
+
+			// chats persisted before the activity was recorded
+			// fall back to the key of their latest message
+			if partnerBucket := privateChats.Bucket(partner); partnerBucket != nil {
+				if k, _ := partnerBucket.Cursor().Last(); len(k) == 8 {
+					latest[string(partner)] = int64(binary.BigEndian.Uint64(k))
+				}
+			}
+			return nil
+
+		})
+	})
+
+	sort.SliceStable(chats, func(i, j int) bool {
+		return latest[string(chats[i])] > latest[string(chats[j])]
+	})
+
+	return chats, err
+}
+
+// amount of raw messages that are read ahead of the decryption
+const messagesReadAhead = 8
+
+// amount of go routines that decrypt messages in parallel
+const messagesDecryptWorkers = 4
+
 func (s *BoltChatMessageStorage) Messages(partner ed25519.PublicKey, start int64, amount uint) ([]Message, error) {
+	return s.messages(partner, start, amount, messagesDecryptWorkers)
+}
+
+// page of messages fetched by MessagesBefore
+type MessagesPage struct {
+	// messages in ascending order
+	Items []Message `json:"items"`
+	// true if there are messages older than the items
+	HasMore bool `json:"has_more"`
+	// pass as beforeID to fetch the next (older) page
+	NextCursor int64 `json:"next_cursor"`
+}
+
+// fetch up to limit messages older than beforeID
+// beforeID == 0 fetches the latest messages
+func (s *BoltChatMessageStorage) MessagesBefore(partner ed25519.PublicKey, beforeID int64, limit uint) (MessagesPage, error) {
+
+	if limit < 1 {
+		return MessagesPage{}, errors.New("invalid limit - must be at least one")
+	}
+
+	page := MessagesPage{
+		Items: []Message{},
+	}
+
+	// find the youngest message older than beforeID
+	var start int64
+	err := s.db.View(func(tx *bolt.Tx) error {
+
+		privChatsBucket := tx.Bucket(privateChatBucketName)
+		if privChatsBucket == nil {
+			return nil
+		}
+		partnerBucket := privChatsBucket.Bucket(partner)
+		if partnerBucket == nil {
+			return nil
+		}
+
+		cursor := partnerBucket.Cursor()
+		var key []byte
+		if beforeID == 0 {
+			key, _ = cursor.Last()
+		} else {
+			beforeBytes := make([]byte, 8)
+			binary.BigEndian.PutUint64(beforeBytes, uint64(beforeID))
+			if key, _ = cursor.Seek(beforeBytes); key == nil {
+				key, _ = cursor.Last()
+			} else {
+				key, _ = cursor.Prev()
+			}
+		}
+		if len(key) == 8 {
+			start = int64(binary.BigEndian.Uint64(key))
+		}
+		return nil
+
+	})
+	if err != nil || start == 0 {
+		return page, err
+	}
+
+	// fetch one more message to know if there are more
+	messages, err := s.messages(partner, start, limit+1, messagesDecryptWorkers)
+	if err != nil {
+		return MessagesPage{}, err
+	}
+	if uint(len(messages)) > limit {
+		page.HasMore = true
+		messages = messages[1:]
+	}
+	page.Items = messages
+	if len(messages) > 0 {
+		page.NextCursor = messages[0].DatabaseID
+	}
+
+	return page, nil
+
+}
+
+// encrypted message with it's position in the result
+type rawPipelineMessage struct {
+	position int
+	rawMsg   []byte
+}
+
+// decrypted message with it's position in the result
+type decryptedPipelineMessage struct {
+	position int
+	msg      Message
+	err      error
+}
+
+// fetch messages of a chat. One go routine reads the encrypted
+// messages from the cursor while the workers decrypt them in parallel.
+func (s *BoltChatMessageStorage) messages(partner ed25519.PublicKey, start int64, amount uint, workers int) ([]Message, error) {
 
 	if amount < 1 {
 		return nil, errors.New("invalid amount - must be at least one")
@@ -260,59 +753,125 @@ func (s *BoltChatMessageStorage) Messages(partner ed25519.PublicKey, start int64
 			return nil
 		}
 
-		cursor := partnerBucket.Cursor()
-		var rawMsg []byte
+		rawMessages := make(chan rawPipelineMessage, messagesReadAhead)
+		decrypted := make(chan decryptedPipelineMessage, messagesReadAhead)
+
+		// read ahead. The raw values are only valid during the
+		// transaction which is fine since we wait for all workers.
+		go func() {
+
+			defer close(rawMessages)
+
+			cursor := partnerBucket.Cursor()
+			var key, rawMsg []byte
+
+			// jump to position
+			if start == 0 {
+				key, rawMsg = cursor.Last()
+			} else {
+				startBytes := make([]byte, 8)
+				binary.BigEndian.PutUint64(startBytes, uint64(start))
+				key, rawMsg = cursor.Seek(startBytes)
+				switch {
+				// start is after the latest message
+				case key == nil:
+					key, rawMsg = cursor.Last()
+				// seek landed on the next younger message
+				case !bytes.Equal(key, startBytes):
+					key, rawMsg = cursor.Prev()
+				}
+			}
 
-		// jump to position
-		if start == 0 {
-			_, value := cursor.Last()
-			rawMsg = value
-		} else {
-			startBytes := make([]byte, 8)
-			binary.BigEndian.PutUint64(startBytes, uint64(start))
-			_, value := cursor.Seek(startBytes)
-			rawMsg = value
+			for position := 0; uint(position) < amount && key != nil; position++ {
+				rawMessages <- rawPipelineMessage{
+					position: position,
+					rawMsg:   rawMsg,
+				}
+				key, rawMsg = cursor.Prev()
+			}
+
+		}()
+
+		// decrypt workers
+		wg := sync.WaitGroup{}
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for raw := range rawMessages {
+					msg, err := s.decryptMessage(raw.rawMsg)
+					decrypted <- decryptedPipelineMessage{
+						position: raw.position,
+						msg:      msg,
+						err:      err,
+					}
+				}
+			}()
+		}
+		go func() {
+			wg.Wait()
+			close(decrypted)
+		}()
+
+		// reassemble messages in cursor order
+		ordered := map[int]Message{}
+		var decryptErr error
+		for d := range decrypted {
+			if d.err != nil {
+				decryptErr = d.err
+				continue
+			}
+			ordered[d.position] = d.msg
+		}
+		if decryptErr != nil {
+			return decryptErr
+		}
+		for position := 0; position < len(ordered); position++ {
+			messages = append(messages, ordered[position])
 		}
 
-		decRawMsg := func(rawEncMsg []byte, km km.KeyManager) (Message, error) {
+		return nil
+	})
 
-			// unmarshal cipher text
-			ct, err := aes.Unmarshal(rawEncMsg)
-			if err != nil {
-				return Message{}, err
-			}
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].DatabaseID < messages[j].DatabaseID
+	})
 
-			// decrypt cipher text
-			plainMsg, err := km.AESDecrypt(ct)
-			if err != nil {
-				return Message{}, err
-			}
+	return messages, err
+
+}
+
+// fetch messages that were persisted after the given database id
+// messages are returned in ascending order
+func (s *BoltChatMessageStorage) GetMessagesAfter(partner ed25519.PublicKey, afterDBID int64, amount uint) ([]Message, error) {
+
+	if amount < 1 {
+		return nil, errors.New("invalid amount - must be at least one")
+	}
+
+	messages := []Message{}
 
-			msg := Message{}
-			return msg, json.Unmarshal(plainMsg, &msg)
+	err := s.db.View(func(tx *bolt.Tx) error {
 
+		// private chats
+		privChatsBucket := tx.Bucket(privateChatBucketName)
+		if privChatsBucket == nil {
+			return nil
 		}
 
-		// unmarshal message
-		msg, err := decRawMsg(rawMsg, *s.km)
-		if err != nil {
-			return err
+		// partner chat bucket
+		partnerBucket := privChatsBucket.Bucket(partner)
+		if partnerBucket == nil {
+			return nil
 		}
 
-		// append message
-		messages = append(messages, msg)
+		// jump to the first message after the given id
+		startBytes := make([]byte, 8)
+		binary.BigEndian.PutUint64(startBytes, uint64(afterDBID+1))
 
-		currentAmount := amount - 1
-		for {
-			if currentAmount == 0 {
-				break
-			}
-			currentAmount--
-			key, rawMsg := cursor.Prev()
-			if key == nil {
-				break
-			}
-			msg, err := decRawMsg(rawMsg, *s.km)
+		cursor := partnerBucket.Cursor()
+		for key, rawMsg := cursor.Seek(startBytes); key != nil && uint(len(messages)) < amount; key, rawMsg = cursor.Next() {
+			msg, err := s.decryptMessage(rawMsg)
 			if err != nil {
 				return err
 			}
@@ -322,8 +881,53 @@ func (s *BoltChatMessageStorage) Messages(partner ed25519.PublicKey, start int64
 		return nil
 	})
 
-	sort.Slice(messages, func(i, j int) bool {
-		return messages[i].DatabaseID < messages[j].DatabaseID
+	return messages, err
+
+}
+
+// fetch all messages of the partner with the given status
+// the messages are looked up in the status index
+func (s *BoltChatMessageStorage) GetMessagesByStatus(partner ed25519.PublicKey, status Status) ([]Message, error) {
+
+	messages := []Message{}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+
+		// status index
+		statusIndex := tx.Bucket(statusIndexBucketName)
+		if statusIndex == nil {
+			return nil
+		}
+		statusBucket := statusIndex.Bucket(uintToBytes(uint(status)))
+		if statusBucket == nil {
+			return nil
+		}
+
+		// partner chat bucket
+		privChatsBucket := tx.Bucket(privateChatBucketName)
+		if privChatsBucket == nil {
+			return nil
+		}
+		partnerBucket := privChatsBucket.Bucket(partner)
+		if partnerBucket == nil {
+			return nil
+		}
+
+		// index entries of the partner are prefixed with the partner key
+		cursor := statusBucket.Cursor()
+		for key, _ := cursor.Seek(partner); key != nil && bytes.HasPrefix(key, partner); key, _ = cursor.Next() {
+			rawMsg := partnerBucket.Get(key[len(partner):])
+			if rawMsg == nil {
+				return fmt.Errorf("status index references missing message %x for partner: %x", key[len(partner):], partner)
+			}
+			msg, err := s.decryptMessage(rawMsg)
+			if err != nil {
+				return err
+			}
+			messages = append(messages, msg)
+		}
+
+		return nil
 	})
 
 	return messages, err
@@ -383,14 +987,29 @@ func (s *BoltChatMessageStorage) GetMessage(partner ed25519.PublicKey, dbID int6
 }
 
 // add listener
-func (s *BoltChatMessageStorage) AddListener(fn func(e MessagePersistedEvent)) {
-	s.postPersistListener = append(s.postPersistListener, fn)
+// call the returned function to remove it again
+func (s *BoltChatMessageStorage) AddListener(fn func(e MessagePersistedEvent)) func() {
+	s.listenersLock.Lock()
+	defer s.listenersLock.Unlock()
+	s.listenerCount++
+	id := s.listenerCount
+	s.postPersistListener[id] = fn
+	return func() {
+		s.listenersLock.Lock()
+		defer s.listenersLock.Unlock()
+		delete(s.postPersistListener, id)
+	}
 }
 
+// persist a message that should be sent to the partner
+// a new id is generated if the message doesn't have one yet
 func (s *BoltChatMessageStorage) PersistMessageToSend(partner ed25519.PublicKey, msg Message) error {
-	id, err := uuid.NewV4()
-	if err != nil {
-		return err
+	if msg.ID == "" {
+		id, err := uuid.NewV4()
+		if err != nil {
+			return err
+		}
+		msg.ID = id.String()
 	}
 	myIdKeyStr, err := s.km.IdentityPublicKey()
 	if err != nil {
@@ -400,7 +1019,6 @@ func (s *BoltChatMessageStorage) PersistMessageToSend(partner ed25519.PublicKey,
 	if len(myIdKey) != 32 {
 		return fmt.Errorf("my id key is invalid (%d bytes long)", len(myIdKey))
 	}
-	msg.ID = id.String()
 	msg.Received = false
 	msg.Status = StatusPersisted
 	msg.Sender = myIdKey
@@ -414,10 +1032,95 @@ func (s *BoltChatMessageStorage) PersistReceivedMessage(partner ed25519.PublicKe
 	return s.persistMessage(partner, msg)
 }
 
-// must be implemented later
+// update the status of a message
 func (s *BoltChatMessageStorage) UpdateStatus(partner ed25519.PublicKey, msgID int64, newStatus Status) error {
-	// @todo implement this
-	return nil
+	// reject unknown statuses before opening a write transaction
+	if _, exist := statuses[newStatus]; !exist {
+		return fmt.Errorf("invalid status: %d (is not registered)", newStatus)
+	}
+	return s.UpdateMessage(partner, msgID, func(m *Message) error {
+		m.Status = newStatus
+		return nil
+	})
+}
+
+// decrypt the message, pass it to the updater and persist the
+// updated message again. Everything happens in one transaction.
+// The database id of the message can't be changed by the updater.
+func (s *BoltChatMessageStorage) UpdateMessage(partner ed25519.PublicKey, dbID int64, updater func(*Message) error) error {
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+
+		// private chats bucket
+		privateChats := tx.Bucket(privateChatBucketName)
+		if privateChats == nil {
+			return fmt.Errorf("coulnd't fetch message for partner: %x and message id: %d", partner, dbID)
+		}
+
+		// bucket with chat of partner
+		partnerMessages := privateChats.Bucket(partner)
+		if partnerMessages == nil {
+			return fmt.Errorf("coulnd't fetch message for partner: %x and message id: %d", partner, dbID)
+		}
+
+		// turn numeric message id into byte message id
+		byteMsgID := make([]byte, 8)
+		binary.BigEndian.PutUint64(byteMsgID, uint64(dbID))
+
+		// fetch encrypted message
+		rawEncryptedMessage := partnerMessages.Get(byteMsgID)
+		if rawEncryptedMessage == nil {
+			return fmt.Errorf("coulnd't fetch message for partner: %x and message id: %d", partner, dbID)
+		}
+
+		msg, err := s.decryptMessage(rawEncryptedMessage)
+		if err != nil {
+			return err
+		}
+
+		// remove the old index entries
+		if err := unindexMessage(tx, partner, msg); err != nil {
+			return err
+		}
+
+		// update message
+		if err := updater(&msg); err != nil {
+			return err
+		}
+		msg.DatabaseID = dbID
+
+		// validate updated message
+		if err := ValidMessage(msg); err != nil {
+			return err
+		}
+
+		// marshal message
+		rawMessage, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+
+		// encrypt message
+		encryptedMessage, err := s.km.AESEncrypt(rawMessage)
+		if err != nil {
+			return err
+		}
+
+		// marshaled encrypted message
+		rawEncryptedMessage, err = encryptedMessage.Marshal()
+		if err != nil {
+			return err
+		}
+
+		// add the updated message to the indexes
+		if err := indexMessage(tx, partner, msg); err != nil {
+			return err
+		}
+
+		return partnerMessages.Put(byteMsgID, rawEncryptedMessage)
+
+	})
+
 }
 
 func (s *BoltChatMessageStorage) PersistDAppMessage(partner ed25519.PublicKey, msg DAppMessage) error {
@@ -437,3 +1140,162 @@ func (s *BoltChatMessageStorage) PersistDAppMessage(partner ed25519.PublicKey, m
 	return s.persistMessage(partner, m)
 
 }
+
+// add a listener that is called after a message or chat got deleted
+func (s *BoltChatMessageStorage) AddDeleteListener(fn func(e MessageDeletedEvent)) {
+	s.listenersLock.Lock()
+	defer s.listenersLock.Unlock()
+	s.deleteListener = append(s.deleteListener, fn)
+}
+
+// tell the delete listeners about the deletion once the transaction committed
+func (s *BoltChatMessageStorage) onDeleteCommit(tx *bolt.Tx, e MessageDeletedEvent) {
+	tx.OnCommit(func() {
+		s.listenersLock.RLock()
+		defer s.listenersLock.RUnlock()
+		for _, listener := range s.deleteListener {
+			go listener(e)
+		}
+	})
+}
+
+// remove the message from the indexes and delete it.
+// Overwriting it with zeros first is best effort only: bolt is
+// copy-on-write, so the pages that held the encrypted message and
+// its index entries stay in the file until bolt reuses them.
+// Use Compact to rewrite the database without the freed pages.
+func (s *BoltChatMessageStorage) removeMessage(tx *bolt.Tx, partner ed25519.PublicKey, partnerMessages *bolt.Bucket, key, rawEncMsg []byte) error {
+
+	msg, err := s.decryptMessage(rawEncMsg)
+	if err != nil {
+		return err
+	}
+	msg.DatabaseID = int64(binary.BigEndian.Uint64(key))
+	if err := unindexMessage(tx, partner, msg); err != nil {
+		return err
+	}
+
+	// the key must be copied since it's only valid
+	// till the bucket got modified
+	key = append([]byte{}, key...)
+	if err := partnerMessages.Put(key, make([]byte, len(rawEncMsg))); err != nil {
+		return err
+	}
+	return partnerMessages.Delete(key)
+
+}
+
+// delete a single message of a chat
+func (s *BoltChatMessageStorage) DeleteMessage(partner ed25519.PublicKey, dbID int64) error {
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+
+		// private chats bucket
+		privateChats := tx.Bucket(privateChatBucketName)
+		if privateChats == nil {
+			return fmt.Errorf("coulnd't fetch message for partner: %x and message id: %d", partner, dbID)
+		}
+
+		// bucket with chat of partner
+		partnerMessages := privateChats.Bucket(partner)
+		if partnerMessages == nil {
+			return fmt.Errorf("coulnd't fetch message for partner: %x and message id: %d", partner, dbID)
+		}
+
+		byteMsgID := make([]byte, 8)
+		binary.BigEndian.PutUint64(byteMsgID, uint64(dbID))
+
+		rawEncryptedMessage := partnerMessages.Get(byteMsgID)
+		if rawEncryptedMessage == nil {
+			return fmt.Errorf("coulnd't fetch message for partner: %x and message id: %d", partner, dbID)
+		}
+
+		if err := s.removeMessage(tx, partner, partnerMessages, byteMsgID, rawEncryptedMessage); err != nil {
+			return err
+		}
+
+		// the latest activity moves to the message before
+		if activity := tx.Bucket(chatActivityBucketName); activity != nil {
+			if latest := activity.Get(partner); latest != nil && int64(binary.BigEndian.Uint64(latest)) == dbID {
+				if err := activity.Delete(partner); err != nil {
+					return err
+				}
+				if k, _ := partnerMessages.Cursor().Last(); len(k) == 8 {
+					if err := recordChatActivity(tx, partner, int64(binary.BigEndian.Uint64(k))); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		s.onDeleteCommit(tx, MessageDeletedEvent{
+			Partner:     partner,
+			DBMessageID: dbID,
+		})
+
+		return nil
+
+	})
+
+}
+
+// delete all messages of a chat
+func (s *BoltChatMessageStorage) DeleteChat(partner ed25519.PublicKey) error {
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+
+		// private chats bucket
+		privateChats := tx.Bucket(privateChatBucketName)
+		if privateChats == nil {
+			return nil
+		}
+
+		// bucket with chat of partner
+		partnerMessages := privateChats.Bucket(partner)
+		if partnerMessages == nil {
+			return nil
+		}
+
+		// collect the messages first since we
+		// can't modify the bucket while iterating over it
+		type persisted struct {
+			key       []byte
+			rawEncMsg []byte
+		}
+		messages := []persisted{}
+		err := partnerMessages.ForEach(func(k, v []byte) error {
+			messages = append(messages, persisted{
+				key:       append([]byte{}, k...),
+				rawEncMsg: append([]byte{}, v...),
+			})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, m := range messages {
+			if err := s.removeMessage(tx, partner, partnerMessages, m.key, m.rawEncMsg); err != nil {
+				return err
+			}
+		}
+
+		if err := privateChats.DeleteBucket(partner); err != nil {
+			return err
+		}
+
+		if activity := tx.Bucket(chatActivityBucketName); activity != nil {
+			if err := activity.Delete(partner); err != nil {
+				return err
+			}
+		}
+
+		s.onDeleteCommit(tx, MessageDeletedEvent{
+			Partner: partner,
+		})
+
+		return nil
+
+	})
+
+}
@@ -6,10 +6,13 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"testing"
+	"time"
 
 	aes "github.com/Bit-Nation/panthalassa/crypto/aes"
 	bolt "github.com/coreos/bbolt"
+	uuid "github.com/satori/go.uuid"
 	require "github.com/stretchr/testify/require"
 	ed25519 "golang.org/x/crypto/ed25519"
 )
@@ -232,6 +235,57 @@ func TestBoltChatMessageStorage_AllChats(t *testing.T) {
 
 }
 
+func TestBoltChatMessageStorage_AllChatsSortedByActivity(t *testing.T) {
+
+	// setup
+	db := createDB()
+	km := createKeyManager()
+	partnerOne, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	partnerTwo, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	storage := NewChatMessageStorage(db, []func(event MessagePersistedEvent){}, km)
+
+	// no chats yet
+	partners, err := storage.AllChatsSortedByActivity()
+	require.Nil(t, err)
+	require.Equal(t, 0, len(partners))
+
+	now := time.Now()
+	persist := func(partner ed25519.PublicKey, createdAt time.Time) {
+		id, err := uuid.NewV4()
+		require.Nil(t, err)
+		require.Nil(t, storage.PersistReceivedMessage(partner, Message{
+			ID:        id.String(),
+			Message:   []byte("hi"),
+			CreatedAt: createdAt.UnixNano(),
+			Sender:    partner,
+		}))
+	}
+
+	persist(partnerOne, now)
+	persist(partnerTwo, now.Add(time.Minute))
+
+	partners, err = storage.AllChatsSortedByActivity()
+	require.Nil(t, err)
+	require.Equal(t, []ed25519.PublicKey{partnerTwo, partnerOne}, partners)
+
+	// a new message moves the chat to the top
+	persist(partnerOne, now.Add(time.Hour))
+
+	partners, err = storage.AllChatsSortedByActivity()
+	require.Nil(t, err)
+	require.Equal(t, []ed25519.PublicKey{partnerOne, partnerTwo}, partners)
+
+	// an older message doesn't change the order
+	persist(partnerTwo, now.Add(-time.Hour))
+
+	partners, err = storage.AllChatsSortedByActivity()
+	require.Nil(t, err)
+	require.Equal(t, []ed25519.PublicKey{partnerOne, partnerTwo}, partners)
+
+}
+
 func TestBoltChatMessageStorage_Messages(t *testing.T) {
 
 	// setup
@@ -256,6 +310,163 @@ func TestBoltChatMessageStorage_Messages(t *testing.T) {
 
 }
 
+func TestBoltChatMessageStorage_MessagesBefore(t *testing.T) {
+
+	// setup
+	db := createDB()
+	km := createKeyManager()
+	partner, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	storage := NewChatMessageStorage(db, []func(event MessagePersistedEvent){}, km)
+
+	// empty history
+	page, err := storage.MessagesBefore(partner, 0, 10)
+	require.Nil(t, err)
+	require.Equal(t, 0, len(page.Items))
+	require.False(t, page.HasMore)
+	require.Equal(t, int64(0), page.NextCursor)
+
+	// persist five messages with known database ids
+	// created at must be bigger than the max unix timestamp in seconds
+	base := int64(3000000000)
+	for i := 1; i <= 5; i++ {
+		id, err := uuid.NewV4()
+		require.Nil(t, err)
+		require.Nil(t, storage.PersistReceivedMessage(partner, Message{
+			ID:        id.String(),
+			Message:   []byte(fmt.Sprintf("message %d", i)),
+			CreatedAt: base + int64(i*10),
+			Sender:    partner,
+		}))
+	}
+
+	// single page
+	page, err = storage.MessagesBefore(partner, 0, 10)
+	require.Nil(t, err)
+	require.Equal(t, 5, len(page.Items))
+	require.False(t, page.HasMore)
+	require.Equal(t, []byte("message 1"), page.Items[0].Message)
+	require.Equal(t, []byte("message 5"), page.Items[4].Message)
+
+	// multiple pages
+	page, err = storage.MessagesBefore(partner, 0, 2)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(page.Items))
+	require.True(t, page.HasMore)
+	require.Equal(t, base+40, page.NextCursor)
+	require.Equal(t, []byte("message 4"), page.Items[0].Message)
+
+	page, err = storage.MessagesBefore(partner, page.NextCursor, 2)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(page.Items))
+	require.True(t, page.HasMore)
+	require.Equal(t, []byte("message 2"), page.Items[0].Message)
+	require.Equal(t, []byte("message 3"), page.Items[1].Message)
+
+	page, err = storage.MessagesBefore(partner, page.NextCursor, 2)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(page.Items))
+	require.False(t, page.HasMore)
+	require.Equal(t, []byte("message 1"), page.Items[0].Message)
+
+	// exact boundary - the page fits the remaining messages
+	page, err = storage.MessagesBefore(partner, base+30, 2)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(page.Items))
+	require.False(t, page.HasMore)
+	require.Equal(t, base+10, page.NextCursor)
+
+	// a cursor between two messages
+	page, err = storage.MessagesBefore(partner, base+35, 1)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(page.Items))
+	require.Equal(t, []byte("message 3"), page.Items[0].Message)
+
+	// nothing before the oldest message
+	page, err = storage.MessagesBefore(partner, base+10, 2)
+	require.Nil(t, err)
+	require.Equal(t, 0, len(page.Items))
+	require.False(t, page.HasMore)
+
+	// Messages doesn't return younger messages if
+	// the start is in between two messages
+	messages, err := storage.Messages(partner, base+35, 10)
+	require.Nil(t, err)
+	require.Equal(t, 3, len(messages))
+	require.Equal(t, []byte("message 3"), messages[2].Message)
+
+}
+
+func TestBoltChatMessageStorage_GetMessagesAfter(t *testing.T) {
+
+	// setup
+	db := createDB()
+	km := createKeyManager()
+	partner, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	storage := NewChatMessageStorage(db, []func(event MessagePersistedEvent){}, km)
+
+	require.Nil(t, storage.PersistMessageToSend(partner, Message{Message: []byte("first")}))
+	require.Nil(t, storage.PersistMessageToSend(partner, Message{Message: []byte("second")}))
+	require.Nil(t, storage.PersistMessageToSend(partner, Message{Message: []byte("third")}))
+	messages, err := storage.Messages(partner, 0, 10)
+	require.Nil(t, err)
+	require.Equal(t, 3, len(messages))
+
+	// messages after the first one
+	after, err := storage.GetMessagesAfter(partner, messages[0].DatabaseID, 10)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(after))
+	require.Equal(t, []byte("second"), after[0].Message)
+	require.Equal(t, []byte("third"), after[1].Message)
+
+	// amount is respected
+	after, err = storage.GetMessagesAfter(partner, messages[0].DatabaseID, 1)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(after))
+	require.Equal(t, []byte("second"), after[0].Message)
+
+	// nothing after the last message
+	after, err = storage.GetMessagesAfter(partner, messages[2].DatabaseID, 10)
+	require.Nil(t, err)
+	require.Equal(t, 0, len(after))
+
+}
+
+func TestBoltChatMessageStorage_GetMessagesByStatus(t *testing.T) {
+
+	// setup
+	db := createDB()
+	km := createKeyManager()
+	partner, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	otherPartner, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	storage := NewChatMessageStorage(db, []func(event MessagePersistedEvent){}, km)
+
+	require.Nil(t, storage.PersistMessageToSend(partner, Message{Message: []byte("first")}))
+	require.Nil(t, storage.PersistMessageToSend(partner, Message{Message: []byte("second")}))
+	require.Nil(t, storage.PersistMessageToSend(otherPartner, Message{Message: []byte("other")}))
+	messages, err := storage.Messages(partner, 0, 10)
+	require.Nil(t, err)
+	require.Nil(t, storage.UpdateStatus(partner, messages[0].DatabaseID, StatusSent))
+
+	persisted, err := storage.GetMessagesByStatus(partner, StatusPersisted)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(persisted))
+	require.Equal(t, []byte("second"), persisted[0].Message)
+
+	sent, err := storage.GetMessagesByStatus(partner, StatusSent)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(sent))
+	require.Equal(t, []byte("first"), sent[0].Message)
+
+	failed, err := storage.GetMessagesByStatus(partner, StatusFailedToSend)
+	require.Nil(t, err)
+	require.Equal(t, 0, len(failed))
+
+}
+
 func TestBoltChatMessageStorage_GetMessage(t *testing.T) {
 
 	// setup
@@ -274,3 +485,390 @@ func TestBoltChatMessageStorage_GetMessage(t *testing.T) {
 	require.Equal(t, []byte("hi there"), msg.Message)
 
 }
+
+func TestMessageIDEqual(t *testing.T) {
+
+	require.True(t, MessageIDEqual("2c6b3fd9-0fbe-4bbd-a1e5-0b3b4b0a7a51", "2c6b3fd9-0fbe-4bbd-a1e5-0b3b4b0a7a51"))
+	require.False(t, MessageIDEqual("2c6b3fd9-0fbe-4bbd-a1e5-0b3b4b0a7a51", "2c6b3fd9-0fbe-4bbd-a1e5-0b3b4b0a7a52"))
+	require.False(t, MessageIDEqual("2c6b3fd9", "2c6b3fd9-0fbe-4bbd-a1e5-0b3b4b0a7a51"))
+	require.True(t, MessageIDEqual("", ""))
+
+}
+
+func TestBoltChatMessageStorage_Reindex(t *testing.T) {
+
+	// setup
+	db := createDB()
+	km := createKeyManager()
+	partner, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	storage := NewChatMessageStorage(db, []func(event MessagePersistedEvent){}, km)
+
+	require.Nil(t, storage.PersistMessageToSend(partner, Message{Message: []byte("hi")}))
+	require.Nil(t, storage.PersistMessageToSend(partner, Message{Message: []byte("there")}))
+
+	// drop the status index to simulate a stale index
+	require.Nil(t, db.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket(statusIndexBucketName)
+	}))
+
+	reindexed, err := storage.Reindex()
+	require.Nil(t, err)
+	require.Equal(t, 2, reindexed)
+
+	err = db.View(func(tx *bolt.Tx) error {
+
+		statusIndex := tx.Bucket(statusIndexBucketName)
+		require.NotNil(t, statusIndex)
+
+		persisted := statusIndex.Bucket(uintToBytes(uint(StatusPersisted)))
+		require.NotNil(t, persisted)
+		require.Equal(t, 2, persisted.Stats().KeyN)
+
+		senderIndex := tx.Bucket(senderIndexBucketName)
+		require.NotNil(t, senderIndex)
+		idKey, err := km.IdentityPublicKey()
+		require.Nil(t, err)
+		rawIdKey, err := hex.DecodeString(idKey)
+		require.Nil(t, err)
+		sent := senderIndex.Bucket(rawIdKey)
+		require.NotNil(t, sent)
+		require.Equal(t, 2, sent.Stats().KeyN)
+
+		return nil
+	})
+	require.Nil(t, err)
+
+}
+
+func TestBoltChatMessageStorage_UpdateStatus(t *testing.T) {
+
+	// setup
+	db := createDB()
+	km := createKeyManager()
+	partner, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	storage := NewChatMessageStorage(db, []func(event MessagePersistedEvent){}, km)
+
+	require.Nil(t, storage.PersistMessageToSend(partner, Message{Message: []byte("hi")}))
+	messages, err := storage.Messages(partner, 0, 1)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(messages))
+	dbID := messages[0].DatabaseID
+	require.Equal(t, StatusPersisted, messages[0].Status)
+
+	status := func() Status {
+		msg, err := storage.GetMessage(partner, dbID)
+		require.Nil(t, err)
+		require.NotNil(t, msg)
+		return msg.Status
+	}
+
+	// persisted -> sent
+	require.Nil(t, storage.UpdateStatus(partner, dbID, StatusSent))
+	require.Equal(t, StatusSent, status())
+
+	// sent -> delivered
+	require.Nil(t, storage.UpdateStatus(partner, dbID, StatusDelivered))
+	require.Equal(t, StatusDelivered, status())
+
+	// unregistered statuses are rejected
+	require.EqualError(t, storage.UpdateStatus(partner, dbID, Status(123)), "invalid status: 123 (is not registered)")
+	require.Equal(t, StatusDelivered, status())
+
+	// unknown messages can't be updated
+	require.Error(t, storage.UpdateStatus(partner, dbID+1, StatusSent))
+
+}
+
+func TestBoltChatMessageStorage_DeleteMessage(t *testing.T) {
+
+	// setup
+	db := createDB()
+	km := createKeyManager()
+	partner, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	storage := NewChatMessageStorage(db, []func(event MessagePersistedEvent){}, km)
+
+	deleted := make(chan MessageDeletedEvent, 1)
+	storage.AddDeleteListener(func(e MessageDeletedEvent) {
+		deleted <- e
+	})
+
+	require.Nil(t, storage.PersistMessageToSend(partner, Message{Message: []byte("first")}))
+	require.Nil(t, storage.PersistMessageToSend(partner, Message{Message: []byte("second")}))
+	messages, err := storage.Messages(partner, 0, 10)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(messages))
+	dbID := messages[1].DatabaseID
+
+	require.Nil(t, storage.DeleteMessage(partner, dbID))
+
+	// the message can't be fetched anymore
+	msg, err := storage.GetMessage(partner, dbID)
+	require.Error(t, err)
+	require.Nil(t, msg)
+	messages, err = storage.Messages(partner, 0, 10)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(messages))
+	require.Equal(t, []byte("first"), messages[0].Message)
+
+	// and is removed from the indexes
+	persisted, err := storage.GetMessagesByStatus(partner, StatusPersisted)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(persisted))
+
+	select {
+	case e := <-deleted:
+		require.Equal(t, partner, e.Partner)
+		require.Equal(t, dbID, e.DBMessageID)
+	case <-time.After(time.Second):
+		require.FailNow(t, "timed out")
+	}
+
+	// deleting an unknown message fails
+	require.Error(t, storage.DeleteMessage(partner, dbID))
+
+}
+
+func TestBoltChatMessageStorage_DeleteChat(t *testing.T) {
+
+	// setup
+	db := createDB()
+	km := createKeyManager()
+	partner, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	otherPartner, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	storage := NewChatMessageStorage(db, []func(event MessagePersistedEvent){}, km)
+
+	deleted := make(chan MessageDeletedEvent, 1)
+	storage.AddDeleteListener(func(e MessageDeletedEvent) {
+		deleted <- e
+	})
+
+	require.Nil(t, storage.PersistMessageToSend(partner, Message{Message: []byte("first")}))
+	require.Nil(t, storage.PersistMessageToSend(partner, Message{Message: []byte("second")}))
+	require.Nil(t, storage.PersistMessageToSend(otherPartner, Message{Message: []byte("other")}))
+
+	require.Nil(t, storage.DeleteChat(partner))
+
+	messages, err := storage.Messages(partner, 0, 10)
+	require.Nil(t, err)
+	require.Equal(t, 0, len(messages))
+	persisted, err := storage.GetMessagesByStatus(partner, StatusPersisted)
+	require.Nil(t, err)
+	require.Equal(t, 0, len(persisted))
+
+	// other chats are not touched
+	chats, err := storage.AllChatsSortedByActivity()
+	require.Nil(t, err)
+	require.Equal(t, []ed25519.PublicKey{otherPartner}, chats)
+
+	select {
+	case e := <-deleted:
+		require.Equal(t, partner, e.Partner)
+		require.Equal(t, int64(0), e.DBMessageID)
+	case <-time.After(time.Second):
+		require.FailNow(t, "timed out")
+	}
+
+}
+
+func TestBoltChatMessageStorage_UpdateMessage(t *testing.T) {
+
+	// setup
+	db := createDB()
+	km := createKeyManager()
+	partner, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	storage := NewChatMessageStorage(db, []func(event MessagePersistedEvent){}, km)
+
+	require.Nil(t, storage.PersistMessageToSend(partner, Message{Message: []byte("hi")}))
+	messages, err := storage.Messages(partner, 0, 1)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(messages))
+	dbID := messages[0].DatabaseID
+
+	// update message content
+	err = storage.UpdateMessage(partner, dbID, func(m *Message) error {
+		m.Message = []byte("hi there")
+		return nil
+	})
+	require.Nil(t, err)
+
+	// update status
+	require.Nil(t, storage.UpdateStatus(partner, dbID, StatusDelivered))
+
+	msg, err := storage.GetMessage(partner, dbID)
+	require.Nil(t, err)
+	require.Equal(t, "hi there", string(msg.Message))
+	require.Equal(t, StatusDelivered, msg.Status)
+	require.Equal(t, dbID, msg.DatabaseID)
+
+	// status index must be in sync
+	err = db.View(func(tx *bolt.Tx) error {
+		statusIndex := tx.Bucket(statusIndexBucketName)
+		require.Equal(t, 0, statusIndex.Bucket(uintToBytes(uint(StatusPersisted))).Stats().KeyN)
+		require.Equal(t, 1, statusIndex.Bucket(uintToBytes(uint(StatusDelivered))).Stats().KeyN)
+		return nil
+	})
+	require.Nil(t, err)
+
+	// updater errors must abort the update
+	err = storage.UpdateMessage(partner, dbID, func(m *Message) error {
+		return errors.New("abort")
+	})
+	require.EqualError(t, err, "abort")
+
+	// message doesn't exist
+	err = storage.UpdateMessage(partner, dbID+1, func(m *Message) error {
+		return nil
+	})
+	require.NotNil(t, err)
+
+}
+
+func TestBoltChatMessageStorage_UnreadMessages(t *testing.T) {
+
+	// setup
+	db := createDB()
+	km := createKeyManager()
+	partner, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	storage := NewChatMessageStorage(db, []func(event MessagePersistedEvent){}, km)
+
+	// sent messages are never unread
+	require.Nil(t, storage.PersistMessageToSend(partner, Message{Message: []byte("hi")}))
+
+	// received message
+	id, err := uuid.NewV4()
+	require.Nil(t, err)
+	require.Nil(t, storage.PersistReceivedMessage(partner, Message{
+		ID:        id.String(),
+		Message:   []byte("hi back"),
+		CreatedAt: time.Now().UnixNano(),
+		Sender:    partner,
+	}))
+
+	unread, err := storage.UnreadMessages()
+	require.Nil(t, err)
+	require.Equal(t, 1, unread)
+
+}
+
+type testPersistListener struct {
+	called chan struct{}
+}
+
+func (l *testPersistListener) handle(e MessagePersistedEvent) {
+	l.called <- struct{}{}
+}
+
+func TestBoltChatMessageStorage_RemoveListener(t *testing.T) {
+
+	// setup
+	db := createDB()
+	km := createKeyManager()
+	partner, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	storage := NewChatMessageStorage(db, []func(event MessagePersistedEvent){}, km)
+
+	// method values of the same method share the code pointer
+	removed := &testPersistListener{called: make(chan struct{}, 1)}
+	kept := &testPersistListener{called: make(chan struct{}, 1)}
+
+	remove := storage.AddListener(removed.handle)
+	storage.AddListener(kept.handle)
+	remove()
+	// removing twice is a no-op
+	remove()
+
+	require.Nil(t, storage.PersistMessageToSend(partner, Message{Message: []byte("hi")}))
+
+	select {
+	case <-kept.called:
+	case <-time.After(time.Second):
+		require.FailNow(t, "timed out")
+	}
+
+	select {
+	case <-removed.called:
+		require.FailNow(t, "removed listener must not be called")
+	case <-time.After(time.Millisecond * 100):
+	}
+
+}
+
+func TestBoltChatMessageStorage_Stats(t *testing.T) {
+
+	// setup
+	db := createDB()
+	km := createKeyManager()
+	partnerOne, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	partnerTwo, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	storage := NewChatMessageStorage(db, []func(event MessagePersistedEvent){}, km)
+
+	// empty storage
+	stats, err := storage.Stats()
+	require.Nil(t, err)
+	require.Equal(t, StorageStats{}, stats)
+
+	oldest := time.Unix(1500000000, 0)
+	newest := time.Unix(1600000000, 0)
+	persist := func(partner ed25519.PublicKey, createdAt time.Time) {
+		id, err := uuid.NewV4()
+		require.Nil(t, err)
+		require.Nil(t, storage.PersistReceivedMessage(partner, Message{
+			ID:        id.String(),
+			Message:   []byte("hi"),
+			CreatedAt: createdAt.UnixNano(),
+			Sender:    partner,
+		}))
+	}
+	persist(partnerOne, oldest)
+	persist(partnerOne, oldest.Add(time.Hour))
+	persist(partnerTwo, newest)
+
+	stats, err = storage.Stats()
+	require.Nil(t, err)
+	require.Equal(t, int64(3), stats.TotalMessages)
+	require.Equal(t, 2, stats.PartnerCount)
+	require.True(t, stats.TotalEncryptedBytes > 0)
+	require.Equal(t, oldest.Unix(), stats.OldestMessageUnix)
+	require.Equal(t, newest.Unix(), stats.NewestMessageUnix)
+
+}
+
+func BenchmarkMessages(b *testing.B) {
+
+	// setup
+	db := createDB()
+	km := createKeyManager()
+	partner, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(b, err)
+	storage := NewChatMessageStorage(db, []func(event MessagePersistedEvent){}, km)
+
+	for i := 0; i < 1000; i++ {
+		require.Nil(b, storage.PersistMessageToSend(partner, Message{Message: []byte("hi")}))
+	}
+
+	b.Run("sequential", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			messages, err := storage.messages(partner, 0, 1000, 1)
+			require.Nil(b, err)
+			require.Equal(b, 1000, len(messages))
+		}
+	})
+
+	b.Run("pipelined", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			messages, err := storage.messages(partner, 0, 1000, messagesDecryptWorkers)
+			require.Nil(b, err)
+			require.Equal(b, 1000, len(messages))
+		}
+	})
+
+}
@@ -0,0 +1,78 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+)
+
+// rewrite the whole database into a new file at newDBPath.
+// BoltDB doesn't shrink the file after deletions, rewriting
+// the data into an empty database drops the free pages.
+// All buckets are copied verbatim (values stay encrypted).
+// Returns the size of the old and the new database file.
+// The caller is responsible for replacing the old file with the new one.
+func (s *BoltChatMessageStorage) Compact(newDBPath string) (int64, int64, error) {
+
+	if newDBPath == s.db.Path() {
+		return 0, 0, errors.New("can't compact the database into it self")
+	}
+
+	oldInfo, err := os.Stat(s.db.Path())
+	if err != nil {
+		return 0, 0, err
+	}
+
+	newDB, err := bolt.Open(newDBPath, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	err = s.db.View(func(oldTx *bolt.Tx) error {
+		return oldTx.ForEach(func(name []byte, oldBucket *bolt.Bucket) error {
+			// one transaction per top level bucket
+			return newDB.Update(func(newTx *bolt.Tx) error {
+				newBucket, err := newTx.CreateBucket(name)
+				if err != nil {
+					return err
+				}
+				return copyBucket(oldBucket, newBucket)
+			})
+		})
+	})
+	if err != nil {
+		newDB.Close()
+		return 0, 0, err
+	}
+
+	if err := newDB.Close(); err != nil {
+		return 0, 0, err
+	}
+
+	newInfo, err := os.Stat(newDBPath)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return oldInfo.Size(), newInfo.Size(), nil
+
+}
+
+// copy all keys and nested buckets of from into to.
+// Bucket sequences are not copied - the pinned bolt version has
+// no way to set them and none of our buckets use NextSequence.
+func copyBucket(from, to *bolt.Bucket) error {
+	return from.ForEach(func(k, v []byte) error {
+		// nested bucket
+		if v == nil {
+			nested, err := to.CreateBucket(k)
+			if err != nil {
+				return err
+			}
+			return copyBucket(from.Bucket(k), nested)
+		}
+		return to.Put(k, v)
+	})
+}
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+	require "github.com/stretchr/testify/require"
+	ed25519 "golang.org/x/crypto/ed25519"
+)
+
+func TestBoltChatMessageStorage_Compact(t *testing.T) {
+
+	// setup
+	db := createDB()
+	km := createKeyManager()
+	partner, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	storage := NewChatMessageStorage(db, []func(event MessagePersistedEvent){}, km)
+
+	require.Nil(t, storage.PersistMessageToSend(partner, Message{Message: []byte("hi")}))
+	require.Nil(t, storage.PersistMessageToSend(partner, Message{Message: []byte("there")}))
+
+	// non message buckets
+	require.Nil(t, db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(sharedSecretBucketName)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("key"), []byte("value"))
+	}))
+
+	// can't compact into the same file
+	_, _, err = storage.Compact(db.Path())
+	require.EqualError(t, err, "can't compact the database into it self")
+
+	newDBPath, err := filepath.Abs(os.TempDir() + "/compacted-" + time.Now().String())
+	require.Nil(t, err)
+	oldSize, newSize, err := storage.Compact(newDBPath)
+	require.Nil(t, err)
+	require.True(t, oldSize > 0)
+	require.True(t, newSize > 0)
+
+	// the compacted database contains the same data
+	newDB, err := bolt.Open(newDBPath, 0600, &bolt.Options{Timeout: time.Second})
+	require.Nil(t, err)
+	newStorage := NewChatMessageStorage(newDB, []func(event MessagePersistedEvent){}, km)
+	messages, err := newStorage.Messages(partner, 0, 10)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(messages))
+	require.Equal(t, []byte("hi"), messages[0].Message)
+	require.Equal(t, []byte("there"), messages[1].Message)
+
+	require.Nil(t, newDB.View(func(tx *bolt.Tx) error {
+		require.Equal(t, []byte("value"), tx.Bucket(sharedSecretBucketName).Get([]byte("key")))
+		return nil
+	}))
+
+}
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 
@@ -9,6 +10,21 @@ import (
 	bolt "github.com/coreos/bbolt"
 )
 
+var (
+	ownerBucketName = []byte("km_owner")
+	ownerKey        = []byte("identity_public_key")
+)
+
+// returned if the database belongs to another identity
+type ErrDatabaseOwnerMismatch struct {
+	Expected string
+	Got      string
+}
+
+func (e ErrDatabaseOwnerMismatch) Error() string {
+	return fmt.Sprintf("database owner mismatch - expected: %s got: %s", e.Expected, e.Got)
+}
+
 // get database path for key manager
 func KMToDBPath(dir string, km *km.KeyManager) (string, error) {
 
@@ -21,10 +37,45 @@ func KMToDBPath(dir string, km *km.KeyManager) (string, error) {
 
 }
 
-// open a database
-func Open(path string, mode os.FileMode, options *bolt.Options) (*bolt.DB, error) {
+// persist the identity key of the key manager as the database owner
+// on first use. Returns ErrDatabaseOwnerMismatch if the database
+// belongs to another identity.
+func InitializeOwner(db *bolt.DB, km *km.KeyManager) error {
+
+	idPubKey, err := km.IdentityPublicKey()
+	if err != nil {
+		return err
+	}
+
+	return db.Update(func(tx *bolt.Tx) error {
 
-	migrations := []migration.Migration{}
+		ownerBucket, err := tx.CreateBucketIfNotExists(ownerBucketName)
+		if err != nil {
+			return err
+		}
+
+		// first open
+		owner := ownerBucket.Get(ownerKey)
+		if owner == nil {
+			return ownerBucket.Put(ownerKey, []byte(idPubKey))
+		}
+
+		if string(owner) != idPubKey {
+			return ErrDatabaseOwnerMismatch{
+				Expected: string(owner),
+				Got:      idPubKey,
+			}
+		}
+
+		return nil
+
+	})
+
+}
+
+// open the database of the key manager
+// pending migrations are executed before the database is returned
+func Open(path string, mode os.FileMode, options *bolt.Options, km *km.KeyManager, migrations []migration.Migration) (*bolt.DB, error) {
 
 	// migrate the database
 	err := migration.Migrate(path, migrations)
@@ -38,6 +89,12 @@ func Open(path string, mode os.FileMode, options *bolt.Options) (*bolt.DB, error
 		return nil, err
 	}
 
+	// make sure the database belongs to the key manager
+	if err := InitializeOwner(db, km); err != nil {
+		db.Close()
+		return nil, err
+	}
+
 	return db, nil
 
 }
@@ -0,0 +1,106 @@
+package db
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+	require "github.com/stretchr/testify/require"
+)
+
+func TestInitializeOwner(t *testing.T) {
+
+	db := createDB()
+	owner := createKeyManager()
+
+	// first open persists the owner
+	require.Nil(t, InitializeOwner(db, owner))
+	require.Nil(t, InitializeOwner(db, owner))
+
+	// other key manager must be rejected
+	other := createKeyManager()
+	err := InitializeOwner(db, other)
+	require.NotNil(t, err)
+
+	ownerIDKey, err := owner.IdentityPublicKey()
+	require.Nil(t, err)
+	otherIDKey, err := other.IdentityPublicKey()
+	require.Nil(t, err)
+
+	require.Equal(t, ErrDatabaseOwnerMismatch{
+		Expected: ownerIDKey,
+		Got:      otherIDKey,
+	}, InitializeOwner(db, other))
+
+}
+
+func TestOpenOwnerMismatch(t *testing.T) {
+
+	dbPath, err := filepath.Abs(os.TempDir() + "/" + time.Now().String())
+	require.Nil(t, err)
+
+	owner := createKeyManager()
+	db, err := Open(dbPath, 0600, &bolt.Options{Timeout: time.Second}, owner, Migrations)
+	require.Nil(t, err)
+	require.Nil(t, db.Close())
+
+	// opening with another key manager must fail
+	_, err = Open(dbPath, 0600, &bolt.Options{Timeout: time.Second}, createKeyManager(), Migrations)
+	require.NotNil(t, err)
+	_, isMismatch := err.(ErrDatabaseOwnerMismatch)
+	require.True(t, isMismatch)
+
+	// the owner can still open it
+	db, err = Open(dbPath, 0600, &bolt.Options{Timeout: time.Second}, owner, Migrations)
+	require.Nil(t, err)
+	require.Nil(t, db.Close())
+
+}
+
+func TestOpenRunsMigrations(t *testing.T) {
+
+	dbPath, err := filepath.Abs(os.TempDir() + "/" + time.Now().String())
+	require.Nil(t, err)
+
+	// pre populate a version 0 database
+	rawDB, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: time.Second})
+	require.Nil(t, err)
+	err = rawDB.Update(func(tx *bolt.Tx) error {
+		system, err := tx.CreateBucket([]byte("system"))
+		if err != nil {
+			return err
+		}
+		if err := system.Put([]byte("database_version"), make([]byte, 4)); err != nil {
+			return err
+		}
+		chats, err := tx.CreateBucket(privateChatBucketName)
+		if err != nil {
+			return err
+		}
+		return chats.Put([]byte("key"), []byte("value"))
+	})
+	require.Nil(t, err)
+	require.Nil(t, rawDB.Close())
+
+	db, err := Open(dbPath, 0600, &bolt.Options{Timeout: time.Second}, createKeyManager(), Migrations)
+	require.Nil(t, err)
+
+	err = db.View(func(tx *bolt.Tx) error {
+		// version must be bumped
+		version := tx.Bucket([]byte("system")).Get([]byte("database_version"))
+		require.Equal(t, uint32(1), binary.BigEndian.Uint32(version))
+		// buckets must be created
+		require.NotNil(t, tx.Bucket(sharedSecretBucketName))
+		require.NotNil(t, tx.Bucket(signedPreKeyBucketName))
+		require.NotNil(t, tx.Bucket(chatActivityBucketName))
+		// existing data must be kept
+		require.Equal(t, []byte("value"), tx.Bucket(privateChatBucketName).Get([]byte("key")))
+		return nil
+	})
+	require.Nil(t, err)
+	require.Nil(t, db.Close())
+
+}
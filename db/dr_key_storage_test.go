@@ -2,6 +2,7 @@ package db
 
 import (
 	"encoding/hex"
+	"sync"
 	"testing"
 
 	aes "github.com/Bit-Nation/panthalassa/crypto/aes"
@@ -309,3 +310,33 @@ func TestStore_AllSuccess(t *testing.T) {
 	require.Equal(t, keyPairTwo.PrivateKey(), allKeys[keyPairTwo.PublicKey()][4])
 
 }
+
+func TestStore_ConcurrentPutGet(t *testing.T) {
+
+	km := createKeyManager()
+	db := createDB()
+
+	s := NewBoltDRKeyStorage(db, km)
+
+	crypto := dr.DefaultCrypto{}
+	keyPair, err := crypto.GenerateDH()
+	require.Nil(t, err)
+
+	wg := sync.WaitGroup{}
+	for i := uint(0); i < 20; i++ {
+		wg.Add(1)
+		go func(msgNum uint) {
+			defer wg.Done()
+			mk := dr.Key{byte(msgNum)}
+			s.Put(keyPair.PublicKey(), msgNum, mk)
+			fetchedMK, ok := s.Get(keyPair.PublicKey(), msgNum)
+			require.True(t, ok)
+			require.Equal(t, mk, fetchedMK)
+		}(i)
+	}
+	wg.Wait()
+
+	require.Equal(t, uint(20), s.Count(keyPair.PublicKey()))
+	require.Len(t, s.All()[keyPair.PublicKey()], 20)
+
+}
@@ -0,0 +1,254 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+
+	group "github.com/Bit-Nation/panthalassa/chat/group"
+	aes "github.com/Bit-Nation/panthalassa/crypto/aes"
+	km "github.com/Bit-Nation/panthalassa/keyManager"
+	bolt "github.com/coreos/bbolt"
+	ed25519 "golang.org/x/crypto/ed25519"
+)
+
+var (
+	groupChatBucketName      = []byte("group_chats")
+	groupSessionBucketName   = []byte("group_sessions")
+	groupSenderKeyBucketName = []byte("group_sender_keys")
+)
+
+// sender key of a member of a group
+type GroupSenderKey struct {
+	GroupID []byte            `json:"group_id"`
+	Member  ed25519.PublicKey `json:"member"`
+	Key     group.SenderKey   `json:"key"`
+}
+
+// persists the metadata of the groups we are a member of
+// and our sessions + the sender keys of the other members
+type GroupChatStorage interface {
+	// overwrites existing metadata of the group
+	Put(metadata group.Metadata) error
+	// returns nil if the group doesn't exist
+	Get(groupID []byte) (*group.Metadata, error)
+	All() ([]group.Metadata, error)
+	Delete(groupID []byte) error
+	// overwrites our existing session in the group
+	PutSession(session group.GroupSession) error
+	Sessions() ([]group.GroupSession, error)
+	DeleteSession(groupID []byte) error
+	// overwrites the existing sender key of the member
+	PutSenderKey(key GroupSenderKey) error
+	SenderKeys() ([]GroupSenderKey, error)
+	DeleteSenderKey(groupID []byte, member ed25519.PublicKey) error
+}
+
+type BoltGroupChatStorage struct {
+	db *bolt.DB
+	km *km.KeyManager
+}
+
+func NewBoltGroupChatStorage(db *bolt.DB, km *km.KeyManager) *BoltGroupChatStorage {
+	return &BoltGroupChatStorage{
+		db: db,
+		km: km,
+	}
+}
+
+func (s *BoltGroupChatStorage) Put(metadata group.Metadata) error {
+
+	if len(metadata.GroupID) != 32 {
+		return errors.New("group id must be 32 bytes long")
+	}
+
+	return s.put(groupChatBucketName, metadata.GroupID, metadata)
+
+}
+
+// encrypt the json encoded value and put it into the bucket
+func (s *BoltGroupChatStorage) put(bucketName, key []byte, value interface{}) error {
+
+	rawValue, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	ct, err := s.km.AESEncrypt(rawValue)
+	if err != nil {
+		return err
+	}
+
+	rawCt, err := ct.Marshal()
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(bucketName)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(key, rawCt)
+	})
+
+}
+
+// decrypt the cipher text into the value
+func (s *BoltGroupChatStorage) decryptInto(rawCt []byte, value interface{}) error {
+
+	ct, err := aes.Unmarshal(rawCt)
+	if err != nil {
+		return err
+	}
+
+	rawValue, err := s.km.AESDecrypt(ct)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(rawValue, value)
+
+}
+
+func (s *BoltGroupChatStorage) decrypt(rawCt []byte) (group.Metadata, error) {
+	metadata := group.Metadata{}
+	return metadata, s.decryptInto(rawCt, &metadata)
+}
+
+// call fn with every value of the bucket
+func (s *BoltGroupChatStorage) forEach(bucketName []byte, fn func(rawCt []byte) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketName)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(_, rawCt []byte) error {
+			return fn(rawCt)
+		})
+	})
+}
+
+func (s *BoltGroupChatStorage) delete(bucketName, key []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketName)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.Delete(key)
+	})
+}
+
+func (s *BoltGroupChatStorage) Get(groupID []byte) (*group.Metadata, error) {
+
+	var metadata *group.Metadata
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+
+		groupChats := tx.Bucket(groupChatBucketName)
+		if groupChats == nil {
+			return nil
+		}
+
+		rawCt := groupChats.Get(groupID)
+		if rawCt == nil {
+			return nil
+		}
+
+		m, err := s.decrypt(rawCt)
+		if err != nil {
+			return err
+		}
+		metadata = &m
+
+		return nil
+
+	})
+
+	return metadata, err
+
+}
+
+func (s *BoltGroupChatStorage) All() ([]group.Metadata, error) {
+
+	groups := []group.Metadata{}
+
+	err := s.forEach(groupChatBucketName, func(rawCt []byte) error {
+		m, err := s.decrypt(rawCt)
+		if err != nil {
+			return err
+		}
+		groups = append(groups, m)
+		return nil
+	})
+
+	return groups, err
+
+}
+
+func (s *BoltGroupChatStorage) Delete(groupID []byte) error {
+	return s.delete(groupChatBucketName, groupID)
+}
+
+func (s *BoltGroupChatStorage) PutSession(session group.GroupSession) error {
+	return s.put(groupSessionBucketName, session.GroupID[:], session)
+}
+
+func (s *BoltGroupChatStorage) Sessions() ([]group.GroupSession, error) {
+
+	sessions := []group.GroupSession{}
+
+	err := s.forEach(groupSessionBucketName, func(rawCt []byte) error {
+		session := group.GroupSession{}
+		if err := s.decryptInto(rawCt, &session); err != nil {
+			return err
+		}
+		sessions = append(sessions, session)
+		return nil
+	})
+
+	return sessions, err
+
+}
+
+func (s *BoltGroupChatStorage) DeleteSession(groupID []byte) error {
+	return s.delete(groupSessionBucketName, groupID)
+}
+
+// sender keys are stored by group id || member
+func senderKeyID(groupID []byte, member ed25519.PublicKey) []byte {
+	return append(append([]byte{}, groupID...), member...)
+}
+
+func (s *BoltGroupChatStorage) PutSenderKey(key GroupSenderKey) error {
+
+	if len(key.GroupID) != 32 {
+		return errors.New("group id must be 32 bytes long")
+	}
+	if len(key.Member) != ed25519.PublicKeySize {
+		return errors.New("member must be 32 bytes long")
+	}
+
+	return s.put(groupSenderKeyBucketName, senderKeyID(key.GroupID, key.Member), key)
+
+}
+
+func (s *BoltGroupChatStorage) SenderKeys() ([]GroupSenderKey, error) {
+
+	keys := []GroupSenderKey{}
+
+	err := s.forEach(groupSenderKeyBucketName, func(rawCt []byte) error {
+		key := GroupSenderKey{}
+		if err := s.decryptInto(rawCt, &key); err != nil {
+			return err
+		}
+		keys = append(keys, key)
+		return nil
+	})
+
+	return keys, err
+
+}
+
+func (s *BoltGroupChatStorage) DeleteSenderKey(groupID []byte, member ed25519.PublicKey) error {
+	return s.delete(groupSenderKeyBucketName, senderKeyID(groupID, member))
+}
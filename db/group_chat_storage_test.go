@@ -0,0 +1,122 @@
+package db
+
+import (
+	"crypto/rand"
+	"testing"
+
+	group "github.com/Bit-Nation/panthalassa/chat/group"
+	require "github.com/stretchr/testify/require"
+	ed25519 "golang.org/x/crypto/ed25519"
+)
+
+func TestBoltGroupChatStorage(t *testing.T) {
+
+	storage := NewBoltGroupChatStorage(createDB(), createKeyManager())
+
+	creator, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+
+	groupID := make([]byte, 32)
+	groupID[0] = 1
+
+	// unknown group
+	m, err := storage.Get(groupID)
+	require.Nil(t, err)
+	require.Nil(t, m)
+
+	// persist group
+	require.Nil(t, storage.Put(group.Metadata{
+		GroupID:   groupID,
+		Creator:   creator,
+		Members:   [][]byte{creator},
+		Version:   1,
+		Signature: []byte("signature"),
+	}))
+	m, err = storage.Get(groupID)
+	require.Nil(t, err)
+	require.NotNil(t, m)
+	require.Equal(t, []byte(creator), m.Creator)
+	require.Equal(t, uint64(1), m.Version)
+
+	all, err := storage.All()
+	require.Nil(t, err)
+	require.Len(t, all, 1)
+
+	// invalid group id
+	require.EqualError(t, storage.Put(group.Metadata{GroupID: []byte("id")}), "group id must be 32 bytes long")
+
+	// delete group
+	require.Nil(t, storage.Delete(groupID))
+	m, err = storage.Get(groupID)
+	require.Nil(t, err)
+	require.Nil(t, m)
+
+}
+
+func TestBoltGroupChatStorage_Sessions(t *testing.T) {
+
+	storage := NewBoltGroupChatStorage(createDB(), createKeyManager())
+
+	member, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+
+	session, err := group.NewGroupSession([]ed25519.PublicKey{member})
+	require.Nil(t, err)
+
+	// no sessions yet
+	sessions, err := storage.Sessions()
+	require.Nil(t, err)
+	require.Len(t, sessions, 0)
+
+	// persist session
+	require.Nil(t, storage.PutSession(*session))
+	sessions, err = storage.Sessions()
+	require.Nil(t, err)
+	require.Len(t, sessions, 1)
+	require.Equal(t, *session, sessions[0])
+
+	// delete session
+	require.Nil(t, storage.DeleteSession(session.GroupID[:]))
+	sessions, err = storage.Sessions()
+	require.Nil(t, err)
+	require.Len(t, sessions, 0)
+
+}
+
+func TestBoltGroupChatStorage_SenderKeys(t *testing.T) {
+
+	storage := NewBoltGroupChatStorage(createDB(), createKeyManager())
+
+	member, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+
+	session, err := group.NewGroupSession([]ed25519.PublicKey{member})
+	require.Nil(t, err)
+	senderKey, err := session.Distribution().Key()
+	require.Nil(t, err)
+
+	key := GroupSenderKey{
+		GroupID: session.GroupID[:],
+		Member:  member,
+		Key:     senderKey,
+	}
+
+	// persist sender key
+	require.Nil(t, storage.PutSenderKey(key))
+	keys, err := storage.SenderKeys()
+	require.Nil(t, err)
+	require.Equal(t, []GroupSenderKey{key}, keys)
+
+	// invalid member
+	require.EqualError(t, storage.PutSenderKey(GroupSenderKey{
+		GroupID: session.GroupID[:],
+		Member:  []byte("member"),
+	}), "member must be 32 bytes long")
+
+	// delete sender key
+	require.Nil(t, storage.DeleteSenderKey(session.GroupID[:], member))
+	keys, err = storage.SenderKeys()
+	require.Nil(t, err)
+	require.Len(t, keys, 0)
+
+}
@@ -20,6 +20,13 @@ type Migration interface {
 	Version() uint32
 }
 
+// migrations implementing TxMigration are executed in the same
+// write transaction that updates the database version
+type TxMigration interface {
+	Migration
+	MigrateTx(tx *bolt.Tx) error
+}
+
 var systemBucketName = []byte("system")
 
 func findNextMigration(currentVersion uint32, migrations []Migration) (Migration, error) {
@@ -72,6 +79,32 @@ var setupSystemBucket = func(db *bolt.DB) error {
 	})
 }
 
+// write the database version to the system bucket
+func setVersion(tx *bolt.Tx, version uint32) error {
+	buck := tx.Bucket(systemBucketName)
+	if buck == nil {
+		return errors.New("system bucket does not exist")
+	}
+	v := make([]byte, 4)
+	binary.BigEndian.PutUint32(v, version)
+	return buck.Put([]byte("database_version"), v)
+}
+
+// run the migration. Transactional migrations and the
+// version update are committed together or not at all.
+func runMigration(db *bolt.DB, m Migration) error {
+	txMigr, isTxMigr := m.(TxMigration)
+	if !isTxMigr {
+		return m.Migrate(db)
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		if err := txMigr.MigrateTx(tx); err != nil {
+			return err
+		}
+		return setVersion(tx, txMigr.Version())
+	})
+}
+
 // create a migration file and create the directory
 // structure needed for the file
 var prepareMigration = func(file string) (string, error) {
@@ -168,7 +201,7 @@ func Migrate(prodDBFile string, migrations []Migration) error {
 		}
 
 		// migrate up
-		if migErr := nextMigr.Migrate(prodDB); migErr != nil {
+		if migErr := runMigration(prodDB, nextMigr); migErr != nil {
 
 			// recover old database on error
 			// which requires to copy the backup to production
@@ -188,16 +221,14 @@ func Migrate(prodDBFile string, migrations []Migration) error {
 
 		}
 
+		// transactional migrations already updated the version
+		if _, isTxMigr := nextMigr.(TxMigration); isTxMigr {
+			continue
+		}
+
 		// update version of last migration on database
 		err = prodDB.Update(func(tx *bolt.Tx) error {
-			// fetch bucket
-			buck := tx.Bucket(systemBucketName)
-			if buck == nil {
-				return errors.New("system bucket does not exist")
-			}
-			v := make([]byte, 4)
-			binary.BigEndian.PutUint32(v, nextMigr.Version())
-			return buck.Put([]byte("database_version"), v)
+			return setVersion(tx, nextMigr.Version())
 		})
 		if err != nil {
 			return err
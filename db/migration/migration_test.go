@@ -26,6 +26,15 @@ func (m *migration) Migrate(db *bolt.DB) error {
 	return m.migrationFunction(db)
 }
 
+type txMigration struct {
+	migration
+	txMigrationFunction func(tx *bolt.Tx) error
+}
+
+func (m *txMigration) MigrateTx(tx *bolt.Tx) error {
+	return m.txMigrationFunction(tx)
+}
+
 func randomTempDBPath() (string, error) {
 	file := make([]byte, 50)
 	_, err := rand.Read(file)
@@ -307,3 +316,53 @@ func TestMigrateRevertChangesOnError(t *testing.T) {
 	})
 	require.Nil(t, err)
 }
+
+func TestMigrateTxMigration(t *testing.T) {
+
+	dbPath, err := randomTempDBPath()
+	require.Nil(t, err)
+
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: time.Second})
+	require.Nil(t, err)
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("system"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("database_version"), make([]byte, 4))
+	})
+	require.Nil(t, err)
+	require.Nil(t, db.Close())
+
+	migrations := []Migration{
+		&txMigration{
+			migration: migration{version: 1},
+			txMigrationFunction: func(tx *bolt.Tx) error {
+				_, err := tx.CreateBucket([]byte("key_value_store"))
+				return err
+			},
+		},
+		&txMigration{
+			migration: migration{version: 2},
+			txMigrationFunction: func(tx *bolt.Tx) error {
+				if _, err := tx.CreateBucket([]byte("half_done")); err != nil {
+					return err
+				}
+				return errors.New("i am a failing migration")
+			},
+		},
+	}
+
+	require.EqualError(t, Migrate(dbPath, migrations), "i am a failing migration")
+
+	db, err = bolt.Open(dbPath, 0600, &bolt.Options{Timeout: time.Second})
+	require.Nil(t, err)
+	err = db.View(func(tx *bolt.Tx) error {
+		// the failed migration must not leave anything behind
+		require.Nil(t, tx.Bucket([]byte("half_done")))
+		return nil
+	})
+	require.Nil(t, err)
+	require.Nil(t, db.Close())
+
+}
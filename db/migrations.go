@@ -0,0 +1,49 @@
+package db
+
+import (
+	migration "github.com/Bit-Nation/panthalassa/db/migration"
+	bolt "github.com/coreos/bbolt"
+)
+
+// migrations of the panthalassa database
+var Migrations = []migration.Migration{
+	bucketScaffoldingMigration{},
+}
+
+// creates the buckets the storages expect. Version 0 databases
+// got their buckets created lazily on the first write.
+type bucketScaffoldingMigration struct{}
+
+func (m bucketScaffoldingMigration) Version() uint32 {
+	return 1
+}
+
+func (m bucketScaffoldingMigration) Migrate(db *bolt.DB) error {
+	return db.Update(m.MigrateTx)
+}
+
+func (m bucketScaffoldingMigration) MigrateTx(tx *bolt.Tx) error {
+
+	buckets := [][]byte{
+		ownerBucketName,
+		privateChatBucketName,
+		statusIndexBucketName,
+		senderIndexBucketName,
+		chatActivityBucketName,
+		doubleRatchetKeyStoreBucket,
+		oneTimePreKeyStorageBucketName,
+		preKeyStoreBucket,
+		sharedSecretBucketName,
+		signedPreKeyBucketName,
+		userStorageBucketName,
+	}
+
+	for _, name := range buckets {
+		if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+
+}
@@ -0,0 +1,115 @@
+package db
+
+import (
+	"encoding/json"
+	"time"
+
+	aes "github.com/Bit-Nation/panthalassa/crypto/aes"
+	km "github.com/Bit-Nation/panthalassa/keyManager"
+	bolt "github.com/coreos/bbolt"
+	ed25519 "golang.org/x/crypto/ed25519"
+)
+
+var profileCacheBucketName = []byte("profile_cache")
+
+// serialized pre key bundle of a user that we fetched from the backend
+type CachedProfile struct {
+	PreKeyBundle []byte    `json:"pre_key_bundle"`
+	FetchedAt    time.Time `json:"fetched_at"`
+}
+
+// caches the pre key bundles of other users
+// keyed by their identity public key
+type ProfileCache interface {
+	// returns nil if nothing has been cached for the key
+	Get(idPubKey ed25519.PublicKey) (*CachedProfile, error)
+	Put(idPubKey ed25519.PublicKey, preKeyBundle []byte) error
+	Invalidate(idPubKey ed25519.PublicKey) error
+}
+
+type BoltProfileCache struct {
+	db *bolt.DB
+	km *km.KeyManager
+}
+
+func NewBoltProfileCache(db *bolt.DB, km *km.KeyManager) *BoltProfileCache {
+	return &BoltProfileCache{
+		db: db,
+		km: km,
+	}
+}
+
+func (c *BoltProfileCache) Get(idPubKey ed25519.PublicKey) (*CachedProfile, error) {
+
+	var cached *CachedProfile
+
+	err := c.db.View(func(tx *bolt.Tx) error {
+
+		profiles := tx.Bucket(profileCacheBucketName)
+		if profiles == nil {
+			return nil
+		}
+
+		rawCt := profiles.Get(idPubKey)
+		if rawCt == nil {
+			return nil
+		}
+
+		ct, err := aes.Unmarshal(rawCt)
+		if err != nil {
+			return err
+		}
+
+		rawCached, err := c.km.AESDecrypt(ct)
+		if err != nil {
+			return err
+		}
+
+		cached = &CachedProfile{}
+		return json.Unmarshal(rawCached, cached)
+
+	})
+
+	return cached, err
+
+}
+
+func (c *BoltProfileCache) Put(idPubKey ed25519.PublicKey, preKeyBundle []byte) error {
+
+	rawCached, err := json.Marshal(CachedProfile{
+		PreKeyBundle: preKeyBundle,
+		FetchedAt:    time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	ct, err := c.km.AESEncrypt(rawCached)
+	if err != nil {
+		return err
+	}
+
+	rawCt, err := ct.Marshal()
+	if err != nil {
+		return err
+	}
+
+	return c.db.Update(func(tx *bolt.Tx) error {
+		profiles, err := tx.CreateBucketIfNotExists(profileCacheBucketName)
+		if err != nil {
+			return err
+		}
+		return profiles.Put(idPubKey, rawCt)
+	})
+
+}
+
+func (c *BoltProfileCache) Invalidate(idPubKey ed25519.PublicKey) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		profiles := tx.Bucket(profileCacheBucketName)
+		if profiles == nil {
+			return nil
+		}
+		return profiles.Delete(idPubKey)
+	})
+}
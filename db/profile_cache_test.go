@@ -0,0 +1,41 @@
+package db
+
+import (
+	"crypto/rand"
+	"testing"
+	"time"
+
+	require "github.com/stretchr/testify/require"
+	ed25519 "golang.org/x/crypto/ed25519"
+)
+
+func TestBoltProfileCache(t *testing.T) {
+
+	// setup
+	db := createDB()
+	km := createKeyManager()
+	cache := NewBoltProfileCache(db, km)
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+
+	// nothing cached yet
+	cached, err := cache.Get(pub)
+	require.Nil(t, err)
+	require.Nil(t, cached)
+
+	// cache pre key bundle
+	require.Nil(t, cache.Put(pub, []byte("pre key bundle")))
+
+	cached, err = cache.Get(pub)
+	require.Nil(t, err)
+	require.NotNil(t, cached)
+	require.Equal(t, []byte("pre key bundle"), cached.PreKeyBundle)
+	require.True(t, time.Since(cached.FetchedAt) < time.Minute)
+
+	// invalidate cached pre key bundle
+	require.Nil(t, cache.Invalidate(pub))
+	cached, err = cache.Get(pub)
+	require.Nil(t, err)
+	require.Nil(t, cached)
+
+}
@@ -2,6 +2,8 @@ package db
 
 import (
 	"bytes"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"sort"
@@ -31,6 +33,18 @@ type SharedSecret struct {
 	IDInitParams []byte `json:"id_init_params"`
 }
 
+// check if two shared secrets are the same
+// the x3dh shared secret is compared in constant time
+func (s *SharedSecret) Equals(other *SharedSecret) bool {
+	if s == nil || other == nil {
+		return s == other
+	}
+	if subtle.ConstantTimeCompare(s.X3dhSS[:], other.X3dhSS[:]) != 1 {
+		return false
+	}
+	return bytes.Equal(s.BaseID, other.BaseID) && bytes.Equal(s.ID, other.ID)
+}
+
 // the persistedSharedSecret is almost the same as SharedSecret except for
 // that the X3dhSS value is an AES cipher text.
 type persistedSharedSecret struct {
@@ -75,6 +89,9 @@ type SharedSecretStorage interface {
 	Accept(partner ed25519.PublicKey, sharedSec *SharedSecret) error
 	// get sender public key and shared secret id
 	Get(key ed25519.PublicKey, sharedSecretID []byte) (*SharedSecret, error)
+	// delete accepted shared secrets older than max age
+	// the youngest accepted shared secret of a partner is kept
+	CleanupExpired(maxAge time.Duration) (int, error)
 }
 
 func NewBoltSharedSecretStorage(db *bolt.DB, km *keyManager.KeyManager) *BoltSharedSecretStorage {
@@ -117,6 +134,105 @@ func (b *BoltSharedSecretStorage) HasAny(partner ed25519.PublicKey) (bool, error
 	return hasAny, err
 }
 
+// count the shared secrets of a partner
+func (b *BoltSharedSecretStorage) Count(partner ed25519.PublicKey) (int, error) {
+	count := 0
+	err := b.db.View(func(tx *bolt.Tx) error {
+
+		// shared secrets bucket
+		sharedSecretBucket := tx.Bucket(sharedSecretBucketName)
+		if sharedSecretBucket == nil {
+			return nil
+		}
+
+		// shared secrets with partner
+		sharedSecretsPartner := sharedSecretBucket.Bucket(partner)
+		if sharedSecretsPartner == nil {
+			return nil
+		}
+
+		count = sharedSecretsPartner.Stats().KeyN
+		return nil
+
+	})
+	return count, err
+}
+
+// count the shared secrets of all partners
+// the map is keyed by the hex encoded partner key
+func (b *BoltSharedSecretStorage) CountAll() (map[string]int, error) {
+	counts := map[string]int{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+
+		// shared secrets bucket
+		sharedSecretBucket := tx.Bucket(sharedSecretBucketName)
+		if sharedSecretBucket == nil {
+			return nil
+		}
+
+		return sharedSecretBucket.ForEach(func(partner, value []byte) error {
+
+			// partner buckets don't have a value
+			if value != nil {
+				return nil
+			}
+
+			sharedSecretsPartner := sharedSecretBucket.Bucket(partner)
+			if sharedSecretsPartner == nil {
+				return nil
+			}
+
+			counts[hex.EncodeToString(partner)] = sharedSecretsPartner.Stats().KeyN
+			return nil
+
+		})
+
+	})
+	return counts, err
+}
+
+// fetch all shared secrets of a partner - youngest first
+func (b *BoltSharedSecretStorage) AllSharedSecrets(partner ed25519.PublicKey) ([]SharedSecret, error) {
+	sharedSecrets := []SharedSecret{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+
+		// shared secrets bucket
+		sharedSecretBucket := tx.Bucket(sharedSecretBucketName)
+		if sharedSecretBucket == nil {
+			return nil
+		}
+
+		// shared secrets with partner
+		sharedSecretsPartner := sharedSecretBucket.Bucket(partner)
+		if sharedSecretsPartner == nil {
+			return nil
+		}
+
+		return sharedSecretsPartner.ForEach(func(k, v []byte) error {
+			persisted := persistedSharedSecret{}
+			if err := json.Unmarshal(v, &persisted); err != nil {
+				return err
+			}
+			ss, err := decryptPersistedSharedSecret(persisted, b.km)
+			if err != nil {
+				return err
+			}
+			sharedSecrets = append(sharedSecrets, *ss)
+			return nil
+		})
+
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(sharedSecrets, func(i, j int) bool {
+		return sharedSecrets[i].CreatedAt.After(sharedSecrets[j].CreatedAt)
+	})
+
+	return sharedSecrets, nil
+}
+
 func (b *BoltSharedSecretStorage) GetYoungest(partner ed25519.PublicKey) (*SharedSecret, error) {
 	shSec := new(SharedSecret)
 	shSec = nil
@@ -250,6 +366,19 @@ func (b *BoltSharedSecretStorage) SecretForChatInitMsg(chatPartner ed25519.Publi
 }
 
 func (b *BoltSharedSecretStorage) Accept(partner ed25519.PublicKey, sharedSec *SharedSecret) error {
+
+	// make sure we accept the shared secret we stored
+	storedSharedSec, err := b.Get(partner, sharedSec.BaseID)
+	if err != nil {
+		return err
+	}
+	if storedSharedSec == nil {
+		return errors.New("can't accept shared secret that doesn't exist")
+	}
+	if !storedSharedSec.Equals(sharedSec) {
+		return errors.New("shared secret doesn't match the stored shared secret")
+	}
+
 	sharedSec.Accepted = true
 	return b.Put(partner, *sharedSec)
 }
@@ -296,3 +425,83 @@ func (b *BoltSharedSecretStorage) Get(partner ed25519.PublicKey, sharedSecretID
 
 	return ss, err
 }
+
+// delete all accepted shared secrets that were created before max age.
+// The youngest accepted shared secret of each partner is never deleted
+// since it's still needed for the chat.
+func (b *BoltSharedSecretStorage) CleanupExpired(maxAge time.Duration) (int, error) {
+	deleted := 0
+	err := b.db.Update(func(tx *bolt.Tx) error {
+
+		// shared secrets bucket
+		sharedSecretBucket := tx.Bucket(sharedSecretBucketName)
+		if sharedSecretBucket == nil {
+			return nil
+		}
+
+		// collect partners first since we can't
+		// delete while iterating
+		partners := [][]byte{}
+		err := sharedSecretBucket.ForEach(func(partner, value []byte) error {
+			// partner buckets don't have a value
+			if value == nil {
+				partners = append(partners, partner)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		expiredBefore := time.Now().Add(-maxAge)
+
+		for _, partner := range partners {
+
+			sharedSecretsPartner := sharedSecretBucket.Bucket(partner)
+			if sharedSecretsPartner == nil {
+				continue
+			}
+
+			// the values only need to be decoded
+			// the shared secret itself stays encrypted
+			var youngest []byte
+			var youngestCreatedAt time.Time
+			expired := [][]byte{}
+			err := sharedSecretsPartner.ForEach(func(k, v []byte) error {
+				ss := persistedSharedSecret{}
+				if err := json.Unmarshal(v, &ss); err != nil {
+					return err
+				}
+				if !ss.Accepted {
+					return nil
+				}
+				if youngest == nil || ss.CreatedAt.After(youngestCreatedAt) {
+					youngest = k
+					youngestCreatedAt = ss.CreatedAt
+				}
+				if ss.CreatedAt.Before(expiredBefore) {
+					expired = append(expired, k)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			for _, k := range expired {
+				if bytes.Equal(k, youngest) {
+					continue
+				}
+				if err := sharedSecretsPartner.Delete(k); err != nil {
+					return err
+				}
+				deleted++
+			}
+
+		}
+
+		return nil
+
+	})
+	return deleted, err
+}
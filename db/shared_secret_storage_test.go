@@ -2,6 +2,7 @@ package db
 
 import (
 	"crypto/rand"
+	"encoding/hex"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -71,6 +72,47 @@ func TestBoltSharedSecretStorage_Accept(t *testing.T) {
 	require.NotNil(t, ss)
 	require.True(t, ss.Accepted)
 
+	// accepting a different shared secret must fail
+	require.EqualError(t, storage.Accept(pub, &SharedSecret{
+		X3dhSS: [32]byte{3, 4},
+		ID:     []byte("shared-secret-id"),
+		BaseID: baseID,
+	}), "shared secret doesn't match the stored shared secret")
+
+	// accepting an unknown shared secret must fail
+	require.EqualError(t, storage.Accept(pub, &SharedSecret{
+		X3dhSS: [32]byte{1, 2},
+		BaseID: make([]byte, 32),
+	}), "can't accept shared secret that doesn't exist")
+
+}
+
+func TestSharedSecret_Equals(t *testing.T) {
+
+	ss := &SharedSecret{
+		X3dhSS: [32]byte{1, 2},
+		ID:     []byte("id"),
+		BaseID: []byte("base id"),
+	}
+
+	require.True(t, ss.Equals(&SharedSecret{
+		X3dhSS:   [32]byte{1, 2},
+		ID:       []byte("id"),
+		BaseID:   []byte("base id"),
+		Accepted: true,
+	}))
+	require.False(t, ss.Equals(&SharedSecret{
+		X3dhSS: [32]byte{1, 3},
+		ID:     []byte("id"),
+		BaseID: []byte("base id"),
+	}))
+	require.False(t, ss.Equals(&SharedSecret{
+		X3dhSS: [32]byte{1, 2},
+		ID:     []byte("other id"),
+		BaseID: []byte("base id"),
+	}))
+	require.False(t, ss.Equals(nil))
+
 }
 
 func TestBoltSharedSecretStorage_SecretForChatInitMsg(t *testing.T) {
@@ -199,3 +241,130 @@ func TestBoltSharedSecretStorage_HasAny(t *testing.T) {
 	require.True(t, has)
 
 }
+
+func TestBoltSharedSecretStorage_Count(t *testing.T) {
+
+	// setup
+	db := createDB()
+	km := createKeyManager()
+	storage := NewBoltSharedSecretStorage(db, km)
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+
+	// no shared secrets yet
+	count, err := storage.Count(pub)
+	require.Nil(t, err)
+	require.Equal(t, 0, count)
+
+	persist := func(partner ed25519.PublicKey) {
+		baseID := make([]byte, 32)
+		_, err := rand.Read(baseID)
+		require.Nil(t, err)
+		require.Nil(t, storage.Put(partner, SharedSecret{
+			X3dhSS: [32]byte{1, 2},
+			BaseID: baseID,
+		}))
+	}
+	persist(pub)
+	persist(pub)
+	persist(otherPub)
+
+	count, err = storage.Count(pub)
+	require.Nil(t, err)
+	require.Equal(t, 2, count)
+
+	counts, err := storage.CountAll()
+	require.Nil(t, err)
+	require.Equal(t, map[string]int{
+		hex.EncodeToString(pub):      2,
+		hex.EncodeToString(otherPub): 1,
+	}, counts)
+
+}
+
+func TestBoltSharedSecretStorage_AllSharedSecrets(t *testing.T) {
+
+	// setup
+	db := createDB()
+	km := createKeyManager()
+	storage := NewBoltSharedSecretStorage(db, km)
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+
+	// no shared secrets yet
+	all, err := storage.AllSharedSecrets(pub)
+	require.Nil(t, err)
+	require.Len(t, all, 0)
+
+	// persist an older and a younger shared secret
+	oldBaseID := make([]byte, 32)
+	oldBaseID[0] = 1
+	youngBaseID := make([]byte, 32)
+	youngBaseID[0] = 2
+	require.Nil(t, storage.Put(pub, SharedSecret{
+		X3dhSS:    [32]byte{1},
+		BaseID:    oldBaseID,
+		CreatedAt: time.Now().Add(-time.Hour),
+	}))
+	require.Nil(t, storage.Put(pub, SharedSecret{
+		X3dhSS:    [32]byte{2},
+		BaseID:    youngBaseID,
+		CreatedAt: time.Now(),
+	}))
+
+	all, err = storage.AllSharedSecrets(pub)
+	require.Nil(t, err)
+	require.Len(t, all, 2)
+	require.Equal(t, youngBaseID, all[0].BaseID)
+	require.Equal(t, byte(2), all[0].X3dhSS[0])
+	require.Equal(t, oldBaseID, all[1].BaseID)
+
+}
+
+func TestBoltSharedSecretStorage_CleanupExpired(t *testing.T) {
+
+	// setup
+	db := createDB()
+	km := createKeyManager()
+	storage := NewBoltSharedSecretStorage(db, km)
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+
+	persist := func(partner ed25519.PublicKey, accepted bool, age time.Duration) {
+		baseID := make([]byte, 32)
+		_, err := rand.Read(baseID)
+		require.Nil(t, err)
+		require.Nil(t, storage.Put(partner, SharedSecret{
+			X3dhSS:    [32]byte{1, 2},
+			BaseID:    baseID,
+			Accepted:  accepted,
+			CreatedAt: time.Now().Add(-age),
+		}))
+	}
+
+	// old accepted secrets are deleted
+	persist(pub, true, time.Hour*3)
+	persist(pub, true, time.Hour*2)
+	// young accepted secret
+	persist(pub, true, time.Minute)
+	// old secret that isn't accepted
+	persist(pub, false, time.Hour*3)
+	// only accepted secret of the partner is kept even if it's old
+	persist(otherPub, true, time.Hour*3)
+
+	deleted, err := storage.CleanupExpired(time.Hour)
+	require.Nil(t, err)
+	require.Equal(t, 2, deleted)
+
+	counts, err := storage.CountAll()
+	require.Nil(t, err)
+	require.Equal(t, map[string]int{
+		hex.EncodeToString(pub):      2,
+		hex.EncodeToString(otherPub): 1,
+	}, counts)
+
+}
@@ -26,6 +26,9 @@ type SignedPreKeyStorage interface {
 	Put(signedPreKey x3dh.KeyPair) error
 	Get(publicKey x3dh.PublicKey) (*x3dh.PrivateKey, error)
 	All() []*x3dh.KeyPair
+	// the signed pre key that is valid the longest
+	// nil if there is no signed pre key
+	Newest() (*SignedPreKey, error)
 }
 
 type SignedPreKey struct {
@@ -38,12 +41,15 @@ type SignedPreKey struct {
 type BoltSignedPreKeyStorage struct {
 	db *bolt.DB
 	km *keyManager.KeyManager
+	// used to determine until when a new key is valid
+	now func() time.Time
 }
 
 func NewBoltSignedPreKeyStorage(db *bolt.DB, km *keyManager.KeyManager) *BoltSignedPreKeyStorage {
 	return &BoltSignedPreKeyStorage{
-		db: db,
-		km: km,
+		db:  db,
+		km:  km,
+		now: time.Now,
 	}
 }
 
@@ -57,7 +63,7 @@ func (s *BoltSignedPreKeyStorage) Put(signedPreKey x3dh.KeyPair) error {
 		}
 
 		spk := SignedPreKey{
-			ValidTill:  time.Now().Add(SignedPreKeyValidTimeFrame).Unix(),
+			ValidTill:  s.now().Add(SignedPreKeyValidTimeFrame).Unix(),
 			PrivateKey: signedPreKey.PrivateKey,
 			PublicKey:  signedPreKey.PublicKey,
 			Version:    1,
@@ -149,9 +155,10 @@ func (s *BoltSignedPreKeyStorage) Get(publicKey x3dh.PublicKey) (*x3dh.PrivateKe
 	return privKey, err
 }
 
-func (s *BoltSignedPreKeyStorage) All() []*x3dh.KeyPair {
+// all persisted signed pre keys
+func (s *BoltSignedPreKeyStorage) all() ([]*SignedPreKey, error) {
 
-	signedPreKeys := []*x3dh.KeyPair{}
+	signedPreKeys := []*SignedPreKey{}
 
 	err := s.db.View(func(tx *bolt.Tx) error {
 
@@ -184,11 +191,7 @@ func (s *BoltSignedPreKeyStorage) All() []*x3dh.KeyPair {
 				return fmt.Errorf("got invalid private key (32x0) for public key: %x", pubKey)
 			}
 
-			// append signed pre key
-			signedPreKeys = append(signedPreKeys, &x3dh.KeyPair{
-				PrivateKey: signedPreKey.PrivateKey,
-				PublicKey:  signedPreKey.PublicKey,
-			})
+			signedPreKeys = append(signedPreKeys, signedPreKey)
 
 			return nil
 
@@ -196,11 +199,44 @@ func (s *BoltSignedPreKeyStorage) All() []*x3dh.KeyPair {
 
 	})
 
+	return signedPreKeys, err
+
+}
+
+func (s *BoltSignedPreKeyStorage) All() []*x3dh.KeyPair {
+
+	signedPreKeys, err := s.all()
 	// @todo we should return the error instead of just logging it
 	if err != nil {
 		logger.Error(err)
 	}
 
-	return signedPreKeys
+	keyPairs := []*x3dh.KeyPair{}
+	for _, signedPreKey := range signedPreKeys {
+		keyPairs = append(keyPairs, &x3dh.KeyPair{
+			PrivateKey: signedPreKey.PrivateKey,
+			PublicKey:  signedPreKey.PublicKey,
+		})
+	}
+
+	return keyPairs
+
+}
+
+func (s *BoltSignedPreKeyStorage) Newest() (*SignedPreKey, error) {
+
+	signedPreKeys, err := s.all()
+	if err != nil {
+		return nil, err
+	}
+
+	var newest *SignedPreKey
+	for _, signedPreKey := range signedPreKeys {
+		if newest == nil || signedPreKey.ValidTill > newest.ValidTill {
+			newest = signedPreKey
+		}
+	}
+
+	return newest, nil
 
 }
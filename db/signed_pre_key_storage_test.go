@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"testing"
+	"time"
 
 	x3dh "github.com/Bit-Nation/x3dh"
 	require "github.com/stretchr/testify/require"
@@ -39,3 +40,39 @@ func TestBoltSignedPreKeyStorage(t *testing.T) {
 	require.True(t, hex.EncodeToString(pairTwo.PrivateKey[:]) == hex.EncodeToString(keyPairs[0].PrivateKey[:]) || hex.EncodeToString(pairTwo.PrivateKey[:]) == hex.EncodeToString(keyPairs[1].PrivateKey[:]))
 
 }
+
+func TestBoltSignedPreKeyStorage_Newest(t *testing.T) {
+
+	// setup
+	db := createDB()
+	km := createKeyManager()
+	curve := x3dh.NewCurve25519(rand.Reader)
+	signedPreKeyStorage := NewBoltSignedPreKeyStorage(db, km)
+
+	// no signed pre key yet
+	newest, err := signedPreKeyStorage.Newest()
+	require.Nil(t, err)
+	require.Nil(t, newest)
+
+	now := time.Unix(1000, 0)
+	signedPreKeyStorage.now = func() time.Time {
+		return now
+	}
+
+	// persist key pairs
+	pairOne, err := curve.GenerateKeyPair()
+	require.Nil(t, err)
+	require.Nil(t, signedPreKeyStorage.Put(pairOne))
+	now = now.Add(time.Hour)
+	pairTwo, err := curve.GenerateKeyPair()
+	require.Nil(t, err)
+	require.Nil(t, signedPreKeyStorage.Put(pairTwo))
+
+	// the key persisted last is valid the longest
+	newest, err = signedPreKeyStorage.Newest()
+	require.Nil(t, err)
+	require.Equal(t, pairTwo.PublicKey, newest.PublicKey)
+	require.Equal(t, pairTwo.PrivateKey, newest.PrivateKey)
+	require.Equal(t, now.Add(SignedPreKeyValidTimeFrame).Unix(), newest.ValidTill)
+
+}
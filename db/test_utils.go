@@ -22,7 +22,12 @@ func createKeyManager() *km.KeyManager {
 		panic(err)
 	}
 
-	return km.CreateFromKeyStore(keyStore)
+	keyManager, err := km.CreateFromKeyStore(keyStore)
+	if err != nil {
+		panic(err)
+	}
+
+	return keyManager
 
 }
 
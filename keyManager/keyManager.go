@@ -4,8 +4,10 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 
 	aes "github.com/Bit-Nation/panthalassa/crypto/aes"
+	chacha20poly1305 "github.com/Bit-Nation/panthalassa/crypto/chacha20poly1305"
 	scrypt "github.com/Bit-Nation/panthalassa/crypto/scrypt"
 	ks "github.com/Bit-Nation/panthalassa/keyStore"
 	chatMigration "github.com/Bit-Nation/panthalassa/keyStore/migration/chat"
@@ -16,12 +18,26 @@ import (
 	x3dh "github.com/Bit-Nation/x3dh"
 	ethCrypto "github.com/ethereum/go-ethereum/crypto"
 	lp2pCrypto "github.com/libp2p/go-libp2p-crypto"
+	curve25519 "golang.org/x/crypto/curve25519"
 	ed25519 "golang.org/x/crypto/ed25519"
 )
 
+// returned by ECDH for public keys that would result in a known shared secret
+var ErrLowOrderPoint = errors.New("public key is a low order point")
+
+// cipher used by AESEncrypt for new cipher texts
+type CipherSuite uint8
+
+const (
+	CipherSuiteAESGCM CipherSuite = iota
+	// for devices without AES instructions
+	CipherSuiteChaCha20Poly1305
+)
+
 type KeyManager struct {
-	keyStore ks.Store
-	account  Store
+	keyStore    ks.Store
+	account     Store
+	cipherSuite CipherSuite
 }
 
 type Store struct {
@@ -59,19 +75,30 @@ func OpenWithPassword(store Store, pw string) (*KeyManager, error) {
 		return &KeyManager{}, err
 	}
 
-	return &KeyManager{
-		keyStore: keyStore,
-		account:  store,
-	}, nil
+	// make sure the decrypted key store has all the keys we need
+	km, err := CreateFromKeyStore(keyStore)
+	if err != nil {
+		return &KeyManager{}, err
+	}
+	km.account = store
+
+	return km, nil
 
 }
 
 //Open account with mnemonic.
 //This should only be used as a backup
-func OpenWithMnemonic(encryptedAccount Store, mnemonic string) (*KeyManager, error) {
+//The mnemonic can be in any supported language
+func OpenWithMnemonic(encryptedAccount Store, mne string) (*KeyManager, error) {
+
+	//the password is encrypted with the english mnemonic
+	m, err := mnemonic.FromString(mne)
+	if err != nil {
+		return &KeyManager{}, err
+	}
 
 	//decrypt password with mnemonic
-	pw, err := scrypt.DecryptCipherText(encryptedAccount.Password, []byte(mnemonic))
+	pw, err := scrypt.DecryptCipherText(encryptedAccount.Password, []byte(m.Canonical()))
 	if err != nil {
 		return &KeyManager{}, err
 	}
@@ -82,6 +109,12 @@ func OpenWithMnemonic(encryptedAccount Store, mnemonic string) (*KeyManager, err
 
 //Export the account
 func (km KeyManager) Export(pw, pwConfirm string) (Store, error) {
+	return km.ExportWithKDF(pw, pwConfirm, scrypt.ScryptConfig{})
+}
+
+//Export the account with the given key derivation function
+//(e.g. argon2id for devices with little RAM)
+func (km KeyManager) ExportWithKDF(pw, pwConfirm string, kdf scrypt.KDFConfig) (Store, error) {
 
 	//Exit if password's are not equal
 	if pw != pwConfirm {
@@ -95,13 +128,13 @@ func (km KeyManager) Export(pw, pwConfirm string) (Store, error) {
 	}
 
 	//encrypt key store with password
-	encryptedKeyStore, err := scrypt.NewCipherText(keyStore, []byte(pw))
+	encryptedKeyStore, err := scrypt.NewCipherText(keyStore, []byte(pw), kdf)
 	if err != nil {
 		return Store{}, err
 	}
 
 	//encrypt password with mnemonic
-	encryptedPassword, err := scrypt.NewCipherText([]byte(pw), []byte(km.keyStore.GetMnemonic().String()))
+	encryptedPassword, err := scrypt.NewCipherText([]byte(pw), []byte(km.keyStore.GetMnemonic().Canonical()), kdf)
 	if err != nil {
 		return Store{}, err
 	}
@@ -208,6 +241,7 @@ func (km KeyManager) IdentitySign(data []byte) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer ZeroBytes(idPriv)
 
 	return ed25519.Sign(idPriv, data), nil
 
@@ -248,33 +282,56 @@ func (km KeyManager) aesSecret() (aes.Secret, error) {
 	}
 
 	if len(AESSecretRaw) != 32 {
+		ZeroBytes(AESSecretRaw)
 		return aes.Secret{}, errors.New("aes secret must have a length of 32")
 	}
 
 	var AESSecret aes.Secret
 	copy(AESSecret[:], AESSecretRaw[:])
+	ZeroBytes(AESSecretRaw)
 
 	return AESSecret, nil
 }
 
-// decrypt a value with AES
+// change the cipher used for new cipher texts
+// existing cipher texts can still be decrypted
+func (km *KeyManager) SetCipherSuite(suite CipherSuite) {
+	km.cipherSuite = suite
+}
+
+// decrypt a value with the algorithm it was encrypted with
+// works for GCM, ChaCha20-Poly1305 and legacy CTR cipher texts
 func (km KeyManager) AESDecrypt(cipherText aes.CipherText) (aes.PlainText, error) {
 	aesSecret, err := km.aesSecret()
 	if err != nil {
 		return aes.PlainText{}, err
 	}
+	defer ZeroBytes(aesSecret[:])
 
-	return aes.CTRDecrypt(cipherText, aesSecret)
+	if cipherText.UsedAlgorithm() == aes.AlgorithmChaCha20Poly1305 {
+		return chacha20poly1305.Decrypt(cipherText, aesSecret)
+	}
+
+	return aes.Decrypt(cipherText, aesSecret)
 }
 
-// encrypt a value with aes
+// encrypt a value with the cipher suite of the key manager
+// (aes gcm by default)
 func (km KeyManager) AESEncrypt(plainText aes.PlainText) (aes.CipherText, error) {
 	aesSecret, err := km.aesSecret()
 	if err != nil {
 		return aes.CipherText{}, err
 	}
+	defer ZeroBytes(aesSecret[:])
 
-	return aes.CTREncrypt(plainText, aesSecret)
+	switch km.cipherSuite {
+	case CipherSuiteAESGCM:
+		return aes.GCMEncrypt(plainText, aesSecret)
+	case CipherSuiteChaCha20Poly1305:
+		return chacha20poly1305.Encrypt(plainText, aesSecret)
+	default:
+		return aes.CipherText{}, fmt.Errorf("unknown cipher suite: %d", km.cipherSuite)
+	}
 }
 
 func (km KeyManager) ChatIdKeyPair() (x3dh.KeyPair, error) {
@@ -311,6 +368,7 @@ func (km KeyManager) ChatIdKeyPair() (x3dh.KeyPair, error) {
 	}
 
 	copy(priv[:], rawPriv[:32])
+	ZeroBytes(rawPriv)
 	copy(pub[:], rawPub[:32])
 
 	return x3dh.KeyPair{
@@ -319,9 +377,83 @@ func (km KeyManager) ChatIdKeyPair() (x3dh.KeyPair, error) {
 	}, nil
 }
 
+// curve25519 diffie hellman with the chat identity key
+// the shared secret must never be handed to a DApp
+func (km KeyManager) ECDH(theirCurvePub []byte) ([]byte, error) {
+
+	if len(theirCurvePub) != 32 {
+		return nil, fmt.Errorf("curve25519 public key must have a length of 32 bytes - got %d", len(theirCurvePub))
+	}
+
+	var zero [32]byte
+	var pub [32]byte
+	copy(pub[:], theirCurvePub)
+	if pub == zero {
+		return nil, ErrLowOrderPoint
+	}
+
+	chatIDKeys, err := km.ChatIdKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	defer ZeroBytes(chatIDKeys.PrivateKey[:])
+
+	// curve25519 needs the plain array type
+	priv := [32]byte(chatIDKeys.PrivateKey)
+	defer ZeroBytes(priv[:])
+
+	var sharedSecret [32]byte
+	curve25519.ScalarMult(&sharedSecret, &priv, &pub)
+
+	// other low order points result in an all zero secret
+	if sharedSecret == zero {
+		return nil, ErrLowOrderPoint
+	}
+
+	return sharedSecret[:], nil
+
+}
+
+// keys (and there byte length) a key store must
+// contain in order to be usable by the key manager
+var requiredKeys = []struct {
+	name   string
+	length int
+}{
+	{name: identity.Ed25519PrivateKey, length: ed25519.PrivateKeySize},
+	{name: identity.Ed25519PublicKey, length: ed25519.PublicKeySize},
+	{name: ethereumMigration.KeyStoreKey, length: 32},
+	{name: chatMigration.MigrationPrivPrefix, length: 32},
+	{name: chatMigration.MigrationPubPrefix, length: 32},
+}
+
+// make sure all the derived keys we need are present
+// and have the correct length
+func validKeyStore(store ks.Store) error {
+	for _, rk := range requiredKeys {
+		hexKey, err := store.GetKey(rk.name)
+		if err != nil {
+			return fmt.Errorf("key store is missing key: %s", rk.name)
+		}
+		rawKey, err := hex.DecodeString(hexKey)
+		if err != nil {
+			return fmt.Errorf("key store contains invalid hex for key: %s", rk.name)
+		}
+		if len(rawKey) != rk.length {
+			return fmt.Errorf("invalid length of key: %s - expected %d bytes but got %d", rk.name, rk.length, len(rawKey))
+		}
+	}
+	return nil
+}
+
 //Create new key manager from key store
-func CreateFromKeyStore(ks ks.Store) *KeyManager {
-	return &KeyManager{
-		keyStore: ks,
+func CreateFromKeyStore(store ks.Store) (*KeyManager, error) {
+
+	if err := validKeyStore(store); err != nil {
+		return nil, err
 	}
+
+	return &KeyManager{
+		keyStore: store,
+	}, nil
 }
@@ -28,11 +28,20 @@ func TestCreateFromKeyStore(t *testing.T) {
 	ks, err := keyStore.NewFromMnemonic(mn)
 	require.Nil(t, err)
 
-	km := CreateFromKeyStore(ks)
+	km, err := CreateFromKeyStore(ks)
+	require.Nil(t, err)
 
 	require.Equal(t, km.keyStore, ks)
 }
 
+func TestCreateFromKeyStoreMissingKeys(t *testing.T) {
+
+	km, err := CreateFromKeyStore(keyStore.Store{})
+	require.EqualError(t, err, "key store is missing key: ed_25519_private_key")
+	require.Nil(t, km)
+
+}
+
 func TestExportFunction(t *testing.T) {
 
 	//create key storage
@@ -41,7 +50,8 @@ func TestExportFunction(t *testing.T) {
 	require.Nil(t, err)
 
 	//create key manager
-	km := CreateFromKeyStore(ks)
+	km, err := CreateFromKeyStore(ks)
+	require.Nil(t, err)
 
 	//Export the key storage via the key manager
 	//The export should be encrypted
@@ -58,6 +68,37 @@ func TestExportFunction(t *testing.T) {
 	require.Equal(t, jsonKeyStore, string(jsonKs))
 }
 
+func TestExportWithArgon2id(t *testing.T) {
+
+	//create key storage
+	jsonKeyStore := `{"mnemonic":"differ destroy head candy imitate barely wine ranch roof barrel sheriff blame umbrella visit sell green dress embark ramp cement rotate crawl session broom","keys":{"chat_identity_curve25519_private_key":"70bcdb281ab3cc1dc75199c33a0edec43fcfe1d70ee2fd11e4821c38a688186c","chat_identity_curve25519_public_key":"1b276c51c849b244a7c40814769c9ea71caad17516aabc1270c8bd2bc096ef45","ed_25519_private_key":"9d426d0eb4170529672df197454bc77cc36cb341c872bcee0bece79ac893b34a8c5de2e7d099b881ed6214f8add6cbba2a84f57546b7f0a6d39197c904529f3f","ed_25519_public_key":"8c5de2e7d099b881ed6214f8add6cbba2a84f57546b7f0a6d39197c904529f3f","encryption_key":"7dc02d78d98fff23d1f4500e4c8742fb26ad233db2d421d5bcb44306a2bb69e2","ethereum_private_key":"eba47c97d7a6688d03e41b145d26090216c4468231bb46677553141f75222d5c"},"version":1}`
+	ks, err := keyStore.UnmarshalStore(jsonKeyStore)
+	require.Nil(t, err)
+
+	//create key manager
+	km, err := CreateFromKeyStore(ks)
+	require.Nil(t, err)
+
+	store, err := km.ExportWithKDF("my_password", "my_password", panthScrypt.Argon2idConfig{})
+	require.Nil(t, err)
+	require.Equal(t, panthScrypt.KDFArgon2id, store.EncryptedKeyStore.KDF)
+	require.Equal(t, panthScrypt.KDFArgon2id, store.Password.KDF)
+
+	//the store can be opened with the password and mnemonic
+	km, err = OpenWithPassword(store, "my_password")
+	require.Nil(t, err)
+	jsonKs, err := km.keyStore.Marshal()
+	require.Nil(t, err)
+	require.Equal(t, jsonKeyStore, string(jsonKs))
+
+	km, err = OpenWithMnemonic(store, "differ destroy head candy imitate barely wine ranch roof barrel sheriff blame umbrella visit sell green dress embark ramp cement rotate crawl session broom")
+	require.Nil(t, err)
+	jsonKs, err = km.keyStore.Marshal()
+	require.Nil(t, err)
+	require.Equal(t, jsonKeyStore, string(jsonKs))
+
+}
+
 func TestOpenWithMnemonic(t *testing.T) {
 
 	//create key storage
@@ -66,7 +107,8 @@ func TestOpenWithMnemonic(t *testing.T) {
 	require.Nil(t, err)
 
 	//create key manager
-	km := CreateFromKeyStore(ks)
+	km, err := CreateFromKeyStore(ks)
+	require.Nil(t, err)
 
 	//Export the key storage via the key manager
 	//The export should be encrypted
@@ -92,7 +134,8 @@ func TestGetMnemonic(t *testing.T) {
 	require.Nil(t, err)
 
 	//key manager
-	km := CreateFromKeyStore(ks)
+	km, err := CreateFromKeyStore(ks)
+	require.Nil(t, err)
 
 	//Get address
 	mne := km.GetMnemonic()
@@ -108,7 +151,8 @@ func TestGetAddressFromPrivateKey(t *testing.T) {
 	require.Nil(t, err)
 
 	//key manager
-	km := CreateFromKeyStore(ks)
+	km, err := CreateFromKeyStore(ks)
+	require.Nil(t, err)
 
 	//Get address
 	addr, err := km.GetEthereumAddress()
@@ -125,7 +169,8 @@ func TestGetLibP2PPrivateKey(t *testing.T) {
 	require.Nil(t, err)
 
 	//key manager
-	km := CreateFromKeyStore(ks)
+	km, err := CreateFromKeyStore(ks)
+	require.Nil(t, err)
 
 	meshPriv, err := km.MeshPrivateKey()
 	require.Nil(t, err)
@@ -156,7 +201,8 @@ func TestGetEthereumPublicKey(t *testing.T) {
 	ks, err := keyStore.UnmarshalStore(jsonKeyStore)
 	require.Nil(t, err)
 
-	km := CreateFromKeyStore(ks)
+	km, err := CreateFromKeyStore(ks)
+	require.Nil(t, err)
 
 	ethPublicKey, err := km.GetEthereumPublicKey()
 	require.Nil(t, err)
@@ -172,7 +218,8 @@ func TestGetEthereumAddress(t *testing.T) {
 	ks, err := keyStore.UnmarshalStore(jsonKeyStore)
 	require.Nil(t, err)
 
-	km := CreateFromKeyStore(ks)
+	km, err := CreateFromKeyStore(ks)
+	require.Nil(t, err)
 
 	address, err := km.GetEthereumAddress()
 	require.Nil(t, err)
@@ -189,7 +236,8 @@ func TestKeyManager_EthereumSign(t *testing.T) {
 	require.Nil(t, err)
 
 	// create key manager
-	km := CreateFromKeyStore(ks)
+	km, err := CreateFromKeyStore(ks)
+	require.Nil(t, err)
 
 	// sample hash
 	hash := sha256.Sum256([]byte("hi"))
@@ -216,7 +264,8 @@ func TestKeyManager_IdentitySign(t *testing.T) {
 	require.Nil(t, err)
 
 	// create key manager
-	km := CreateFromKeyStore(ks)
+	km, err := CreateFromKeyStore(ks)
+	require.Nil(t, err)
 
 	// sign data
 	signedData, err := km.IdentitySign([]byte("hi"))
@@ -241,7 +290,8 @@ func TestKeyManager_AESEncryptDecrypt(t *testing.T) {
 	require.Nil(t, err)
 
 	// create key manager
-	km := CreateFromKeyStore(ks)
+	km, err := CreateFromKeyStore(ks)
+	require.Nil(t, err)
 
 	// encrypt the cipher text
 	cipherText, err := km.AESEncrypt([]byte("hi"))
@@ -251,6 +301,74 @@ func TestKeyManager_AESEncryptDecrypt(t *testing.T) {
 	plain, err := km.AESDecrypt(cipherText)
 	require.Nil(t, err)
 	require.Equal(t, "hi", string(plain))
+
+	// new data is encrypted with aes gcm
+	require.Equal(t, aes.AlgorithmGCM, cipherText.Algorithm)
+
+	// cipher texts created with aes ctr must still be readable
+	secret, err := km.aesSecret()
+	require.Nil(t, err)
+	legacyCipherText, err := aes.CTREncrypt([]byte("hi"), secret)
+	require.Nil(t, err)
+	plain, err = km.AESDecrypt(legacyCipherText)
+	require.Nil(t, err)
+	require.Equal(t, "hi", string(plain))
+
+	// switch to chacha20 poly1305 for new cipher texts
+	km.SetCipherSuite(CipherSuiteChaCha20Poly1305)
+	chachaCipherText, err := km.AESEncrypt([]byte("hi"))
+	require.Nil(t, err)
+	require.Equal(t, aes.AlgorithmChaCha20Poly1305, chachaCipherText.Algorithm)
+	plain, err = km.AESDecrypt(chachaCipherText)
+	require.Nil(t, err)
+	require.Equal(t, "hi", string(plain))
+
+	// aes gcm cipher texts are still readable
+	plain, err = km.AESDecrypt(cipherText)
+	require.Nil(t, err)
+	require.Equal(t, "hi", string(plain))
+}
+
+func TestKeyManager_ECDH(t *testing.T) {
+
+	newKeyManager := func() *KeyManager {
+		mn, err := mnemonic.New()
+		require.Nil(t, err)
+		ks, err := keyStore.NewFromMnemonic(mn)
+		require.Nil(t, err)
+		km, err := CreateFromKeyStore(ks)
+		require.Nil(t, err)
+		return km
+	}
+
+	alice := newKeyManager()
+	bob := newKeyManager()
+
+	aliceChatKeys, err := alice.ChatIdKeyPair()
+	require.Nil(t, err)
+	bobChatKeys, err := bob.ChatIdKeyPair()
+	require.Nil(t, err)
+
+	// both sides must calculate the same secret
+	aliceSecret, err := alice.ECDH(bobChatKeys.PublicKey[:])
+	require.Nil(t, err)
+	bobSecret, err := bob.ECDH(aliceChatKeys.PublicKey[:])
+	require.Nil(t, err)
+	require.Equal(t, aliceSecret, bobSecret)
+	require.Len(t, aliceSecret, 32)
+
+	// invalid length
+	_, err = alice.ECDH([]byte{1, 2, 3})
+	require.EqualError(t, err, "curve25519 public key must have a length of 32 bytes - got 3")
+
+	// low order points
+	_, err = alice.ECDH(make([]byte, 32))
+	require.Equal(t, ErrLowOrderPoint, err)
+	one := make([]byte, 32)
+	one[0] = 1
+	_, err = alice.ECDH(one)
+	require.Equal(t, ErrLowOrderPoint, err)
+
 }
 
 func TestV2KeyManager(t *testing.T) {
@@ -261,7 +379,8 @@ func TestV2KeyManager(t *testing.T) {
 	require.Nil(t, err)
 
 	// create key manager
-	km := CreateFromKeyStore(ks)
+	km, err := CreateFromKeyStore(ks)
+	require.Nil(t, err)
 
 	// test if export works
 	s, err := km.Export("pw", "pw")
@@ -0,0 +1,20 @@
+package keyManager
+
+import (
+	secure "github.com/Bit-Nation/panthalassa/crypto/secure"
+)
+
+// key material that is zeroed by a finalizer or by calling Zero.
+// It's implemented in crypto/secure so that the crypto packages
+// can use it without importing the key manager.
+type SecureBytes = secure.Bytes
+
+// wrap key material - the caller must not use b afterwards
+func NewSecureBytes(b []byte) *SecureBytes {
+	return secure.NewBytes(b)
+}
+
+// overwrite key material with zeros once it's not needed anymore
+func ZeroBytes(b []byte) {
+	secure.Zero(b)
+}
@@ -0,0 +1,136 @@
+package mnemonic
+
+import (
+	"errors"
+	"fmt"
+)
+
+// language of the BIP-39 word list a mnemonic is written in
+type Language uint8
+
+const (
+	English Language = iota
+	Japanese
+	Spanish
+	ChineseSimplified
+	ChineseTraditional
+	French
+	Italian
+	Korean
+	Czech
+	Portuguese
+)
+
+func (l Language) String() string {
+	switch l {
+	case English:
+		return "english"
+	case Japanese:
+		return "japanese"
+	case Spanish:
+		return "spanish"
+	case ChineseSimplified:
+		return "chinese_simplified"
+	case ChineseTraditional:
+		return "chinese_traditional"
+	case French:
+		return "french"
+	case Italian:
+		return "italian"
+	case Korean:
+		return "korean"
+	case Czech:
+		return "czech"
+	case Portuguese:
+		return "portuguese"
+	default:
+		return fmt.Sprintf("unknown language %d", l)
+	}
+}
+
+// word lists of the languages we support. A list must contain
+// the 2048 words of the BIP-39 spec in their original order.
+// (https://github.com/bitcoin/bips/tree/master/bip-0039)
+var wordLists = map[Language][]string{
+	English:            englishWordList,
+	Japanese:           japaneseWordList,
+	Spanish:            spanishWordList,
+	ChineseSimplified:  chineseSimplifiedWordList,
+	ChineseTraditional: chineseTraditionalWordList,
+	French:             frenchWordList,
+	Italian:            italianWordList,
+	Korean:             koreanWordList,
+	Czech:              czechWordList,
+	Portuguese:         portugueseWordList,
+}
+
+// order in which we try to detect the language of a mnemonic
+var detectionOrder = []Language{
+	English,
+	Japanese,
+	Spanish,
+	ChineseSimplified,
+	ChineseTraditional,
+	French,
+	Italian,
+	Korean,
+	Czech,
+	Portuguese,
+}
+
+func wordList(l Language) ([]string, error) {
+	words, exist := wordLists[l]
+	if !exist || len(words) != 2048 {
+		return nil, fmt.Errorf("word list for %s is not available", l)
+	}
+	return words, nil
+}
+
+// words are separated by an ideographic space in japanese mnemonics
+func wordSeparator(l Language) string {
+	if l == Japanese {
+		return "　"
+	}
+	return " "
+}
+
+// detect the language of the words and decode them. All words
+// must be part of the word list of the language. Since some lists
+// share words (e.g. the chinese ones) the first language the words
+// decode with a valid checksum in wins.
+func detectLanguage(words []string) (Language, []byte, error) {
+
+	for _, l := range detectionOrder {
+
+		list, err := wordList(l)
+		if err != nil {
+			continue
+		}
+
+		index := map[string]bool{}
+		for _, w := range list {
+			index[w] = true
+		}
+
+		matchesAll := true
+		for _, w := range words {
+			if !index[w] {
+				matchesAll = false
+				break
+			}
+		}
+		if !matchesAll {
+			continue
+		}
+
+		entropy, err := decodeWords(words, list)
+		if err != nil {
+			continue
+		}
+		return l, entropy, nil
+
+	}
+
+	return English, nil, errors.New("failed to detect language of mnemonic")
+
+}
@@ -2,26 +2,50 @@ package mnemonic
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"errors"
+	"fmt"
+	"math/big"
+	"strings"
 
 	bip39 "github.com/tyler-smith/go-bip39"
+	norm "golang.org/x/text/unicode/norm"
 )
 
 type Mnemonic struct {
+	//always the english mnemonic - keys are derived from it
 	mnemonic string
+	//language the mnemonic is presented in
+	language Language
 }
 
 //Create Mnemonic from string
+//the language is detected from the words
 //@todo should also check if = 24 word's long
 func FromString(mnemonic string) (Mnemonic, error) {
 
-	if !bip39.IsMnemonicValid(mnemonic) {
+	if bip39.IsMnemonicValid(mnemonic) {
+		return Mnemonic{
+			mnemonic: mnemonic,
+			language: English,
+		}, nil
+	}
+
+	//the word lists are NFKD normalized
+	words := strings.Fields(norm.NFKD.String(mnemonic))
+	language, entropy, err := detectLanguage(words)
+	if err != nil || language == English {
 		return Mnemonic{}, errors.New("got invalid mnemonic")
 	}
 
-	return Mnemonic{
-		mnemonic: mnemonic,
-	}, nil
+	//normalize to the english mnemonic of the same entropy
+	m, err := NewFromEntropy(entropy)
+	if err != nil {
+		return Mnemonic{}, err
+	}
+	m.language = language
+
+	return m, nil
 }
 
 //Mnemonic factory
@@ -42,6 +66,110 @@ func New() (Mnemonic, error) {
 	return FromString(m)
 }
 
+//Create Mnemonic that is presented in the given language
+func NewWithLanguage(language Language) (Mnemonic, error) {
+
+	if _, err := wordList(language); err != nil {
+		return Mnemonic{}, err
+	}
+
+	m, err := New()
+	if err != nil {
+		return Mnemonic{}, err
+	}
+	m.language = language
+
+	return m, nil
+}
+
+//Create Mnemonic from raw entropy
+//the entropy must have 16 to 32 bytes and a length that is a multiple of 4
+func NewFromEntropy(entropy []byte) (Mnemonic, error) {
+
+	if len(entropy) < 16 || len(entropy) > 32 || len(entropy)%4 != 0 {
+		return Mnemonic{}, fmt.Errorf("invalid entropy length %d - must be a multiple of 4 between 16 and 32", len(entropy))
+	}
+
+	m, err := bip39.NewMnemonic(entropy)
+	if err != nil {
+		return Mnemonic{}, err
+	}
+
+	return FromString(m)
+}
+
+//Decode the mnemonic back to the entropy it was created from
+func (m Mnemonic) Entropy() ([]byte, error) {
+	return decodeWords(strings.Fields(m.mnemonic), bip39.WordList)
+}
+
+//Decode the words of the word list to the entropy
+func decodeWords(words []string, list []string) ([]byte, error) {
+
+	if len(words)%3 != 0 || len(words) < 12 || len(words) > 24 {
+		return nil, errors.New("invalid amount of mnemonic words")
+	}
+
+	//Index of each word in the word list
+	wordIndex := map[string]int64{}
+	for i, w := range list {
+		wordIndex[w] = int64(i)
+	}
+
+	//Each word encodes 11 bits
+	bits := big.NewInt(0)
+	for _, w := range words {
+		index, exist := wordIndex[w]
+		if !exist {
+			return nil, fmt.Errorf("unknown mnemonic word: %s", w)
+		}
+		bits.Lsh(bits, 11)
+		bits.Or(bits, big.NewInt(index))
+	}
+
+	//The last bits are the checksum (1 bit per 32 bits of entropy)
+	checksumBits := uint(len(words) * 11 / 33)
+	checksum := new(big.Int).And(bits, big.NewInt(1<<checksumBits-1))
+	bits.Rsh(bits, checksumBits)
+
+	entropy := make([]byte, int(checksumBits)*4)
+	rawEntropy := bits.Bytes()
+	copy(entropy[len(entropy)-len(rawEntropy):], rawEntropy)
+
+	//Verify the checksum
+	hash := sha256.Sum256(entropy)
+	expectedChecksum := uint64(hash[0]) >> (8 - checksumBits)
+	if checksum.Uint64() != expectedChecksum {
+		return nil, errors.New("invalid mnemonic checksum")
+	}
+
+	return entropy, nil
+
+}
+
+//Encode the entropy with the words of the word list
+func encodeWords(entropy []byte, list []string) []string {
+
+	//Append the checksum (1 bit per 32 bits of entropy)
+	checksumBits := uint(len(entropy) / 4)
+	hash := sha256.Sum256(entropy)
+	bits := new(big.Int).SetBytes(entropy)
+	bits.Lsh(bits, checksumBits)
+	bits.Or(bits, big.NewInt(int64(hash[0]>>(8-checksumBits))))
+
+	//Each word encodes 11 bits
+	words := make([]string, (len(entropy)*8+int(checksumBits))/11)
+	mask := big.NewInt(2047)
+	for i := len(words) - 1; i >= 0; i-- {
+		index := new(big.Int).And(bits, mask)
+		words[i] = list[index.Int64()]
+		bits.Rsh(bits, 11)
+	}
+
+	return words
+
+}
+
 //Generate new seed of mnemonic and password
 func (m Mnemonic) NewSeed(password string) ([]byte, error) {
 
@@ -53,11 +181,40 @@ func (m Mnemonic) NewSeed(password string) ([]byte, error) {
 
 }
 
+//The mnemonic in the language it was created / imported with
 func (m Mnemonic) String() string {
 
 	if !bip39.IsMnemonicValid(m.mnemonic) {
 		panic("Got invalid mnemonic. This shouldn't happen since we check it in the FromString method")
 	}
 
+	if m.language == English {
+		return m.mnemonic
+	}
+
+	list, err := wordList(m.language)
+	if err != nil {
+		panic(err)
+	}
+	entropy, err := m.Entropy()
+	if err != nil {
+		panic(err)
+	}
+
+	return strings.Join(encodeWords(entropy, list), wordSeparator(m.language))
+}
+
+//The english mnemonic the keys are derived from
+//independent of the language of the mnemonic
+func (m Mnemonic) Canonical() string {
+
+	if !bip39.IsMnemonicValid(m.mnemonic) {
+		panic("Got invalid mnemonic. This shouldn't happen since we check it in the FromString method")
+	}
+
 	return m.mnemonic
 }
+
+func (m Mnemonic) Language() Language {
+	return m.language
+}
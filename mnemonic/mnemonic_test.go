@@ -1,11 +1,14 @@
 package mnemonic
 
 import (
+	"crypto/sha256"
 	"encoding/hex"
+	"strings"
 	"testing"
 
 	require "github.com/stretchr/testify/require"
 	bip39 "github.com/tyler-smith/go-bip39"
+	norm "golang.org/x/text/unicode/norm"
 )
 
 func TestNewFromString(t *testing.T) {
@@ -42,3 +45,188 @@ func TestSeed(t *testing.T) {
 	require.Equal(t, expectedSeed, newSeed)
 
 }
+
+func TestEntropy(t *testing.T) {
+
+	// bip39 test vectors
+	vectors := map[string]string{
+		"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f": "legal winner thank year wave sausage worth useful legal winner thank year wave sausage worth useful legal winner thank year wave sausage worth title",
+		"00000000000000000000000000000000":                                 "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+		"ffffffffffffffffffffffffffffffffffffffffffffffff":                 "zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo when",
+	}
+
+	for hexEntropy, mne := range vectors {
+
+		m, err := FromString(mne)
+		require.Nil(t, err)
+
+		entropy, err := m.Entropy()
+		require.Nil(t, err)
+		require.Equal(t, hexEntropy, hex.EncodeToString(entropy))
+
+		// must reproduce the mnemonic
+		fromEntropy, err := NewFromEntropy(entropy)
+		require.Nil(t, err)
+		require.Equal(t, mne, fromEntropy.String())
+
+	}
+
+}
+
+func TestNewFromEntropyInvalidLength(t *testing.T) {
+
+	_, err := NewFromEntropy(make([]byte, 12))
+	require.EqualError(t, err, "invalid entropy length 12 - must be a multiple of 4 between 16 and 32")
+
+	_, err = NewFromEntropy(make([]byte, 18))
+	require.EqualError(t, err, "invalid entropy length 18 - must be a multiple of 4 between 16 and 32")
+
+	_, err = NewFromEntropy(make([]byte, 36))
+	require.EqualError(t, err, "invalid entropy length 36 - must be a multiple of 4 between 16 and 32")
+
+}
+
+func TestEncodeWords(t *testing.T) {
+
+	entropy, err := hex.DecodeString("7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f")
+	require.Nil(t, err)
+	require.Equal(t, "legal winner thank year wave sausage worth useful legal winner thank yellow", strings.Join(encodeWords(entropy, bip39.WordList), " "))
+
+}
+
+func TestWordListsMatchOfficial(t *testing.T) {
+
+	// sha256 of the official word list files
+	// (https://github.com/bitcoin/bips/tree/master/bip-0039)
+	checksums := map[Language]string{
+		English:            "2f5eed53a4727b4bf8880d8f3f199efc90e58503646d9ff8eff3a2ed3b24dbda",
+		Japanese:           "2eed0aef492291e061633d7ad8117f1a2b03eb80a29d0e4e3117ac2528d05ffd",
+		Spanish:            "46846a5a0139d1e3cb77293e521c2865f7bcdb82c44e8d0a06a2cd0ecba48c0b",
+		ChineseSimplified:  "5c5942792bd8340cb8b27cd592f1015edf56a8c5b26276ee18a482428e7c5726",
+		ChineseTraditional: "417b26b3d8500a4ae3d59717d7011952db6fc2fb84b807f3f94ac734e89c1b5f",
+		French:             "ebc3959ab7801a1df6bac4fa7d970652f1df76b683cd2f4003c941c63d517e59",
+		Italian:            "d392c49fdb700a24cd1fceb237c1f65dcc128f6b34a8aacb58b59384b5c648c2",
+		Korean:             "9e95f86c167de88f450f0aaf89e87f6624a57f973c67b516e338e8e8b8897f60",
+		Czech:              "7e80e161c3e93d9554c2efb78d4e3cebf8fc727e9c52e03b83b94406bdcc95fc",
+		Portuguese:         "2685e9c194c82ae67e10ba59d9ea5345a23dc093e92276fc5361f6667d79cd3f",
+	}
+
+	for _, language := range detectionOrder {
+
+		list, err := wordList(language)
+		require.Nil(t, err, language.String())
+
+		file := sha256.Sum256([]byte(strings.Join(list, "\n") + "\n"))
+		require.Equal(t, checksums[language], hex.EncodeToString(file[:]), language.String())
+
+	}
+
+	require.Equal(t, bip39.WordList, englishWordList)
+
+}
+
+func TestEnglishTestVectors(t *testing.T) {
+
+	for _, v := range englishTestVectors() {
+
+		entropy, err := hex.DecodeString(v.entropy)
+		require.Nil(t, err)
+
+		m, err := NewFromEntropy(entropy)
+		require.Nil(t, err)
+		require.Equal(t, v.mnemonic, m.String())
+
+		seed, err := m.NewSeed("TREZOR")
+		require.Nil(t, err)
+		require.Equal(t, v.seed, hex.EncodeToString(seed))
+
+	}
+
+}
+
+func TestJapaneseTestVectors(t *testing.T) {
+
+	for _, v := range japaneseTestVectors() {
+
+		entropy, err := hex.DecodeString(v.entropy)
+		require.Nil(t, err)
+
+		m, err := NewFromEntropy(entropy)
+		require.Nil(t, err)
+		m.language = Japanese
+		// the word lists are NFKD normalized, the vectors are not
+		require.Equal(t, strings.Fields(norm.NFKD.String(v.mnemonic)), strings.Split(m.String(), "　"))
+
+		imported, err := FromString(v.mnemonic)
+		require.Nil(t, err)
+		require.Equal(t, Japanese, imported.Language())
+		require.Equal(t, m.Canonical(), imported.Canonical())
+
+	}
+
+}
+
+func TestNewWithLanguage(t *testing.T) {
+
+	for _, language := range detectionOrder {
+
+		m, err := NewWithLanguage(language)
+		require.Nil(t, err)
+		require.Equal(t, language, m.Language())
+		require.True(t, bip39.IsMnemonicValid(m.Canonical()))
+
+		// the words are in the chosen language
+		words := strings.Fields(m.String())
+		require.Len(t, words, 24)
+		if language != English {
+			require.NotEqual(t, m.Canonical(), m.String())
+		}
+
+		// round trip detects the language and keeps the canonical mnemonic
+		imported, err := FromString(m.String())
+		require.Nil(t, err)
+		require.Equal(t, language, imported.Language())
+		require.Equal(t, m.Canonical(), imported.Canonical())
+		require.Equal(t, m.String(), imported.String())
+
+		// keys are derived from the canonical mnemonic
+		seed, err := imported.NewSeed("")
+		require.Nil(t, err)
+		require.Equal(t, bip39.NewSeed(m.Canonical(), ""), seed)
+
+	}
+
+	// japanese words are separated by an ideographic space
+	m, err := NewWithLanguage(Japanese)
+	require.Nil(t, err)
+	require.Contains(t, m.String(), "　")
+
+}
+
+func TestNewWithLanguageUnavailable(t *testing.T) {
+
+	_, err := NewWithLanguage(Language(200))
+	require.EqualError(t, err, "word list for unknown language 200 is not available")
+
+}
+
+func TestFromStringInvalidChecksum(t *testing.T) {
+
+	m, err := NewFromEntropy(make([]byte, 32))
+	require.Nil(t, err)
+	m.language = Spanish
+
+	// flip a checksum bit of the last word
+	words := strings.Fields(m.String())
+	index := -1
+	for i, w := range spanishWordList {
+		if w == words[23] {
+			index = i
+		}
+	}
+	require.NotEqual(t, -1, index)
+	words[23] = spanishWordList[index^1]
+	_, err = FromString(strings.Join(words, " "))
+	require.EqualError(t, err, "got invalid mnemonic")
+
+}
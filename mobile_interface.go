@@ -1,6 +1,7 @@
 package panthalassa
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
@@ -11,6 +12,7 @@ import (
 	apiPB "github.com/Bit-Nation/panthalassa/api/pb"
 	backend "github.com/Bit-Nation/panthalassa/backend"
 	chat "github.com/Bit-Nation/panthalassa/chat"
+	scrypt "github.com/Bit-Nation/panthalassa/crypto/scrypt"
 	dapp "github.com/Bit-Nation/panthalassa/dapp"
 	dAppReg "github.com/Bit-Nation/panthalassa/dapp/registry"
 	db "github.com/Bit-Nation/panthalassa/db"
@@ -39,6 +41,13 @@ type StartConfig struct {
 	EnableDebugging     bool   `json:"enable_debugging"`
 	PrivChatEndpoint    string `json:"private_chat_endpoint"`
 	PrivChatBearerToken string `json:"private_chat_bearer_token"`
+	// extra headers sent to the private chat endpoint
+	// e.g. "X-Device-ID" and "X-App-Version"
+	PrivChatHeaders map[string]string `json:"private_chat_headers"`
+	Locale          string            `json:"locale"`
+	// called for a new bearer token once the private chat backend
+	// rejected the current one. Can't be passed in as json
+	PrivChatTokenRefresher func() (string, error) `json:"-"`
 }
 
 // create a new panthalassa instance
@@ -67,7 +76,7 @@ func start(dbDir string, km *keyManager.KeyManager, config StartConfig, client,
 	if err != nil {
 		return err
 	}
-	dbInstance, err := db.Open(dbPath, 0644, &bolt.Options{Timeout: time.Second})
+	dbInstance, err := db.Open(dbPath, 0644, &bolt.Options{Timeout: time.Second}, km, db.Migrations)
 	if err != nil {
 		return err
 	}
@@ -76,16 +85,31 @@ func start(dbDir string, km *keyManager.KeyManager, config StartConfig, client,
 	signedPreKeyStorage := db.NewBoltSignedPreKeyStorage(dbInstance, km)
 
 	// create backend
-	trans := backend.NewWSTransport(config.PrivChatEndpoint, config.PrivChatBearerToken, km)
-
-	backend, err := backend.NewBackend(trans, km, signedPreKeyStorage)
-	if err != nil {
-		return err
+	var trans backend.Transport = backend.NewWSTransport(backend.ServerConfig{
+		WebSocketUrl:       config.PrivChatEndpoint,
+		BearerToken:        config.PrivChatBearerToken,
+		ExtraHeaders:       config.PrivChatHeaders,
+		RefreshBearerToken: config.PrivChatTokenRefresher,
+	}, km)
+	if config.EnableDebugging {
+		trans = backend.NewLoggingTransport(trans, log.Logger("backend transport"))
 	}
 
 	// ui api
 	uiApi := uiapi.New(uiUpstream)
 
+	backendInstance, err := backend.NewServerBackend(
+		trans,
+		km,
+		signedPreKeyStorage,
+		uiApi,
+		backend.WithEndpoint(config.PrivChatEndpoint),
+		backend.WithProfileCache(db.NewBoltProfileCache(dbInstance, km), 0),
+	)
+	if err != nil {
+		return err
+	}
+
 	// open message storage
 	messageStorage := db.NewChatMessageStorage(dbInstance, []func(db.MessagePersistedEvent){}, km)
 
@@ -93,11 +117,19 @@ func start(dbDir string, km *keyManager.KeyManager, config StartConfig, client,
 	jobStorage := queue.NewStorage(dbInstance)
 	q := queue.New(jobStorage, 250, 4)
 
+	// retry the requests that were queued when we shut down
+	if err := q.RegisterProcessor(backend.NewRetryMessageProcessor(backendInstance, q)); err != nil {
+		return err
+	}
+
+	// shared secret storage
+	sharedSecretStorage := db.NewBoltSharedSecretStorage(dbInstance, km)
+
 	// chat
 	chatInstance, err := chat.NewChat(chat.Config{
 		MessageDB:            messageStorage,
-		Backend:              backend,
-		SharedSecretDB:       db.NewBoltSharedSecretStorage(dbInstance, km),
+		Backend:              backendInstance,
+		SharedSecretDB:       sharedSecretStorage,
 		KM:                   km,
 		DRKeyStorage:         db.NewBoltDRKeyStorage(dbInstance, km),
 		SignedPreKeyStorage:  signedPreKeyStorage,
@@ -105,17 +137,35 @@ func start(dbDir string, km *keyManager.KeyManager, config StartConfig, client,
 		UserStorage:          db.NewBoltUserStorage(dbInstance),
 		UiApi:                uiApi,
 		Queue:                q,
+		GroupChatStorage:     db.NewBoltGroupChatStorage(dbInstance, km),
 	})
 	if err != nil {
 		return err
 	}
 
+	// inform the ui about the chat connection
+	go func() {
+		for status := range chatInstance.ConnectStatusChan() {
+			if err := uiApi.Dispatch(uiapi.ChatStatusEvent{Status: status.String()}); err != nil {
+				logger.Error(err)
+			}
+		}
+	}()
+
+	// handle messages delivered directly by peers
+	p2pNetwork.HandleDirectMessages(chatInstance)
+
 	// dApp storage
 	dAppStorage := dapp.NewDAppStorage(dbInstance, uiApi)
 
 	// dApp registry
 	dAppRegistry, err := dAppReg.NewDAppRegistry(p2pNetwork.Host, dAppReg.Config{
 		EthWSEndpoint: config.EthWsEndpoint,
+		Locale:        config.Locale,
+		UiApi:         uiApi,
+		GroupChat:     &groupMessenger{chat: chatInstance},
+		// DApps only start once the user granted their permissions
+		PermissionStorage: dapp.NewBoltPermissionStorage(dbInstance),
 	}, deviceApi, km, dAppStorage, messageStorage, dbInstance)
 	if err != nil {
 		return err
@@ -123,14 +173,22 @@ func start(dbDir string, km *keyManager.KeyManager, config StartConfig, client,
 
 	//Create panthalassa instance
 	panthalassaInstance = &Panthalassa{
-		km:          km,
-		upStream:    client,
-		api:         deviceApi,
-		p2p:         p2pNetwork,
-		dAppReg:     dAppRegistry,
-		chat:        chatInstance,
-		db:          dbInstance,
-		dAppStorage: dAppStorage,
+		km:              km,
+		upStream:        client,
+		api:             deviceApi,
+		p2p:             p2pNetwork,
+		dAppReg:         dAppRegistry,
+		chat:            chatInstance,
+		backend:         backendInstance,
+		backendEndpoint: config.PrivChatEndpoint,
+		msgDB:           messageStorage,
+		sharedSecretDB:  sharedSecretStorage,
+		db:              dbInstance,
+		dAppStorage:     dAppStorage,
+		queue:           q,
+		jobStorage:      jobStorage,
+		signedProfile:   config.SignedProfile,
+		uiApi:           uiApi,
 	}
 
 	return nil
@@ -238,6 +296,23 @@ func ExportAccountStore(pw, pwConfirm string) (string, error) {
 
 }
 
+//Export the current account store with given password
+//kdf is the key derivation function ("scrypt" or "argon2id")
+func ExportAccountStoreWithKDF(pw, pwConfirm, kdf string) (string, error) {
+
+	if panthalassaInstance == nil {
+		return "", errors.New("you have to start panthalassa")
+	}
+
+	kdfConfig, err := scrypt.KDFConfigFromName(kdf)
+	if err != nil {
+		return "", err
+	}
+
+	return panthalassaInstance.ExportWithKDF(pw, pwConfirm, kdfConfig)
+
+}
+
 func IdentityPublicKey() (string, error) {
 
 	if panthalassaInstance == nil {
@@ -418,7 +493,7 @@ func CallDAppFunction(signingKey string, id int, args string) error {
 		return errors.New("dapp signign key must be 32 bytes long")
 	}
 
-	return panthalassaInstance.dAppReg.CallFunction(dAppSigningKey, uint(id), args)
+	return panthalassaInstance.dAppReg.CallFunction(dAppSigningKey, uint(id), args, time.Second*30)
 
 }
 
@@ -443,14 +518,37 @@ func StopDApp(dAppSingingKeyStr string) error {
 
 }
 
+// run a script in a DApp, only works after
+// connecting to a DApp development host
+func ExecuteDAppScript(signingKeyHex, script string) (string, error) {
+
+	if panthalassaInstance == nil {
+		return "", errors.New("you have to start panthalassa first")
+	}
+
+	// decode singing key
+	dAppSigningKey, err := hex.DecodeString(signingKeyHex)
+	if err != nil {
+		return "", err
+	}
+
+	// signing key must be 32 bytes long since it's and ed25519 pub key
+	if len(dAppSigningKey) != 32 {
+		return "", errors.New("DApp singing key must be 32 bytes long")
+	}
+
+	return panthalassaInstance.dAppReg.ExecuteScript(dAppSigningKey, script)
+
+}
+
 func DApps() (string, error) {
 
 	if panthalassaInstance == nil {
 		return "", errors.New("you have to start panthalassa first")
 	}
 
-	// fetch dApps
-	dApps, err := panthalassaInstance.dAppStorage.All()
+	// fetch dApps - newest installation first
+	dApps, err := panthalassaInstance.dAppStorage.AllSortedByInstallTime()
 	if err != nil {
 		return "", err
 	}
@@ -460,3 +558,327 @@ func DApps() (string, error) {
 	return string(rawDApps), err
 
 }
+
+// check the installed DApps for updates
+func CheckDAppUpdates(timeoutSeconds int) (string, error) {
+
+	if panthalassaInstance == nil {
+		return "", errors.New("you have to start panthalassa first")
+	}
+
+	updates, err := panthalassaInstance.dAppReg.CheckForUpdates(time.Second * time.Duration(timeoutSeconds))
+	if err != nil {
+		return "", err
+	}
+
+	rawUpdates, err := json.Marshal(updates)
+	return string(rawUpdates), err
+
+}
+
+// json array of the DApps that require the permission
+func GetDAppsByPermission(permission string) (string, error) {
+
+	if panthalassaInstance == nil {
+		return "", errors.New("you have to start panthalassa first")
+	}
+
+	dApps, err := panthalassaInstance.dAppStorage.FindByPermission(permission)
+	if err != nil {
+		return "", err
+	}
+
+	type dAppSummary struct {
+		Name           map[string]string `json:"name"`
+		UsedSigningKey string            `json:"used_signing_key"`
+		Version        int               `json:"version"`
+		Permissions    []string          `json:"permissions"`
+	}
+
+	summaries := []dAppSummary{}
+	for _, d := range dApps {
+		summaries = append(summaries, dAppSummary{
+			Name:           d.Name,
+			UsedSigningKey: hex.EncodeToString(d.UsedSigningKey),
+			Version:        d.Version,
+			Permissions:    d.Permissions,
+		})
+	}
+
+	rawSummaries, err := json.Marshal(summaries)
+	return string(rawSummaries), err
+
+}
+
+// health snapshot of panthalassa
+func GetStatus() (string, error) {
+
+	status := PanthalassaStatus{}
+
+	// a stopped instance is reported as not running
+	if panthalassaInstance != nil {
+		s, err := panthalassaInstance.Status()
+		if err != nil {
+			return "", err
+		}
+		status = s
+	}
+
+	rawStatus, err := json.Marshal(status)
+	return string(rawStatus), err
+
+}
+
+// statistics about the stored chat messages
+func GetStorageStats() (string, error) {
+
+	if panthalassaInstance == nil {
+		return "", errors.New("you have to start panthalassa first")
+	}
+
+	stats, err := panthalassaInstance.msgDB.Stats()
+	if err != nil {
+		return "", err
+	}
+
+	rawStats, err := json.Marshal(stats)
+	return string(rawStats), err
+
+}
+
+type sharedSecretInfo struct {
+	BaseIDHex        string `json:"base_id_hex"`
+	Accepted         bool   `json:"accepted"`
+	CreatedAtUnix    int64  `json:"created_at_unix"`
+	HasOneTimePreKey bool   `json:"has_one_time_pre_key"`
+}
+
+// information about the shared secrets with a partner
+// the shared secrets themselves are never exposed
+func GetSharedSecretInfo(partnerHex string) (string, error) {
+
+	if panthalassaInstance == nil {
+		return "", errors.New("you have to start panthalassa first")
+	}
+
+	partner, err := hex.DecodeString(partnerHex)
+	if err != nil {
+		return "", err
+	}
+	if len(partner) != 32 {
+		return "", errors.New("partner key must be 32 bytes long")
+	}
+
+	sharedSecrets, err := panthalassaInstance.sharedSecretDB.AllSharedSecrets(partner)
+	if err != nil {
+		return "", err
+	}
+
+	infos := []sharedSecretInfo{}
+	for _, ss := range sharedSecrets {
+		infos = append(infos, sharedSecretInfo{
+			BaseIDHex:        hex.EncodeToString(ss.BaseID),
+			Accepted:         ss.Accepted,
+			CreatedAtUnix:    ss.CreatedAt.Unix(),
+			HasOneTimePreKey: ss.UsedOneTimePreKey != nil,
+		})
+	}
+
+	rawInfos, err := json.Marshal(infos)
+	return string(rawInfos), err
+
+}
+
+// run in process diagnostics and return a JSON report
+func SelfTest() (string, error) {
+
+	if panthalassaInstance == nil {
+		return "", errors.New("you have to start panthalassa first")
+	}
+
+	rawReport, err := json.Marshal(panthalassaInstance.SelfTest())
+	return string(rawReport), err
+
+}
+
+// pause all DApps when the app goes to background
+func PauseAllDApps() error {
+
+	if panthalassaInstance == nil {
+		return errors.New("you have to start panthalassa first")
+	}
+
+	panthalassaInstance.dAppReg.PauseAll()
+	return nil
+
+}
+
+// resume all DApps when the app comes back to foreground
+func ResumeAllDApps() error {
+
+	if panthalassaInstance == nil {
+		return errors.New("you have to start panthalassa first")
+	}
+
+	panthalassaInstance.dAppReg.ResumeAll()
+	return nil
+
+}
+
+// should be called by the client once it refreshed
+// the bearer token of the private chat backend
+func UpdateBackendAuthToken(token string) error {
+
+	if panthalassaInstance == nil {
+		return errors.New("you have to start panthalassa first")
+	}
+
+	return panthalassaInstance.backend.UpdateAuthToken(token)
+
+}
+
+// returns an error if the private chat backend
+// isn't usable within the timeout
+func BackendHealthCheck(timeoutSeconds int) error {
+
+	if panthalassaInstance == nil {
+		return errors.New("you have to start panthalassa first")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(timeoutSeconds))
+	defer cancel()
+
+	return panthalassaInstance.backend.HealthCheck(ctx)
+
+}
+
+// json encoded metrics of the private chat backend
+func GetBackendStats() (string, error) {
+
+	if panthalassaInstance == nil {
+		return "", errors.New("you have to start panthalassa first")
+	}
+
+	stats, err := json.Marshal(panthalassaInstance.backend.Stats())
+	if err != nil {
+		return "", err
+	}
+
+	return string(stats), nil
+
+}
+
+// json encoded information about the p2p network
+func GetNetworkInfo() (string, error) {
+
+	if panthalassaInstance == nil {
+		return "", errors.New("you have to start panthalassa first")
+	}
+
+	info, err := json.Marshal(panthalassaInstance.p2p.Info())
+	if err != nil {
+		return "", err
+	}
+
+	return string(info), nil
+
+}
+
+// json encoded counters of the chat since panthalassa was started
+func GetChatStatistics() (string, error) {
+
+	if panthalassaInstance == nil {
+		return "", errors.New("you have to start panthalassa first")
+	}
+
+	stats, err := json.Marshal(panthalassaInstance.chat.Statistics())
+	if err != nil {
+		return "", err
+	}
+
+	return string(stats), nil
+
+}
+
+// persist an encrypted personal note
+// returns the id of the note
+func SaveNote(content string) (string, error) {
+
+	if panthalassaInstance == nil {
+		return "", errors.New("you have to start panthalassa first")
+	}
+
+	return panthalassaInstance.SaveNote(content)
+
+}
+
+// fetch a personal note by it's id
+func GetNote(noteID string) (string, error) {
+
+	if panthalassaInstance == nil {
+		return "", errors.New("you have to start panthalassa first")
+	}
+
+	return panthalassaInstance.GetNote(noteID)
+
+}
+
+// base64 encoded contact card that can be shared with others
+func GetContactCard() (string, error) {
+
+	if panthalassaInstance == nil {
+		return "", errors.New("you have to start panthalassa first")
+	}
+
+	card, err := panthalassaInstance.ContactCard()
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(card), nil
+
+}
+
+// add a contact from a base64 encoded contact card
+func AddContactFromCard(cardBase64 string) error {
+
+	if panthalassaInstance == nil {
+		return errors.New("you have to start panthalassa first")
+	}
+
+	card, err := base64.StdEncoding.DecodeString(cardBase64)
+	if err != nil {
+		return err
+	}
+
+	return panthalassaInstance.AddContactFromCard(card)
+
+}
+
+// respond to a request that was sent over the ui api
+// the response must be a JSON object
+func SendUIResponse(requestID string, response string) error {
+
+	if panthalassaInstance == nil {
+		return errors.New("you have to start panthalassa first")
+	}
+
+	resp := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(response), &resp); err != nil {
+		return err
+	}
+
+	return panthalassaInstance.uiApi.Receive(requestID, resp)
+
+}
+
+// create a new signed pre key and upload it to the backend
+func RefreshPreKeyBundle() error {
+
+	if panthalassaInstance == nil {
+		return errors.New("you have to start panthalassa first")
+	}
+
+	return panthalassaInstance.chat.RefreshPreKeyBundle()
+
+}
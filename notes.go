@@ -0,0 +1,76 @@
+package panthalassa
+
+import (
+	"errors"
+
+	bolt "github.com/coreos/bbolt"
+	uuid "github.com/satori/go.uuid"
+)
+
+// note id -> note encrypted with Chat.EncryptForSelf
+var selfNotesBucketName = []byte("self_notes")
+
+var ErrNoteNotFound = errors.New("note not found")
+
+// persist a personal note, returns the id of the note
+func (p *Panthalassa) SaveNote(content string) (string, error) {
+
+	encryptedNote, err := p.chat.EncryptForSelf([]byte(content))
+	if err != nil {
+		return "", err
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		return "", err
+	}
+
+	err = p.db.Update(func(tx *bolt.Tx) error {
+		notes, err := tx.CreateBucketIfNotExists(selfNotesBucketName)
+		if err != nil {
+			return err
+		}
+		return notes.Put(id.Bytes(), encryptedNote)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return id.String(), nil
+
+}
+
+// fetch a personal note by it's id
+func (p *Panthalassa) GetNote(noteID string) (string, error) {
+
+	id, err := uuid.FromString(noteID)
+	if err != nil {
+		return "", err
+	}
+
+	var encryptedNote []byte
+	err = p.db.View(func(tx *bolt.Tx) error {
+		notes := tx.Bucket(selfNotesBucketName)
+		if notes == nil {
+			return ErrNoteNotFound
+		}
+		note := notes.Get(id.Bytes())
+		if note == nil {
+			return ErrNoteNotFound
+		}
+		// copy since the value is only valid during the transaction
+		encryptedNote = append([]byte{}, note...)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	note, err := p.chat.DecryptFromSelf(encryptedNote)
+	if err != nil {
+		return "", err
+	}
+
+	return string(note), nil
+
+}
@@ -0,0 +1,70 @@
+package p2p
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io"
+
+	bpb "github.com/Bit-Nation/protobuffers"
+	proto "github.com/golang/protobuf/proto"
+	net "github.com/libp2p/go-libp2p-net"
+)
+
+const DirectMessageProtocol = "/chat/direct-message/0.0.0"
+
+// receives chat messages that were delivered directly
+// by a peer instead of through the backend
+type MessageReceiver interface {
+	ReceiveMessage(msg *bpb.ChatMessage) error
+}
+
+// register the direct message stream handler.
+// every message on the stream is a base64 encoded
+// protobuf chat message terminated by a new line
+func (n *Network) HandleDirectMessages(receiver MessageReceiver) {
+
+	n.Host.SetStreamHandler(DirectMessageProtocol, func(str net.Stream) {
+
+		go func() {
+
+			reader := bufio.NewReader(str)
+
+			for {
+
+				// read message from stream
+				encodedMsg, err := reader.ReadBytes(0x0A)
+				if err != nil {
+					if err == io.EOF {
+						str.Close()
+					} else {
+						logger.Error(err)
+						str.Reset()
+					}
+					break
+				}
+
+				// decode base64 message
+				rawMsg, err := base64.StdEncoding.DecodeString(string(encodedMsg[:len(encodedMsg)-1]))
+				if err != nil {
+					logger.Error(err)
+					continue
+				}
+
+				// unmarshal chat message
+				msg := &bpb.ChatMessage{}
+				if err := proto.Unmarshal(rawMsg, msg); err != nil {
+					logger.Error(err)
+					continue
+				}
+
+				if err := receiver.ReceiveMessage(msg); err != nil {
+					logger.Error(err)
+				}
+
+			}
+
+		}()
+
+	})
+
+}
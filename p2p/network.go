@@ -2,10 +2,12 @@ package p2p
 
 import (
 	"context"
+	"strings"
 
 	log "github.com/ipfs/go-log"
 	lp2p "github.com/libp2p/go-libp2p"
 	host "github.com/libp2p/go-libp2p-host"
+	metrics "github.com/libp2p/go-libp2p-metrics"
 	mplex "github.com/whyrusleeping/go-smux-multiplex"
 	msmux "github.com/whyrusleeping/go-smux-multistream"
 	yamux "github.com/whyrusleeping/go-smux-yamux"
@@ -15,12 +17,15 @@ var logger = log.Logger("network")
 
 func New() (*Network, error) {
 
+	bandwidth := metrics.NewBandwidthCounter()
+
 	//Create host
 	h, err := lp2p.New(context.Background(), func(cfg *lp2p.Config) error {
 		if err := lp2p.Defaults(cfg); err != nil {
 			return err
 		}
 		cfg.DisableSecio = false
+		cfg.Reporter = bandwidth
 
 		// add muxer
 		tpt := msmux.NewBlankTransport()
@@ -37,13 +42,51 @@ func New() (*Network, error) {
 	}
 
 	return &Network{
-		Host: h,
+		Host:      h,
+		Bandwidth: bandwidth,
 	}, nil
 
 }
 
 type Network struct {
 	Host host.Host
+	// optional, counts the traffic of the host
+	Bandwidth *metrics.BandwidthCounter
+}
+
+type NetworkInfo struct {
+	PeerID           string   `json:"peer_id"`
+	ConnectedPeers   int      `json:"connected_peers"`
+	RelayConnections int      `json:"relay_connections"`
+	BytesIn          uint64   `json:"bytes_in"`
+	BytesOut         uint64   `json:"bytes_out"`
+	Protocols        []string `json:"protocols"`
+}
+
+// information about the state of the network
+func (n *Network) Info() NetworkInfo {
+
+	info := NetworkInfo{
+		PeerID:         n.Host.ID().Pretty(),
+		ConnectedPeers: len(n.Host.Network().Peers()),
+		Protocols:      n.Host.Mux().Protocols(),
+	}
+
+	// connections relayed through another peer
+	for _, conn := range n.Host.Network().Conns() {
+		if strings.Contains(conn.RemoteMultiaddr().String(), "/p2p-circuit") {
+			info.RelayConnections++
+		}
+	}
+
+	if n.Bandwidth != nil {
+		totals := n.Bandwidth.GetBandwidthTotals()
+		info.BytesIn = uint64(totals.TotalIn)
+		info.BytesOut = uint64(totals.TotalOut)
+	}
+
+	return info
+
 }
 
 func (n *Network) Close() error {
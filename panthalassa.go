@@ -1,31 +1,53 @@
 package panthalassa
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"time"
 
 	api "github.com/Bit-Nation/panthalassa/api"
+	backend "github.com/Bit-Nation/panthalassa/backend"
 	chat "github.com/Bit-Nation/panthalassa/chat"
+	prekey "github.com/Bit-Nation/panthalassa/chat/prekey"
+	scrypt "github.com/Bit-Nation/panthalassa/crypto/scrypt"
 	dapp "github.com/Bit-Nation/panthalassa/dapp"
 	dAppReg "github.com/Bit-Nation/panthalassa/dapp/registry"
 	db "github.com/Bit-Nation/panthalassa/db"
 	keyManager "github.com/Bit-Nation/panthalassa/keyManager"
 	p2p "github.com/Bit-Nation/panthalassa/p2p"
+	profile "github.com/Bit-Nation/panthalassa/profile"
+	queue "github.com/Bit-Nation/panthalassa/queue"
+	uiapi "github.com/Bit-Nation/panthalassa/uiapi"
+	bpb "github.com/Bit-Nation/protobuffers"
+	x3dh "github.com/Bit-Nation/x3dh"
 	bolt "github.com/coreos/bbolt"
+	proto "github.com/golang/protobuf/proto"
 	lp2pCrypto "github.com/libp2p/go-libp2p-crypto"
 	peer "github.com/libp2p/go-libp2p-peer"
+	ed25519 "golang.org/x/crypto/ed25519"
 )
 
 type Panthalassa struct {
-	km          *keyManager.KeyManager
-	upStream    api.UpStream
-	api         *api.API
-	p2p         *p2p.Network
-	dAppReg     *dAppReg.Registry
-	chat        *chat.Chat
-	msgDB       *db.BoltChatMessageStorage
-	db          *bolt.DB
-	dAppStorage dapp.Storage
+	km              *keyManager.KeyManager
+	upStream        api.UpStream
+	api             *api.API
+	p2p             *p2p.Network
+	dAppReg         *dAppReg.Registry
+	chat            *chat.Chat
+	backend         *backend.Backend
+	backendEndpoint string
+	msgDB           *db.BoltChatMessageStorage
+	sharedSecretDB  *db.BoltSharedSecretStorage
+	db              *bolt.DB
+	dAppStorage     dapp.Storage
+	queue           *queue.Queue
+	jobStorage      queue.Storage
+	// base64 encoded protobuf profile
+	signedProfile string
+	uiApi         *uiapi.Api
 }
 
 //Stop the panthalassa instance
@@ -33,17 +55,69 @@ type Panthalassa struct {
 //to use the mesh network
 func (p *Panthalassa) Stop() error {
 	var err error
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := p.dAppReg.Shutdown(ctx); err != nil {
+		logger.Error(err)
+	}
+	// keep the requests that haven't been send to the backend yet
+	if err := p.backend.DrainQueueToStorage(p.jobStorage); err != nil {
+		logger.Error(err)
+	}
+	// the queue must be drained before the database is closed
+	if err := p.queue.Close(time.Second * 5); err != nil {
+		logger.Error(err)
+	}
 	err = p.db.Close()
 	err = p.p2p.Close()
 	err = p.chat.Close()
 	return err
 }
 
+type PanthalassaStatus struct {
+	Running           bool   `json:"running"`
+	BackendConnected  bool   `json:"backend_connected"`
+	P2PPeerCount      int    `json:"p2p_peer_count"`
+	DAppsRunning      int    `json:"dapps_running"`
+	UnreadMessages    int    `json:"unread_messages"`
+	IdentityPublicKey string `json:"identity_public_key"`
+}
+
+// snapshot of the current state
+// this must not make any network calls
+func (p *Panthalassa) Status() (PanthalassaStatus, error) {
+
+	unread, err := p.msgDB.UnreadMessages()
+	if err != nil {
+		return PanthalassaStatus{}, err
+	}
+
+	idKey, err := p.km.IdentityPublicKey()
+	if err != nil {
+		return PanthalassaStatus{}, err
+	}
+
+	return PanthalassaStatus{
+		Running:           true,
+		BackendConnected:  p.backend.Connected(),
+		P2PPeerCount:      len(p.p2p.Host.Network().Peers()),
+		DAppsRunning:      p.dAppReg.RunningDApps(),
+		UnreadMessages:    unread,
+		IdentityPublicKey: idKey,
+	}, nil
+
+}
+
 //Export account with the given password
 func (p *Panthalassa) Export(pw, pwConfirm string) (string, error) {
+	return p.ExportWithKDF(pw, pwConfirm, scrypt.ScryptConfig{})
+}
+
+//Export account with the given password and key derivation function
+func (p *Panthalassa) ExportWithKDF(pw, pwConfirm string, kdf scrypt.KDFConfig) (string, error) {
 
 	// export
-	store, err := p.km.Export(pw, pwConfirm)
+	store, err := p.km.ExportWithKDF(pw, pwConfirm, kdf)
 	if err != nil {
 		return "", err
 	}
@@ -90,3 +164,66 @@ func (p *Panthalassa) AddContact(pubKey string) error {
 	return p.p2p.Host.Peerstore().Put(id, "contact", true)
 
 }
+
+// contact card of the configured profile
+// together with our active signed pre key
+func (p *Panthalassa) ContactCard() ([]byte, error) {
+
+	if p.signedProfile == "" {
+		return nil, errors.New("no signed profile configured")
+	}
+
+	// decode signed profile
+	rawProfile, err := base64.StdEncoding.DecodeString(p.signedProfile)
+	if err != nil {
+		return nil, err
+	}
+	protoProfile := &bpb.Profile{}
+	if err := proto.Unmarshal(rawProfile, protoProfile); err != nil {
+		return nil, err
+	}
+	prof, err := profile.ProtobufToProfile(protoProfile)
+	if err != nil {
+		return nil, err
+	}
+
+	// sign our signed pre key
+	// rotated keys are kept to decrypt old messages
+	// so we pick the one that is valid the longest
+	newest, err := db.NewBoltSignedPreKeyStorage(p.db, p.km).Newest()
+	if err != nil {
+		return nil, err
+	}
+	if newest == nil || newest.ValidTill <= time.Now().Unix() {
+		return nil, errors.New("no signed pre key available")
+	}
+	signedPreKey := prekey.PreKey{}
+	signedPreKey.KeyPair = x3dh.KeyPair{
+		PrivateKey: newest.PrivateKey,
+		PublicKey:  newest.PublicKey,
+	}
+	if err := signedPreKey.Sign(*p.km); err != nil {
+		return nil, err
+	}
+
+	return prof.ContactCard(signedPreKey)
+
+}
+
+// add a contact from a contact card
+// the signed pre key of the card is used for the first message
+func (p *Panthalassa) AddContactFromCard(card []byte) error {
+
+	prof, signedPreKey, err := profile.ParseContactCard(card)
+	if err != nil {
+		return err
+	}
+
+	idKey := ed25519.PublicKey(prof.Information.IdentityPubKey)
+	if err := db.NewBoltUserStorage(p.db).PutSignedPreKey(idKey, *signedPreKey); err != nil {
+		return err
+	}
+
+	return p.AddContact(hex.EncodeToString(idKey))
+
+}
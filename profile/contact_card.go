@@ -0,0 +1,77 @@
+package profile
+
+import (
+	"errors"
+
+	prekey "github.com/Bit-Nation/panthalassa/chat/prekey"
+	pb "github.com/Bit-Nation/protobuffers"
+	proto "github.com/gogo/protobuf/proto"
+	ed25519 "golang.org/x/crypto/ed25519"
+)
+
+// serialize the profile together with the signed pre key
+// so that a contact can be added without fetching it from the backend.
+// The pre key bundle protobuf is used as the container.
+func (p *Profile) ContactCard(signedPreKey prekey.PreKey) ([]byte, error) {
+
+	protoProfile, err := p.ToProtobuf()
+	if err != nil {
+		return nil, err
+	}
+
+	protoSignedPreKey, err := signedPreKey.ToProtobuf()
+	if err != nil {
+		return nil, err
+	}
+
+	return proto.Marshal(&pb.BackendMessage_PreKeyBundle{
+		Profile:      protoProfile,
+		SignedPreKey: &protoSignedPreKey,
+	})
+
+}
+
+// parse a contact card and verify the signatures
+// of the profile and the signed pre key
+func ParseContactCard(data []byte) (*Profile, *prekey.PreKey, error) {
+
+	card := pb.BackendMessage_PreKeyBundle{}
+	if err := proto.Unmarshal(data, &card); err != nil {
+		return nil, nil, err
+	}
+	if card.Profile == nil {
+		return nil, nil, errors.New("contact card is missing the profile")
+	}
+	if card.SignedPreKey == nil {
+		return nil, nil, errors.New("contact card is missing the signed pre key")
+	}
+
+	// profile
+	prof, err := ProtobufToProfile(card.Profile)
+	if err != nil {
+		return nil, nil, err
+	}
+	valid, err := prof.SignaturesValid()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !valid {
+		return nil, nil, errors.New("contact card profile has invalid signatures")
+	}
+
+	// signed pre key must be signed by the profile owner
+	signedPreKey, err := prekey.FromProtoBuf(*card.SignedPreKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	valid, err = signedPreKey.VerifySignature(ed25519.PublicKey(prof.Information.IdentityPubKey))
+	if err != nil {
+		return nil, nil, err
+	}
+	if !valid {
+		return nil, nil, errors.New("contact card signed pre key has an invalid signature")
+	}
+
+	return prof, &signedPreKey, nil
+
+}
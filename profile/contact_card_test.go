@@ -0,0 +1,56 @@
+package profile
+
+import (
+	"crypto/rand"
+	"testing"
+
+	prekey "github.com/Bit-Nation/panthalassa/chat/prekey"
+	km "github.com/Bit-Nation/panthalassa/keyManager"
+	ks "github.com/Bit-Nation/panthalassa/keyStore"
+	mnemonic "github.com/Bit-Nation/panthalassa/mnemonic"
+	x3dh "github.com/Bit-Nation/x3dh"
+	require "github.com/stretchr/testify/require"
+)
+
+func TestContactCard(t *testing.T) {
+
+	mne, err := mnemonic.New()
+	require.Nil(t, err)
+	store, err := ks.NewFromMnemonic(mne)
+	require.Nil(t, err)
+	keyManager, err := km.CreateFromKeyStore(store)
+	require.Nil(t, err)
+
+	prof, err := SignProfile("Florian", "Earth", "base64", *keyManager)
+	require.Nil(t, err)
+
+	// signed pre key
+	c25519 := x3dh.NewCurve25519(rand.Reader)
+	keyPair, err := c25519.GenerateKeyPair()
+	require.Nil(t, err)
+	signedPreKey := prekey.PreKey{}
+	signedPreKey.KeyPair = keyPair
+	require.Nil(t, signedPreKey.Sign(*keyManager))
+
+	card, err := prof.ContactCard(signedPreKey)
+	require.Nil(t, err)
+
+	parsedProfile, parsedPreKey, err := ParseContactCard(card)
+	require.Nil(t, err)
+	require.Equal(t, "Florian", parsedProfile.Information.Name)
+	require.Equal(t, keyPair.PublicKey, parsedPreKey.PublicKey)
+
+	// pre key signed by someone else is rejected
+	otherMne, err := mnemonic.New()
+	require.Nil(t, err)
+	otherKs, err := ks.NewFromMnemonic(otherMne)
+	require.Nil(t, err)
+	otherKm, err := km.CreateFromKeyStore(otherKs)
+	require.Nil(t, err)
+	require.Nil(t, signedPreKey.Sign(*otherKm))
+	card, err = prof.ContactCard(signedPreKey)
+	require.Nil(t, err)
+	_, _, err = ParseContactCard(card)
+	require.EqualError(t, err, "contact card signed pre key has an invalid signature")
+
+}
@@ -238,6 +238,17 @@ func (p *Profile) EthereumAddress() (common.Address, error) {
 	return crypto.PubkeyToAddress(*decPubKey), nil
 }
 
+// time since the profile was signed
+// the signing timestamp is the creation time of the profile
+func (p *Profile) Age() time.Duration {
+	return time.Since(p.Information.Timestamp)
+}
+
+// check if the profile is older than max age
+func (p *Profile) IsExpired(maxAge time.Duration) bool {
+	return p.Age() > maxAge
+}
+
 // sign the metadata with identity and ethereum key
 func SignProfile(name, location, image string, km km.KeyManager) (*Profile, error) {
 
@@ -26,7 +26,8 @@ func TestProfile(t *testing.T) {
 	require.Nil(t, err)
 
 	// open key manger with created keystore
-	keyManager := km.CreateFromKeyStore(store)
+	keyManager, err := km.CreateFromKeyStore(store)
+	require.Nil(t, err)
 
 	// create profile
 	prof, err := SignProfile("Florian", "Earth", "base64", *keyManager)
@@ -108,3 +109,17 @@ func TestHash(t *testing.T) {
 	require.Equal(t, "1220b5081e1476192853cf9dfd0ed371275572e3b66e34af8fc89f0868b42ef0c3b4", h.String())
 
 }
+
+func TestProfileAge(t *testing.T) {
+
+	prof := Profile{
+		Information: Information{
+			Timestamp: time.Now().Add(-time.Hour),
+		},
+	}
+
+	require.True(t, prof.Age() >= time.Hour)
+	require.True(t, prof.IsExpired(time.Minute))
+	require.False(t, prof.IsExpired(time.Hour*2))
+
+}
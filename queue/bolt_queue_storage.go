@@ -3,11 +3,22 @@ package queue
 import (
 	"bytes"
 	"encoding/json"
+	"sort"
 
 	bolt "github.com/coreos/bbolt"
 )
 
-var queueStorageBucketName = []byte("queue_storage")
+var (
+	queueStorageBucketName = []byte("queue_storage")
+	deadLetterBucketName   = []byte("queue_dead_letter")
+)
+
+func decodeJob(rawJob []byte) (Job, error) {
+	j := Job{}
+	d := json.NewDecoder(bytes.NewReader(rawJob))
+	d.UseNumber()
+	return j, d.Decode(&j)
+}
 
 type BoltQueueStorage struct {
 	db *bolt.DB
@@ -50,6 +61,8 @@ func (s *BoltQueueStorage) DeleteJob(id string) error {
 func (s *BoltQueueStorage) Map(queue chan Job) {
 	go func() {
 
+		jobs := []Job{}
+
 		err := s.db.View(func(tx *bolt.Tx) error {
 
 			// queue bucket
@@ -60,14 +73,12 @@ func (s *BoltQueueStorage) Map(queue chan Job) {
 
 			// map over job bucket
 			return jobBucket.ForEach(func(_, job []byte) error {
-				j := Job{}
-				d := json.NewDecoder(bytes.NewReader(job))
-				d.UseNumber()
-				if err := d.Decode(&j); err != nil {
+				j, err := decodeJob(job)
+				if err != nil {
 					logger.Error(err)
 					return nil
 				}
-				queue <- j
+				jobs = append(jobs, j)
 				return nil
 			})
 
@@ -75,11 +86,82 @@ func (s *BoltQueueStorage) Map(queue chan Job) {
 
 		if err != nil {
 			logger.Error(err)
+			return
+		}
+
+		// jobs with a higher priority (lower number) first
+		// and jobs with the same priority by their enqueue time
+		sort.SliceStable(jobs, func(i, j int) bool {
+			if jobs[i].Priority != jobs[j].Priority {
+				return jobs[i].Priority < jobs[j].Priority
+			}
+			return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+		})
+
+		for _, j := range jobs {
+			queue <- j
 		}
 
 	}()
 }
 
+func (s *BoltQueueStorage) MoveToDeadLetter(j Job) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+
+		// queue bucket
+		jobBucket, err := tx.CreateBucketIfNotExists(queueStorageBucketName)
+		if err != nil {
+			return err
+		}
+
+		// dead letter bucket
+		deadLetterBucket, err := tx.CreateBucketIfNotExists(deadLetterBucketName)
+		if err != nil {
+			return err
+		}
+
+		// marshal job
+		rawJob, err := json.Marshal(j)
+		if err != nil {
+			return err
+		}
+
+		if err := deadLetterBucket.Put([]byte(j.ID), rawJob); err != nil {
+			return err
+		}
+
+		return jobBucket.Delete([]byte(j.ID))
+
+	})
+}
+
+func (s *BoltQueueStorage) DeadLetterJobs() ([]Job, error) {
+
+	jobs := []Job{}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+
+		// dead letter bucket
+		deadLetterBucket := tx.Bucket(deadLetterBucketName)
+		if deadLetterBucket == nil {
+			return nil
+		}
+
+		return deadLetterBucket.ForEach(func(_, job []byte) error {
+			j, err := decodeJob(job)
+			if err != nil {
+				return err
+			}
+			jobs = append(jobs, j)
+			return nil
+		})
+
+	})
+
+	return jobs, err
+
+}
+
 func NewStorage(db *bolt.DB) *BoltQueueStorage {
 	return &BoltQueueStorage{
 		db: db,
@@ -7,6 +7,7 @@ import (
 	"github.com/coreos/bbolt"
 	"github.com/stretchr/testify/require"
 	"testing"
+	"time"
 )
 
 func TestBoltQueueStorage_PersistAndDeleteJob(t *testing.T) {
@@ -112,3 +113,67 @@ func TestBoltQueueStorage_Map(t *testing.T) {
 	require.Equal(t, secondJob, job)
 
 }
+
+func TestBoltQueueStorage_MapPriority(t *testing.T) {
+
+	boltDB := createDB()
+
+	s := NewStorage(boltDB)
+
+	now := time.Now()
+	jobs := []Job{
+		{ID: "a", Type: "SEND_MONEY", Priority: 2, CreatedAt: now},
+		{ID: "b", Type: "SEND_MONEY", Priority: 0, CreatedAt: now.Add(time.Second)},
+		{ID: "c", Type: "SEND_MONEY", Priority: 0, CreatedAt: now},
+		{ID: "d", Type: "SEND_MONEY", Priority: 1, CreatedAt: now},
+	}
+	for _, j := range jobs {
+		require.Nil(t, s.PersistJob(j))
+	}
+
+	stack := make(chan Job, len(jobs))
+	s.Map(stack)
+
+	// ordered by priority and then by enqueue time
+	for _, id := range []string{"c", "b", "d", "a"} {
+		require.Equal(t, id, (<-stack).ID)
+	}
+
+}
+
+func TestBoltQueueStorage_MoveToDeadLetter(t *testing.T) {
+
+	boltDB := createDB()
+
+	s := NewStorage(boltDB)
+
+	// no dead letter jobs yet
+	deadLetterJobs, err := s.DeadLetterJobs()
+	require.Nil(t, err)
+	require.Len(t, deadLetterJobs, 0)
+
+	j := Job{
+		ID:       "my_id",
+		Type:     "SEND_MONEY",
+		Attempts: 3,
+		RetryPolicy: RetryPolicy{
+			MaxAttempts: 3,
+		},
+	}
+	require.Nil(t, s.PersistJob(j))
+	require.Nil(t, s.MoveToDeadLetter(j))
+
+	// job got removed from the queue
+	err = s.db.View(func(tx *bolt.Tx) error {
+		require.Nil(t, tx.Bucket(queueStorageBucketName).Get([]byte("my_id")))
+		return nil
+	})
+	require.Nil(t, err)
+
+	deadLetterJobs, err = s.DeadLetterJobs()
+	require.Nil(t, err)
+	require.Len(t, deadLetterJobs, 1)
+	require.Equal(t, "my_id", deadLetterJobs[0].ID)
+	require.Equal(t, uint(3), deadLetterJobs[0].Attempts)
+
+}
@@ -0,0 +1,22 @@
+package queue
+
+import (
+	"time"
+)
+
+// Clock is used by the queue to schedule retries
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// clock backed by the time package
+type realClock struct{}
+
+func (c realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (c realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
@@ -1,8 +1,10 @@
 package queue
 
 import (
+	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	log "github.com/ipfs/go-log"
@@ -13,6 +15,11 @@ import (
 
 var logger = log.Logger("queue")
 
+var (
+	ErrQueueClosed  = errors.New("queue has been closed")
+	ErrDrainTimeout = errors.New("timed out while waiting for in flight jobs")
+)
+
 type Processor interface {
 	Type() string
 	ValidJob(j Job) error
@@ -22,13 +29,56 @@ type Processor interface {
 type Storage interface {
 	PersistJob(j Job) error
 	DeleteJob(id string) error
+	// send all persisted jobs to the queue ordered
+	// by their priority and then by their enqueue time
 	Map(queue chan Job)
+	// remove the job from the queue and keep it
+	// as a job that failed too often
+	MoveToDeadLetter(j Job) error
+	DeadLetterJobs() ([]Job, error)
+}
+
+// default delay before the first retry of a failed job
+const defaultBackoffBase = time.Second * 5
+
+// upper bound of the delay between two attempts
+const maxBackoff = time.Hour
+
+type RetryPolicy struct {
+	// job is moved to the dead letter jobs after it
+	// failed this often - 0 retries the job forever
+	MaxAttempts uint `json:"max_attempts"`
+	// delay before the first retry - doubled with
+	// every attempt. Defaults to 5 seconds
+	BackoffBase time.Duration `json:"backoff_base"`
+}
+
+// delay before the next attempt of a job that failed attempts times
+func (p RetryPolicy) backoff(attempts uint) time.Duration {
+	delay := p.BackoffBase
+	if delay == 0 {
+		delay = defaultBackoffBase
+	}
+	for i := uint(1); i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		return maxBackoff
+	}
+	return delay
 }
 
 type Job struct {
 	ID   string                 `json:"id"`
 	Type string                 `json:"type"`
 	Data map[string]interface{} `json:"data"`
+	// 0 is the highest priority
+	Priority uint8 `json:"priority"`
+	// set when the job is added to the queue
+	CreatedAt time.Time `json:"created_at"`
+	// number of failed attempts to process the job
+	Attempts    uint        `json:"attempts"`
+	RetryPolicy RetryPolicy `json:"retry_policy"`
 }
 
 type Queue struct {
@@ -36,12 +86,37 @@ type Queue struct {
 	storage    Storage
 	lock       sync.Mutex
 	jobStack   chan Job
+	// 1 once the queue got closed
+	closed     int32
+	workerDone chan struct{}
+	workers    sync.WaitGroup
+	clock      Clock
 }
 
-// close the queue
-func (q *Queue) Close() error {
-	close(q.jobStack)
-	return nil
+// close the queue. No new jobs are accepted and the workers
+// stop after their current job. Jobs that are not processed
+// stay in the storage and are loaded on the next start.
+func (q *Queue) Close(drainTimeout time.Duration) error {
+
+	if !atomic.CompareAndSwapInt32(&q.closed, 0, 1) {
+		return ErrQueueClosed
+	}
+	close(q.workerDone)
+
+	// wait for in flight jobs
+	drained := make(chan struct{})
+	go func() {
+		q.workers.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-q.clock.After(drainTimeout):
+		return ErrDrainTimeout
+	}
+
 }
 
 // register a new processor
@@ -57,6 +132,10 @@ func (q *Queue) RegisterProcessor(p Processor) error {
 
 // persist job to queue
 func (q *Queue) AddJob(j Job) error {
+	// reject jobs once closed
+	if atomic.LoadInt32(&q.closed) == 1 {
+		return ErrQueueClosed
+	}
 	// lock
 	q.lock.Lock()
 	defer q.lock.Unlock()
@@ -65,6 +144,9 @@ func (q *Queue) AddJob(j Job) error {
 	if !exist {
 		return fmt.Errorf("can't add job of type: %s since no processor has been registered", j.Type)
 	}
+	if j.CreatedAt.IsZero() {
+		j.CreatedAt = q.clock.Now()
+	}
 	// validate job
 	err := p.ValidJob(j)
 	if err != nil {
@@ -95,7 +177,49 @@ func (q *Queue) DeleteJob(j Job) error {
 	return q.storage.DeleteJob(j.ID)
 }
 
+// jobs that exceeded the max attempts of their retry policy
+func (q *Queue) DeadLetterJobs() ([]Job, error) {
+	return q.storage.DeadLetterJobs()
+}
+
+// retry a job after a failure with an exponential backoff. The
+// job is moved to the dead letter jobs once it failed too often
+// and it's not retried in the case the queue got closed.
+func (q *Queue) retry(j Job) {
+
+	j.Attempts++
+
+	if j.RetryPolicy.MaxAttempts != 0 && j.Attempts >= j.RetryPolicy.MaxAttempts {
+		if err := q.storage.MoveToDeadLetter(j); err != nil {
+			logger.Error(err)
+		}
+		return
+	}
+
+	// persist the attempts so that they survive a restart
+	if err := q.storage.PersistJob(j); err != nil {
+		logger.Error(err)
+	}
+
+	go func() {
+		select {
+		case <-q.workerDone:
+		case <-q.clock.After(j.RetryPolicy.backoff(j.Attempts)):
+			select {
+			case <-q.workerDone:
+			case q.jobStack <- j:
+			}
+		}
+	}()
+
+}
+
 func New(s Storage, jobStackSize uint, concurrency uint) *Queue {
+	return NewWithClock(s, jobStackSize, concurrency, realClock{})
+}
+
+// create a queue that uses the given clock to schedule retries
+func NewWithClock(s Storage, jobStackSize uint, concurrency uint, clock Clock) *Queue {
 
 	// construct queue
 	q := &Queue{
@@ -103,6 +227,8 @@ func New(s Storage, jobStackSize uint, concurrency uint) *Queue {
 		storage:    s,
 		lock:       sync.Mutex{},
 		jobStack:   make(chan Job, jobStackSize),
+		workerDone: make(chan struct{}),
+		clock:      clock,
 	}
 
 	// register all processors
@@ -112,28 +238,27 @@ func New(s Storage, jobStackSize uint, concurrency uint) *Queue {
 			break
 		}
 		concurrency--
+		q.workers.Add(1)
 		go func(q *Queue) {
+			defer q.workers.Done()
 			for {
-				// exit if job stack got closed
-				if q.jobStack == nil {
-					return
-				}
 				select {
+				// exit if the queue got closed
+				case <-q.workerDone:
+					return
 				case j := <-q.jobStack:
 					// fetch processor
 					p, err := q.fetchProcessor(j.Type)
 					if err != nil {
 						logger.Error(err)
-						time.Sleep(time.Second * 5)
-						q.jobStack <- j
+						q.retry(j)
 						continue
 					}
 
 					// process error
 					if err := p.Process(j); err != nil {
 						logger.Error(err)
-						time.Sleep(time.Second * 5)
-						q.jobStack <- j
+						q.retry(j)
 					}
 				}
 			}
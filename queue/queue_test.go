@@ -3,6 +3,7 @@ package queue
 import (
 	"errors"
 	"testing"
+	"time"
 
 	require "github.com/stretchr/testify/require"
 )
@@ -196,3 +197,221 @@ func TestQueue_ProcessJob(t *testing.T) {
 	<-wait
 
 }
+
+func TestQueue_Close(t *testing.T) {
+
+	queue := New(&testStorage{
+		mapFunc: func(queue chan Job) {},
+	}, 10, 3)
+
+	started := make(chan struct{}, 1)
+	finish := make(chan struct{})
+	err := queue.RegisterProcessor(&testProcessor{
+		processorType: "SEND_MONEY",
+		validJob: func(j Job) error {
+			return nil
+		},
+		process: func(j Job) error {
+			started <- struct{}{}
+			<-finish
+			return nil
+		},
+	})
+	require.Nil(t, err)
+
+	queue.jobStack <- Job{
+		ID:   "<job-id>",
+		Type: "SEND_MONEY",
+	}
+	<-started
+
+	// in flight job doesn't finish in time
+	require.Equal(t, ErrDrainTimeout, queue.Close(time.Millisecond*50))
+
+	// closed queue doesn't accept jobs
+	require.Equal(t, ErrQueueClosed, queue.AddJob(Job{Type: "SEND_MONEY"}))
+	require.Equal(t, ErrQueueClosed, queue.Close(time.Second))
+
+	close(finish)
+
+}
+
+func TestQueue_CloseDrained(t *testing.T) {
+
+	queue := New(&testStorage{
+		mapFunc: func(queue chan Job) {},
+	}, 10, 3)
+
+	require.Nil(t, queue.Close(time.Second))
+
+}
+
+func TestQueueRetryBackoff(t *testing.T) {
+
+	clock := newMockClock()
+
+	queue := NewWithClock(&testStorage{
+		mapFunc: func(queue chan Job) {},
+		persistJob: func(j Job) error {
+			require.Equal(t, uint(1), j.Attempts)
+			return nil
+		},
+	}, 10, 1, clock)
+
+	processed := make(chan int, 2)
+	attempts := 0
+	err := queue.RegisterProcessor(&testProcessor{
+		processorType: "SEND_MONEY",
+		validJob: func(j Job) error {
+			return nil
+		},
+		process: func(j Job) error {
+			attempts++
+			processed <- attempts
+			if attempts == 1 {
+				return errors.New("failed to process job")
+			}
+			return nil
+		},
+	})
+	require.Nil(t, err)
+
+	queue.jobStack <- Job{
+		ID:   "<job-id>",
+		Type: "SEND_MONEY",
+	}
+
+	// first attempt fails and schedules a retry in 5 seconds
+	require.Equal(t, 1, <-processed)
+	require.Equal(t, time.Second*5, <-clock.afterCalls)
+
+	// job must not be retried before the backoff elapsed
+	clock.Advance(time.Second * 4)
+	select {
+	case <-processed:
+		require.FailNow(t, "job was retried too early")
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	clock.Advance(time.Second)
+	require.Equal(t, 2, <-processed)
+
+}
+
+func TestQueueRetryExponentialBackoff(t *testing.T) {
+
+	clock := newMockClock()
+
+	queue := NewWithClock(&testStorage{
+		mapFunc: func(queue chan Job) {},
+		persistJob: func(j Job) error {
+			return nil
+		},
+	}, 10, 1, clock)
+
+	processed := make(chan Job, 4)
+	err := queue.RegisterProcessor(&testProcessor{
+		processorType: "SEND_MONEY",
+		validJob: func(j Job) error {
+			return nil
+		},
+		process: func(j Job) error {
+			processed <- j
+			if j.Attempts < 3 {
+				return errors.New("failed to process job")
+			}
+			return nil
+		},
+	})
+	require.Nil(t, err)
+
+	queue.jobStack <- Job{
+		ID:   "<job-id>",
+		Type: "SEND_MONEY",
+		RetryPolicy: RetryPolicy{
+			BackoffBase: time.Second,
+		},
+	}
+
+	// the delay doubles with every failed attempt
+	for i, expectedDelay := range []time.Duration{time.Second, time.Second * 2, time.Second * 4} {
+		require.Equal(t, uint(i), (<-processed).Attempts)
+		require.Equal(t, expectedDelay, <-clock.afterCalls)
+		clock.Advance(expectedDelay)
+	}
+	require.Equal(t, uint(3), (<-processed).Attempts)
+
+}
+
+func TestQueueDeadLetter(t *testing.T) {
+
+	clock := newMockClock()
+
+	deadLetter := make(chan Job, 1)
+	queue := NewWithClock(&testStorage{
+		mapFunc: func(queue chan Job) {},
+		persistJob: func(j Job) error {
+			return nil
+		},
+		moveToDeadLetter: func(j Job) error {
+			deadLetter <- j
+			return nil
+		},
+	}, 10, 1, clock)
+
+	err := queue.RegisterProcessor(&testProcessor{
+		processorType: "SEND_MONEY",
+		validJob: func(j Job) error {
+			return nil
+		},
+		process: func(j Job) error {
+			return errors.New("failed to process job")
+		},
+	})
+	require.Nil(t, err)
+
+	queue.jobStack <- Job{
+		ID:   "<job-id>",
+		Type: "SEND_MONEY",
+		RetryPolicy: RetryPolicy{
+			MaxAttempts: 2,
+			BackoffBase: time.Second,
+		},
+	}
+
+	// first attempt is retried
+	require.Equal(t, time.Second, <-clock.afterCalls)
+	clock.Advance(time.Second)
+
+	// second attempt exhausts the retry policy
+	select {
+	case j := <-deadLetter:
+		require.Equal(t, "<job-id>", j.ID)
+		require.Equal(t, uint(2), j.Attempts)
+	case <-time.After(time.Second):
+		require.FailNow(t, "job hasn't been moved to the dead letter jobs")
+	}
+
+	// no further retry is scheduled
+	select {
+	case <-clock.afterCalls:
+		require.FailNow(t, "exhausted job was retried")
+	case <-time.After(time.Millisecond * 50):
+	}
+
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+
+	// defaults to 5 seconds
+	require.Equal(t, time.Second*5, RetryPolicy{}.backoff(1))
+	require.Equal(t, time.Second*10, RetryPolicy{}.backoff(2))
+
+	p := RetryPolicy{BackoffBase: time.Second}
+	require.Equal(t, time.Second, p.backoff(1))
+	require.Equal(t, time.Second*8, p.backoff(4))
+
+	// the delay is capped
+	require.Equal(t, maxBackoff, p.backoff(100))
+
+}
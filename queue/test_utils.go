@@ -3,6 +3,7 @@ package queue
 import (
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"crypto/rand"
@@ -29,9 +30,11 @@ func (p *testProcessor) Process(j Job) error {
 }
 
 type testStorage struct {
-	persistJob func(j Job) error
-	deleteJob  func(j string) error
-	mapFunc    func(queue chan Job)
+	persistJob       func(j Job) error
+	deleteJob        func(j string) error
+	mapFunc          func(queue chan Job)
+	moveToDeadLetter func(j Job) error
+	deadLetterJobs   func() ([]Job, error)
 }
 
 func (s *testStorage) PersistJob(j Job) error {
@@ -46,6 +49,69 @@ func (s *testStorage) Map(queue chan Job) {
 	s.mapFunc(queue)
 }
 
+func (s *testStorage) MoveToDeadLetter(j Job) error {
+	return s.moveToDeadLetter(j)
+}
+
+func (s *testStorage) DeadLetterJobs() ([]Job, error) {
+	return s.deadLetterJobs()
+}
+
+type mockClockWaiter struct {
+	deadline time.Time
+	c        chan time.Time
+}
+
+// clock that only moves forward when advanced
+type mockClock struct {
+	lock    sync.Mutex
+	now     time.Time
+	waiters []mockClockWaiter
+	// receives the duration of every After call
+	afterCalls chan time.Duration
+}
+
+func newMockClock() *mockClock {
+	return &mockClock{
+		now:        time.Unix(0, 0),
+		afterCalls: make(chan time.Duration, 10),
+	}
+}
+
+func (c *mockClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *mockClock) After(d time.Duration) <-chan time.Time {
+	c.lock.Lock()
+	w := mockClockWaiter{
+		deadline: c.now.Add(d),
+		c:        make(chan time.Time, 1),
+	}
+	c.waiters = append(c.waiters, w)
+	c.lock.Unlock()
+	c.afterCalls <- d
+	return w.c
+}
+
+// move the clock forward and fire all due waiters
+func (c *mockClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+	pending := []mockClockWaiter{}
+	for _, w := range c.waiters {
+		if w.deadline.After(c.now) {
+			pending = append(pending, w)
+			continue
+		}
+		w.c <- c.now
+	}
+	c.waiters = pending
+}
+
 func createDB() *bolt.DB {
 	file := make([]byte, 32)
 	if _, err := rand.Read(file); err != nil {
@@ -0,0 +1,138 @@
+package panthalassa
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/url"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+	ed25519 "golang.org/x/crypto/ed25519"
+)
+
+var selfTestBucketName = []byte("self_test")
+
+type SelfTestCheck struct {
+	Name       string `json:"name"`
+	Passed     bool   `json:"passed"`
+	DurationMs int64  `json:"durationMs"`
+	Error      string `json:"error"`
+}
+
+// run a single check and measure it
+func runSelfTestCheck(name string, check func() error) SelfTestCheck {
+	startedAt := time.Now()
+	err := check()
+	result := SelfTestCheck{
+		Name:       name,
+		Passed:     err == nil,
+		DurationMs: int64(time.Since(startedAt) / time.Millisecond),
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// run all in process checks
+func (p *Panthalassa) SelfTest() []SelfTestCheck {
+
+	payload := []byte("panthalassa self test")
+
+	return []SelfTestCheck{
+		// sign and verify with the identity key
+		runSelfTestCheck("key_manager_sign", func() error {
+			signature, err := p.km.IdentitySign(payload)
+			if err != nil {
+				return err
+			}
+			idKeyStr, err := p.km.IdentityPublicKey()
+			if err != nil {
+				return err
+			}
+			idKey, err := hex.DecodeString(idKeyStr)
+			if err != nil {
+				return err
+			}
+			if !ed25519.Verify(idKey, payload, signature) {
+				return errors.New("failed to verify signature")
+			}
+			return nil
+		}),
+		// encrypt and decrypt a payload
+		runSelfTestCheck("aes_round_trip", func() error {
+			ct, err := p.km.AESEncrypt(payload)
+			if err != nil {
+				return err
+			}
+			plain, err := p.km.AESDecrypt(ct)
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(plain, payload) {
+				return errors.New("decrypted payload doesn't match")
+			}
+			return nil
+		}),
+		// write, read and delete a value
+		runSelfTestCheck("database_read_write", func() error {
+			key := []byte("probe")
+			err := p.db.Update(func(tx *bolt.Tx) error {
+				b, err := tx.CreateBucketIfNotExists(selfTestBucketName)
+				if err != nil {
+					return err
+				}
+				return b.Put(key, payload)
+			})
+			if err != nil {
+				return err
+			}
+			return p.db.Update(func(tx *bolt.Tx) error {
+				b := tx.Bucket(selfTestBucketName)
+				if b == nil || !bytes.Equal(b.Get(key), payload) {
+					return errors.New("failed to read written value")
+				}
+				return tx.DeleteBucket(selfTestBucketName)
+			})
+		}),
+		// make sure the backend host accepts tcp connections
+		// this doesn't test the websocket endpoint or the authentication
+		runSelfTestCheck("backend_reachable", func() error {
+			endpoint, err := url.Parse(p.backendEndpoint)
+			if err != nil {
+				return err
+			}
+			address := endpoint.Host
+			if endpoint.Port() == "" {
+				port := "80"
+				if endpoint.Scheme == "wss" {
+					port = "443"
+				}
+				address = net.JoinHostPort(endpoint.Hostname(), port)
+			}
+			conn, err := net.DialTimeout("tcp", address, time.Second*5)
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		}),
+		// the websocket connection must have completed the handshake
+		// and the backend must have accepted our authentication
+		runSelfTestCheck("backend_authenticated", func() error {
+			if !p.backend.Connected() {
+				return errors.New("websocket connection to the backend isn't established")
+			}
+			if !p.backend.Authenticated() {
+				return errors.New("not authenticated with the backend")
+			}
+			return nil
+		}),
+		// p2p host must have a valid id
+		runSelfTestCheck("p2p_peer_id", func() error {
+			return p.p2p.Host.ID().Validate()
+		}),
+	}
+
+}
@@ -5,6 +5,8 @@ package stapi
 
 import (
 	"encoding/json"
+	"fmt"
+	"sync"
 
 	log "github.com/ipfs/go-log"
 )
@@ -16,14 +18,25 @@ type UpStream interface {
 }
 
 type call struct {
-	Name    string                 `json:"name"`
-	Payload map[string]interface{} `json:"payload"`
+	Name    string          `json:"name"`
+	Payload json.RawMessage `json:"payload"`
 }
 
+// name of the event that wraps a batch of events
+const BatchEventType = "BATCH"
+
+// default of the max amount of events in a batch
+const defaultMaxBatchSize = 100
+
 type Api struct {
-	us     UpStream
-	closer chan struct{}
-	stack  chan call
+	// max amount of events SendBatch accepts
+	MaxBatchSize int
+	us           UpStream
+	closer       chan struct{}
+	stack        chan string
+	// requests waiting for a response of the ui
+	lock    sync.Mutex
+	pending map[string]chan map[string]interface{}
 }
 
 func (a *Api) Close() error {
@@ -31,20 +44,76 @@ func (a *Api) Close() error {
 	return nil
 }
 
-// send to api
-func (a *Api) Send(name string, payload map[string]interface{}) {
-	a.stack <- call{
-		Name:    name,
+func marshalCall(e Event) ([]byte, error) {
+	payload, err := e.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(call{
+		Name:    e.EventType(),
+		Payload: json.RawMessage(payload),
+	})
+}
+
+// dispatch an event to the ui
+func (a *Api) Dispatch(e Event) error {
+	rawCall, err := marshalCall(e)
+	if err != nil {
+		return err
+	}
+	a.stack <- string(rawCall)
+	return nil
+}
+
+// dispatch multiple events with one call to the ui
+// the payload of the batch event is the list of events
+func (a *Api) SendBatch(events []Event) error {
+
+	if len(events) > a.MaxBatchSize {
+		return fmt.Errorf("batch of %d events exceeds the max batch size of %d", len(events), a.MaxBatchSize)
+	}
+
+	calls := make([]json.RawMessage, len(events))
+	for i, e := range events {
+		rawCall, err := marshalCall(e)
+		if err != nil {
+			return err
+		}
+		calls[i] = rawCall
+	}
+
+	payload, err := json.Marshal(calls)
+	if err != nil {
+		return err
+	}
+	rawBatch, err := json.Marshal(call{
+		Name:    BatchEventType,
 		Payload: payload,
+	})
+	if err != nil {
+		return err
+	}
+	a.stack <- string(rawBatch)
+	return nil
+
+}
+
+// send a raw event to the api
+// prefer Dispatch with a typed event
+func (a *Api) Send(name string, payload interface{}) {
+	if err := a.Dispatch(UnknownEvent{Type: name, Data: payload}); err != nil {
+		logger.Error(err)
 	}
 }
 
 func New(us UpStream) *Api {
 
 	api := &Api{
-		us:     us,
-		closer: make(chan struct{}, 1),
-		stack:  make(chan call, 200),
+		MaxBatchSize: defaultMaxBatchSize,
+		us:           us,
+		closer:       make(chan struct{}, 1),
+		stack:        make(chan string, 200),
+		pending:      map[string]chan map[string]interface{}{},
 	}
 
 	go func() {
@@ -53,14 +122,8 @@ func New(us UpStream) *Api {
 			select {
 			case <-api.closer:
 				return
-			case call := <-api.stack:
-				rawCall, err := json.Marshal(call)
-				if err != nil {
-					logger.Error(err)
-					continue
-				}
-				api.us.Send(string(rawCall))
-
+			case rawCall := <-api.stack:
+				api.us.Send(rawCall)
 			}
 		}
 
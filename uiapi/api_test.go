@@ -1,6 +1,7 @@
 package stapi
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
 
@@ -37,3 +38,104 @@ func TestApi_Send(t *testing.T) {
 	}
 
 }
+
+func TestApi_Dispatch(t *testing.T) {
+
+	signal := make(chan string, 1)
+	a := New(&upstream{
+		send: func(data string) {
+			signal <- data
+		},
+	})
+
+	require.Nil(t, a.Dispatch(DAppPersistedEvent{
+		DAppSigningKey: "aabb",
+	}))
+
+	select {
+	case data := <-signal:
+		require.Equal(t, `{"name":"DAPP:PERSISTED","payload":{"dapp_signing_key":"aabb"}}`, data)
+	case <-time.After(time.Second):
+		require.Fail(t, "time out")
+	}
+
+	// payloads that can't be marshaled are rejected
+	require.NotNil(t, a.Dispatch(UnknownEvent{
+		Type: "TEST:CALL",
+		Data: make(chan int),
+	}))
+
+}
+
+func TestApi_SendBatch(t *testing.T) {
+
+	signal := make(chan string, 1)
+	a := New(&upstream{
+		send: func(data string) {
+			signal <- data
+		},
+	})
+
+	require.Nil(t, a.SendBatch([]Event{
+		DAppPersistedEvent{DAppSigningKey: "aabb"},
+		UnknownEvent{Type: "TEST:CALL", Data: map[string]interface{}{"key": "value"}},
+	}))
+
+	select {
+	case data := <-signal:
+		require.Equal(t, `{"name":"BATCH","payload":[{"name":"DAPP:PERSISTED","payload":{"dapp_signing_key":"aabb"}},{"name":"TEST:CALL","payload":{"key":"value"}}]}`, data)
+	case <-time.After(time.Second):
+		require.Fail(t, "time out")
+	}
+
+	// batches bigger than the max batch size are rejected
+	a.MaxBatchSize = 1
+	require.EqualError(t, a.SendBatch([]Event{
+		DAppPersistedEvent{DAppSigningKey: "aabb"},
+		DAppPersistedEvent{DAppSigningKey: "ccdd"},
+	}), "batch of 2 events exceeds the max batch size of 1")
+
+}
+
+func TestApi_RequestReceive(t *testing.T) {
+
+	calls := make(chan string, 1)
+	a := New(&upstream{
+		send: func(data string) {
+			calls <- data
+		},
+	})
+
+	go func() {
+		c := call{}
+		if err := json.Unmarshal([]byte(<-calls), &c); err != nil {
+			panic(err)
+		}
+		payload := map[string]interface{}{}
+		if err := json.Unmarshal(c.Payload, &payload); err != nil {
+			panic(err)
+		}
+		if err := a.Receive(payload["request_id"].(string), map[string]interface{}{"approved": true}); err != nil {
+			panic(err)
+		}
+	}()
+
+	resp, err := a.Request("TEST:REQUEST", map[string]interface{}{}, time.Second)
+	require.Nil(t, err)
+	require.Equal(t, true, resp["approved"])
+
+	// unknown requests can't be responded to
+	require.EqualError(t, a.Receive("unknown", nil), "there is no pending request with id: unknown")
+
+}
+
+func TestApi_RequestTimeout(t *testing.T) {
+
+	a := New(&upstream{
+		send: func(data string) {},
+	})
+
+	_, err := a.Request("TEST:REQUEST", map[string]interface{}{}, time.Millisecond*10)
+	require.Equal(t, ErrRequestTimeout, err)
+
+}
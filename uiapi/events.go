@@ -0,0 +1,114 @@
+package stapi
+
+import (
+	"encoding/json"
+)
+
+// event that can be dispatched to the ui
+type Event interface {
+	EventType() string
+	// json encoded payload of the event
+	Marshal() (string, error)
+}
+
+func marshalPayload(payload interface{}) (string, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
+
+// MESSAGE:RECEIVED
+type MessageReceivedEvent struct {
+	// database id of the message
+	DBID      string `json:"db_id"`
+	Content   string `json:"content"`
+	CreatedAt int64  `json:"created_at"`
+	// hex encoded public key of the chat partner
+	Chat     string `json:"chat"`
+	Received bool   `json:"received"`
+	// json encoded DApp message ("" if it's not a DApp message)
+	DApp string `json:"dapp"`
+}
+
+func (e MessageReceivedEvent) EventType() string {
+	return "MESSAGE:RECEIVED"
+}
+
+func (e MessageReceivedEvent) Marshal() (string, error) {
+	return marshalPayload(e)
+}
+
+// DAPP:PERSISTED
+type DAppPersistedEvent struct {
+	// hex encoded signing key of the DApp
+	DAppSigningKey string `json:"dapp_signing_key"`
+}
+
+func (e DAppPersistedEvent) EventType() string {
+	return "DAPP:PERSISTED"
+}
+
+func (e DAppPersistedEvent) Marshal() (string, error) {
+	return marshalPayload(e)
+}
+
+// CHAT:READ
+type ChatReadEvent struct {
+	// hex encoded public key of the chat partner
+	Chat string `json:"chat"`
+	// unix timestamp
+	ReadAt int64 `json:"read_at"`
+}
+
+func (e ChatReadEvent) EventType() string {
+	return "CHAT:READ"
+}
+
+func (e ChatReadEvent) Marshal() (string, error) {
+	return marshalPayload(e)
+}
+
+// BACKEND:STATUS
+type BackendStatusEvent struct {
+	Connected     bool `json:"connected"`
+	Authenticated bool `json:"authenticated"`
+}
+
+func (e BackendStatusEvent) EventType() string {
+	return "BACKEND:STATUS"
+}
+
+func (e BackendStatusEvent) Marshal() (string, error) {
+	return marshalPayload(e)
+}
+
+// CHAT:STATUS
+type ChatStatusEvent struct {
+	// one of "disconnected", "connecting", "connected" or "auth_failed"
+	Status string `json:"status"`
+}
+
+func (e ChatStatusEvent) EventType() string {
+	return "CHAT:STATUS"
+}
+
+func (e ChatStatusEvent) Marshal() (string, error) {
+	return marshalPayload(e)
+}
+
+// event without a dedicated type
+// used by Send to stay compatible with raw events
+type UnknownEvent struct {
+	Type string
+	Data interface{}
+}
+
+func (e UnknownEvent) EventType() string {
+	return e.Type
+}
+
+func (e UnknownEvent) Marshal() (string, error) {
+	return marshalPayload(e.Data)
+}
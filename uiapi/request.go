@@ -0,0 +1,64 @@
+package stapi
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+var ErrRequestTimeout = errors.New("ui didn't respond in time")
+
+// send a call to the ui and wait for the response.
+// The call payload contains a "request_id" that must be
+// passed to Receive together with the response.
+func (a *Api) Request(name string, payload map[string]interface{}, timeout time.Duration) (map[string]interface{}, error) {
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+	requestID := id.String()
+
+	respChan := make(chan map[string]interface{}, 1)
+	a.lock.Lock()
+	a.pending[requestID] = respChan
+	a.lock.Unlock()
+
+	// copy so that we don't modify the payload of the caller
+	requestPayload := map[string]interface{}{}
+	for k, v := range payload {
+		requestPayload[k] = v
+	}
+	requestPayload["request_id"] = requestID
+	a.Send(name, requestPayload)
+
+	select {
+	case resp := <-respChan:
+		return resp, nil
+	case <-time.After(timeout):
+		a.lock.Lock()
+		delete(a.pending, requestID)
+		a.lock.Unlock()
+		return nil, ErrRequestTimeout
+	}
+
+}
+
+// pass the response of the ui to the waiting request
+func (a *Api) Receive(requestID string, response map[string]interface{}) error {
+
+	a.lock.Lock()
+	respChan, exist := a.pending[requestID]
+	delete(a.pending, requestID)
+	a.lock.Unlock()
+
+	if !exist {
+		return fmt.Errorf("there is no pending request with id: %s", requestID)
+	}
+
+	respChan <- response
+	return nil
+
+}
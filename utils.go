@@ -33,7 +33,10 @@ func NewAccountKeys(pw, pwConfirm string) (string, error) {
 		return "", err
 	}
 
-	km := keyManager.CreateFromKeyStore(ks)
+	km, err := keyManager.CreateFromKeyStore(ks)
+	if err != nil {
+		return "", err
+	}
 
 	// export store
 	store, err := km.Export(pw, pwConfirm)
@@ -67,7 +70,10 @@ func NewAccountKeysFromMnemonic(mne, pw, pwConfirm string) (string, error) {
 	}
 
 	//Create keyManager
-	km := keyManager.CreateFromKeyStore(ks)
+	km, err := keyManager.CreateFromKeyStore(ks)
+	if err != nil {
+		return "", err
+	}
 
 	store, err := km.Export(pw, pwConfirm)
 	if err != nil {